@@ -1,13 +1,28 @@
 package main
 
 import (
+	"chat-app/pkg/attachment"
 	"chat-app/pkg/auth"
+	"chat-app/pkg/bot"
 	"chat-app/pkg/code"
+	"chat-app/pkg/command"
 	"chat-app/pkg/database"
+	"chat-app/pkg/export"
+	"chat-app/pkg/gdpr"
+	"chat-app/pkg/importer"
+	"chat-app/pkg/mail"
 	"chat-app/pkg/message"
+	"chat-app/pkg/oidc"
+	"chat-app/pkg/preview"
+	"chat-app/pkg/retention"
 	"chat-app/pkg/room"
 	"chat-app/pkg/router"
+	"chat-app/pkg/spam"
 	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
+	"chat-app/pkg/webhook"
+	"chat-app/pkg/websocket"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -36,6 +51,29 @@ func main() {
 	roomCollection := db.Collection("rooms")
 	messageCollection := db.Collection("messages")
 	codeCollection := db.Collection("codes")
+	spamCollection := db.Collection("spam_flags")
+	spamMuteCollection := db.Collection("spam_mutes")
+	roomHistoryCollection := db.Collection("room_history")
+	messageArchiveCollection := db.Collection("messages_archive")
+	retentionRunCollection := db.Collection("retention_runs")
+	loginCollection := db.Collection("logins")
+	refreshTokenCollection := db.Collection("refresh_tokens")
+	revokedTokenCollection := db.Collection("revoked_tokens")
+	sessionCollection := db.Collection("sessions")
+	passwordResetCollection := db.Collection("password_resets")
+	emailVerificationCollection := db.Collection("email_verifications")
+	twoFactorCollection := db.Collection("two_factors")
+	challengeCollection := db.Collection("two_factor_challenges")
+	identityCollection := db.Collection("identities")
+	oidcStateCollection := db.Collection("oidc_states")
+	botCollection := db.Collection("bots")
+	apiKeyCollection := db.Collection("api_keys")
+	webhookCollection := db.Collection("webhooks")
+	webhookDeliveryCollection := db.Collection("webhook_deliveries")
+	dataExportCollection := db.Collection("data_exports")
+	attachmentCollection := db.Collection("attachments")
+	previewCollection := db.Collection("link_previews")
+	slowModeCollection := db.Collection("slow_mode")
 
 
 
@@ -44,19 +82,109 @@ func main() {
 	codeService := code.NewCodeService(codeRepo)
 	// Initialize user repository and service
 	userRepo := user.NewUserRepository(userCollection, messageCollection)
+	if err := userRepo.CreateIndexes(context.Background()); err != nil {
+		log.Printf("Failed to create the unique index of the emails, remove the duplicate emails of the users: %v", err)
+	}
 	userService := user.NewUserService(userRepo)
 	// Initialize auth repository and service
-	authRepo := auth.NewAuthRepository(userCollection)
-	authService := auth.NewAuthService(authRepo)
+	authRepo := auth.NewAuthRepository(userCollection, loginCollection, refreshTokenCollection, revokedTokenCollection, sessionCollection, passwordResetCollection, emailVerificationCollection, twoFactorCollection, challengeCollection)
+	mailer, err := mail.MailerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService := auth.NewAuthService(authRepo, auth.ConfigFromEnv(), websocket.CloseSession, mailer)
+	// every token verification checks the tokens revoked by a logout
+	utils.SetRevocationStore(authService)
 	// Initialize room repository and service
-	roomRepo := room.NewRoomRepository(roomCollection, userCollection)
-	roomService := room.NewRoomService(roomRepo)
+	roomRepo := room.NewRoomRepository(roomCollection, userCollection, roomHistoryCollection)
+	roomService := room.NewRoomService(roomRepo, websocket.BroadcastEvent)
+	// Initialize webhooks, the events of the rooms, messages and users are sent to them
+	webhookRepo := webhook.NewWebhookRepository(webhookCollection, webhookDeliveryCollection)
+	webhookService := webhook.NewWebhookService(webhookRepo, roomService, webhook.ConfigFromEnv())
+	roomService = webhook.NewNotifiedRoomService(roomService, webhookService)
+	userService = webhook.NewNotifiedUserService(userService, webhookService)
 	// Initialize message repository and service
-	messageRepo := message.NewMessageRepository(messageCollection, roomCollection)
-	messageService := message.NewMessageService(messageRepo)
+	messageRepo := message.NewMessageRepository(messageCollection, roomCollection, slowModeCollection)
+	messageService := message.NewMessageService(messageRepo, roomService)
+	// Initialize spam detector in front of the message service
+	spamRepo := spam.NewSpamRepository(spamCollection, spamMuteCollection)
+	spamService := spam.NewSpamService(spamRepo, spam.ConfigFromEnv())
+	messageService = spam.NewGuardedMessageService(messageService, spamService)
+	// Initialize attachment storage and service, attachments are checked before the spam detector
+	attachmentStorage, err := attachment.StorageFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	attachmentRepo := attachment.NewAttachmentRepository(attachmentCollection, messageCollection)
+	attachmentService := attachment.NewAttachmentService(attachmentRepo, attachmentStorage, roomService, websocket.BroadcastEvent, attachment.ConfigFromEnv())
+	messageService = attachment.NewAttachedMessageService(messageService, attachmentService)
+	// Initialize link previews, the links of the messages sent are fetched in background
+	previewRepo := preview.NewPreviewRepository(previewCollection, messageCollection)
+	previewService := preview.NewPreviewService(previewRepo, websocket.BroadcastEvent, preview.ConfigFromEnv())
+	messageService = preview.NewPreviewedMessageService(messageService, previewService)
+	// The messages sent and deleted are sent to the webhooks
+	messageService = webhook.NewNotifiedMessageService(messageService, webhookService)
+	// Users without a verified email are stopped before anything else, when the policy requires it
+	messageService = auth.NewVerifiedMessageService(messageService, authService)
+
+	// Initialize single sign-on with the OpenID Connect providers
+	oidcRepo := oidc.NewOidcRepository(identityCollection, oidcStateCollection, userCollection)
+	oidcService := oidc.NewOidcService(oidcRepo, userService, authService, oidc.ConfigFromEnv())
+
+	// Initialize bots, their API keys are accepted in place of the access tokens
+	botRepo := bot.NewBotRepository(botCollection, apiKeyCollection)
+	botService := bot.NewBotService(botRepo, userService, roomService)
+	utils.SetAPIKeyStore(botService)
+
+	// Initialize slash commands, the commands of other packages are registered here too
+	commandRegistry := command.NewRegistry(roomService)
+	if err := command.RegisterBuiltins(commandRegistry, userService, spamService, websocket.BroadcastEvent); err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize room history export
+	exportRepo := export.NewExportRepository(roomCollection, userCollection, messageCollection)
+	exportService := export.NewExportService(exportRepo)
+
+	// Run a command instead of the server, e.g. chat-app export -room <id> -format html
+	// or chat-app import -slack export.zip -creator admin, or chat-app oidc-mock to log in with a mock provider
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "export":
+			err = export.RunCommand(context.Background(), exportService, os.Args[2:])
+		case "import":
+			importService := importer.NewImportService(importer.NewImportRepository(userCollection, roomCollection, messageCollection))
+			err = importer.RunCommand(context.Background(), importService, os.Args[2:], os.Stdout)
+		case "oidc-mock":
+			err = oidc.RunMockCommand(os.Args[2:], os.Stdout)
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Initialize retention purger and start it in background
+	retentionRepo := retention.NewRetentionRepository(messageCollection, roomCollection, messageArchiveCollection, retentionRunCollection)
+	retentionService := retention.NewRetentionService(retentionRepo, roomService, retention.ConfigFromEnv())
+	go retentionService.Start(context.Background())
+	go roomService.Start(context.Background())
+
+	// Initialize personal data exports and start the worker in background
+	gdprRepo := gdpr.NewGdprRepository(dataExportCollection, userCollection, roomCollection, messageCollection, loginCollection)
+	gdprService := gdpr.NewGdprService(gdprRepo, gdpr.ConfigFromEnv())
+	go gdprService.Start(context.Background())
+	go attachmentService.Start(context.Background())
+	go authService.Start(context.Background())
+	go previewService.Start(context.Background())
+	go oidcService.Start(context.Background())
+	go webhookService.Start(context.Background())
 
 	// Initialize router
-	r := router.NewRouter(userService, codeService, authService, roomService, messageService)
+	r := router.NewRouter(userService, codeService, authService, roomService, messageService, spamService, retentionService, exportService, gdprService, attachmentService, oidcService, botService, commandRegistry, webhookService)
 
 	// Start HTTP server
 	port := os.Getenv("PORT")
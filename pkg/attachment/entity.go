@@ -0,0 +1,27 @@
+package attachment
+
+import "chat-app/pkg/message"
+
+// AttachmentEntity is an uploaded file
+type AttachmentEntity struct {
+	ID          string `json:"_id"`
+	RoomID      string `json:"roomId"`
+	UploaderID  string `json:"uploaderId"`
+	MessageID   string `json:"messageId,omitempty"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"`
+	CreatedAt   string `json:"createdAt"`
+	// Status tells if the thumbnails of an image are ready, Width and Height are the dimensions of an image
+	Status     string                    `json:"status"`
+	Width      int                       `json:"width,omitempty"`
+	Height     int                       `json:"height,omitempty"`
+	Thumbnails []message.ThumbnailEntity `json:"thumbnails,omitempty"`
+}
+
+// EventEntity is the data of the WebSocket event sent when the thumbnails of an attachment are done
+type EventEntity struct {
+	MessageID  string                   `json:"messageId"`
+	Attachment message.AttachmentEntity `json:"attachment"`
+}
@@ -0,0 +1,215 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// EXIF tags read or cleaned
+const (
+	exifTagOrientation = 0x0112
+	exifTagGPSInfo     = 0x8825
+)
+
+// exifTypeSizes are the sizes in bytes of the EXIF value types
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// xmpPrefixes start the APP1 segments of the XMP data of a JPEG image, the main one and its extensions
+var xmpPrefixes = [][]byte{[]byte("http://ns.adobe.com/xap/1.0/\x00"), []byte("http://ns.adobe.com/xmp/extension/\x00")}
+
+// xmpKeyword is the keyword of the text chunks of the XMP data of a PNG image
+const xmpKeyword = "XML:com.adobe.xmp"
+
+// stripLocation removes the GPS data of a JPEG or PNG image: the GPS IFD of its EXIF data, and its XMP data,
+// which can hold the location too. The other EXIF data, like the orientation, are kept. It returns the image without location.
+func stripLocation(contentType string, data []byte) []byte {
+	switch contentType {
+	case "image/jpeg":
+		for _, segment := range jpegExifSegments(data) {
+			stripExifGPS(segment)
+		}
+		return stripJPEGXMP(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	}
+	return data
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG image, 1 when it has none
+func exifOrientation(data []byte) int {
+	for _, segment := range jpegExifSegments(data) {
+		order, ifd, ok := tiffHeader(segment)
+		if !ok {
+			continue
+		}
+		for _, entry := range ifdEntries(segment, order, ifd) {
+			if order.Uint16(segment[entry:]) == exifTagOrientation {
+				orientation := int(order.Uint16(segment[entry+8:]))
+				if orientation >= 1 && orientation <= 8 {
+					return orientation
+				}
+			}
+		}
+	}
+	return 1
+}
+
+// jpegExifSegments returns the TIFF data of the APP1 Exif segments of a JPEG image, as slices of data
+func jpegExifSegments(data []byte) [][]byte {
+	var segments [][]byte
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		// the image data starts after the start of scan, there are no more metadata
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			segments = append(segments, segment[6:])
+		}
+		i += 2 + length
+	}
+	return segments
+}
+
+// stripJPEGXMP removes the APP1 XMP segments of a JPEG image
+func stripJPEGXMP(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	cleaned := make([]byte, 0, len(data))
+	cleaned = append(cleaned, data[:2]...)
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		if marker != 0xE1 || !isXMPSegment(data[i+4:i+2+length]) {
+			cleaned = append(cleaned, data[i:i+2+length]...)
+		}
+		i += 2 + length
+	}
+	// the image data, and anything that could not be read, is kept as it is
+	return append(cleaned, data[i:]...)
+}
+
+// isXMPSegment checks if the data of an APP1 segment is XMP
+func isXMPSegment(segment []byte) bool {
+	for _, prefix := range xmpPrefixes {
+		if bytes.HasPrefix(segment, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tiffHeader reads the byte order and the offset of the first IFD of TIFF data
+func tiffHeader(tiff []byte) (binary.ByteOrder, uint32, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	return order, order.Uint32(tiff[4:]), true
+}
+
+// ifdEntries returns the offsets of the 12-byte entries of an IFD
+func ifdEntries(tiff []byte, order binary.ByteOrder, ifd uint32) []uint32 {
+	if uint64(ifd)+2 > uint64(len(tiff)) {
+		return nil
+	}
+	count := uint32(order.Uint16(tiff[ifd:]))
+	var entries []uint32
+	for i := uint32(0); i < count; i++ {
+		entry := ifd + 2 + i*12
+		if uint64(entry)+12 > uint64(len(tiff)) {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// stripExifGPS empties the GPS IFD of TIFF data: its values are zeroed and its entry count set to 0
+func stripExifGPS(tiff []byte) {
+	order, ifd, ok := tiffHeader(tiff)
+	if !ok {
+		return
+	}
+	for _, entry := range ifdEntries(tiff, order, ifd) {
+		if order.Uint16(tiff[entry:]) != exifTagGPSInfo {
+			continue
+		}
+		gps := order.Uint32(tiff[entry+8:])
+		for _, gpsEntry := range ifdEntries(tiff, order, gps) {
+			// values larger than 4 bytes are stored at an offset
+			size := uint64(exifTypeSizes[order.Uint16(tiff[gpsEntry+2:])]) * uint64(order.Uint32(tiff[gpsEntry+4:]))
+			if size > 4 {
+				offset := uint64(order.Uint32(tiff[gpsEntry+8:]))
+				if offset+size <= uint64(len(tiff)) {
+					zero(tiff[offset : offset+size])
+				}
+			}
+			zero(tiff[gpsEntry : gpsEntry+12])
+		}
+		if uint64(gps)+2 <= uint64(len(tiff)) {
+			order.PutUint16(tiff[gps:], 0)
+		}
+	}
+}
+
+// stripPNGMetadata removes the eXIf chunks of a PNG image, and the text chunks of its XMP data
+func stripPNGMetadata(data []byte) []byte {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return data
+	}
+	cleaned := make([]byte, 0, len(data))
+	cleaned = append(cleaned, signature...)
+	for i := len(signature); i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return data
+		}
+		if chunk := string(data[i+4 : i+8]); chunk != "eXIf" && !isXMPChunk(chunk, data[i+8:end-4]) {
+			cleaned = append(cleaned, data[i:end]...)
+		}
+		i = end
+	}
+	return cleaned
+}
+
+// isXMPChunk checks if a PNG chunk is a text chunk of XMP data, its data starts with its keyword and a null byte
+func isXMPChunk(chunk string, chunkData []byte) bool {
+	if chunk != "iTXt" && chunk != "tEXt" && chunk != "zTXt" {
+		return false
+	}
+	return bytes.HasPrefix(chunkData, []byte(xmpKeyword+"\x00"))
+}
+
+// zero sets bytes to 0
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
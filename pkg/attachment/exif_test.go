@@ -0,0 +1,130 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// xmpGPS is an XMP packet with the location of the photo
+const xmpGPS = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="48,51.5N" exif:GPSLongitude="2,17.7E"/>` +
+	`</rdf:RDF></x:xmpmeta>`
+
+// testExif is big endian TIFF data with the orientation 6 and a GPS IFD with a latitude
+func testExif() []byte {
+	tiff := make([]byte, 80)
+	copy(tiff, "MM\x00\x2a\x00\x00\x00\x08")
+	order := binary.BigEndian
+	// IFD0 at 8: the orientation and the offset of the GPS IFD
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], exifTagOrientation)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], 6)
+	order.PutUint16(tiff[22:], exifTagGPSInfo)
+	order.PutUint16(tiff[24:], 4)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint32(tiff[30:], 38)
+	// GPS IFD at 38: the latitude, three rationals at 56
+	order.PutUint16(tiff[38:], 1)
+	order.PutUint16(tiff[40:], 2)
+	order.PutUint16(tiff[42:], 5)
+	order.PutUint32(tiff[44:], 3)
+	order.PutUint32(tiff[48:], 56)
+	for i, value := range []uint32{48, 1, 51, 1, 30, 1} {
+		order.PutUint32(tiff[56+4*i:], value)
+	}
+	return tiff
+}
+
+// jpegSegment is an APP1 segment with its data
+func jpegSegment(data []byte) []byte {
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+// pngChunk is a PNG chunk with its checksum
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, sum...)
+}
+
+func TestStripLocationJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	data = append(data, encoded.Bytes()[:2]...)
+	data = append(data, jpegSegment(append([]byte("Exif\x00\x00"), testExif()...))...)
+	data = append(data, jpegSegment(append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmpGPS...))...)
+	data = append(data, jpegSegment(append([]byte("http://ns.adobe.com/xmp/extension/\x00"), xmpGPS...))...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	stripped := stripLocation("image/jpeg", data)
+	if bytes.Contains(stripped, []byte("GPSLatitude")) || bytes.Contains(stripped, []byte("ns.adobe.com")) {
+		t.Fatal("the XMP location was kept")
+	}
+	segments := jpegExifSegments(stripped)
+	if len(segments) != 1 {
+		t.Fatalf("got %d EXIF segments, want 1", len(segments))
+	}
+	gps := segments[0][38:]
+	if binary.BigEndian.Uint16(gps) != 0 || !bytes.Equal(segments[0][56:80], make([]byte, 24)) {
+		t.Fatal("the EXIF location was kept")
+	}
+	if orientation := exifOrientation(stripped); orientation != 6 {
+		t.Fatalf("got the orientation %d, want 6", orientation)
+	}
+	if img, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil || img.Bounds().Dx() != 8 {
+		t.Fatalf("the image is broken: %v", err)
+	}
+}
+
+func TestStripLocationPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	// the signature and the header come first
+	header := encoded.Bytes()[:8+25]
+	var data []byte
+	data = append(data, header...)
+	data = append(data, pngChunk("eXIf", testExif())...)
+	data = append(data, pngChunk("iTXt", []byte(xmpKeyword+"\x00\x00\x00\x00\x00"+xmpGPS))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00taken at home"))...)
+	data = append(data, encoded.Bytes()[len(header):]...)
+
+	stripped := stripLocation("image/png", data)
+	if bytes.Contains(stripped, []byte("GPSLatitude")) || bytes.Contains(stripped, []byte("eXIf")) {
+		t.Fatal("the location was kept")
+	}
+	if !bytes.Contains(stripped, []byte("taken at home")) {
+		t.Fatal("a text chunk that is not XMP was removed")
+	}
+	if img, err := png.Decode(bytes.NewReader(stripped)); err != nil || img.Bounds().Dx() != 8 {
+		t.Fatalf("the image is broken: %v", err)
+	}
+}
+
+func TestStripLocationKeepsOtherData(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("not an image"), {0xFF, 0xD8, 0xFF}} {
+		if got := stripLocation("image/jpeg", data); !bytes.Equal(got, data) {
+			t.Errorf("got %q for %q", got, data)
+		}
+	}
+	if got := stripLocation("image/gif", []byte("GIF89a")); string(got) != "GIF89a" {
+		t.Fatalf("got %q", got)
+	}
+}
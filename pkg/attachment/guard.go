@@ -0,0 +1,41 @@
+package attachment
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"log"
+)
+
+// attachedMessageService checks the attachments of every new message and links them to it
+type attachedMessageService struct {
+	message.MessageService
+	attachmentService AttachmentService
+}
+
+// NewAttachedMessageService puts the attachment checks in front of a message service
+func NewAttachedMessageService(messageService message.MessageService, attachmentService AttachmentService) message.MessageService {
+	return &attachedMessageService{MessageService: messageService, attachmentService: attachmentService}
+}
+
+// CreateMessage rejects invalid attachments and claims the others, creates the message, then links the attachments to it.
+// A message whose attachments can not be linked is deleted, it would point to files it does not own.
+func (a *attachedMessageService) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	claim, err := a.attachmentService.Claim(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	created, err := a.MessageService.CreateMessage(ctx, msg)
+	if err != nil {
+		a.attachmentService.Release(ctx, claim)
+		return nil, err
+	}
+	if err := a.attachmentService.Attach(ctx, claim, created); err != nil {
+		log.Printf("Failed to attach files to message %s: %v", created.ID, err)
+		if err := a.MessageService.DeleteMessage(ctx, created.ID); err != nil {
+			log.Printf("Failed to delete message %s without its files: %v", created.ID, err)
+		}
+		a.attachmentService.Release(ctx, claim)
+		return nil, ErrInvalidAttachment
+	}
+	return created, nil
+}
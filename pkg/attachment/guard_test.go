@@ -0,0 +1,190 @@
+package attachment
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRepository keeps the attachments in memory, with the conditions of the repository updates
+type testRepository struct {
+	AttachmentRepository
+	mu          sync.Mutex
+	attachments map[string]*AttachmentModel
+	// attachFails makes Attach fail, like a claim taken over
+	attachFails bool
+}
+
+func newTestRepository(ids ...primitive.ObjectID) *testRepository {
+	r := &testRepository{attachments: make(map[string]*AttachmentModel)}
+	for _, id := range ids {
+		r.attachments[id.Hex()] = &AttachmentModel{ID: id, RoomID: "room1", UploaderID: "bob", Status: StatusReady}
+	}
+	return r
+}
+
+func (r *testRepository) Get(ctx context.Context, attachmentID string) (*AttachmentModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attachment, ok := r.attachments[attachmentID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *attachment
+	return &copied, nil
+}
+
+func (r *testRepository) Claim(ctx context.Context, attachmentIDs []string, uploaderID string, roomID string, claim string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range attachmentIDs {
+		attachment := r.attachments[id]
+		if attachment.UploaderID != uploaderID || attachment.RoomID != roomID || attachment.MessageID != "" || attachment.Claim != "" {
+			return errors.New(" Some attachments are already sent")
+		}
+	}
+	for _, id := range attachmentIDs {
+		r.attachments[id].Claim = claim
+	}
+	return nil
+}
+
+func (r *testRepository) Attach(ctx context.Context, attachmentIDs []string, claim string, messageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.attachFails {
+		return errors.New(" Some attachments are not claimed anymore")
+	}
+	for _, id := range attachmentIDs {
+		r.attachments[id].MessageID, r.attachments[id].Claim = messageID, ""
+	}
+	return nil
+}
+
+func (r *testRepository) Release(ctx context.Context, claim string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, attachment := range r.attachments {
+		if attachment.Claim == claim && attachment.MessageID == "" {
+			attachment.Claim = ""
+		}
+	}
+	return nil
+}
+
+// testMessages creates and deletes messages in memory, it fails while fail is set
+type testMessages struct {
+	message.MessageService
+	mu       sync.Mutex
+	messages map[string]*message.MessageEntity
+	fail     bool
+}
+
+func (m *testMessages) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	if m.fail {
+		return nil, errors.New("Slow mode is enabled")
+	}
+	// leave time for a concurrent message
+	time.Sleep(5 * time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	created := *msg
+	created.ID = primitive.NewObjectID().Hex()
+	m.messages[created.ID] = &created
+	return &created, nil
+}
+
+func (m *testMessages) DeleteMessage(ctx context.Context, messageID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.messages, messageID)
+	return nil
+}
+
+func newTestGuard(repo *testRepository, messages *testMessages) message.MessageService {
+	service := NewAttachmentService(repo, nil, nil, nil, Config{MaxPerMessage: 10})
+	return NewAttachedMessageService(messages, service)
+}
+
+func sendWith(service message.MessageService, ids ...string) (*message.MessageEntity, error) {
+	msg := &message.MessageEntity{RoomID: "room1", UserID: "bob", Content: "look"}
+	for _, id := range ids {
+		msg.Attachments = append(msg.Attachments, message.AttachmentEntity{ID: id})
+	}
+	return service.CreateMessage(context.Background(), msg)
+}
+
+func TestAttachmentIsSentOnce(t *testing.T) {
+	id := primitive.NewObjectID()
+	repo := newTestRepository(id)
+	messages := &testMessages{messages: make(map[string]*message.MessageEntity)}
+	guard := newTestGuard(repo, messages)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = sendWith(guard, id.Hex())
+		}(i)
+	}
+	wg.Wait()
+	sent := 0
+	for _, err := range errs {
+		if err == nil {
+			sent++
+		} else if err != ErrInvalidAttachment {
+			t.Fatalf("got %v, want ErrInvalidAttachment", err)
+		}
+	}
+	if sent != 1 || len(messages.messages) != 1 {
+		t.Fatalf("the file was sent in %d messages", sent)
+	}
+	for messageID := range messages.messages {
+		if repo.attachments[id.Hex()].MessageID != messageID {
+			t.Fatal("the file is not owned by the message that has it")
+		}
+	}
+}
+
+func TestAttachmentIsReleasedWhenTheMessageFails(t *testing.T) {
+	id := primitive.NewObjectID()
+	repo := newTestRepository(id)
+	messages := &testMessages{messages: make(map[string]*message.MessageEntity), fail: true}
+	guard := newTestGuard(repo, messages)
+	if _, err := sendWith(guard, id.Hex()); err == nil {
+		t.Fatal("the error of the message was lost")
+	}
+	messages.fail = false
+	if _, err := sendWith(guard, id.Hex()); err != nil {
+		t.Fatalf("the file is still claimed by the failed message: %v", err)
+	}
+}
+
+func TestMessageIsDeletedWhenAttachFails(t *testing.T) {
+	id := primitive.NewObjectID()
+	repo := newTestRepository(id)
+	repo.attachFails = true
+	messages := &testMessages{messages: make(map[string]*message.MessageEntity)}
+	if _, err := sendWith(newTestGuard(repo, messages), id.Hex()); err != ErrInvalidAttachment {
+		t.Fatalf("got %v, want ErrInvalidAttachment", err)
+	}
+	if len(messages.messages) != 0 || repo.attachments[id.Hex()].Claim != "" {
+		t.Fatal("the message without its files was kept")
+	}
+}
+
+func TestAttachmentOfAnotherUser(t *testing.T) {
+	id := primitive.NewObjectID()
+	repo := newTestRepository(id)
+	repo.attachments[id.Hex()].UploaderID = "alice"
+	messages := &testMessages{messages: make(map[string]*message.MessageEntity)}
+	if _, err := sendWith(newTestGuard(repo, messages), id.Hex()); err != ErrInvalidAttachment {
+		t.Fatalf("got %v, want ErrInvalidAttachment", err)
+	}
+}
@@ -0,0 +1,142 @@
+package attachment
+
+import (
+	"chat-app/pkg/room"
+	"chat-app/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UploadAttachmentHandler uploads a file to a room, sent as the "file" field of a multipart form.
+// The file is read as it is received, and attached to a message by sending its ID with the message.
+func UploadAttachmentHandler(attachmentService AttachmentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+		userID, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not upload file"})
+			return
+		}
+
+		// the form can only be a little larger than the file
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, attachmentService.Config().MaxSize+64<<10)
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The file is required"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrTooLarge.Error()})
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+
+			attachment, err := attachmentService.Upload(c.Request.Context(), roomID, userID, part.FileName(), part)
+			switch {
+			case errors.Is(err, ErrTooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrTooLarge.Error()})
+			case errors.Is(err, ErrNotMember) || errors.Is(err, room.ErrRoomArchived):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case err != nil:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Could not upload file"})
+			default:
+				c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+			}
+			return
+		}
+	}
+}
+
+// DownloadAttachmentHandler sends a file to a member of its room.
+// Images are shown in the browser, the other files are always downloaded.
+func DownloadAttachmentHandler(attachmentService AttachmentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not download file"})
+			return
+		}
+		attachment, content, err := attachmentService.Open(c.Request.Context(), c.Param("id"), userID)
+		if errors.Is(err, ErrNotMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not download file"})
+			return
+		}
+		defer content.Close()
+
+		disposition := "attachment"
+		if strings.HasPrefix(attachment.ContentType, "image/") {
+			disposition = "inline"
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q; filename*=UTF-8''%s",
+			disposition, asciiName(attachment.Name), url.PathEscape(attachment.Name)))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("ETag", strconv.Quote(attachment.Checksum))
+		c.Header("Cache-Control", "private, max-age=86400")
+		if c.GetHeader("If-None-Match") == strconv.Quote(attachment.Checksum) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, nil)
+	}
+}
+
+// asciiName replaces the characters of a file name that are not printable ASCII, for old clients
+func asciiName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// DownloadThumbnailHandler sends a thumbnail of an image to a member of its room
+func DownloadThumbnailHandler(attachmentService AttachmentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not download thumbnail"})
+			return
+		}
+		thumbnail, content, err := attachmentService.OpenThumbnail(c.Request.Context(), c.Param("id"), c.Param("size"), userID)
+		if errors.Is(err, ErrNotMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not download thumbnail"})
+			return
+		}
+		defer content.Close()
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.DataFromReader(http.StatusOK, thumbnail.Size, thumbnail.ContentType, content, nil)
+	}
+}
@@ -0,0 +1,83 @@
+package attachment
+
+import (
+	"chat-app/pkg/message"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// AttachmentModel is an uploaded file, MessageID is set once the file is sent in a message.
+// Checksum is the hex SHA-256 of the content, Key is where the content is in the storage.
+type AttachmentModel struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	RoomID      string             `bson:"roomId,omitempty"`
+	UploaderID  string             `bson:"uploaderId,omitempty"`
+	MessageID   string             `bson:"messageId,omitempty"`
+	Name        string             `bson:"name,omitempty"`
+	ContentType string             `bson:"contentType,omitempty"`
+	Size        int64              `bson:"size,omitempty"`
+	Checksum    string             `bson:"checksum,omitempty"`
+	Key         string             `bson:"key,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt,omitempty"`
+	AttachedAt  time.Time          `bson:"attachedAt,omitempty"`
+	Status      string             `bson:"status,omitempty"`
+	Width       int                `bson:"width,omitempty"`
+	Height      int                `bson:"height,omitempty"`
+	Thumbnails  []ThumbnailModel   `bson:"thumbnails,omitempty"`
+	// Claim reserves the file for a message being created, so that no other message takes it
+	Claim     string    `bson:"claim,omitempty"`
+	ClaimedAt time.Time `bson:"claimedAt,omitempty"`
+}
+
+// ThumbnailModel is a smaller version of an image attachment, Name is its largest dimension
+type ThumbnailModel struct {
+	Name        string `bson:"name"`
+	Width       int    `bson:"width"`
+	Height      int    `bson:"height"`
+	ContentType string `bson:"contentType"`
+	Size        int64  `bson:"size"`
+	Key         string `bson:"key"`
+}
+
+// ModelToEntity converts an attachment model to an attachment entity
+func ModelToEntity(attachment *AttachmentModel) *AttachmentEntity {
+	return &AttachmentEntity{
+		ID:          attachment.ID.Hex(),
+		RoomID:      attachment.RoomID,
+		UploaderID:  attachment.UploaderID,
+		MessageID:   attachment.MessageID,
+		Name:        attachment.Name,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Checksum:    attachment.Checksum,
+		CreatedAt:   attachment.CreatedAt.String(),
+		Status:      attachment.Status,
+		Width:       attachment.Width,
+		Height:      attachment.Height,
+		Thumbnails:  thumbnailModelsToEntities(attachment.Thumbnails),
+	}
+}
+
+// ModelToMessageEntity converts an attachment model to the attachment of a message
+func ModelToMessageEntity(attachment *AttachmentModel) message.AttachmentEntity {
+	return message.AttachmentEntity{
+		ID:          attachment.ID.Hex(),
+		Name:        attachment.Name,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Checksum:    attachment.Checksum,
+		Status:      attachment.Status,
+		Width:       attachment.Width,
+		Height:      attachment.Height,
+		Thumbnails:  thumbnailModelsToEntities(attachment.Thumbnails),
+	}
+}
+
+// thumbnailModelsToEntities converts the thumbnails of an attachment
+func thumbnailModelsToEntities(thumbnails []ThumbnailModel) []message.ThumbnailEntity {
+	var entities []message.ThumbnailEntity
+	for _, thumbnail := range thumbnails {
+		entities = append(entities, message.ThumbnailEntity{Name: thumbnail.Name, Width: thumbnail.Width, Height: thumbnail.Height})
+	}
+	return entities
+}
@@ -0,0 +1,227 @@
+package attachment
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// AttachmentRepository defines the methods to keep the metadata of the uploaded files
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *AttachmentModel) error
+	Get(ctx context.Context, attachmentID string) (*AttachmentModel, error)
+	Claim(ctx context.Context, attachmentIDs []string, uploaderID string, roomID string, claim string) error
+	Attach(ctx context.Context, attachmentIDs []string, claim string, messageID string) error
+	Release(ctx context.Context, claim string) error
+	GetOrphans(ctx context.Context, before time.Time, limit int64) ([]*AttachmentModel, error)
+	Delete(ctx context.Context, attachmentID primitive.ObjectID) error
+	ClaimPending(ctx context.Context) (*AttachmentModel, error)
+	ResetProcessing(ctx context.Context) error
+	SetThumbnails(ctx context.Context, attachmentID primitive.ObjectID, status string, thumbnails []ThumbnailModel) error
+	SyncMessages(ctx context.Context, attachment *AttachmentModel) error
+}
+
+// status of the thumbnails of the attachments
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+// attachmentRepository is the implementation of the AttachmentRepository interface
+type attachmentRepository struct {
+	collection        *mongo.Collection
+	collectionMessage *mongo.Collection
+}
+
+// NewAttachmentRepository creates a new attachment repository
+func NewAttachmentRepository(collection *mongo.Collection, collectionMessage *mongo.Collection) AttachmentRepository {
+	return &attachmentRepository{collection: collection, collectionMessage: collectionMessage}
+}
+
+// Create inserts the metadata of an uploaded file
+func (r *attachmentRepository) Create(ctx context.Context, attachment *AttachmentModel) error {
+	_, err := r.collection.InsertOne(ctx, attachment)
+	return err
+}
+
+// Get retrieves an attachment by its ID
+func (r *attachmentRepository) Get(ctx context.Context, attachmentID string) (*AttachmentModel, error) {
+	attachmentObjectID, err := primitive.ObjectIDFromHex(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	var attachment AttachmentModel
+	err = r.collection.FindOne(ctx, bson.D{{"_id", attachmentObjectID}}).Decode(&attachment)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// claimTTL is how long a claim holds the files, a claim left by a crash is then taken over
+const claimTTL = time.Minute
+
+// Claim reserves attachments of an uploader in a room, not sent yet and not claimed by another message.
+// All of them are claimed or none.
+func (r *attachmentRepository) Claim(ctx context.Context, attachmentIDs []string, uploaderID string, roomID string, claim string) error {
+	ids, err := objectIDs(attachmentIDs)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	result, err := r.collection.UpdateMany(ctx,
+		bson.D{
+			{"_id", bson.D{{"$in", ids}}},
+			{"uploaderId", uploaderID},
+			{"roomId", roomID},
+			{"messageId", bson.D{{"$exists", false}}},
+			{"$or", bson.A{
+				bson.D{{"claim", bson.D{{"$exists", false}}}},
+				bson.D{{"claimedAt", bson.D{{"$lt", now.Add(-claimTTL)}}}},
+			}},
+		},
+		bson.D{{"$set", bson.D{{"claim", claim}, {"claimedAt", now}}}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount != int64(len(ids)) {
+		if err := r.Release(ctx, claim); err != nil {
+			return err
+		}
+		return errors.New(" Some attachments are already sent")
+	}
+	return nil
+}
+
+// Attach links the claimed attachments to their message
+func (r *attachmentRepository) Attach(ctx context.Context, attachmentIDs []string, claim string, messageID string) error {
+	ids, err := objectIDs(attachmentIDs)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateMany(ctx,
+		bson.D{{"_id", bson.D{{"$in", ids}}}, {"claim", claim}, {"messageId", bson.D{{"$exists", false}}}},
+		bson.D{
+			{"$set", bson.D{{"messageId", messageID}, {"attachedAt", time.Now()}}},
+			{"$unset", bson.D{{"claim", ""}, {"claimedAt", ""}}},
+		})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount != int64(len(ids)) {
+		return errors.New(" Some attachments are not claimed anymore")
+	}
+	return nil
+}
+
+// Release frees the attachments of a claim that were not sent
+func (r *attachmentRepository) Release(ctx context.Context, claim string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.D{{"claim", claim}, {"messageId", bson.D{{"$exists", false}}}},
+		bson.D{{"$unset", bson.D{{"claim", ""}, {"claimedAt", ""}}}})
+	return err
+}
+
+// GetOrphans returns the attachments uploaded before a date that are not in a message,
+// because they were never sent or their message was deleted
+func (r *attachmentRepository) GetOrphans(ctx context.Context, before time.Time, limit int64) ([]*AttachmentModel, error) {
+	pipeline := mongo.Pipeline{
+		// the files claimed by a message being created are not orphans yet
+		{{"$match", bson.D{
+			{"createdAt", bson.D{{"$lt", before}}},
+			{"$or", bson.A{
+				bson.D{{"claimedAt", bson.D{{"$exists", false}}}},
+				bson.D{{"claimedAt", bson.D{{"$lt", time.Now().Add(-claimTTL)}}}},
+			}},
+		}}},
+		{{"$lookup", bson.D{
+			{"from", r.collectionMessage.Name()},
+			{"let", bson.D{{"messageId", "$messageId"}}},
+			{"pipeline", bson.A{
+				bson.D{{"$match", bson.D{{"$expr", bson.D{{"$eq", bson.A{
+					"$_id",
+					bson.D{{"$convert", bson.D{{"input", "$$messageId"}, {"to", "objectId"}, {"onError", nil}, {"onNull", nil}}}},
+				}}}}}}},
+				bson.D{{"$project", bson.D{{"_id", 1}}}},
+			}},
+			{"as", "message"},
+		}}},
+		{{"$match", bson.D{{"message", bson.D{{"$size", 0}}}}}},
+		{{"$limit", limit}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var attachments []*AttachmentModel
+	if err = cursor.All(ctx, &attachments); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// Delete removes the metadata of an attachment
+func (r *attachmentRepository) Delete(ctx context.Context, attachmentID primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.D{{"_id", attachmentID}})
+	return err
+}
+
+// ClaimPending marks the oldest attachment waiting for its thumbnails as processing and returns it, or nil
+func (r *attachmentRepository) ClaimPending(ctx context.Context) (*AttachmentModel, error) {
+	var attachment AttachmentModel
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{"createdAt", 1}}).SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.D{{"status", StatusPending}},
+		bson.D{{"$set", bson.D{{"status", StatusProcessing}}}}, opts).Decode(&attachment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// ResetProcessing puts back in the queue the attachments interrupted by a restart
+func (r *attachmentRepository) ResetProcessing(ctx context.Context) error {
+	_, err := r.collection.UpdateMany(ctx, bson.D{{"status", StatusProcessing}}, bson.D{{"$set", bson.D{{"status", StatusPending}}}})
+	return err
+}
+
+// SetThumbnails records the thumbnails of an attachment
+func (r *attachmentRepository) SetThumbnails(ctx context.Context, attachmentID primitive.ObjectID, status string, thumbnails []ThumbnailModel) error {
+	_, err := r.collection.UpdateOne(ctx, bson.D{{"_id", attachmentID}},
+		bson.D{{"$set", bson.D{{"status", status}, {"thumbnails", thumbnails}}}})
+	return err
+}
+
+// SyncMessages copies the status and the thumbnails of an attachment to the messages it is attached to
+func (r *attachmentRepository) SyncMessages(ctx context.Context, attachment *AttachmentModel) error {
+	thumbnails := make([]message.ThumbnailModel, 0, len(attachment.Thumbnails))
+	for _, thumbnail := range attachment.Thumbnails {
+		thumbnails = append(thumbnails, message.ThumbnailModel{Name: thumbnail.Name, Width: thumbnail.Width, Height: thumbnail.Height})
+	}
+	_, err := r.collectionMessage.UpdateMany(ctx, bson.D{{"attachments._id", attachment.ID.Hex()}},
+		bson.D{{"$set", bson.D{{"attachments.$.status", attachment.Status}, {"attachments.$.thumbnails", thumbnails}}}})
+	return err
+}
+
+// objectIDs converts hex IDs to object IDs
+func objectIDs(hexIDs []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(hexIDs))
+	for _, hexID := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,508 @@
+package attachment
+
+import (
+	"bytes"
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrTooLarge is returned for a file over the size limit
+	ErrTooLarge = errors.New("The file is too large")
+	// ErrNotMember is returned when a user uploads to, or downloads from, a room they are not a member of
+	ErrNotMember = errors.New("You are not a member of this room")
+	// ErrInvalidAttachment is returned when a message is sent with a file not uploaded by its sender in its room
+	ErrInvalidAttachment = errors.New("Invalid attachment")
+	// ErrTooManyAttachments is returned when a message has too many files
+	ErrTooManyAttachments = errors.New("Too many attachments")
+)
+
+// Config holds the limits of the attachments
+type Config struct {
+	// MaxSize is the size limit of a file, in bytes
+	MaxSize int64
+	// MaxPerMessage is the number of files of a message
+	MaxPerMessage int
+	// OrphanTTL is how long a file not sent in a message is kept
+	OrphanTTL time.Duration
+	// Interval is the time between two garbage collections
+	Interval time.Duration
+	// ThumbnailSizes are the largest dimensions of the thumbnails of the images
+	ThumbnailSizes []int
+}
+
+// ConfigFromEnv reads the attachment limits from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{MaxSize: 10 << 20, MaxPerMessage: 10, OrphanTTL: 24 * time.Hour, Interval: time.Hour, ThumbnailSizes: []int{64, 256, 1024}}
+	if size, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		config.MaxSize = size
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("ATTACHMENT_ORPHAN_TTL")); err == nil && ttl > 0 {
+		config.OrphanTTL = ttl
+	}
+	if interval, err := time.ParseDuration(os.Getenv("ATTACHMENT_GC_INTERVAL")); err == nil && interval > 0 {
+		config.Interval = interval
+	}
+	if value := os.Getenv("THUMBNAIL_SIZES"); value != "" {
+		var sizes []int
+		for _, field := range strings.Split(value, ",") {
+			if size, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && size > 0 {
+				sizes = append(sizes, size)
+			}
+		}
+		config.ThumbnailSizes = sizes
+	}
+	return config
+}
+
+// AttachmentService defines the methods of the uploaded files
+type AttachmentService interface {
+	Upload(ctx context.Context, roomID string, userID string, name string, r io.Reader) (*AttachmentEntity, error)
+	Open(ctx context.Context, attachmentID string, userID string) (*AttachmentEntity, io.ReadCloser, error)
+	OpenThumbnail(ctx context.Context, attachmentID string, name string, userID string) (*ThumbnailModel, io.ReadCloser, error)
+	Claim(ctx context.Context, msg *message.MessageEntity) (string, error)
+	Attach(ctx context.Context, claim string, msg *message.MessageEntity) error
+	Release(ctx context.Context, claim string)
+	CollectGarbage(ctx context.Context) (int, error)
+	Start(ctx context.Context)
+	Config() Config
+}
+
+// attachmentService is the implementation of the AttachmentService interface
+type attachmentService struct {
+	repo        AttachmentRepository
+	storage     Storage
+	roomService room.RoomService
+	broadcast   room.Broadcaster
+	config      Config
+	// wake starts the thumbnail worker without waiting
+	wake chan struct{}
+}
+
+// EventAttachmentUpdated is the WebSocket event sent when the thumbnails of an attachment are done
+const EventAttachmentUpdated = "attachment.updated"
+
+// NewAttachmentService creates a new attachment service
+func NewAttachmentService(repo AttachmentRepository, storage Storage, roomService room.RoomService, broadcast room.Broadcaster, config Config) AttachmentService {
+	return &attachmentService{
+		repo:        repo,
+		storage:     storage,
+		roomService: roomService,
+		broadcast:   broadcast,
+		config:      config,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Config returns the limits of the attachments
+func (s *attachmentService) Config() Config {
+	return s.config
+}
+
+// Upload stores a file sent to a room, with its sniffed MIME type and checksum
+func (s *attachmentService) Upload(ctx context.Context, roomID string, userID string, name string, r io.Reader) (*AttachmentEntity, error) {
+	// only the members can upload to a room
+	roomRetrieved, err := s.roomService.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, errors.New("The room does not exist")
+	}
+	if roomRetrieved.Archived {
+		return nil, room.ErrRoomArchived
+	}
+	if !isMember(roomRetrieved, userID) {
+		return nil, ErrNotMember
+	}
+
+	// copy the file to a temporary file, to know its size and checksum before storing it
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, s.config.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > s.config.MaxSize {
+		return nil, ErrTooLarge
+	}
+	if size == 0 {
+		return nil, errors.New("The file is empty")
+	}
+
+	// the MIME type is sniffed from the content, the name sent is not trusted
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	attachment := &AttachmentModel{
+		ID:          primitive.NewObjectID(),
+		RoomID:      roomID,
+		UploaderID:  userID,
+		Name:        cleanName(name),
+		ContentType: http.DetectContentType(head[:n]),
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt:   time.Now(),
+		Status:      StatusReady,
+	}
+	attachment.Key = "attachments/" + attachment.ID.Hex()
+	var content io.Reader = tmp
+
+	// the location of the images is removed before they are stored, their dimensions are known at once
+	// and their thumbnails are made in background
+	if isImage(attachment.ContentType) {
+		data, err := io.ReadAll(tmp)
+		if err != nil {
+			return nil, err
+		}
+		data = stripLocation(attachment.ContentType, data)
+		sum := sha256.Sum256(data)
+		attachment.Size, attachment.Checksum = int64(len(data)), hex.EncodeToString(sum[:])
+		if width, height, err := imageSize(attachment.ContentType, data); err == nil {
+			attachment.Width, attachment.Height = width, height
+			attachment.Status = StatusPending
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if err := s.storage.Put(ctx, attachment.Key, content, attachment.Size, attachment.ContentType); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, attachment); err != nil {
+		s.storage.Delete(ctx, attachment.Key)
+		return nil, err
+	}
+	if attachment.Status == StatusPending {
+		s.wakeWorker()
+	}
+	return ModelToEntity(attachment), nil
+}
+
+// Open returns a file and its content, for a member of its room.
+// A file not sent yet is only available to its uploader.
+func (s *attachmentService) Open(ctx context.Context, attachmentID string, userID string) (*AttachmentEntity, io.ReadCloser, error) {
+	attachment, err := s.authorize(ctx, attachmentID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := s.storage.Get(ctx, attachment.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ModelToEntity(attachment), content, nil
+}
+
+// OpenThumbnail returns a thumbnail of an image and its content, for a member of its room
+func (s *attachmentService) OpenThumbnail(ctx context.Context, attachmentID string, name string, userID string) (*ThumbnailModel, io.ReadCloser, error) {
+	attachment, err := s.authorize(ctx, attachmentID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, thumbnail := range attachment.Thumbnails {
+		if thumbnail.Name == name {
+			content, err := s.storage.Get(ctx, thumbnail.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &thumbnail, content, nil
+		}
+	}
+	return nil, nil, ErrObjectNotFound
+}
+
+// authorize returns an attachment if the user can download it
+func (s *attachmentService) authorize(ctx context.Context, attachmentID string, userID string) (*AttachmentModel, error) {
+	attachment, err := s.repo.Get(ctx, attachmentID)
+	if err != nil {
+		return nil, ErrObjectNotFound
+	}
+	if attachment.MessageID == "" && attachment.UploaderID != userID {
+		return nil, ErrObjectNotFound
+	}
+	roomRetrieved, err := s.roomService.GetRoom(ctx, attachment.RoomID)
+	if err != nil || !isMember(roomRetrieved, userID) {
+		return nil, ErrNotMember
+	}
+	return attachment, nil
+}
+
+// Claim checks the attachments of a new message, completes their metadata and reserves them for it.
+// The files must have been uploaded by the sender to the room of the message, and not sent or claimed yet.
+// It returns the claim to attach the files to the message once created, or to release them.
+func (s *attachmentService) Claim(ctx context.Context, msg *message.MessageEntity) (string, error) {
+	if len(msg.Attachments) == 0 {
+		return "", nil
+	}
+	if len(msg.Attachments) > s.config.MaxPerMessage {
+		return "", ErrTooManyAttachments
+	}
+	seen := make(map[string]bool, len(msg.Attachments))
+	resolved := make([]message.AttachmentEntity, 0, len(msg.Attachments))
+	for _, requested := range msg.Attachments {
+		if seen[requested.ID] {
+			continue
+		}
+		seen[requested.ID] = true
+		attachment, err := s.repo.Get(ctx, requested.ID)
+		if err != nil || attachment.UploaderID != msg.UserID || attachment.RoomID != msg.RoomID || attachment.MessageID != "" {
+			return "", ErrInvalidAttachment
+		}
+		resolved = append(resolved, ModelToMessageEntity(attachment))
+	}
+
+	// the checks and the claim are one update, two messages sent at once can not both take a file
+	claim := primitive.NewObjectID().Hex()
+	ids := make([]string, 0, len(resolved))
+	for _, attachment := range resolved {
+		ids = append(ids, attachment.ID)
+	}
+	if err := s.repo.Claim(ctx, ids, msg.UserID, msg.RoomID, claim); err != nil {
+		return "", ErrInvalidAttachment
+	}
+	msg.Attachments = resolved
+	return claim, nil
+}
+
+// Attach links the claimed attachments of a message to it once created
+func (s *attachmentService) Attach(ctx context.Context, claim string, msg *message.MessageEntity) error {
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		ids = append(ids, attachment.ID)
+	}
+	if err := s.repo.Attach(ctx, ids, claim, msg.ID); err != nil {
+		return err
+	}
+	// thumbnails done since the message was checked are not in it yet
+	for _, attachment := range msg.Attachments {
+		if attachment.Status != StatusPending && attachment.Status != StatusProcessing {
+			continue
+		}
+		updated, err := s.repo.Get(ctx, attachment.ID)
+		if err == nil && updated.Status != attachment.Status && updated.Status != StatusProcessing {
+			s.notify(ctx, updated)
+		}
+	}
+	return nil
+}
+
+// Release frees the attachments of a claim, for a message that was not created
+func (s *attachmentService) Release(ctx context.Context, claim string) {
+	if claim == "" {
+		return
+	}
+	if err := s.repo.Release(ctx, claim); err != nil {
+		log.Printf("Failed to release the attachments of claim %s: %v", claim, err)
+	}
+}
+
+// CollectGarbage removes the files not sent in a message after the orphan delay, and the files of deleted messages
+func (s *attachmentService) CollectGarbage(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		orphans, err := s.repo.GetOrphans(ctx, time.Now().Add(-s.config.OrphanTTL), 500)
+		if err != nil {
+			return removed, err
+		}
+		for _, orphan := range orphans {
+			if err := s.storage.Delete(ctx, orphan.Key); err != nil {
+				return removed, fmt.Errorf("attachment %s: %v", orphan.ID.Hex(), err)
+			}
+			for _, thumbnail := range orphan.Thumbnails {
+				if err := s.storage.Delete(ctx, thumbnail.Key); err != nil {
+					return removed, fmt.Errorf("attachment %s: %v", orphan.ID.Hex(), err)
+				}
+			}
+			if err := s.repo.Delete(ctx, orphan.ID); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(orphans) < 500 {
+			return removed, nil
+		}
+	}
+}
+
+// Start makes the thumbnails in background, and collects the garbage at every interval, until the context is done
+func (s *attachmentService) Start(ctx context.Context) {
+	go s.runThumbnails(ctx)
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.CollectGarbage(ctx)
+			if err != nil {
+				log.Printf("Attachment garbage collection failed: %v", err)
+			}
+			if removed > 0 {
+				log.Printf("Attachment garbage collection: %d files removed", removed)
+			}
+		}
+	}
+}
+
+// runThumbnails makes the thumbnails of the images uploaded, one image at a time
+func (s *attachmentService) runThumbnails(ctx context.Context) {
+	// the images interrupted by a restart are done again
+	if err := s.repo.ResetProcessing(ctx); err != nil {
+		log.Printf("Failed to reset the thumbnails in progress: %v", err)
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		for {
+			attachment, err := s.repo.ClaimPending(ctx)
+			if err != nil {
+				log.Printf("Failed to get the pending thumbnails: %v", err)
+				break
+			}
+			if attachment == nil {
+				break
+			}
+			s.processThumbnails(ctx, attachment)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// processThumbnails makes and stores the thumbnails of an image, then tells the room of its message
+func (s *attachmentService) processThumbnails(ctx context.Context, attachment *AttachmentModel) {
+	thumbnails, err := s.storeThumbnails(ctx, attachment)
+	status := StatusReady
+	if err != nil {
+		log.Printf("Failed to make the thumbnails of attachment %s: %v", attachment.ID.Hex(), err)
+		status = StatusFailed
+	}
+	if err := s.repo.SetThumbnails(ctx, attachment.ID, status, thumbnails); err != nil {
+		log.Printf("Failed to save the thumbnails of attachment %s: %v", attachment.ID.Hex(), err)
+		return
+	}
+	// the attachment may have been sent in a message meanwhile
+	updated, err := s.repo.Get(ctx, attachment.ID.Hex())
+	if err != nil {
+		return
+	}
+	s.notify(ctx, updated)
+}
+
+// storeThumbnails makes the thumbnails of an image and puts them in the storage
+func (s *attachmentService) storeThumbnails(ctx context.Context, attachment *AttachmentModel) ([]ThumbnailModel, error) {
+	content, err := s.storage.Get(ctx, attachment.Key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(content, attachment.Size+1))
+	content.Close()
+	if err != nil {
+		return nil, err
+	}
+	thumbnails, err := makeThumbnails(attachment.ContentType, data, s.config.ThumbnailSizes)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]ThumbnailModel, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		model := ThumbnailModel{
+			Name:        thumbnail.Name,
+			Width:       thumbnail.Width,
+			Height:      thumbnail.Height,
+			ContentType: thumbnail.ContentType,
+			Size:        int64(len(thumbnail.Data)),
+			Key:         "thumbnails/" + attachment.ID.Hex() + "-" + thumbnail.Name,
+		}
+		if err := s.storage.Put(ctx, model.Key, bytes.NewReader(thumbnail.Data), model.Size, model.ContentType); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// notify copies the status of an attachment sent in a message to the message, and sends it to the room
+func (s *attachmentService) notify(ctx context.Context, attachment *AttachmentModel) {
+	if attachment.MessageID == "" {
+		return
+	}
+	if err := s.repo.SyncMessages(ctx, attachment); err != nil {
+		log.Printf("Failed to update the message of attachment %s: %v", attachment.ID.Hex(), err)
+	}
+	if s.broadcast != nil {
+		s.broadcast(attachment.RoomID, EventAttachmentUpdated, EventEntity{
+			MessageID:  attachment.MessageID,
+			Attachment: ModelToMessageEntity(attachment),
+		})
+	}
+}
+
+// wakeWorker starts the thumbnail worker if it is waiting
+func (s *attachmentService) wakeWorker() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// isMember checks if a user is a member of a room
+func isMember(roomEntity *room.RoomEntity, userID string) bool {
+	for _, member := range roomEntity.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanName keeps the base name of a file, without control characters
+func cleanName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	// keep the end of a long name, with its extension
+	for len(name) > 255 {
+		_, size := utf8.DecodeRuneInString(name)
+		name = name[size:]
+	}
+	return name
+}
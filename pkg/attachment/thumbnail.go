@@ -0,0 +1,180 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+)
+
+// maxPixels limits the size of the decoded images, against decompression bombs
+const maxPixels = 40_000_000
+
+// ErrImageTooLarge is returned for an image with too many pixels to make thumbnails
+var ErrImageTooLarge = errors.New("The image is too large")
+
+// thumbnail is a generated smaller version of an image
+type thumbnail struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// isImage checks if the thumbnails of a MIME type can be generated
+func isImage(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif"
+}
+
+// imageSize returns the dimensions of an image as displayed, after its EXIF orientation
+func imageSize(contentType string, data []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if contentType == "image/jpeg" && exifOrientation(data) >= 5 {
+		return config.Height, config.Width, nil
+	}
+	return config.Width, config.Height, nil
+}
+
+// makeThumbnails creates a thumbnail of an image for every size smaller than the image.
+// A size is the largest dimension of its thumbnail. JPEG images give JPEG thumbnails, the others PNG.
+func makeThumbnails(contentType string, data []byte, sizes []int) ([]thumbnail, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	// only the first frame of a GIF is used
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img := toRGBA(source)
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	var thumbnails []thumbnail
+	bounds := img.Bounds()
+	for _, size := range sizes {
+		if size >= bounds.Dx() && size >= bounds.Dy() {
+			continue
+		}
+		width, height := fit(bounds.Dx(), bounds.Dy(), size)
+		resized := resize(img, width, height)
+
+		var buffer bytes.Buffer
+		thumb := thumbnail{Name: strconv.Itoa(size), Width: width, Height: height}
+		if contentType == "image/jpeg" {
+			thumb.ContentType = "image/jpeg"
+			err = jpeg.Encode(&buffer, resized, &jpeg.Options{Quality: 85})
+		} else {
+			thumb.ContentType = "image/png"
+			err = png.Encode(&buffer, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		thumb.Data = buffer.Bytes()
+		thumbnails = append(thumbnails, thumb)
+	}
+	return thumbnails, nil
+}
+
+// fit returns the dimensions of an image scaled down so its largest dimension is size
+func fit(width, height, size int) (int, int) {
+	if width >= height {
+		return size, maxInt(1, height*size/width)
+	}
+	return maxInt(1, width*size/height), size
+}
+
+// toRGBA converts an image to RGBA, with its origin at 0,0
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// resize scales an image down by averaging the source pixels covered by each destination pixel
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, maxInt((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, maxInt((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+					count++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
+
+// orient turns an image as its EXIF orientation says, so the thumbnails need no metadata
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // mirrored and rotated 270°
+				dx, dy = y, x
+			case 6: // rotated 90°
+				dx, dy = height-1-y, x
+			case 7: // mirrored and rotated 90°
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 270°
+				dx, dy = y, width-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// maxInt returns the largest of two ints
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
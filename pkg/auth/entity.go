@@ -5,3 +5,93 @@ type UserCredentials struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
 }
+
+// LoginEntity is an attempt to log in to an account
+type LoginEntity struct {
+	ID        string `json:"_id,omitempty"`
+	UserID    string `json:"userId,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Success   bool   `json:"success"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// TokenEntity is the pair of tokens given on login and on refresh
+type TokenEntity struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is the lifetime of the access token, in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// RefreshRequest is the body of a refresh, the refresh token can also be sent as a cookie
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// SessionEntity is a login of a user on a device, until it logs out or the session is revoked
+type SessionEntity struct {
+	ID         string `json:"_id"`
+	UserID     string `json:"userId"`
+	Device     string `json:"device"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	ExpiresAt  string `json:"expiresAt"`
+	// Current is the session of the token of the request
+	Current bool `json:"current"`
+}
+
+// PasswordResetRequest asks for a password reset link, sent to the email of the user
+type PasswordResetRequest struct {
+	// Login is the username or the email of the user
+	Login string `json:"login,omitempty"`
+}
+
+// PasswordResetConfirmation sets a new password with the token of a reset link
+type PasswordResetConfirmation struct {
+	Token       string `json:"token,omitempty"`
+	NewPassword string `json:"newPassword,omitempty"`
+}
+
+// EmailVerificationRequest asks for a new email verification link
+type EmailVerificationRequest struct {
+	// Login is the username or the email of the user
+	Login string `json:"login,omitempty"`
+}
+
+// EmailVerificationConfirmation verifies an email with the token of its link
+type EmailVerificationConfirmation struct {
+	Token string `json:"token,omitempty"`
+}
+
+// TwoFactorChallengeEntity is the second step of a login with two-factor authentication
+type TwoFactorChallengeEntity struct {
+	ChallengeToken string `json:"challengeToken"`
+	// Step is "verify" to send a code of the authenticator app, or "enroll" to set up two-factor authentication first
+	Step string `json:"step"`
+	// ExpiresIn is the lifetime of the challenge token, in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// TwoFactorRequest is a code of the authenticator app, or a recovery code.
+// The challenge token of a login is set for the second step, or to enroll before the first login.
+type TwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken,omitempty"`
+	Code           string `json:"code,omitempty"`
+}
+
+// TwoFactorEnrollmentEntity is the secret of a new enrollment, to add to an authenticator app
+type TwoFactorEnrollmentEntity struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI of the secret, to show as a QR code
+	URI string `json:"uri"`
+}
+
+// TwoFactorStatusEntity tells if two-factor authentication is on for a user
+type TwoFactorStatusEntity struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
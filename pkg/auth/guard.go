@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"chat-app/pkg/message"
+	"context"
+)
+
+// verifiedMessageService stops the users without a verified email from posting, when the policy requires it
+type verifiedMessageService struct {
+	message.MessageService
+	authService AuthService
+}
+
+// NewVerifiedMessageService puts the email verification policy in front of a message service
+func NewVerifiedMessageService(messageService message.MessageService, authService AuthService) message.MessageService {
+	return &verifiedMessageService{MessageService: messageService, authService: authService}
+}
+
+// CreateMessage rejects the messages of the users whose email is not verified, then creates the message
+func (v *verifiedMessageService) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	if err := v.authService.CheckEmailVerified(ctx, msg.UserID); err != nil {
+		return nil, err
+	}
+	return v.MessageService.CreateMessage(ctx, msg)
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"chat-app/pkg/user"
 	"chat-app/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -34,6 +35,7 @@ func LoginUserHandler(authService AuthService) gin.HandlerFunc {
 
 		// compare if password is correct
 		if !utils.ComparePasswords(authenticatedUser.Password, credentials.Password) {
+			authService.RecordLogin(c.Request.Context(), authenticatedUser.ID, c.ClientIP(), c.Request.UserAgent(), false)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -45,32 +47,124 @@ func LoginUserHandler(authService AuthService) gin.HandlerFunc {
 			return
 		}
 
-		// Generate JWT token
-		token, err := utils.GenerateToken(&credentials.Username, &authenticatedUser.ID, &authenticatedUser.Role)
+		// Check if the email is verified, when it is required to log in
+		if authService.Config().EmailVerification == VerificationLogin && !authenticatedUser.EmailVerified && authenticatedUser.Role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": ErrEmailNotVerified.Error(), "emailVerified": false})
+			return
+		}
+
+		// With two-factor authentication, the login ends with a code of the authenticator app
+		challenge, err := authService.LoginChallenge(c.Request.Context(), authenticatedUser, c.ClientIP(), c.Request.UserAgent())
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not generate token"})
 			return
 		}
+		if challenge != nil {
+			message := "Please enter the code of your authenticator app"
+			if challenge.Step == ChallengeEnroll {
+				message = "Two-factor authentication is required, please set it up"
+			}
+			c.JSON(http.StatusOK, gin.H{"status": true, "twoFactorRequired": true, "step": challenge.Step,
+				"challengeToken": challenge.ChallengeToken, "expiresIn": challenge.ExpiresIn, "message": message})
+			return
+		}
 
-		// Set token in cookie
-		c.SetCookie("token", token, 72*3600, "/", "localhost", false, true)
-		// Set token in header
-		c.Header("Authorization", token)
+		// Generate the access token and the refresh token
+		tokens, err := authService.IssueTokens(c.Request.Context(), authenticatedUser, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not generate token"})
+			return
+		}
+
+		authService.RecordLogin(c.Request.Context(), authenticatedUser.ID, c.ClientIP(), c.Request.UserAgent(), true)
 
-		// Send token as response
-		c.JSON(http.StatusOK, gin.H{"status": true, "token": token, "message": "You're logged in!"})
+		loggedIn(c, authService, tokens)
 	}
 }
 
+// LoginTwoFactorHandler ends a login with the challenge token and a code of the authenticator app, or a recovery code.
+func LoginTwoFactorHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request TwoFactorRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		tokens, err := authService.CompleteLogin(c.Request.Context(), request.ChallengeToken, request.Code, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			twoFactorError(c, err, "Could not generate token")
+			return
+		}
+		loggedIn(c, authService, tokens)
+	}
+}
+
+// loggedIn sets the tokens of a login and writes the response.
+func loggedIn(c *gin.Context, authService AuthService, tokens *TokenEntity) {
+	SetTokens(c, authService, tokens)
+	c.JSON(http.StatusOK, gin.H{"status": true, "token": tokens.Token, "refreshToken": tokens.RefreshToken,
+		"expiresIn": tokens.ExpiresIn, "message": "You're logged in!"})
+}
+
+// RefreshTokenHandler gives a new access token and a new refresh token for a refresh token, sent in the body or as a cookie.
+func RefreshTokenHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request RefreshRequest
+		// the body is optional when the refresh token is a cookie
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+				return
+			}
+		}
+		if request.RefreshToken == "" {
+			request.RefreshToken, _ = c.Cookie("refresh_token")
+		}
+
+		tokens, err := authService.Refresh(c.Request.Context(), request.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			clearTokens(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not refresh token"})
+			return
+		}
+
+		SetTokens(c, authService, tokens)
+		c.JSON(http.StatusOK, gin.H{"status": true, "token": tokens.Token, "refreshToken": tokens.RefreshToken,
+			"expiresIn": tokens.ExpiresIn})
+	}
+}
+
+// SetTokens sets the access token in cookie and header, and the refresh token in a cookie only sent to the auth routes.
+func SetTokens(c *gin.Context, authService AuthService, tokens *TokenEntity) {
+	c.SetCookie("token", tokens.Token, tokens.ExpiresIn, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", tokens.RefreshToken, int(authService.Config().RefreshTokenTTL.Seconds()), "/auth", "localhost", false, true)
+	c.Header("Authorization", tokens.Token)
+}
+
+// clearTokens removes the access token and the refresh token from cookie and header.
+func clearTokens(c *gin.Context) {
+	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", "", -1, "/auth", "localhost", false, true)
+	c.Header("Authorization", "")
+}
+
 // LogoutUserHandler handles user logout by invalidating the token.
 func LogoutUserHandler(authService AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Retrieve JWT token from header
-		token := c.Request.Header.Get("Authorization")
-		if token == "" {
+		// the refresh token of the login can no longer be used
+		if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+			authService.RevokeRefreshToken(c.Request.Context(), refreshToken)
+		}
+
+		// Retrieve JWT token from cookie/headers
+		token, err := utils.GetTokenFromContext(c)
+		if err != nil {
 			// Invalidate token by removing it from cookie and header
-			c.SetCookie("token", "", -1, "/", "localhost", false, true)
-			c.Header("Authorization", "")
+			clearTokens(c)
 			c.JSON(http.StatusOK, gin.H{"error": "Invalid token"})
 			return
 		}
@@ -79,26 +173,334 @@ func LogoutUserHandler(authService AuthService) gin.HandlerFunc {
 		claims, err := utils.VerifyToken(&token)
 		if err != nil {
 			// Invalidate token by removing it from cookie and header
-			c.SetCookie("token", "", -1, "/", "localhost", false, true)
-			c.Header("Authorization", "")
+			clearTokens(c)
 			c.JSON(http.StatusOK, gin.H{"error": "Invalid Token", "message": err.Error()})
 			return
 		}
+		// an API key is not logged out, it is revoked by the owner of its bot
+		if claims.IsAPIKey() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "API keys cannot log out"})
+			return
+		}
 
-		// Call logout service
-		err = authService.LogoutUser(c.Request.Context(), &claims.UserID)
+		// Call logout service, the token is revoked
+		err = authService.LogoutUser(c.Request.Context(), claims)
 		if err != nil {
 			// Invalidate token by removing it from cookie and header
-			c.SetCookie("token", "", -1, "/", "localhost", false, true)
-			c.Header("Authorization", "")
+			clearTokens(c)
 			c.JSON(http.StatusOK, gin.H{"error": "Failed to logout"})
 			return
 		}
 
 		// Invalidate token by removing it from cookie and header
-		c.SetCookie("token", "", -1, "/", "localhost", false, true)
-		c.Header("Authorization", "")
+		clearTokens(c)
 
 		c.JSON(http.StatusOK, gin.H{"message": "You're logged out!"})
 	}
 }
+
+// LogoutEverywhereHandler logs the user connected out of all its devices.
+func LogoutEverywhereHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		if err := authService.LogoutEverywhere(c.Request.Context(), claims.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to logout"})
+			return
+		}
+
+		clearTokens(c)
+		c.JSON(http.StatusOK, gin.H{"message": "You're logged out everywhere!"})
+	}
+}
+
+// GetSessionsHandler lists the active sessions of the user connected.
+func GetSessionsHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		sessions, err := authService.GetSessions(c.Request.Context(), claims.UserID, claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSessionHandler ends a session of the user connected, its live connections are closed.
+func RevokeSessionHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		revokeSession(c, authService, claims.UserID, c.Param("id"))
+	}
+}
+
+// GetUserSessionsHandler lists the active sessions of a user, for the admins.
+func GetUserSessionsHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessions, err := authService.GetSessions(c.Request.Context(), c.Param("id"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeUserSessionHandler ends a session of a user, for the admins.
+func RevokeUserSessionHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revokeSession(c, authService, c.Param("id"), c.Param("sessionId"))
+	}
+}
+
+// revokeSession ends a session of a user and writes the response.
+func revokeSession(c *gin.Context, authService AuthService, userID string, sessionID string) {
+	err := authService.RevokeSession(c.Request.Context(), userID, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "The session has been revoked"})
+}
+
+// RequestPasswordResetHandler sends a password reset link to the email of a user, the response is the same for any login.
+func RequestPasswordResetHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request PasswordResetRequest
+		if err := c.ShouldBindJSON(&request); err != nil || request.Login == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := authService.RequestPasswordReset(c.Request.Context(), request.Login, c.ClientIP()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request a password reset"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "If the account exists and has an email, a reset link has been sent to it"})
+	}
+}
+
+// ResetPasswordHandler sets a new password with the token of a reset link, the user is logged out everywhere.
+func ResetPasswordHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var confirmation PasswordResetConfirmation
+		if err := c.ShouldBindJSON(&confirmation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		err := authService.ResetPassword(c.Request.Context(), confirmation.Token, confirmation.NewPassword)
+		if errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not reset password"})
+			return
+		}
+		clearTokens(c)
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "Password reset successfully, please log in again"})
+	}
+}
+
+// ResendEmailVerificationHandler sends a new verification link to the email of a user, the response is the same for any login.
+func ResendEmailVerificationHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request EmailVerificationRequest
+		if err := c.ShouldBindJSON(&request); err != nil || request.Login == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := authService.ResendEmailVerification(c.Request.Context(), request.Login); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not send a verification link"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "If the account exists and its email is not verified, a verification link has been sent to it"})
+	}
+}
+
+// VerifyEmailHandler verifies the email of a user with the token of its verification link.
+func VerifyEmailHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var confirmation EmailVerificationConfirmation
+		if err := c.ShouldBindJSON(&confirmation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		err := authService.VerifyEmail(c.Request.Context(), confirmation.Token)
+		if errors.Is(err, ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not verify email"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "Your email has been verified"})
+	}
+}
+
+// GetTwoFactorHandler tells if two-factor authentication is on for the user connected.
+func GetTwoFactorHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		status, err := authService.GetTwoFactor(c.Request.Context(), claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get two-factor authentication"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// EnrollTwoFactorHandler gives a new secret to the user connected, or to the user of an enrollment challenge.
+func EnrollTwoFactorHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request TwoFactorRequest
+		// the body is optional when the user is connected
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+				return
+			}
+		}
+		userID, ok := twoFactorUser(c, authService, request.ChallengeToken)
+		if !ok {
+			return
+		}
+		enrollment, err := authService.EnrollTwoFactor(c.Request.Context(), userID)
+		if err != nil {
+			twoFactorError(c, err, "Could not enroll")
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// ConfirmTwoFactorHandler turns two-factor authentication on with a first code, and gives the recovery codes.
+// With an enrollment challenge, the login ends and the tokens are given too.
+func ConfirmTwoFactorHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request TwoFactorRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		userID, ok := twoFactorUser(c, authService, request.ChallengeToken)
+		if !ok {
+			return
+		}
+		recoveryCodes, err := authService.ConfirmTwoFactor(c.Request.Context(), userID, request.Code)
+		if err != nil {
+			twoFactorError(c, err, "Could not enable two-factor authentication")
+			return
+		}
+		response := gin.H{"status": true, "recoveryCodes": recoveryCodes,
+			"message": "Two-factor authentication is enabled, keep your recovery codes in a safe place"}
+		if request.ChallengeToken != "" {
+			tokens, err := authService.CompleteEnrollment(c.Request.Context(), request.ChallengeToken, c.ClientIP(), c.Request.UserAgent())
+			if err != nil {
+				// two-factor authentication is on, the user logs in again with a code
+				c.JSON(http.StatusOK, response)
+				return
+			}
+			SetTokens(c, authService, tokens)
+			response["token"], response["refreshToken"], response["expiresIn"] = tokens.Token, tokens.RefreshToken, tokens.ExpiresIn
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off for the user connected, with a code.
+func DisableTwoFactorHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request TwoFactorRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err := authService.DisableTwoFactor(c.Request.Context(), claims.UserID, request.Code); err != nil {
+			twoFactorError(c, err, "Could not disable two-factor authentication")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "Two-factor authentication is disabled"})
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the user connected, with a code.
+func RegenerateRecoveryCodesHandler(authService AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request TwoFactorRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		recoveryCodes, err := authService.RegenerateRecoveryCodes(c.Request.Context(), claims.UserID, request.Code)
+		if err != nil {
+			twoFactorError(c, err, "Could not generate recovery codes")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "recoveryCodes": recoveryCodes})
+	}
+}
+
+// twoFactorUser returns the user of an enrollment challenge, or the user connected, and writes the response when there is none.
+func twoFactorUser(c *gin.Context, authService AuthService, challengeToken string) (string, bool) {
+	if challengeToken != "" {
+		userID, err := authService.ChallengeUser(c.Request.Context(), challengeToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return "", false
+		}
+		return userID, true
+	}
+	claims, err := utils.GetClaimsFromContext(c)
+	if err != nil || claims.IsAPIKey() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+// twoFactorError writes the response of a two-factor authentication error.
+func twoFactorError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrInvalidChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidTwoFactorCode), errors.Is(err, ErrTwoFactorEnabled), errors.Is(err, ErrTwoFactorDisabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// LoginModel is an attempt to log in, kept in the login history of the user
+type LoginModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId,omitempty"`
+	IP        string             `bson:"ip,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty"`
+	Success   bool               `bson:"success"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+}
+
+// LoginModelToEntity converts a login model to a login entity
+func LoginModelToEntity(login *LoginModel) *LoginEntity {
+	return &LoginEntity{
+		ID:        login.ID.Hex(),
+		UserID:    login.UserID,
+		IP:        login.IP,
+		UserAgent: login.UserAgent,
+		Success:   login.Success,
+		CreatedAt: login.CreatedAt.String(),
+	}
+}
+
+// RefreshTokenModel is a refresh token, only its hash is stored.
+// The tokens of a family come from the same login, each one replaces the one used to get it,
+// and Version is the token version of the user at the login.
+type RefreshTokenModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId"`
+	FamilyID  string             `bson:"familyId"`
+	Hash      string             `bson:"hash"`
+	Version   int                `bson:"version,omitempty"`
+	IP        string             `bson:"ip,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty"`
+}
+
+// RevokedTokenModel is an access token revoked by a logout, kept until it expires
+type RevokedTokenModel struct {
+	ID        string    `bson:"_id"`
+	UserID    string    `bson:"userId"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// SessionModel is a login of a user on a device, its ID is the family of its refresh tokens
+type SessionModel struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	UserID     string             `bson:"userId"`
+	Device     string             `bson:"device,omitempty"`
+	UserAgent  string             `bson:"userAgent,omitempty"`
+	IP         string             `bson:"ip,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty"`
+}
+
+// SessionModelToEntity converts a session model to a session entity
+func SessionModelToEntity(session *SessionModel) *SessionEntity {
+	return &SessionEntity{
+		ID:         session.ID.Hex(),
+		UserID:     session.UserID,
+		Device:     session.Device,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt.String(),
+		LastSeenAt: session.LastSeenAt.String(),
+		ExpiresAt:  session.ExpiresAt.String(),
+	}
+}
+
+// PasswordResetModel is a password reset token, only its hash is stored and it is used once
+type PasswordResetModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId"`
+	Hash      string             `bson:"hash"`
+	IP        string             `bson:"ip,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+}
+
+// EmailVerificationModel is an email verification token, only its hash is stored and it is used once.
+// It verifies the email it was sent to only, the user may have changed it since.
+type EmailVerificationModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId"`
+	Email     string             `bson:"email"`
+	Hash      string             `bson:"hash"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+}
+
+// TwoFactorModel is the TOTP two-factor authentication of a user, its ID is the ID of the user.
+// PendingSecret is the secret of an enrollment not confirmed yet, and LastStep the period of the last code used,
+// a code is used once. Only the hashes of the recovery codes are stored.
+type TwoFactorModel struct {
+	UserID        string     `bson:"_id"`
+	Secret        string     `bson:"secret,omitempty"`
+	PendingSecret string     `bson:"pendingSecret,omitempty"`
+	Enabled       bool       `bson:"enabled"`
+	RecoveryCodes []string   `bson:"recoveryCodes,omitempty"`
+	LastStep      int64      `bson:"lastStep"`
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty"`
+	UpdatedAt     time.Time  `bson:"updatedAt"`
+}
+
+// TwoFactorChallengeModel is the second step of a login, given once the password is checked.
+// Only the hash of its token is stored, and it is used once within a few attempts.
+type TwoFactorChallengeModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId"`
+	Hash      string             `bson:"hash"`
+	Step      string             `bson:"step"`
+	IP        string             `bson:"ip,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty"`
+	Attempts  int                `bson:"attempts"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+}
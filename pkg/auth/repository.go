@@ -7,22 +7,83 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
 )
 
 // AuthRepository defines the interface for authentication repository operations.
 type AuthRepository interface {
 	Login(ctx context.Context, credentials UserCredentials) (*user.UserEntity, error)
-	Logout(ctx context.Context, userID *string) error
+	Logout(ctx context.Context, revoked *RevokedTokenModel) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	GetTokenVersion(ctx context.Context, userID string) (int, error)
+	IncrementTokenVersion(ctx context.Context, userID string) error
+	DeleteExpiredRevocations(ctx context.Context, before time.Time) (int64, error)
+	CreateSession(ctx context.Context, session *SessionModel) error
+	GetSession(ctx context.Context, sessionID string) (*SessionModel, error)
+	GetSessions(ctx context.Context, userID string) ([]*SessionModel, error)
+	RefreshSession(ctx context.Context, sessionID string, ip string, expiresAt time.Time) error
+	SeeSession(ctx context.Context, sessionID primitive.ObjectID, before time.Time) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID string) ([]string, error)
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+	FindUserByLogin(ctx context.Context, login string) (*user.UserEntity, error)
+	CreatePasswordReset(ctx context.Context, reset *PasswordResetModel) error
+	UsePasswordReset(ctx context.Context, hash string) (*PasswordResetModel, error)
+	UpdatePassword(ctx context.Context, userID string, hashedPassword string) error
+	DeleteExpiredPasswordResets(ctx context.Context, before time.Time) (int64, error)
+	CreateEmailVerification(ctx context.Context, verification *EmailVerificationModel) error
+	UseEmailVerification(ctx context.Context, hash string) (*EmailVerificationModel, error)
+	SetEmailVerified(ctx context.Context, userID string, email string) error
+	DeleteExpiredEmailVerifications(ctx context.Context, before time.Time) (int64, error)
+	GetTwoFactor(ctx context.Context, userID string) (*TwoFactorModel, error)
+	SetPendingSecret(ctx context.Context, userID string, secret string) error
+	EnableTwoFactor(ctx context.Context, userID string, secret string, step int64, recoveryCodes []string) (bool, error)
+	DisableTwoFactor(ctx context.Context, userID string) error
+	UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID string, hash string) (bool, error)
+	SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error
+	CreateChallenge(ctx context.Context, challenge *TwoFactorChallengeModel) error
+	AttemptChallenge(ctx context.Context, hash string, maxAttempts int) (*TwoFactorChallengeModel, error)
+	UseChallenge(ctx context.Context, challengeID primitive.ObjectID) (bool, error)
+	DeleteExpiredChallenges(ctx context.Context, before time.Time) (int64, error)
+	RecordLogin(ctx context.Context, login *LoginModel) error
+	GetUser(ctx context.Context, userID string) (*user.UserEntity, error)
+	CreateRefreshToken(ctx context.Context, token *RefreshTokenModel) error
+	GetRefreshToken(ctx context.Context, hash string) (*RefreshTokenModel, error)
+	UseRefreshToken(ctx context.Context, tokenID primitive.ObjectID) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+	DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error)
 }
 
 // authRepository is the concrete implementation of AuthRepository.
 type authRepository struct {
-	collection *mongo.Collection
+	collection              *mongo.Collection
+	collectionLogins        *mongo.Collection
+	collectionRefreshTokens *mongo.Collection
+	collectionRevoked       *mongo.Collection
+	collectionSessions      *mongo.Collection
+	collectionResets        *mongo.Collection
+	collectionVerifications *mongo.Collection
+	collectionTwoFactors    *mongo.Collection
+	collectionChallenges    *mongo.Collection
 }
 
 // NewAuthRepository creates a new instance of AuthRepository.
-func NewAuthRepository(collection *mongo.Collection) AuthRepository {
-	return &authRepository{collection: collection}
+func NewAuthRepository(collection *mongo.Collection, collectionLogins *mongo.Collection, collectionRefreshTokens *mongo.Collection, collectionRevoked *mongo.Collection, collectionSessions *mongo.Collection, collectionResets *mongo.Collection, collectionVerifications *mongo.Collection, collectionTwoFactors *mongo.Collection, collectionChallenges *mongo.Collection) AuthRepository {
+	return &authRepository{
+		collection:              collection,
+		collectionLogins:        collectionLogins,
+		collectionRefreshTokens: collectionRefreshTokens,
+		collectionRevoked:       collectionRevoked,
+		collectionSessions:      collectionSessions,
+		collectionResets:        collectionResets,
+		collectionVerifications: collectionVerifications,
+		collectionTwoFactors:    collectionTwoFactors,
+		collectionChallenges:    collectionChallenges,
+	}
 }
 
 // Login attempts to authenticate a user with the provided credentials.
@@ -38,17 +99,456 @@ func (r *authRepository) Login(ctx context.Context, credentials UserCredentials)
 	return user.ModelToEntity(&foundUser), nil
 }
 
-// Logout logs a user out by invalidating the session or token.
-func (r *authRepository) Logout(ctx context.Context, userID *string) error {
-	// convert userID to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(*userID)
+// Logout logs a user out by revoking its access token until it expires.
+func (r *authRepository) Logout(ctx context.Context, revoked *RevokedTokenModel) error {
+	// a token revoked twice is already revoked
+	_, err := r.collectionRevoked.UpdateOne(ctx, bson.D{{"_id", revoked.ID}}, bson.D{{"$setOnInsert", revoked}}, options.Update().SetUpsert(true))
+	return err
+}
+
+// IsTokenRevoked checks if an access token was revoked.
+func (r *authRepository) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	count, err := r.collectionRevoked.CountDocuments(ctx, bson.D{{"_id", tokenID}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetTokenVersion retrieves the token version of a user.
+func (r *authRepository) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+	var foundUser user.UserModel
+	opts := options.FindOne().SetProjection(bson.D{{"tokenVersion", 1}})
+	err = r.collection.FindOne(ctx, bson.D{{"_id", objectID}}, opts).Decode(&foundUser)
+	if err != nil {
+		return 0, errors.New("user not found")
+	}
+	return foundUser.TokenVersion, nil
+}
+
+// IncrementTokenVersion increases the token version of a user, its tokens issued before are rejected.
+func (r *authRepository) IncrementTokenVersion(ctx context.Context, userID string) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.D{{"_id", objectID}}, bson.D{{"$inc", bson.D{{"tokenVersion", 1}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// DeleteExpiredRevocations removes the revoked tokens expired before a date, they are rejected anyway.
+func (r *authRepository) DeleteExpiredRevocations(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionRevoked.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// RecordLogin adds a login attempt to the login history.
+func (r *authRepository) RecordLogin(ctx context.Context, login *LoginModel) error {
+	login.ID = primitive.NewObjectID()
+	login.CreatedAt = time.Now()
+	_, err := r.collectionLogins.InsertOne(ctx, login)
+	return err
+}
+
+// GetUser retrieves a user by ID, to issue new tokens with its current role.
+func (r *authRepository) GetUser(ctx context.Context, userID string) (*user.UserEntity, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	var foundUser user.UserModel
+	err = r.collection.FindOne(ctx, bson.D{{"_id", objectID}}).Decode(&foundUser)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return user.ModelToEntity(&foundUser), nil
+}
+
+// CreateRefreshToken inserts a refresh token.
+func (r *authRepository) CreateRefreshToken(ctx context.Context, token *RefreshTokenModel) error {
+	token.ID = primitive.NewObjectID()
+	_, err := r.collectionRefreshTokens.InsertOne(ctx, token)
+	return err
+}
+
+// GetRefreshToken retrieves a refresh token by its hash.
+func (r *authRepository) GetRefreshToken(ctx context.Context, hash string) (*RefreshTokenModel, error) {
+	var token RefreshTokenModel
+	err := r.collectionRefreshTokens.FindOne(ctx, bson.D{{"hash", hash}}).Decode(&token)
+	if err != nil {
+		return nil, errors.New(" refresh token not found")
+	}
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token as used, false if it was already used or revoked.
+func (r *authRepository) UseRefreshToken(ctx context.Context, tokenID primitive.ObjectID) (bool, error) {
+	filter := bson.D{{"_id", tokenID}, {"usedAt", nil}, {"revokedAt", nil}}
+	result, err := r.collectionRefreshTokens.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeFamily revokes all the refresh tokens of a login.
+func (r *authRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.collectionRefreshTokens.UpdateMany(ctx, bson.D{{"familyId", familyID}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	return err
+}
+
+// RevokeUserRefreshTokens revokes all the refresh tokens of a user.
+func (r *authRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	_, err := r.collectionRefreshTokens.UpdateMany(ctx, bson.D{{"userId", userID}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	return err
+}
+
+// DeleteExpiredRefreshTokens removes the refresh tokens expired before a date.
+// The used tokens are kept until then, a reuse of one of them revokes its family.
+func (r *authRepository) DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionRefreshTokens.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// CreateSession inserts a session.
+func (r *authRepository) CreateSession(ctx context.Context, session *SessionModel) error {
+	_, err := r.collectionSessions.InsertOne(ctx, session)
+	return err
+}
+
+// GetSession retrieves a session by its ID.
+func (r *authRepository) GetSession(ctx context.Context, sessionID string) (*SessionModel, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var session SessionModel
+	err = r.collectionSessions.FindOne(ctx, bson.D{{"_id", objectID}}).Decode(&session)
+	if err != nil {
+		return nil, errors.New(" session not found")
+	}
+	return &session, nil
+}
+
+// GetSessions retrieves the active sessions of a user, the last seen first.
+func (r *authRepository) GetSessions(ctx context.Context, userID string) ([]*SessionModel, error) {
+	filter := bson.D{{"userId", userID}, {"revokedAt", nil}, {"expiresAt", bson.D{{"$gt", time.Now()}}}}
+	cursor, err := r.collectionSessions.Find(ctx, filter, options.Find().SetSort(bson.D{{"lastSeenAt", -1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*SessionModel{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RefreshSession records a refresh of the tokens of a session.
+func (r *authRepository) RefreshSession(ctx context.Context, sessionID string, ip string, expiresAt time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return err
+	}
+	_, err = r.collectionSessions.UpdateOne(ctx, bson.D{{"_id", objectID}},
+		bson.D{{"$set", bson.D{{"lastSeenAt", time.Now()}, {"ip", ip}, {"expiresAt", expiresAt}}}})
+	return err
+}
+
+// SeeSession updates the last seen time of a session, if it was last seen before a date.
+func (r *authRepository) SeeSession(ctx context.Context, sessionID primitive.ObjectID, before time.Time) error {
+	_, err := r.collectionSessions.UpdateOne(ctx, bson.D{{"_id", sessionID}, {"lastSeenAt", bson.D{{"$lt", before}}}},
+		bson.D{{"$set", bson.D{{"lastSeenAt", time.Now()}}}})
+	return err
+}
+
+// RevokeSession revokes a session.
+func (r *authRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return err
+	}
+	_, err = r.collectionSessions.UpdateOne(ctx, bson.D{{"_id", objectID}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	return err
+}
+
+// RevokeUserSessions revokes all the sessions of a user, and returns their IDs.
+func (r *authRepository) RevokeUserSessions(ctx context.Context, userID string) ([]string, error) {
+	filter := bson.D{{"userId", userID}, {"revokedAt", nil}}
+	cursor, err := r.collectionSessions.Find(ctx, filter, options.Find().SetProjection(bson.D{{"_id", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*SessionModel
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(sessions))
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+		sessionIDs = append(sessionIDs, session.ID.Hex())
+	}
+	_, err = r.collectionSessions.UpdateMany(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	if err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
+
+// DeleteExpiredSessions removes the sessions expired before a date.
+func (r *authRepository) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionSessions.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// FindUserByLogin retrieves a user by username or email, the emails are stored lowercased.
+func (r *authRepository) FindUserByLogin(ctx context.Context, login string) (*user.UserEntity, error) {
+	var foundUser user.UserModel
+	filter := bson.D{{"$or", bson.A{bson.D{{"username", login}}, bson.D{{"email", strings.ToLower(strings.TrimSpace(login))}}}}}
+	err := r.collection.FindOne(ctx, filter).Decode(&foundUser)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return user.ModelToEntity(&foundUser), nil
+}
+
+// CreatePasswordReset inserts a password reset token, the tokens requested before by the user can no longer be used.
+func (r *authRepository) CreatePasswordReset(ctx context.Context, reset *PasswordResetModel) error {
+	_, err := r.collectionResets.UpdateMany(ctx, bson.D{{"userId", reset.UserID}, {"usedAt", nil}},
+		bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}})
+	if err != nil {
+		return err
+	}
+	reset.ID = primitive.NewObjectID()
+	_, err = r.collectionResets.InsertOne(ctx, reset)
+	return err
+}
+
+// UsePasswordReset marks a password reset token as used, once, before it expires.
+func (r *authRepository) UsePasswordReset(ctx context.Context, hash string) (*PasswordResetModel, error) {
+	filter := bson.D{{"hash", hash}, {"usedAt", nil}, {"expiresAt", bson.D{{"$gt", time.Now()}}}}
+	var reset PasswordResetModel
+	err := r.collectionResets.FindOneAndUpdate(ctx, filter, bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}}).Decode(&reset)
+	if err != nil {
+		return nil, errors.New(" password reset token not found")
+	}
+	return &reset, nil
+}
+
+// UpdatePassword sets the password of a user.
+func (r *authRepository) UpdatePassword(ctx context.Context, userID string, hashedPassword string) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.D{{"_id", objectID}},
+		bson.D{{"$set", bson.D{{"password", hashedPassword}, {"updatedAt", time.Now()}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// DeleteExpiredPasswordResets removes the password reset tokens expired before a date.
+func (r *authRepository) DeleteExpiredPasswordResets(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionResets.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// CreateEmailVerification inserts an email verification token, the tokens sent before to the user can no longer be used.
+func (r *authRepository) CreateEmailVerification(ctx context.Context, verification *EmailVerificationModel) error {
+	_, err := r.collectionVerifications.UpdateMany(ctx, bson.D{{"userId", verification.UserID}, {"usedAt", nil}},
+		bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}})
+	if err != nil {
+		return err
+	}
+	verification.ID = primitive.NewObjectID()
+	_, err = r.collectionVerifications.InsertOne(ctx, verification)
+	return err
+}
+
+// UseEmailVerification marks an email verification token as used, once, before it expires.
+func (r *authRepository) UseEmailVerification(ctx context.Context, hash string) (*EmailVerificationModel, error) {
+	filter := bson.D{{"hash", hash}, {"usedAt", nil}, {"expiresAt", bson.D{{"$gt", time.Now()}}}}
+	var verification EmailVerificationModel
+	err := r.collectionVerifications.FindOneAndUpdate(ctx, filter, bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}}).Decode(&verification)
+	if err != nil {
+		return nil, errors.New(" email verification token not found")
+	}
+	return &verification, nil
+}
+
+// SetEmailVerified marks the email of a user as verified, if it is still the email verified.
+func (r *authRepository) SetEmailVerified(ctx context.Context, userID string, email string) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.D{{"_id", objectID}, {"email", email}},
+		bson.D{{"$set", bson.D{{"emailVerified", true}, {"updatedAt", time.Now()}}}})
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// DeleteExpiredEmailVerifications removes the email verification tokens expired before a date.
+func (r *authRepository) DeleteExpiredEmailVerifications(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionVerifications.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
 
-	err = r.collection.FindOne(ctx, bson.D{{"_id", &objectID}}).Err()
+// GetTwoFactor retrieves the two-factor authentication of a user, nil if it never enrolled.
+func (r *authRepository) GetTwoFactor(ctx context.Context, userID string) (*TwoFactorModel, error) {
+	var twoFactor TwoFactorModel
+	err := r.collectionTwoFactors.FindOne(ctx, bson.D{{"_id", userID}}).Decode(&twoFactor)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+// SetPendingSecret starts an enrollment with a new secret, replacing the one of an enrollment not confirmed.
+func (r *authRepository) SetPendingSecret(ctx context.Context, userID string, secret string) error {
+	_, err := r.collectionTwoFactors.UpdateOne(ctx, bson.D{{"_id", userID}},
+		bson.D{
+			{"$set", bson.D{{"pendingSecret", secret}, {"updatedAt", time.Now()}}},
+			{"$setOnInsert", bson.D{{"enabled", false}, {"lastStep", int64(0)}}},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// EnableTwoFactor confirms the enrollment of a pending secret with its recovery codes, false if it was replaced meanwhile.
+func (r *authRepository) EnableTwoFactor(ctx context.Context, userID string, secret string, step int64, recoveryCodes []string) (bool, error) {
+	now := time.Now()
+	result, err := r.collectionTwoFactors.UpdateOne(ctx, bson.D{{"_id", userID}, {"pendingSecret", secret}, {"enabled", false}},
+		bson.D{
+			{"$set", bson.D{{"secret", secret}, {"enabled", true}, {"lastStep", step}, {"recoveryCodes", recoveryCodes},
+				{"enabledAt", now}, {"updatedAt", now}}},
+			{"$unset", bson.D{{"pendingSecret", ""}}},
+		})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DisableTwoFactor removes the two-factor authentication of a user, with its secret and recovery codes.
+func (r *authRepository) DisableTwoFactor(ctx context.Context, userID string) error {
+	_, err := r.collectionTwoFactors.DeleteOne(ctx, bson.D{{"_id", userID}})
+	return err
+}
+
+// UseTwoFactorStep records the period of a code used, false if a code of this period or a later one was already used.
+func (r *authRepository) UseTwoFactorStep(ctx context.Context, userID string, step int64) (bool, error) {
+	result, err := r.collectionTwoFactors.UpdateOne(ctx, bson.D{{"_id", userID}, {"enabled", true}, {"lastStep", bson.D{{"$lt", step}}}},
+		bson.D{{"$set", bson.D{{"lastStep", step}, {"updatedAt", time.Now()}}}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code of a user, false if it is not one of its codes.
+func (r *authRepository) UseRecoveryCode(ctx context.Context, userID string, hash string) (bool, error) {
+	result, err := r.collectionTwoFactors.UpdateOne(ctx, bson.D{{"_id", userID}, {"enabled", true}, {"recoveryCodes", hash}},
+		bson.D{{"$pull", bson.D{{"recoveryCodes", hash}}}, {"$set", bson.D{{"updatedAt", time.Now()}}}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// SetRecoveryCodes replaces the recovery codes of a user.
+func (r *authRepository) SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	result, err := r.collectionTwoFactors.UpdateOne(ctx, bson.D{{"_id", userID}, {"enabled", true}},
+		bson.D{{"$set", bson.D{{"recoveryCodes", recoveryCodes}, {"updatedAt", time.Now()}}}})
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return errors.New(" two-factor authentication not found")
+	}
 	return nil
 }
+
+// CreateChallenge inserts the challenge of a login.
+func (r *authRepository) CreateChallenge(ctx context.Context, challenge *TwoFactorChallengeModel) error {
+	challenge.ID = primitive.NewObjectID()
+	_, err := r.collectionChallenges.InsertOne(ctx, challenge)
+	return err
+}
+
+// AttemptChallenge counts an attempt on a challenge not used nor expired, and returns it while it has attempts left.
+func (r *authRepository) AttemptChallenge(ctx context.Context, hash string, maxAttempts int) (*TwoFactorChallengeModel, error) {
+	filter := bson.D{{"hash", hash}, {"usedAt", nil}, {"expiresAt", bson.D{{"$gt", time.Now()}}}, {"attempts", bson.D{{"$lt", maxAttempts}}}}
+	var challenge TwoFactorChallengeModel
+	err := r.collectionChallenges.FindOneAndUpdate(ctx, filter, bson.D{{"$inc", bson.D{{"attempts", 1}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&challenge)
+	if err != nil {
+		return nil, errors.New(" challenge not found")
+	}
+	return &challenge, nil
+}
+
+// UseChallenge marks a challenge as used, false if it was already used.
+func (r *authRepository) UseChallenge(ctx context.Context, challengeID primitive.ObjectID) (bool, error) {
+	result, err := r.collectionChallenges.UpdateOne(ctx, bson.D{{"_id", challengeID}, {"usedAt", nil}},
+		bson.D{{"$set", bson.D{{"usedAt", time.Now()}}}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DeleteExpiredChallenges removes the login challenges expired before a date.
+func (r *authRepository) DeleteExpiredChallenges(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionChallenges.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -1,26 +1,927 @@
 package auth
 
 import (
+	"chat-app/pkg/mail"
 	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
 	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+var (
+	// ErrInvalidRefreshToken is returned for an unknown, expired or revoked refresh token
+	ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token is used twice, all the tokens of its login are then revoked
+	ErrRefreshTokenReused = errors.New("Refresh token already used, please log in again")
+	// ErrSessionNotFound is returned for a session that does not exist, or not of the user
+	ErrSessionNotFound = errors.New("Session not found")
+	// ErrInvalidResetToken is returned for an unknown, used or expired password reset token
+	ErrInvalidResetToken = errors.New("Invalid or expired password reset link")
+	// ErrPasswordTooShort is returned for a new password too short
+	ErrPasswordTooShort = errors.New("Password must have at least 6 characters")
+	// ErrInvalidVerificationToken is returned for an unknown, used or expired email verification token
+	ErrInvalidVerificationToken = errors.New("Invalid or expired email verification link")
+	// ErrEmailNotVerified is returned when the email of the user has to be verified first
+	ErrEmailNotVerified = errors.New("Please verify your email first")
+	// ErrInvalidChallenge is returned for an unknown, used or expired login challenge, or one with no attempts left
+	ErrInvalidChallenge = errors.New("Invalid or expired login challenge, please log in again")
+	// ErrInvalidTwoFactorCode is returned for a wrong or already used code of the authenticator app, or a wrong recovery code
+	ErrInvalidTwoFactorCode = errors.New("Invalid two-factor authentication code")
+	// ErrTwoFactorEnabled is returned to enroll a user whose two-factor authentication is already on
+	ErrTwoFactorEnabled = errors.New("Two-factor authentication is already enabled")
+	// ErrTwoFactorDisabled is returned to manage the two-factor authentication of a user who has none
+	ErrTwoFactorDisabled = errors.New("Two-factor authentication is not enabled")
+	// ErrTwoFactorRequired is returned to disable the two-factor authentication of a user who must have it
+	ErrTwoFactorRequired = errors.New("Two-factor authentication is required for your account")
+)
+
+// steps of a login challenge
+const (
+	// ChallengeVerify asks for a code of the authenticator app, or a recovery code
+	ChallengeVerify = "verify"
+	// ChallengeEnroll asks to set up two-factor authentication, required for the user, before the login ends
+	ChallengeEnroll = "enroll"
+)
+
+// limits of the login challenges, and number of recovery codes of a user
+const (
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// policies of the email verification, what an unverified user cannot do
+const (
+	// VerificationOptional lets the unverified users do everything
+	VerificationOptional = "optional"
+	// VerificationPost stops the unverified users from sending messages
+	VerificationPost = "post"
+	// VerificationLogin stops the unverified users from logging in
+	VerificationLogin = "login"
+)
+
+// SessionCloser closes the live connections of a revoked session
+type SessionCloser func(sessionID string)
+
+// seenInterval is how often the last seen time of a session is updated
+const seenInterval = time.Minute
+
+// Config holds the lifetime of the refresh tokens, of the password reset and email verification links, and the email verification policy
+type Config struct {
+	// RefreshTokenTTL is how long a refresh token can be used, each refresh gives a new one
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL is how long a password reset link can be used
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is the page of the password reset links, the token is added as the token query parameter
+	PasswordResetURL string
+	// EmailVerificationTTL is how long an email verification link can be used
+	EmailVerificationTTL time.Duration
+	// EmailVerificationURL is the page of the email verification links, with the token query parameter
+	EmailVerificationURL string
+	// EmailVerification is the policy of the unverified users: optional, post or login
+	EmailVerification string
+	// TwoFactorIssuer is the name of the accounts in the authenticator apps
+	TwoFactorIssuer string
+	// TwoFactorAdmins requires two-factor authentication for the admins, they enroll on their next login
+	TwoFactorAdmins bool
+}
+
+// ConfigFromEnv reads the lifetimes from the environment, 30 days for the refresh tokens, 1 hour for the reset links
+// and 2 days for the verification links by default. The emails do not have to be verified by default.
+func ConfigFromEnv() Config {
+	config := Config{
+		RefreshTokenTTL:      30 * 24 * time.Hour,
+		PasswordResetTTL:     time.Hour,
+		PasswordResetURL:     "http://localhost:8080/reset-password",
+		EmailVerificationTTL: 48 * time.Hour,
+		EmailVerificationURL: "http://localhost:8080/verify-email",
+		EmailVerification:    VerificationOptional,
+		TwoFactorIssuer:      "chat-app",
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		config.RefreshTokenTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL")); err == nil && ttl > 0 {
+		config.PasswordResetTTL = ttl
+	}
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		config.PasswordResetURL = resetURL
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_TTL")); err == nil && ttl > 0 {
+		config.EmailVerificationTTL = ttl
+	}
+	if verifyURL := os.Getenv("EMAIL_VERIFICATION_URL"); verifyURL != "" {
+		config.EmailVerificationURL = verifyURL
+	}
+	switch policy := strings.ToLower(os.Getenv("EMAIL_VERIFICATION_REQUIRED")); policy {
+	case VerificationPost, VerificationLogin:
+		config.EmailVerification = policy
+	}
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		config.TwoFactorIssuer = issuer
+	}
+	if required, err := strconv.ParseBool(os.Getenv("TWO_FACTOR_REQUIRED_ADMIN")); err == nil {
+		config.TwoFactorAdmins = required
+	}
+	return config
+}
+
 type AuthService interface {
 	LoginUser(ctx context.Context, userLogin *UserCredentials) (*user.UserEntity, error)
-	LogoutUser(ctx context.Context, id *string) error
+	LogoutUser(ctx context.Context, claims *utils.Claims) error
+	LogoutEverywhere(ctx context.Context, userID string) error
+	IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error)
+	GetSessions(ctx context.Context, userID string, currentSessionID string) ([]*SessionEntity, error)
+	RevokeSession(ctx context.Context, userID string, sessionID string) error
+	RequestPasswordReset(ctx context.Context, login string, ip string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	SendEmailVerification(ctx context.Context, u *user.UserEntity) error
+	ResendEmailVerification(ctx context.Context, login string) error
+	VerifyEmail(ctx context.Context, token string) error
+	CheckEmailVerified(ctx context.Context, userID string) error
+	EmailRequired() bool
+	LoginChallenge(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*TwoFactorChallengeEntity, error)
+	CompleteLogin(ctx context.Context, challengeToken string, code string, ip string, userAgent string) (*TokenEntity, error)
+	ChallengeUser(ctx context.Context, challengeToken string) (string, error)
+	CompleteEnrollment(ctx context.Context, challengeToken string, ip string, userAgent string) (*TokenEntity, error)
+	GetTwoFactor(ctx context.Context, userID string) (*TwoFactorStatusEntity, error)
+	EnrollTwoFactor(ctx context.Context, userID string) (*TwoFactorEnrollmentEntity, error)
+	ConfirmTwoFactor(ctx context.Context, userID string, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID string, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID string, code string) ([]string, error)
+	Start(ctx context.Context)
+	RecordLogin(ctx context.Context, userID string, ip string, userAgent string, success bool)
+	IssueTokens(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*TokenEntity, error)
+	Refresh(ctx context.Context, refreshToken string, ip string, userAgent string) (*TokenEntity, error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+	Config() Config
 }
 
 type authService struct {
-	repo AuthRepository
+	repo         AuthRepository
+	config       Config
+	closeSession SessionCloser
+	mailer       mail.Mailer
 }
 
-func NewAuthService(repo AuthRepository) AuthService {
-	return &authService{repo: repo}
+func NewAuthService(repo AuthRepository, config Config, closeSession SessionCloser, mailer mail.Mailer) AuthService {
+	return &authService{repo: repo, config: config, closeSession: closeSession, mailer: mailer}
 }
 
 func (s *authService) LoginUser(ctx context.Context, userLogin *UserCredentials) (*user.UserEntity, error) {
 	return s.repo.Login(ctx, *userLogin)
 }
-func (s *authService) LogoutUser(ctx context.Context, id *string) error {
-	return s.repo.Logout(ctx, id)
+
+// LogoutUser revokes an access token until it expires, and ends its session
+func (s *authService) LogoutUser(ctx context.Context, claims *utils.Claims) error {
+	err := s.repo.Logout(ctx, &RevokedTokenModel{ID: claims.Id, UserID: claims.UserID, ExpiresAt: time.Unix(claims.ExpiresAt, 0)})
+	if err != nil {
+		return err
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	return s.endSession(ctx, claims.SessionID)
+}
+
+// LogoutEverywhere revokes all the access tokens, refresh tokens and sessions of a user, on all its devices
+func (s *authService) LogoutEverywhere(ctx context.Context, userID string) error {
+	if err := s.repo.IncrementTokenVersion(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	sessionIDs, err := s.repo.RevokeUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		s.close(sessionID)
+	}
+	return nil
+}
+
+// IsRevoked checks if an access token was revoked by a logout, with its session, or by a logout everywhere.
+// The last seen time of the session is updated on the way.
+func (s *authService) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	revoked, err := s.repo.IsTokenRevoked(ctx, claims.Id)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	if claims.SessionID != "" {
+		session, err := s.repo.GetSession(ctx, claims.SessionID)
+		if err != nil || session.RevokedAt != nil || session.UserID != claims.UserID {
+			return true, nil
+		}
+		if time.Since(session.LastSeenAt) > seenInterval {
+			if err := s.repo.SeeSession(ctx, session.ID, time.Now().Add(-seenInterval)); err != nil {
+				log.Printf("Failed to update the session %s: %v", claims.SessionID, err)
+			}
+		}
+	}
+	version, err := s.repo.GetTokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	return claims.Version < version, nil
+}
+
+// GetSessions returns the active sessions of a user, marking the current one
+func (s *authService) GetSessions(ctx context.Context, userID string, currentSessionID string) ([]*SessionEntity, error) {
+	sessions, err := s.repo.GetSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*SessionEntity, 0, len(sessions))
+	for _, session := range sessions {
+		entity := SessionModelToEntity(session)
+		entity.Current = entity.ID == currentSessionID
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// RevokeSession ends a session of a user: its tokens can no longer be used and its live connections are closed
+func (s *authService) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	return s.endSession(ctx, sessionID)
+}
+
+// RequestPasswordReset sends a password reset link to the email of a user.
+// Nothing tells if the user exists: an unknown user, or a user without email, gets no email and no error.
+func (s *authService) RequestPasswordReset(ctx context.Context, login string, ip string) error {
+	foundUser, err := s.repo.FindUserByLogin(ctx, login)
+	if err != nil || foundUser.Email == "" {
+		return nil
+	}
+	token, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.repo.CreatePasswordReset(ctx, &PasswordResetModel{
+		UserID:    foundUser.ID,
+		Hash:      utils.HashToken(token),
+		IP:        ip,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+	s.send(&mail.Message{
+		To:      foundUser.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nTo choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If you did not ask for it, you can ignore this email, your password stays the same.\n",
+			foundUser.Username, s.config.PasswordResetTTL, tokenLink(s.config.PasswordResetURL, token)),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a password reset token, then logs the user out everywhere
+func (s *authService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	if len(newPassword) < 6 {
+		return ErrPasswordTooShort
+	}
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	reset, err := s.repo.UsePasswordReset(ctx, utils.HashToken(token))
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := s.repo.UpdatePassword(ctx, reset.UserID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.LogoutEverywhere(ctx, reset.UserID); err != nil {
+		return err
+	}
+	if foundUser, err := s.repo.GetUser(ctx, reset.UserID); err == nil && foundUser.Email != "" {
+		s.send(&mail.Message{
+			To:      foundUser.Email,
+			Subject: "Your password was changed",
+			Body: fmt.Sprintf("Hello %s,\n\nYour password was reset and you were logged out of all your devices.\n"+
+				"If you did not do it, please contact the administrator.\n", foundUser.Username),
+		})
+	}
+	return nil
+}
+
+// SendEmailVerification sends a verification link to the email of a user, the links sent before can no longer be used
+func (s *authService) SendEmailVerification(ctx context.Context, u *user.UserEntity) error {
+	if u.ID == "" || u.Email == "" {
+		return errors.New("the user has no email")
+	}
+	token, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.repo.CreateEmailVerification(ctx, &EmailVerificationModel{
+		UserID:    u.ID,
+		Email:     u.Email,
+		Hash:      utils.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+	s.send(&mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nTo verify your email, open this link within %s:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n",
+			u.Username, s.config.EmailVerificationTTL, tokenLink(s.config.EmailVerificationURL, token)),
+	})
+	return nil
+}
+
+// ResendEmailVerification sends a new verification link to the email of a user.
+// Like the password reset, nothing tells if the user exists or if its email is already verified.
+func (s *authService) ResendEmailVerification(ctx context.Context, login string) error {
+	foundUser, err := s.repo.FindUserByLogin(ctx, login)
+	if err != nil || foundUser.Email == "" || foundUser.EmailVerified {
+		return nil
+	}
+	return s.SendEmailVerification(ctx, foundUser)
+}
+
+// VerifyEmail marks the email of a user as verified with the token of its link
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidVerificationToken
+	}
+	verification, err := s.repo.UseEmailVerification(ctx, utils.HashToken(token))
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	// the link of an email the user no longer has verifies nothing
+	if err := s.repo.SetEmailVerified(ctx, verification.UserID, verification.Email); err != nil {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// CheckEmailVerified returns ErrEmailNotVerified when the policy stops a user without a verified email from posting.
+// The admins are never stopped, they may have no email.
+func (s *authService) CheckEmailVerified(ctx context.Context, userID string) error {
+	if !s.EmailRequired() {
+		return nil
+	}
+	foundUser, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// the bots have no email
+	if !foundUser.EmailVerified && foundUser.Role != "admin" && foundUser.Role != "bot" {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// EmailRequired tells if the emails have to be verified, to post or to log in
+func (s *authService) EmailRequired() bool {
+	return s.config.EmailVerification == VerificationPost || s.config.EmailVerification == VerificationLogin
+}
+
+// LoginChallenge starts the second step of a login once the password is checked, when the user has two-factor authentication
+// or must set it up. It returns nil when the login ends with the password.
+func (s *authService) LoginChallenge(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*TwoFactorChallengeEntity, error) {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, authenticatedUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	step := ChallengeVerify
+	if twoFactor == nil || !twoFactor.Enabled {
+		if !s.twoFactorRequired(authenticatedUser) {
+			return nil, nil
+		}
+		step = ChallengeEnroll
+	}
+	token, err := utils.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.repo.CreateChallenge(ctx, &TwoFactorChallengeModel{
+		UserID:    authenticatedUser.ID,
+		Hash:      utils.HashToken(token),
+		Step:      step,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(challengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallengeEntity{ChallengeToken: token, Step: step, ExpiresIn: int(challengeTTL.Seconds())}, nil
+}
+
+// CompleteLogin ends a login with a code of the authenticator app or a recovery code, and issues the tokens
+func (s *authService) CompleteLogin(ctx context.Context, challengeToken string, code string, ip string, userAgent string) (*TokenEntity, error) {
+	challenge, err := s.challenge(ctx, challengeToken, ChallengeVerify)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return nil, ErrInvalidChallenge
+	}
+	if err := s.checkCode(ctx, twoFactor, code); err != nil {
+		s.RecordLogin(ctx, challenge.UserID, ip, userAgent, false)
+		return nil, err
+	}
+	return s.finishChallenge(ctx, challenge, ip, userAgent)
+}
+
+// ChallengeUser returns the user of an enrollment challenge, to enroll before the first login ends
+func (s *authService) ChallengeUser(ctx context.Context, challengeToken string) (string, error) {
+	challenge, err := s.challenge(ctx, challengeToken, ChallengeEnroll)
+	if err != nil {
+		return "", err
+	}
+	return challenge.UserID, nil
+}
+
+// CompleteEnrollment ends the login of an enrollment challenge once two-factor authentication is on, and issues the tokens
+func (s *authService) CompleteEnrollment(ctx context.Context, challengeToken string, ip string, userAgent string) (*TokenEntity, error) {
+	challenge, err := s.challenge(ctx, challengeToken, ChallengeEnroll)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return nil, ErrTwoFactorDisabled
+	}
+	return s.finishChallenge(ctx, challenge, ip, userAgent)
+}
+
+// GetTwoFactor tells if two-factor authentication is on for a user, and how many recovery codes it has left
+func (s *authService) GetTwoFactor(ctx context.Context, userID string) (*TwoFactorStatusEntity, error) {
+	foundUser, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatusEntity{Required: s.twoFactorRequired(foundUser)}
+	if twoFactor != nil && twoFactor.Enabled {
+		status.Enabled = true
+		status.RecoveryCodesLeft = len(twoFactor.RecoveryCodes)
+	}
+	return status, nil
+}
+
+// EnrollTwoFactor gives a new secret to add to an authenticator app, two-factor authentication is on once a code is confirmed
+func (s *authService) EnrollTwoFactor(ctx context.Context, userID string) (*TwoFactorEnrollmentEntity, error) {
+	foundUser, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingSecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollmentEntity{Secret: secret, URI: provisioningURI(s.config.TwoFactorIssuer, foundUser.Username, secret)}, nil
+}
+
+// ConfirmTwoFactor turns two-factor authentication on with a first code of the new secret, and returns the recovery codes, shown once
+func (s *authService) ConfirmTwoFactor(ctx context.Context, userID string, code string) ([]string, error) {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if twoFactor == nil || twoFactor.PendingSecret == "" {
+		return nil, ErrTwoFactorDisabled
+	}
+	step, ok := checkTOTP(twoFactor.PendingSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.repo.EnableTwoFactor(ctx, userID, twoFactor.PendingSecret, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	// another enrollment replaced the secret meanwhile
+	if !enabled {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off with a code, unless it is required for the user
+func (s *authService) DisableTwoFactor(ctx context.Context, userID string, code string) error {
+	foundUser, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.twoFactorRequired(foundUser) {
+		return ErrTwoFactorRequired
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return ErrTwoFactorDisabled
+	}
+	if err := s.checkCode(ctx, twoFactor, code); err != nil {
+		return err
+	}
+	return s.repo.DisableTwoFactor(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with new ones, with a code
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userID string, code string) ([]string, error) {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return nil, ErrTwoFactorDisabled
+	}
+	if err := s.checkCode(ctx, twoFactor, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Start removes the expired tokens, sessions and login challenges every hour until the context is done
+func (s *authService) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if _, err := s.repo.DeleteExpiredRevocations(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired revoked tokens: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredSessions(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired sessions: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredRefreshTokens(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired refresh tokens: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredPasswordResets(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired password reset tokens: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredEmailVerifications(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired email verification tokens: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredChallenges(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired login challenges: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordLogin adds a login attempt to the login history of a user, a failure to record it does not stop the login
+func (s *authService) RecordLogin(ctx context.Context, userID string, ip string, userAgent string, success bool) {
+	err := s.repo.RecordLogin(ctx, &LoginModel{UserID: userID, IP: ip, UserAgent: userAgent, Success: success})
+	if err != nil {
+		log.Printf("Failed to record login of user %s: %v", userID, err)
+	}
+}
+
+// IssueTokens starts a session, and gives its access token and its first refresh token
+func (s *authService) IssueTokens(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*TokenEntity, error) {
+	now := time.Now()
+	session := &SessionModel{
+		ID:         primitive.NewObjectID(),
+		UserID:     authenticatedUser.ID,
+		Device:     deviceName(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.config.RefreshTokenTTL),
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, authenticatedUser, session.ID.Hex(), ip, userAgent)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token is used once: using it again means it was stolen, and the whole login is revoked.
+func (s *authService) Refresh(ctx context.Context, refreshToken string, ip string, userAgent string) (*TokenEntity, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	stored, err := s.repo.GetRefreshToken(ctx, utils.HashToken(refreshToken))
+	if err != nil || stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		s.revokeFamily(ctx, stored)
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	// two requests with the same token, only one of them gets the new tokens
+	used, err := s.repo.UseRefreshToken(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		s.revokeFamily(ctx, stored)
+		return nil, ErrRefreshTokenReused
+	}
+
+	// the role and the validity of the user may have changed since the login, or it logged out everywhere
+	authenticatedUser, err := s.repo.GetUser(ctx, stored.UserID)
+	if err != nil || authenticatedUser.Validity != "valid" || stored.Version < authenticatedUser.TokenVersion {
+		s.revokeFamily(ctx, stored)
+		return nil, ErrInvalidRefreshToken
+	}
+	// a user who must enroll in two-factor authentication logs in again to do it
+	if enroll, err := s.mustEnroll(ctx, authenticatedUser); err != nil || enroll {
+		s.revokeFamily(ctx, stored)
+		return nil, ErrInvalidRefreshToken
+	}
+	// the session may have been revoked while its refresh token was not used
+	session, err := s.repo.GetSession(ctx, stored.FamilyID)
+	if err != nil || session.RevokedAt != nil {
+		s.revokeFamily(ctx, stored)
+		return nil, ErrInvalidRefreshToken
+	}
+	tokens, err := s.issue(ctx, authenticatedUser, stored.FamilyID, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RefreshSession(ctx, stored.FamilyID, ip, time.Now().Add(s.config.RefreshTokenTTL)); err != nil {
+		log.Printf("Failed to update the session %s: %v", stored.FamilyID, err)
+	}
+	return tokens, nil
+}
+
+// RevokeRefreshToken ends the session of a refresh token, on logout
+func (s *authService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	stored, err := s.repo.GetRefreshToken(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	return s.endSession(ctx, stored.FamilyID)
+}
+
+// Config returns the lifetime of the refresh tokens
+func (s *authService) Config() Config {
+	return s.config
+}
+
+// issue creates an access token and a refresh token of a session
+func (s *authService) issue(ctx context.Context, authenticatedUser *user.UserEntity, sessionID string, ip string, userAgent string) (*TokenEntity, error) {
+	token, err := utils.GenerateToken(&authenticatedUser.Username, &authenticatedUser.ID, &authenticatedUser.Role, authenticatedUser.TokenVersion, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.repo.CreateRefreshToken(ctx, &RefreshTokenModel{
+		UserID:    authenticatedUser.ID,
+		FamilyID:  sessionID,
+		Hash:      utils.HashToken(refreshToken),
+		Version:   authenticatedUser.TokenVersion,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenEntity{Token: token, RefreshToken: refreshToken, ExpiresIn: int(utils.AccessTokenTTL().Seconds())}, nil
+}
+
+// twoFactorRequired tells if the policy requires two-factor authentication for a user
+func (s *authService) twoFactorRequired(u *user.UserEntity) bool {
+	return s.config.TwoFactorAdmins && u.Role == "admin"
+}
+
+// mustEnroll tells if a user must set up two-factor authentication before it can log in
+func (s *authService) mustEnroll(ctx context.Context, u *user.UserEntity) (bool, error) {
+	if !s.twoFactorRequired(u) {
+		return false, nil
+	}
+	twoFactor, err := s.repo.GetTwoFactor(ctx, u.ID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor == nil || !twoFactor.Enabled, nil
+}
+
+// challenge counts an attempt on a login challenge of a step
+func (s *authService) challenge(ctx context.Context, challengeToken string, step string) (*TwoFactorChallengeModel, error) {
+	if challengeToken == "" {
+		return nil, ErrInvalidChallenge
+	}
+	challenge, err := s.repo.AttemptChallenge(ctx, utils.HashToken(challengeToken), maxChallengeAttempts)
+	if err != nil || challenge.Step != step {
+		return nil, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// finishChallenge uses a login challenge, once, and issues the tokens of its user
+func (s *authService) finishChallenge(ctx context.Context, challenge *TwoFactorChallengeModel, ip string, userAgent string) (*TokenEntity, error) {
+	used, err := s.repo.UseChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidChallenge
+	}
+	// the user may have been banned since the password was checked
+	authenticatedUser, err := s.repo.GetUser(ctx, challenge.UserID)
+	if err != nil || authenticatedUser.Validity != "valid" {
+		return nil, ErrInvalidChallenge
+	}
+	tokens, err := s.IssueTokens(ctx, authenticatedUser, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	s.RecordLogin(ctx, authenticatedUser.ID, ip, userAgent, true)
+	return tokens, nil
+}
+
+// checkCode checks a code of the authenticator app, used once, or uses a recovery code
+func (s *authService) checkCode(ctx context.Context, twoFactor *TwoFactorModel, code string) error {
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := checkTOTP(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		// a code seen by someone else cannot be used again
+		used, err := s.repo.UseTwoFactorStep(ctx, twoFactor.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	used, err := s.repo.UseRecoveryCode(ctx, twoFactor.UserID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns new recovery codes, and their hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// revokeFamily ends the session of a refresh token
+func (s *authService) revokeFamily(ctx context.Context, stored *RefreshTokenModel) {
+	if err := s.endSession(ctx, stored.FamilyID); err != nil {
+		log.Printf("Failed to revoke the refresh tokens of user %s: %v", stored.UserID, err)
+	}
+}
+
+// endSession revokes a session and its refresh tokens, and closes its live connections
+func (s *authService) endSession(ctx context.Context, sessionID string) error {
+	if err := s.repo.RevokeFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	s.close(sessionID)
+	return nil
+}
+
+// send sends an email in background, so the response does not tell if an email was sent
+func (s *authService) send(msg *mail.Message) {
+	if s.mailer == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send the email %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// tokenLink adds a password reset or email verification token to the page of the links
+func tokenLink(page string, token string) string {
+	link, err := url.Parse(page)
+	if err != nil {
+		return page + "?token=" + token
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// close closes the live connections of a session
+func (s *authService) close(sessionID string) {
+	if s.closeSession != nil {
+		s.closeSession(sessionID)
+	}
+}
+
+// deviceName describes the browser and the system of a user agent, like "Firefox on Linux"
+func deviceName(userAgent string) string {
+	browser, system := "Unknown browser", ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"}, {"PostmanRuntime/", "Postman"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Android", "Android"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			system = o.name
+			break
+		}
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
 }
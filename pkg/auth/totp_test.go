@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors of RFC 6238
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// the vectors of RFC 6238 have 8 digits, the codes are their last 6
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	key := []byte("12345678901234567890")
+	for _, test := range tests {
+		want := test.code[len(test.code)-totpDigits:]
+		if got := totpCode(key, test.unix/totpPeriod); got != want {
+			t.Errorf("at %d got %s, want %s", test.unix, got, want)
+		}
+		step, ok := checkTOTP(rfcSecret, want, time.Unix(test.unix, 0))
+		if !ok || step != test.unix/totpPeriod {
+			t.Errorf("at %d the code %s was not accepted", test.unix, want)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	// 1111111111 is in the period 37037037, 081804 is the code of the period before
+	if step, ok := checkTOTP(strings.ToLower(rfcSecret), "081804", now); !ok || step != 37037036 {
+		t.Fatalf("got %d %v for the code of the period before", step, ok)
+	}
+	if _, ok := checkTOTP(rfcSecret, "081804", now.Add(2*totpPeriod*time.Second)); ok {
+		t.Fatal("a code two periods old was accepted")
+	}
+	for _, code := range []string{"000000", "50471", "0050471", ""} {
+		if _, ok := checkTOTP(rfcSecret, code, now); ok {
+			t.Errorf("the code %q was accepted", code)
+		}
+	}
+	if _, ok := checkTOTP("not base32!", "050471", now); ok {
+		t.Fatal("an invalid secret was accepted")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 || strings.Contains(secret, "=") {
+		t.Fatalf("got the secret %q: %v", secret, err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(provisioningURI("Chat App", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chat App:alice@example.com" ||
+		query.Get("secret") != rfcSecret || query.Get("issuer") != "Chat App" || query.Get("digits") != "6" ||
+		query.Get("period") != "30" || query.Get("algorithm") != "SHA1" || strings.Contains(uri.RawQuery, "+") {
+		t.Fatalf("got %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := newRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' || isTOTPCode(code) {
+		t.Fatalf("got %q", code)
+	}
+	if normalizeRecoveryCode(" 4F2A9-C81D0") != "4f2a9c81d0" {
+		t.Fatalf("got %q", normalizeRecoveryCode(" 4F2A9-C81D0"))
+	}
+	if !isTOTPCode("081804") || isTOTPCode("08180a") || isTOTPCode("0818040") {
+		t.Fatal("isTOTPCode does not check the form of the codes")
+	}
+}
@@ -0,0 +1,38 @@
+package bot
+
+// BotEntity is a bot, a user account of an integration that posts with API keys
+type BotEntity struct {
+	ID          string `json:"_id"`
+	Username    string `json:"username"`
+	OwnerID     string `json:"ownerId"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// CreateBotRequest creates a bot owned by the user connected
+type CreateBotRequest struct {
+	Username    string `json:"username"`
+	Description string `json:"description,omitempty"`
+}
+
+// APIKeyEntity is an API key of a bot, the key itself is only shown when it is created
+type APIKeyEntity struct {
+	ID         string   `json:"_id"`
+	BotID      string   `json:"botId"`
+	Name       string   `json:"name,omitempty"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	Expired    bool     `json:"expired"`
+	Revoked    bool     `json:"revoked"`
+}
+
+// CreateAPIKeyRequest creates an API key with scopes, like "messages:write" or "messages:write:<room ID>"
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is the number of days the key is valid, it does not expire when 0
+	ExpiresInDays int `json:"expiresInDays,omitempty"`
+}
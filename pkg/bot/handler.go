@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"regexp"
+)
+
+// usernamePattern is the convention of the usernames, the same as the users
+var usernamePattern = regexp.MustCompile("^[a-zA-Z0-9_]*$")
+
+// CreateBotHandler creates a bot owned by the user connected.
+func CreateBotHandler(botService BotService, userService user.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		var request CreateBotRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		// the username of a bot follows the convention of the users
+		if len(request.Username) < 3 || len(request.Username) > 10 || !usernamePattern.MatchString(request.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid username"})
+			return
+		}
+		if len(request.Description) > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Description is too long"})
+			return
+		}
+		if err := userService.CheckUsername(c.Request.Context(), request.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+			return
+		}
+		bot, err := botService.CreateBot(c.Request.Context(), claims.UserID, claims.Role, &request)
+		if errors.Is(err, ErrTooManyBots) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not create the bot"})
+			return
+		}
+		c.JSON(http.StatusOK, bot)
+	}
+}
+
+// GetBotsHandler lists the bots of the user connected, or all the bots for an admin.
+func GetBotsHandler(botService BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		bots, err := botService.GetBots(c.Request.Context(), claims.UserID, claims.Role)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get the bots"})
+			return
+		}
+		c.JSON(http.StatusOK, bots)
+	}
+}
+
+// DeleteBotHandler deletes a bot of the user connected, with its API keys.
+func DeleteBotHandler(botService BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err := botService.DeleteBot(c.Request.Context(), claims.UserID, claims.Role, c.Param("id")); err != nil {
+			botError(c, err, "Could not delete the bot")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "The bot has been deleted"})
+	}
+}
+
+// CreateAPIKeyHandler creates an API key for a bot of the user connected, the key is only shown in this response.
+func CreateAPIKeyHandler(botService BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		var request CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if len(request.Name) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name is too long"})
+			return
+		}
+		key, apiKey, err := botService.CreateAPIKey(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"), &request)
+		if err != nil {
+			botError(c, err, "Could not create the API key")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"key": key, "apiKey": apiKey, "message": "Copy the key now, it will not be shown again"})
+	}
+}
+
+// GetAPIKeysHandler lists the API keys of a bot of the user connected.
+func GetAPIKeysHandler(botService BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		keys, err := botService.GetAPIKeys(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"))
+		if err != nil {
+			botError(c, err, "Could not get the API keys")
+			return
+		}
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// RevokeAPIKeyHandler revokes an API key of a bot of the user connected.
+func RevokeAPIKeyHandler(botService BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err := botService.RevokeAPIKey(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"), c.Param("keyId")); err != nil {
+			botError(c, err, "Could not revoke the API key")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "The API key has been revoked"})
+	}
+}
+
+// botError writes the response of a bot or API key error.
+func botError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrBotNotFound), errors.Is(err, ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrScopeNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidScope), errors.Is(err, ErrInvalidExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// BotModel is a bot, its account is a user with the bot role and the same ID
+type BotModel struct {
+	ID          string    `bson:"_id"`
+	OwnerID     string    `bson:"ownerId"`
+	Description string    `bson:"description,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+// APIKeyModel is an API key of a bot, only its hash is stored, and its prefix to recognize it
+type APIKeyModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	BotID     string             `bson:"botId"`
+	Name      string             `bson:"name,omitempty"`
+	Prefix    string             `bson:"prefix"`
+	Hash      string             `bson:"hash"`
+	Scopes    []string           `bson:"scopes"`
+	CreatedBy string             `bson:"createdBy"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	// ExpiresAt is zero for a key that does not expire
+	ExpiresAt  time.Time  `bson:"expiresAt,omitempty"`
+	LastUsedAt time.Time  `bson:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `bson:"revokedAt,omitempty"`
+}
+
+// ModelToEntity converts a bot model to a bot entity, with the username of its account
+func ModelToEntity(bot *BotModel, username string) *BotEntity {
+	return &BotEntity{
+		ID:          bot.ID,
+		Username:    username,
+		OwnerID:     bot.OwnerID,
+		Description: bot.Description,
+		CreatedAt:   bot.CreatedAt.String(),
+	}
+}
+
+// APIKeyModelToEntity converts an API key model to an API key entity
+func APIKeyModelToEntity(key *APIKeyModel) *APIKeyEntity {
+	entity := &APIKeyEntity{
+		ID:        key.ID.Hex(),
+		BotID:     key.BotID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.String(),
+		Revoked:   key.RevokedAt != nil,
+	}
+	if !key.ExpiresAt.IsZero() {
+		entity.ExpiresAt = key.ExpiresAt.String()
+		entity.Expired = time.Now().After(key.ExpiresAt)
+	}
+	if !key.LastUsedAt.IsZero() {
+		entity.LastUsedAt = key.LastUsedAt.String()
+	}
+	return entity
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// BotRepository defines the storage of the bots and of their API keys
+type BotRepository interface {
+	CreateBot(ctx context.Context, bot *BotModel) error
+	GetBot(ctx context.Context, botID string) (*BotModel, error)
+	GetBots(ctx context.Context, ownerID string) ([]*BotModel, error)
+	CountBots(ctx context.Context, ownerID string) (int64, error)
+	DeleteBot(ctx context.Context, botID string) error
+	CreateAPIKey(ctx context.Context, key *APIKeyModel) error
+	GetAPIKeys(ctx context.Context, botID string) ([]*APIKeyModel, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKeyModel, error)
+	UseAPIKey(ctx context.Context, keyID primitive.ObjectID, usedBefore time.Time) error
+	RevokeAPIKey(ctx context.Context, botID string, keyID string) error
+	RevokeAPIKeys(ctx context.Context, botID string) error
+}
+
+// botRepository stores the bots and their API keys in MongoDB
+type botRepository struct {
+	collection       *mongo.Collection
+	collectionAPIKey *mongo.Collection
+}
+
+// NewBotRepository creates a new bot repository
+func NewBotRepository(collection *mongo.Collection, collectionAPIKey *mongo.Collection) BotRepository {
+	return &botRepository{collection: collection, collectionAPIKey: collectionAPIKey}
+}
+
+// CreateBot inserts a bot
+func (r *botRepository) CreateBot(ctx context.Context, bot *BotModel) error {
+	_, err := r.collection.InsertOne(ctx, bot)
+	return err
+}
+
+// GetBot retrieves a bot by ID
+func (r *botRepository) GetBot(ctx context.Context, botID string) (*BotModel, error) {
+	var bot BotModel
+	if err := r.collection.FindOne(ctx, bson.D{{"_id", botID}}).Decode(&bot); err != nil {
+		return nil, errors.New(" bot not found")
+	}
+	return &bot, nil
+}
+
+// GetBots retrieves the bots of an owner, or all the bots when the owner is empty
+func (r *botRepository) GetBots(ctx context.Context, ownerID string) ([]*BotModel, error) {
+	filter := bson.D{}
+	if ownerID != "" {
+		filter = bson.D{{"ownerId", ownerID}}
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{"createdAt", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var bots []*BotModel
+	if err := cursor.All(ctx, &bots); err != nil {
+		return nil, err
+	}
+	return bots, nil
+}
+
+// CountBots counts the bots of an owner
+func (r *botRepository) CountBots(ctx context.Context, ownerID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.D{{"ownerId", ownerID}})
+}
+
+// DeleteBot removes a bot
+func (r *botRepository) DeleteBot(ctx context.Context, botID string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.D{{"_id", botID}})
+	return err
+}
+
+// CreateAPIKey inserts an API key
+func (r *botRepository) CreateAPIKey(ctx context.Context, key *APIKeyModel) error {
+	key.ID = primitive.NewObjectID()
+	_, err := r.collectionAPIKey.InsertOne(ctx, key)
+	return err
+}
+
+// GetAPIKeys retrieves the API keys of a bot, revoked and expired ones included
+func (r *botRepository) GetAPIKeys(ctx context.Context, botID string) ([]*APIKeyModel, error) {
+	cursor, err := r.collectionAPIKey.Find(ctx, bson.D{{"botId", botID}}, options.Find().SetSort(bson.D{{"createdAt", -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var keys []*APIKeyModel
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves the API key of a hash, if it is not revoked
+func (r *botRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKeyModel, error) {
+	var key APIKeyModel
+	err := r.collectionAPIKey.FindOne(ctx, bson.D{{"hash", hash}, {"revokedAt", nil}}).Decode(&key)
+	if err != nil {
+		return nil, errors.New(" API key not found")
+	}
+	return &key, nil
+}
+
+// UseAPIKey records the use of an API key, when it was not used since a date
+func (r *botRepository) UseAPIKey(ctx context.Context, keyID primitive.ObjectID, usedBefore time.Time) error {
+	filter := bson.D{{"_id", keyID}, {"$or", bson.A{
+		bson.D{{"lastUsedAt", bson.D{{"$exists", false}}}},
+		bson.D{{"lastUsedAt", bson.D{{"$lt", usedBefore}}}},
+	}}}
+	_, err := r.collectionAPIKey.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"lastUsedAt", time.Now()}}}})
+	return err
+}
+
+// RevokeAPIKey revokes an API key of a bot
+func (r *botRepository) RevokeAPIKey(ctx context.Context, botID string, keyID string) error {
+	objectID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collectionAPIKey.UpdateOne(ctx, bson.D{{"_id", objectID}, {"botId", botID}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(" API key not found")
+	}
+	return nil
+}
+
+// RevokeAPIKeys revokes all the API keys of a bot
+func (r *botRepository) RevokeAPIKeys(ctx context.Context, botID string) error {
+	_, err := r.collectionAPIKey.UpdateMany(ctx, bson.D{{"botId", botID}, {"revokedAt", nil}},
+		bson.D{{"$set", bson.D{{"revokedAt", time.Now()}}}})
+	return err
+}
@@ -0,0 +1,275 @@
+package bot
+
+import (
+	"chat-app/pkg/room"
+	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Role is the role of the user accounts of the bots
+const Role = "bot"
+
+const (
+	// maxBots is the number of bots a user other than an admin can own
+	maxBots = 10
+	// maxKeyDays is the longest validity of an API key, in days
+	maxKeyDays = 3650
+	// usedInterval is how often the last use of an API key is recorded
+	usedInterval = time.Minute
+	// prefixLength is the length of the start of a key shown to recognize it, its prefix and 8 characters
+	prefixLength = len(utils.APIKeyPrefix) + 8
+)
+
+var (
+	// ErrBotNotFound is returned for a bot that does not exist, or not of the user
+	ErrBotNotFound = errors.New("Bot not found")
+	// ErrAPIKeyNotFound is returned for an API key that does not exist, or already revoked
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrTooManyBots is returned when a user already owns the most bots allowed
+	ErrTooManyBots = errors.New("You cannot create more bots")
+	// ErrInvalidScope is returned for an unknown scope, or the scope of a room that does not exist
+	ErrInvalidScope = errors.New("Invalid scope, the scopes are messages:read and messages:write, for all rooms or as <scope>:<room ID>")
+	// ErrScopeNotAllowed is returned for a scope the user cannot give
+	ErrScopeNotAllowed = errors.New("You can only give the scopes of the rooms you moderate, an admin gives the scopes of all rooms")
+	// ErrInvalidExpiry is returned for an expiry out of range
+	ErrInvalidExpiry = errors.New("The expiry must be a number of days up to 3650, or 0 for a key that does not expire")
+)
+
+// BotService defines the bots and their API keys. It is the store of the API keys checked by the tokens verification.
+type BotService interface {
+	CreateBot(ctx context.Context, ownerID string, role string, request *CreateBotRequest) (*BotEntity, error)
+	GetBots(ctx context.Context, ownerID string, role string) ([]*BotEntity, error)
+	DeleteBot(ctx context.Context, ownerID string, role string, botID string) error
+	CreateAPIKey(ctx context.Context, ownerID string, role string, botID string, request *CreateAPIKeyRequest) (string, *APIKeyEntity, error)
+	GetAPIKeys(ctx context.Context, ownerID string, role string, botID string) ([]*APIKeyEntity, error)
+	RevokeAPIKey(ctx context.Context, ownerID string, role string, botID string, keyID string) error
+	VerifyAPIKey(ctx context.Context, key string) (*utils.Claims, error)
+}
+
+// botService manages the bots, their accounts and their API keys
+type botService struct {
+	repo        BotRepository
+	userService user.UserService
+	roomService room.RoomService
+}
+
+// NewBotService creates a new bot service
+func NewBotService(repo BotRepository, userService user.UserService, roomService room.RoomService) BotService {
+	return &botService{repo: repo, userService: userService, roomService: roomService}
+}
+
+// CreateBot creates a bot and its account, without password: it can only be used with its API keys
+func (s *botService) CreateBot(ctx context.Context, ownerID string, role string, request *CreateBotRequest) (*BotEntity, error) {
+	if role != "admin" {
+		count, err := s.repo.CountBots(ctx, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxBots {
+			return nil, ErrTooManyBots
+		}
+	}
+	account := &user.UserEntity{
+		Username: request.Username,
+		Role:     Role,
+		Validity: "valid",
+	}
+	if err := s.userService.CreateUser(ctx, account); err != nil {
+		return nil, err
+	}
+	bot := &BotModel{
+		ID:          account.ID,
+		OwnerID:     ownerID,
+		Description: strings.TrimSpace(request.Description),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateBot(ctx, bot); err != nil {
+		return nil, err
+	}
+	return ModelToEntity(bot, account.Username), nil
+}
+
+// GetBots lists the bots of a user, or all the bots for an admin
+func (s *botService) GetBots(ctx context.Context, ownerID string, role string) ([]*BotEntity, error) {
+	if role == "admin" {
+		ownerID = ""
+	}
+	bots, err := s.repo.GetBots(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*BotEntity, 0, len(bots))
+	for _, bot := range bots {
+		username := ""
+		if account, err := s.userService.GetUser(ctx, bot.ID); err == nil {
+			username = account.Username
+		}
+		entities = append(entities, ModelToEntity(bot, username))
+	}
+	return entities, nil
+}
+
+// DeleteBot revokes the API keys of a bot and removes it with its account, its messages are kept
+func (s *botService) DeleteBot(ctx context.Context, ownerID string, role string, botID string) error {
+	if _, err := s.getBot(ctx, ownerID, role, botID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeAPIKeys(ctx, botID); err != nil {
+		return err
+	}
+	if err := s.userService.DeleteUser(ctx, botID); err != nil {
+		return err
+	}
+	return s.repo.DeleteBot(ctx, botID)
+}
+
+// CreateAPIKey creates an API key for a bot and returns it, it is never shown again
+func (s *botService) CreateAPIKey(ctx context.Context, ownerID string, role string, botID string, request *CreateAPIKeyRequest) (string, *APIKeyEntity, error) {
+	if _, err := s.getBot(ctx, ownerID, role, botID); err != nil {
+		return "", nil, err
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > maxKeyDays {
+		return "", nil, ErrInvalidExpiry
+	}
+	scopes, err := s.checkScopes(ctx, ownerID, role, request.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := utils.NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+	key := utils.APIKeyPrefix + token
+	now := time.Now()
+	model := &APIKeyModel{
+		BotID:     botID,
+		Name:      strings.TrimSpace(request.Name),
+		Prefix:    key[:prefixLength],
+		Hash:      utils.HashToken(key),
+		Scopes:    scopes,
+		CreatedBy: ownerID,
+		CreatedAt: now,
+	}
+	if request.ExpiresInDays > 0 {
+		model.ExpiresAt = now.AddDate(0, 0, request.ExpiresInDays)
+	}
+	if err := s.repo.CreateAPIKey(ctx, model); err != nil {
+		return "", nil, err
+	}
+	return key, APIKeyModelToEntity(model), nil
+}
+
+// checkScopes validates the scopes of a new key: the scopes of a room are given by its moderators, the scopes of all
+// the rooms by an admin. It returns them without duplicates.
+func (s *botService) checkScopes(ctx context.Context, ownerID string, role string, scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	checked := make([]string, 0, len(scopes))
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		parts := strings.SplitN(scope, ":", 3)
+		if len(parts) < 2 || !validScope(parts[0]+":"+parts[1]) {
+			return nil, ErrInvalidScope
+		}
+		if len(parts) == 2 {
+			if role != "admin" {
+				return nil, ErrScopeNotAllowed
+			}
+		} else {
+			roomRetrieved, err := s.roomService.GetRoom(ctx, parts[2])
+			if err != nil {
+				return nil, ErrInvalidScope
+			}
+			if role != "admin" && !roomRetrieved.IsModerator(ownerID) {
+				return nil, ErrScopeNotAllowed
+			}
+		}
+		checked = append(checked, scope)
+	}
+	return checked, nil
+}
+
+// validScope tells if a scope, without room, is one of the scopes of the API keys
+func validScope(scope string) bool {
+	for _, s := range utils.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAPIKeys lists the API keys of a bot, by their prefix
+func (s *botService) GetAPIKeys(ctx context.Context, ownerID string, role string, botID string) ([]*APIKeyEntity, error) {
+	if _, err := s.getBot(ctx, ownerID, role, botID); err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.GetAPIKeys(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*APIKeyEntity, 0, len(keys))
+	for _, key := range keys {
+		entities = append(entities, APIKeyModelToEntity(key))
+	}
+	return entities, nil
+}
+
+// RevokeAPIKey revokes an API key of a bot, it is rejected from the next request
+func (s *botService) RevokeAPIKey(ctx context.Context, ownerID string, role string, botID string, keyID string) error {
+	if _, err := s.getBot(ctx, ownerID, role, botID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeAPIKey(ctx, botID, keyID); err != nil {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// VerifyAPIKey returns the claims of the bot of an API key, if the key is not revoked nor expired and the bot is not banned
+func (s *botService) VerifyAPIKey(ctx context.Context, key string) (*utils.Claims, error) {
+	model, err := s.repo.GetAPIKeyByHash(ctx, utils.HashToken(key))
+	if err != nil {
+		return nil, utils.ErrInvalidAPIKey
+	}
+	if !model.ExpiresAt.IsZero() && time.Now().After(model.ExpiresAt) {
+		return nil, utils.ErrInvalidAPIKey
+	}
+	account, err := s.userService.GetUser(ctx, model.BotID)
+	if err != nil || account.Role != Role || account.Validity != "valid" {
+		return nil, utils.ErrInvalidAPIKey
+	}
+	if time.Since(model.LastUsedAt) > usedInterval {
+		if err := s.repo.UseAPIKey(ctx, model.ID, time.Now().Add(-usedInterval)); err != nil {
+			log.Printf("Failed to update the API key %s: %v", model.Prefix, err)
+		}
+	}
+	return &utils.Claims{
+		UserID:   account.ID,
+		Username: account.Username,
+		Role:     Role,
+		APIKeyID: model.ID.Hex(),
+		Scopes:   model.Scopes,
+		Bot:      true,
+	}, nil
+}
+
+// getBot returns a bot of its owner, or of any owner for an admin
+func (s *botService) getBot(ctx context.Context, ownerID string, role string, botID string) (*BotModel, error) {
+	bot, err := s.repo.GetBot(ctx, botID)
+	if err != nil || (bot.OwnerID != ownerID && role != "admin") {
+		return nil, ErrBotNotFound
+	}
+	return bot, nil
+}
@@ -0,0 +1,221 @@
+package command
+
+import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"chat-app/pkg/spam"
+	"chat-app/pkg/user"
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMute is the duration of /mute without duration
+	defaultMute = 10 * time.Minute
+	// maxMute is the longest mute of /mute
+	maxMute = 24 * time.Hour
+	// maxTopicLength is the longest topic, the same as the route of the topic
+	maxTopicLength = 120
+)
+
+// builtins holds the services of the commands of the server
+type builtins struct {
+	registry    *Registry
+	roomService room.RoomService
+	userService user.UserService
+	spamService spam.SpamService
+	broadcast   room.Broadcaster
+}
+
+// RegisterBuiltins adds the commands of the server: /help, /me, /topic, /invite, /kick, /mute and /unmute
+func RegisterBuiltins(registry *Registry, userService user.UserService, spamService spam.SpamService, broadcast room.Broadcaster) error {
+	b := &builtins{registry: registry, roomService: registry.roomService, userService: userService, spamService: spamService, broadcast: broadcast}
+	commands := []Command{
+		{Name: "help", Usage: "/help", Description: "List the commands you can run", Permission: PermissionMember, Run: b.help},
+		{Name: "me", Usage: "/me <action>", Description: "Send an action, like /me waves", Permission: PermissionMember, Run: b.me},
+		{Name: "topic", Usage: "/topic [topic]", Description: "Show the topic of the room, or set it as a moderator", Permission: PermissionMember, Run: b.topic},
+		{Name: "invite", Usage: "/invite @user", Description: "Add a user to the room", Permission: PermissionMember, Run: b.invite},
+		{Name: "kick", Usage: "/kick @user", Description: "Remove a user from the room", Permission: PermissionModerator, Run: b.kick},
+		{Name: "mute", Usage: "/mute @user [duration]", Description: "Stop a user from sending messages in the room, for 10m by default", Permission: PermissionModerator, Run: b.mute},
+		{Name: "unmute", Usage: "/unmute @user", Description: "Let a muted user send messages in the room again", Permission: PermissionModerator, Run: b.unmute},
+	}
+	for _, command := range commands {
+		if err := registry.Register(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// help lists the commands the sender can run in the room
+func (b *builtins) help(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	var lines []string
+	for _, command := range b.registry.Commands() {
+		if invocation.Allows(command.Permission) {
+			lines = append(lines, command.Usage+" - "+command.Description)
+		}
+	}
+	return Reply("%s", strings.Join(lines, "\n")), nil
+}
+
+// me sends the action of the sender as a message
+func (b *builtins) me(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	if invocation.Args == "" {
+		return nil, errors.New("Usage: /me <action>")
+	}
+	action := *invocation.Message
+	action.Content = invocation.Args
+	action.Action = true
+	return &message.CommandResult{Message: &action}, nil
+}
+
+// topic shows the topic of the room, or sets it for a moderator
+func (b *builtins) topic(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	if invocation.Args == "" {
+		if invocation.Room.Topic == "" {
+			return Reply("This room has no topic"), nil
+		}
+		return Reply("Topic: %s", invocation.Room.Topic), nil
+	}
+	if !invocation.IsModerator() {
+		return nil, message.ErrCommandNotAllowed
+	}
+	if len(invocation.Args) > maxTopicLength {
+		return nil, errors.New("Topic is too long")
+	}
+	updated, err := b.roomService.SetTopic(ctx, invocation.RoomID, invocation.UserID, invocation.Args)
+	if errors.Is(err, room.ErrRoomArchived) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("Could not set topic")
+	}
+	b.broadcast(invocation.RoomID, room.EventRoomTopic, updated.TopicEvent())
+	return Reply("Topic set"), nil
+}
+
+// invite adds a user to the room, the sender must be a member of the room
+func (b *builtins) invite(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	target, err := b.target(ctx, invocation, "/invite @user")
+	if err != nil {
+		return nil, err
+	}
+	if !invocation.IsModerator() && !contains(invocation.Room.Members, invocation.UserID) {
+		return nil, message.ErrCommandNotAllowed
+	}
+	if contains(invocation.Room.Members, target.ID) {
+		return Reply("%s is already in the room", target.Username), nil
+	}
+	updated, err := b.roomService.AddMember(ctx, invocation.RoomID, target.ID)
+	if errors.Is(err, room.ErrRoomArchived) || errors.Is(err, room.ErrRoomFull) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("Could not add member")
+	}
+	b.broadcast(invocation.RoomID, room.EventRoomUpdated, updated)
+	return Reply("%s has been added to the room", target.Username), nil
+}
+
+// kick removes a user from the room
+func (b *builtins) kick(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	target, err := b.target(ctx, invocation, "/kick @user")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModerated(invocation, target); err != nil {
+		return nil, err
+	}
+	if !contains(invocation.Room.Members, target.ID) {
+		return Reply("%s is not in the room", target.Username), nil
+	}
+	updated, err := b.roomService.RemoveMember(ctx, invocation.RoomID, target.ID)
+	if errors.Is(err, room.ErrRoomArchived) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("Could not remove member")
+	}
+	b.broadcast(invocation.RoomID, room.EventRoomUpdated, updated)
+	return Reply("%s has been removed from the room", target.Username), nil
+}
+
+// mute stops a user from sending messages in the room for a duration
+func (b *builtins) mute(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	fields := strings.Fields(invocation.Args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("Usage: /mute @user [duration], like 10m or 1h")
+	}
+	duration, label := defaultMute, "10m"
+	if len(fields) == 2 {
+		parsed, err := time.ParseDuration(fields[1])
+		if err != nil || parsed <= 0 || parsed > maxMute {
+			return nil, errors.New("The duration must be like 30s, 10m or 1h, up to 24h")
+		}
+		duration, label = parsed, fields[1]
+	}
+	target, err := b.lookup(ctx, fields[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModerated(invocation, target); err != nil {
+		return nil, err
+	}
+	b.spamService.MuteInRoom(invocation.RoomID, target.ID, duration)
+	return Reply("%s is muted in this room for %s", target.Username, label), nil
+}
+
+// unmute lifts the mute of a user in the room
+func (b *builtins) unmute(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+	target, err := b.target(ctx, invocation, "/unmute @user")
+	if err != nil {
+		return nil, err
+	}
+	b.spamService.UnmuteInRoom(invocation.RoomID, target.ID)
+	return Reply("%s can send messages in this room again", target.Username), nil
+}
+
+// target returns the user named by the only argument of a command
+func (b *builtins) target(ctx context.Context, invocation *Invocation, usage string) (*user.UserEntity, error) {
+	fields := strings.Fields(invocation.Args)
+	if len(fields) != 1 {
+		return nil, errors.New("Usage: " + usage)
+	}
+	return b.lookup(ctx, fields[0])
+}
+
+// lookup returns the user of a username, with or without @
+func (b *builtins) lookup(ctx context.Context, username string) (*user.UserEntity, error) {
+	username = strings.TrimPrefix(username, "@")
+	found, err := b.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, errors.New("User " + username + " not found")
+	}
+	return found, nil
+}
+
+// checkModerated tells if the sender can moderate a user: not itself, not the owner of the room, and a moderator only
+// by the owner or an admin
+func checkModerated(invocation *Invocation, target *user.UserEntity) error {
+	switch {
+	case target.ID == invocation.UserID:
+		return errors.New("You cannot do this to yourself")
+	case target.Role == "admin" || target.ID == invocation.Room.Creator:
+		return message.ErrCommandNotAllowed
+	case invocation.Room.IsModerator(target.ID) && invocation.Role != "admin" && invocation.UserID != invocation.Room.Creator:
+		return message.ErrCommandNotAllowed
+	}
+	return nil
+}
+
+// contains tells if a list of IDs has an ID
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
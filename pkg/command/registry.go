@@ -0,0 +1,197 @@
+package command
+
+import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Permission is who can run a command in a room
+type Permission int
+
+const (
+	// PermissionMember lets everyone who can send messages in the room run the command
+	PermissionMember Permission = iota
+	// PermissionModerator lets the owner and the moderators of the room, and the admins, run the command
+	PermissionModerator
+	// PermissionAdmin lets only the admins run the command
+	PermissionAdmin
+)
+
+// Invocation is a command typed in a room, with its sender
+type Invocation struct {
+	Name string
+	// Args is the text after the name of the command, trimmed
+	Args     string
+	RoomID   string
+	UserID   string
+	Username string
+	Role     string
+	Bot      bool
+	// Room is the room the command is typed in
+	Room *room.RoomEntity
+	// Message is the message the command was typed in
+	Message *message.MessageEntity
+}
+
+// IsModerator tells if the sender of the command moderates the room, an admin moderates all the rooms
+func (i *Invocation) IsModerator() bool {
+	return i.Role == "admin" || i.Room.IsModerator(i.UserID)
+}
+
+// Allows tells if the sender of the command has a permission in the room
+func (i *Invocation) Allows(permission Permission) bool {
+	switch permission {
+	case PermissionMember:
+		return true
+	case PermissionModerator:
+		return i.IsModerator()
+	default:
+		return i.Role == "admin"
+	}
+}
+
+// Handler runs a command, the error is shown to the sender
+type Handler func(ctx context.Context, invocation *Invocation) (*message.CommandResult, error)
+
+// Command is a slash command, like /topic
+type Command struct {
+	// Name is typed after the slash, lowercase letters, digits, - and _
+	Name string
+	// Usage shows the arguments, like "/mute @user [duration]"
+	Usage       string
+	Description string
+	Permission  Permission
+	Run         Handler
+}
+
+var (
+	// ErrUnknownCommand is returned for a command not registered
+	ErrUnknownCommand = errors.New("Unknown command, type /help for the list of the commands")
+	// ErrCommandExists is returned when a command is registered twice
+	ErrCommandExists = errors.New("command already registered")
+	// ErrInvalidCommand is returned when a command without name or handler is registered
+	ErrInvalidCommand = errors.New("invalid command, a command has a name and a handler")
+)
+
+// namePattern is the form of the names of the commands
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Registry holds the slash commands, it implements message.Commands.
+// Other packages add their commands with Register, before the server starts.
+type Registry struct {
+	roomService room.RoomService
+
+	mu       sync.RWMutex
+	commands map[string]*Command
+}
+
+// NewRegistry creates a registry without commands
+func NewRegistry(roomService room.RoomService) *Registry {
+	return &Registry{roomService: roomService, commands: map[string]*Command{}}
+}
+
+// Register adds a command, its name must be new
+func (r *Registry) Register(command Command) error {
+	command.Name = strings.ToLower(command.Name)
+	if !namePattern.MatchString(command.Name) || command.Run == nil {
+		return ErrInvalidCommand
+	}
+	if command.Usage == "" {
+		command.Usage = "/" + command.Name
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.commands[command.Name]; ok {
+		return fmt.Errorf("%w: /%s", ErrCommandExists, command.Name)
+	}
+	r.commands[command.Name] = &command
+	return nil
+}
+
+// Commands lists the commands by name
+func (r *Registry) Commands() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	commands := make([]Command, 0, len(r.commands))
+	for _, command := range r.commands {
+		commands = append(commands, *command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// IsCommand tells if a message is a command: it starts with a slash, a message starting with two slashes is sent
+// with one, like "//shrug"
+func (r *Registry) IsCommand(content string) bool {
+	return strings.HasPrefix(content, "/")
+}
+
+// Run checks the permission of the sender of a command and runs it
+func (r *Registry) Run(ctx context.Context, msg *message.MessageEntity, role string) (*message.CommandResult, error) {
+	// two slashes send the message with one
+	if strings.HasPrefix(msg.Content, "//") {
+		escaped := *msg
+		escaped.Content = msg.Content[1:]
+		return &message.CommandResult{Message: &escaped}, nil
+	}
+
+	name, args := parse(msg.Content)
+	r.mu.RLock()
+	command, ok := r.commands[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+
+	roomRetrieved, err := r.roomService.GetRoom(ctx, msg.RoomID)
+	if err != nil {
+		return nil, errors.New("The room does not exist")
+	}
+	invocation := &Invocation{
+		Name:     name,
+		Args:     args,
+		RoomID:   msg.RoomID,
+		UserID:   msg.UserID,
+		Username: msg.Username,
+		Role:     role,
+		Bot:      msg.Bot,
+		Room:     roomRetrieved,
+		Message:  msg,
+	}
+	if !invocation.Allows(command.Permission) {
+		return nil, message.ErrCommandNotAllowed
+	}
+
+	result, err := command.Run(ctx, invocation)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = &message.CommandResult{}
+	}
+	result.Command = name
+	return result, nil
+}
+
+// parse splits a command into its lowercase name and its arguments
+func parse(content string) (string, string) {
+	content = strings.TrimPrefix(content, "/")
+	name := content
+	args := ""
+	if i := strings.IndexAny(content, " \t\n"); i >= 0 {
+		name, args = content[:i], content[i+1:]
+	}
+	return strings.ToLower(name), strings.TrimSpace(args)
+}
+
+// Reply is the result of a command answered to its sender only
+func Reply(format string, args ...interface{}) *message.CommandResult {
+	return &message.CommandResult{Response: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,170 @@
+package command
+
+import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"chat-app/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testRoomID  = "64b7f0c2a1b2c3d4e5f60718"
+	testOwnerID = "64b7f0c2a1b2c3d4e5f60001"
+	testUserID  = "64b7f0c2a1b2c3d4e5f60002"
+)
+
+// testRooms serves one room
+type testRooms struct {
+	room.RoomService
+	room *room.RoomEntity
+}
+
+func (r *testRooms) GetRoom(ctx context.Context, roomID string) (*room.RoomEntity, error) {
+	if roomID != r.room.ID {
+		return nil, errors.New(" room not found")
+	}
+	return r.room, nil
+}
+
+// testMessages stores the messages created through the model, like the repository
+type testMessages struct {
+	message.MessageService
+	created []*message.MessageEntity
+}
+
+func (m *testMessages) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	model := message.EntityToModel(msg)
+	model.ID = primitive.NewObjectID()
+	created := message.ModelToEntity(model)
+	m.created = append(m.created, created)
+	return created, nil
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	rooms := &testRooms{room: &room.RoomEntity{ID: testRoomID, Creator: testOwnerID, Members: []string{testOwnerID, testUserID}}}
+	registry := NewRegistry(rooms)
+	if err := RegisterBuiltins(registry, nil, nil, func(string, string, interface{}) {}); err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// postMessage sends a message as bob, a member of the room
+func postMessage(t *testing.T, registry *Registry, messages *testMessages, content string) (int, map[string]interface{}) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	username, userID, role := "bob", testUserID, "user"
+	token, err := utils.GenerateToken(&username, &userID, &role, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("messages", message.CreateMessageHandler(messages, registry))
+	body, _ := json.Marshal(map[string]string{"roomId": testRoomID, "username": username, "content": content})
+	req := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func TestMeIsSentAsAnAction(t *testing.T) {
+	messages := &testMessages{}
+	code, response := postMessage(t, newTestRegistry(t), messages, "/me waves")
+	if code != http.StatusOK {
+		t.Fatalf("got %d %v", code, response)
+	}
+	if response["action"] != true || response["content"] != "waves" {
+		t.Fatalf("got %v, want an action with the content waves", response)
+	}
+	if len(messages.created) != 1 || !messages.created[0].Action {
+		t.Fatalf("the action was not stored: %+v", messages.created)
+	}
+}
+
+func TestHelpIsEphemeral(t *testing.T) {
+	messages := &testMessages{}
+	code, response := postMessage(t, newTestRegistry(t), messages, "/help")
+	if code != http.StatusOK || response["ephemeral"] != true || response["command"] != "help" {
+		t.Fatalf("got %d %v", code, response)
+	}
+	// a member does not see the commands of the moderators
+	if text, _ := response["response"].(string); !strings.Contains(text, "/me") || strings.Contains(text, "/kick") {
+		t.Fatalf("unexpected help %q", text)
+	}
+	if len(messages.created) != 0 {
+		t.Fatal("a command was sent as a message")
+	}
+}
+
+func TestModeratorCommandIsForbidden(t *testing.T) {
+	messages := &testMessages{}
+	code, response := postMessage(t, newTestRegistry(t), messages, "/kick @alice")
+	if code != http.StatusForbidden {
+		t.Fatalf("got %d %v, want 403", code, response)
+	}
+}
+
+func TestDoubleSlashIsSentAsItIs(t *testing.T) {
+	messages := &testMessages{}
+	code, response := postMessage(t, newTestRegistry(t), messages, "//shrug")
+	if code != http.StatusOK || response["content"] != "/shrug" || response["action"] != nil {
+		t.Fatalf("got %d %v", code, response)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	registry := newTestRegistry(t)
+	_, err := registry.Run(context.Background(), &message.MessageEntity{RoomID: testRoomID, Content: "/nope"}, "user")
+	if err != ErrUnknownCommand {
+		t.Fatalf("got %v, want ErrUnknownCommand", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registry := newTestRegistry(t)
+	run := func(ctx context.Context, invocation *Invocation) (*message.CommandResult, error) {
+		return Reply("ok"), nil
+	}
+	if err := registry.Register(Command{Name: "ME", Run: run}); !errors.Is(err, ErrCommandExists) {
+		t.Fatalf("got %v, want ErrCommandExists", err)
+	}
+	if err := registry.Register(Command{Name: "bad name", Run: run}); err != ErrInvalidCommand {
+		t.Fatalf("got %v, want ErrInvalidCommand", err)
+	}
+	if err := registry.Register(Command{Name: "roll", Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := registry.Run(context.Background(), &message.MessageEntity{RoomID: testRoomID, Content: "/roll"}, "user")
+	if err != nil || result.Response != "ok" || result.Command != "roll" {
+		t.Fatalf("got %+v %v", result, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct{ content, name, args string }{
+		{"/help", "help", ""},
+		{"/Mute  @bob 5m ", "mute", "@bob 5m"},
+		{"/me\tdances", "me", "dances"},
+	}
+	for _, test := range tests {
+		name, args := parse(test.content)
+		if name != test.name || args != test.args {
+			t.Errorf("parse(%q) = %q, %q, want %q, %q", test.content, name, args, test.name, test.args)
+		}
+	}
+}
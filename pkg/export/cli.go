@@ -0,0 +1,51 @@
+package export
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RunCommand runs the export command line: export -room <id> [-format jsonl|csv|html] [-from date] [-to date] [-out file]
+func RunCommand(ctx context.Context, exportService ExportService, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	roomID := flags.String("room", "", "ID of the room to export")
+	format := flags.String("format", FormatJSONL, "export format: jsonl, csv or html")
+	from := flags.String("from", "", "first day of the export, YYYY-MM-DD or RFC3339")
+	to := flags.String("to", "", "last day of the export, YYYY-MM-DD or RFC3339")
+	out := flags.String("out", "", "output file, the standard output by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *roomID == "" {
+		flags.Usage()
+		return fmt.Errorf("the room is required")
+	}
+
+	query := QueryEntity{RoomID: *roomID, Format: *format}
+	var err error
+	if query.From, err = ParseDate(*from, false); err != nil {
+		return err
+	}
+	if query.To, err = ParseDate(*to, true); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	count, err := exportService.Export(ctx, &query, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d messages of room %s\n", count, *roomID)
+	return nil
+}
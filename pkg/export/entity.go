@@ -0,0 +1,47 @@
+package export
+
+import "time"
+
+// RoomEntity is the room metadata written at the start of an export
+type RoomEntity struct {
+	ID          string          `json:"_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Topic       string          `json:"topic,omitempty"`
+	Creator     string          `json:"creator"`
+	CreatedAt   string          `json:"createdAt"`
+	Archived    bool            `json:"archived,omitempty"`
+	Hashtags    []string        `json:"hashtags,omitempty"`
+	Members     []*MemberEntity `json:"members"`
+	From        string          `json:"from,omitempty"`
+	To          string          `json:"to,omitempty"`
+	ExportedAt  string          `json:"exportedAt"`
+}
+
+// MemberEntity is a member of the exported room
+type MemberEntity struct {
+	ID       string `json:"_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// MessageEntity is an exported message, with its edit and bot markers
+type MessageEntity struct {
+	ID        string `json:"_id"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"createdAt"`
+	Edited    bool   `json:"edited"`
+	EditedAt  string `json:"editedAt,omitempty"`
+	Bot       bool   `json:"bot,omitempty"`
+}
+
+// QueryEntity selects the messages to export
+type QueryEntity struct {
+	RoomID string
+	Format string
+	// From and To bound the creation date of the messages, a zero time is unbounded
+	From time.Time
+	To   time.Time
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"chat-app/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// ExportRoomHandler streams the messages of a room over a date range, as JSON lines, CSV or HTML
+func ExportRoomHandler(exportService ExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := QueryEntity{RoomID: c.Param("id"), Format: c.DefaultQuery("format", FormatJSONL)}
+		if _, err := NewWriter(query.Format, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var err error
+		if query.From, err = ParseDate(c.Query("from"), false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if query.To, err = ParseDate(c.Query("to"), true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// only the members of the room and the admins can export it
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not export room"})
+			return
+		}
+		room, err := exportService.GetRoom(c.Request.Context(), query.RoomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if !isMember(room, claims.UserID) && claims.Role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+			return
+		}
+
+		// the response is written while the messages are read
+		c.Header("Content-Type", ContentType(query.Format))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", FileName(room.Name, query.Format)))
+		c.Status(http.StatusOK)
+		if _, err := exportService.Export(c.Request.Context(), &query, c.Writer); err != nil {
+			if errors.Is(err, ErrRoomNotFound) && !c.Writer.Written() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			// the status is already sent, the export is truncated
+			log.Printf("Export of room %s failed: %v", query.RoomID, err)
+		}
+	}
+}
+
+// isMember checks if a user is a member of the exported room
+func isMember(room *RoomEntity, userID string) bool {
+	for _, member := range room.Members {
+		if member.ID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// MessageModel is a message read for the export.
+// EditedAt is only set on imported messages that were edited in their source, the messages cannot be edited here.
+type MessageModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId,omitempty"`
+	Username  string             `bson:"username,omitempty"`
+	Content   string             `bson:"content,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+	EditedAt  time.Time          `bson:"editedAt,omitempty"`
+	Bot       bool               `bson:"bot,omitempty"`
+}
+
+// UserModel is the part of a user read for the export
+type UserModel struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Username string             `bson:"username,omitempty"`
+}
+
+// ModelToEntity converts a message model to an exported message
+func ModelToEntity(message *MessageModel) *MessageEntity {
+	return &MessageEntity{
+		ID:        message.ID.Hex(),
+		UserID:    message.UserID,
+		Username:  message.Username,
+		Content:   message.Content,
+		CreatedAt: formatTime(message.CreatedAt),
+		Edited:    !message.EditedAt.IsZero(),
+		EditedAt:  formatTime(message.EditedAt),
+		Bot:       message.Bot,
+	}
+}
+
+// formatTime formats a time in RFC3339, a zero time gives an empty string
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
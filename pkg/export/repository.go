@@ -0,0 +1,105 @@
+package export
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ExportRepository defines the methods to read the history of a room
+type ExportRepository interface {
+	GetRoom(ctx context.Context, roomID string) (*room.RoomModel, error)
+	GetUsers(ctx context.Context, userIDs []string) ([]*UserModel, error)
+	StreamMessages(ctx context.Context, roomID string, from, to time.Time, fn func(*MessageModel) error) error
+}
+
+// exportRepository is the implementation of the ExportRepository interface
+type exportRepository struct {
+	collectionRoom    *mongo.Collection
+	collectionUser    *mongo.Collection
+	collectionMessage *mongo.Collection
+}
+
+// NewExportRepository creates a new export repository
+func NewExportRepository(collectionRoom *mongo.Collection, collectionUser *mongo.Collection, collectionMessage *mongo.Collection) ExportRepository {
+	return &exportRepository{
+		collectionRoom:    collectionRoom,
+		collectionUser:    collectionUser,
+		collectionMessage: collectionMessage,
+	}
+}
+
+// GetRoom retrieves a room by its ID
+func (r *exportRepository) GetRoom(ctx context.Context, roomID string) (*room.RoomModel, error) {
+	roomObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, err
+	}
+	var roomRetrieved room.RoomModel
+	err = r.collectionRoom.FindOne(ctx, bson.D{{"_id", roomObjectID}}).Decode(&roomRetrieved)
+	if err != nil {
+		return nil, err
+	}
+	return &roomRetrieved, nil
+}
+
+// GetUsers retrieves the IDs and usernames of users
+func (r *exportRepository) GetUsers(ctx context.Context, userIDs []string) ([]*UserModel, error) {
+	ids := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	opts := options.Find().SetProjection(bson.D{{"username", 1}})
+	cursor, err := r.collectionUser.Find(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var users []*UserModel
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// StreamMessages calls fn on every message of a room created between from and to, oldest first.
+// The messages are read one at a time from the cursor, a zero time leaves the range open.
+func (r *exportRepository) StreamMessages(ctx context.Context, roomID string, from, to time.Time, fn func(*MessageModel) error) error {
+	// build the date range
+	createdAt := bson.D{}
+	if !from.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: to})
+	}
+	filter := bson.D{{"roomId", roomID}}
+	if len(createdAt) > 0 {
+		filter = append(filter, bson.E{Key: "createdAt", Value: createdAt})
+	}
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", 1}, {"_id", 1}})
+	cursor, err := r.collectionMessage.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var message MessageModel
+		if err := cursor.Decode(&message); err != nil {
+			return err
+		}
+		if err := fn(&message); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrRoomNotFound is returned when the exported room does not exist
+var ErrRoomNotFound = errors.New("The room does not exist")
+
+// ExportService defines the methods to export the history of a room
+type ExportService interface {
+	Export(ctx context.Context, query *QueryEntity, w io.Writer) (int, error)
+	GetRoom(ctx context.Context, roomID string) (*RoomEntity, error)
+}
+
+// exportService is the implementation of the ExportService interface
+type exportService struct {
+	repo ExportRepository
+}
+
+// NewExportService creates a new export service
+func NewExportService(repo ExportRepository) ExportService {
+	return &exportService{repo: repo}
+}
+
+// GetRoom returns the metadata and the members of a room
+func (s *exportService) GetRoom(ctx context.Context, roomID string) (*RoomEntity, error) {
+	roomRetrieved, err := s.repo.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, ErrRoomNotFound
+	}
+	users, err := s.repo.GetUsers(ctx, roomRetrieved.Members)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		usernames[user.ID.Hex()] = user.Username
+	}
+
+	roomEntity := &RoomEntity{
+		ID:          roomRetrieved.ID.Hex(),
+		Name:        roomRetrieved.Name,
+		Description: roomRetrieved.Description,
+		Topic:       roomRetrieved.Topic,
+		Creator:     roomRetrieved.Creator,
+		CreatedAt:   formatTime(roomRetrieved.CreatedAt),
+		Archived:    roomRetrieved.Archived,
+		Hashtags:    roomRetrieved.Hashtags,
+		Members:     make([]*MemberEntity, 0, len(roomRetrieved.Members)),
+		ExportedAt:  formatTime(time.Now()),
+	}
+	for _, memberID := range roomRetrieved.Members {
+		role := "member"
+		if memberID == roomRetrieved.Creator {
+			role = "owner"
+		} else {
+			for _, moderator := range roomRetrieved.Moderators {
+				if moderator == memberID {
+					role = "moderator"
+				}
+			}
+		}
+		roomEntity.Members = append(roomEntity.Members, &MemberEntity{ID: memberID, Username: usernames[memberID], Role: role})
+	}
+	return roomEntity, nil
+}
+
+// Export writes the room and its messages in the requested format, and returns the number of messages written
+func (s *exportService) Export(ctx context.Context, query *QueryEntity, w io.Writer) (int, error) {
+	writer, err := NewWriter(query.Format, w)
+	if err != nil {
+		return 0, err
+	}
+	roomEntity, err := s.GetRoom(ctx, query.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	roomEntity.From = formatTime(query.From)
+	roomEntity.To = formatTime(query.To)
+
+	if err := writer.WriteRoom(roomEntity); err != nil {
+		return 0, err
+	}
+	// write the messages as they are read
+	count := 0
+	err = s.repo.StreamMessages(ctx, query.RoomID, query.From, query.To, func(message *MessageModel) error {
+		count++
+		return writer.WriteMessage(ModelToEntity(message))
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
+
+// ParseDate parses a date of an export range, as RFC3339 or YYYY-MM-DD.
+// A day given as the end of the range is included.
+func ParseDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid date, use YYYY-MM-DD or RFC3339")
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// FileName returns the name of the export file of a room
+func FileName(roomName string, format string) string {
+	name := make([]rune, 0, len(roomName))
+	for _, r := range roomName {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			name = append(name, r)
+		} else {
+			name = append(name, '_')
+		}
+	}
+	if len(name) == 0 {
+		name = []rune("room")
+	}
+	return string(name) + "-" + time.Now().Format("20060102") + "." + format
+}
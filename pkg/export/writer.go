@@ -0,0 +1,189 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// export formats
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatHTML  = "html"
+)
+
+// ErrUnknownFormat is returned for a format that is not supported
+var ErrUnknownFormat = errors.New("Unknown export format, use jsonl, csv or html")
+
+// Writer writes an export one part at a time: the room, every message, then the end
+type Writer interface {
+	WriteRoom(room *RoomEntity) error
+	WriteMessage(message *MessageEntity) error
+	Close() error
+}
+
+// NewWriter creates the writer of a format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatJSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatHTML:
+		return &htmlWriter{w: w}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// jsonlWriter writes one JSON object per line, the room first
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+// jsonlRoom is the first line of a JSON lines export
+type jsonlRoom struct {
+	Type string `json:"type"`
+	*RoomEntity
+}
+
+// jsonlMessage is a message line of a JSON lines export
+type jsonlMessage struct {
+	Type string `json:"type"`
+	*MessageEntity
+}
+
+func (j *jsonlWriter) WriteRoom(room *RoomEntity) error {
+	return j.encoder.Encode(jsonlRoom{Type: "room", RoomEntity: room})
+}
+
+func (j *jsonlWriter) WriteMessage(message *MessageEntity) error {
+	return j.encoder.Encode(jsonlMessage{Type: "message", MessageEntity: message})
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes the room and its members as comment rows starting with #, then one row per message
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) WriteRoom(room *RoomEntity) error {
+	rows := [][]string{
+		{"#room", room.ID, room.Name, room.Description, room.Topic, room.CreatedAt},
+		{"#export", room.From, room.To, room.ExportedAt},
+	}
+	for _, member := range room.Members {
+		rows = append(rows, []string{"#member", member.ID, member.Username, member.Role})
+	}
+	rows = append(rows, []string{"id", "createdAt", "userId", "username", "content", "edited", "editedAt", "bot"})
+	for _, row := range rows {
+		if err := c.writer.Write(escapeCSV(row)); err != nil {
+			return err
+		}
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvWriter) WriteMessage(message *MessageEntity) error {
+	return c.writer.Write(escapeCSV([]string{
+		message.ID,
+		message.CreatedAt,
+		message.UserID,
+		message.Username,
+		message.Content,
+		strconv.FormatBool(message.Edited),
+		message.EditedAt,
+		strconv.FormatBool(message.Bot),
+	}))
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// escapeCSV prevents spreadsheets from reading user content as formulas
+func escapeCSV(row []string) []string {
+	for i, field := range row {
+		if i > 0 && field != "" && strings.ContainsAny(field[:1], "=+-@\t\r") {
+			row[i] = "'" + field
+		}
+	}
+	return row
+}
+
+// htmlWriter writes a self-contained HTML transcript
+type htmlWriter struct {
+	w io.Writer
+}
+
+var htmlTemplates = template.Must(template.New("room").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - transcript</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;max-width:860px;margin:2em auto;padding:0 1em;color:#222}
+header{border-bottom:1px solid #ddd;margin-bottom:1em}
+.meta{color:#666;font-size:.9em}
+.members span{display:inline-block;margin:0 .5em .3em 0;padding:.1em .5em;background:#f0f0f0;border-radius:3px;font-size:.85em}
+.message{padding:.4em 0;border-bottom:1px solid #f3f3f3}
+.message .author{font-weight:bold}
+.message time{color:#999;font-size:.8em;margin-left:.5em}
+.message .content{white-space:pre-wrap;word-wrap:break-word;margin-top:.2em}
+.marker{color:#999;font-style:italic;font-size:.8em;margin-left:.5em}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Topic}}<p><strong>Topic:</strong> {{.Topic}}</p>{{end}}
+<p class="meta">Created {{.CreatedAt}}{{if .Archived}} &middot; archived{{end}} &middot; exported {{.ExportedAt}}{{if .From}} &middot; from {{.From}}{{end}}{{if .To}} &middot; to {{.To}}{{end}}</p>
+<p class="members">{{range .Members}}<span title="{{.Role}}">{{.Username}}</span>{{end}}</p>
+</header>
+<main>
+`))
+
+func init() {
+	template.Must(htmlTemplates.New("message").Parse(`<div class="message" id="{{.ID}}">
+<span class="author">{{.Username}}</span>{{if .Bot}}<span class="marker">(bot)</span>{{end}}<time datetime="{{.CreatedAt}}">{{.CreatedAt}}</time>{{if .Edited}}<span class="marker" title="{{.EditedAt}}">(edited)</span>{{end}}
+<div class="content">{{.Content}}</div>
+</div>
+`))
+	template.Must(htmlTemplates.New("end").Parse(`</main>
+</body>
+</html>
+`))
+}
+
+func (h *htmlWriter) WriteRoom(room *RoomEntity) error {
+	return htmlTemplates.ExecuteTemplate(h.w, "room", room)
+}
+
+func (h *htmlWriter) WriteMessage(message *MessageEntity) error {
+	return htmlTemplates.ExecuteTemplate(h.w, "message", message)
+}
+
+func (h *htmlWriter) Close() error {
+	return htmlTemplates.ExecuteTemplate(h.w, "end", nil)
+}
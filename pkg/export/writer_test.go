@@ -0,0 +1,93 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func testRoom() *RoomEntity {
+	return &RoomEntity{ID: "room1", Name: "general", CreatedAt: "2024-01-01T00:00:00Z", ExportedAt: "2024-02-01T00:00:00Z",
+		Members: []*MemberEntity{{ID: "user1", Username: "alice", Role: "creator"}}}
+}
+
+// export writes a room and its messages in a format
+func export(t *testing.T, format string, messages ...*MessageEntity) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer, err := NewWriter(format, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteRoom(testRoom()); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		if err := writer.WriteMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+func TestCSVHasTheBotColumn(t *testing.T) {
+	out := export(t, FormatCSV,
+		&MessageEntity{ID: "m1", UserID: "bot1", Username: "deploy", Content: "done", CreatedAt: "2024-01-02T00:00:00Z", Bot: true},
+		&MessageEntity{ID: "m2", UserID: "user1", Username: "alice", Content: "=1+1", CreatedAt: "2024-01-02T00:01:00Z"})
+	reader := csv.NewReader(strings.NewReader(out))
+	// the metadata rows have their own lengths
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header []string
+	var messages [][]string
+	for _, row := range rows {
+		switch {
+		case row[0] == "id":
+			header = row
+		case !strings.HasPrefix(row[0], "#"):
+			messages = append(messages, row)
+		}
+	}
+	if len(header) == 0 || header[len(header)-1] != "bot" || len(messages) != 2 {
+		t.Fatalf("got the header %v and %d messages", header, len(messages))
+	}
+	if messages[0][len(header)-1] != "true" || messages[1][len(header)-1] != "false" {
+		t.Fatalf("got the messages %v", messages)
+	}
+	// user content is not read as a formula
+	if messages[1][4] != "'=1+1" {
+		t.Fatalf("got the content %q", messages[1][4])
+	}
+}
+
+func TestJSONLMarksBotsAndEdits(t *testing.T) {
+	out := export(t, FormatJSONL,
+		&MessageEntity{ID: "m1", Username: "deploy", Content: "done", Bot: true, Edited: true, EditedAt: "2024-01-03T00:00:00Z"})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"type":"room"`) {
+		t.Fatalf("got %q", out)
+	}
+	if !strings.Contains(lines[1], `"bot":true`) || !strings.Contains(lines[1], `"edited":true`) || strings.Contains(lines[1], "deleted") {
+		t.Fatalf("got the message %s", lines[1])
+	}
+}
+
+func TestHTMLEscapesTheContent(t *testing.T) {
+	out := export(t, FormatHTML, &MessageEntity{ID: "m1", Username: "deploy", Content: "<script>alert(1)</script>", Bot: true})
+	if strings.Contains(out, "<script>") || !strings.Contains(out, "(bot)") || !strings.HasSuffix(out, "</html>\n") {
+		t.Fatalf("got %s", out)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("xml", &bytes.Buffer{}); err != ErrUnknownFormat {
+		t.Fatalf("got %v, want ErrUnknownFormat", err)
+	}
+}
@@ -0,0 +1,143 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"chat-app/pkg/room"
+	"context"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"time"
+)
+
+// membershipEntity is a room of the user in the archive, with the roles of the user only
+type membershipEntity struct {
+	RoomID      string   `json:"roomId"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Roles       []string `json:"roles"`
+	CreatedAt   string   `json:"createdAt"`
+}
+
+// archiveReadme explains the content of the archive
+const archiveReadme = `Personal data export
+
+profile.json    your account, without the password hash
+rooms.json      the rooms you are a member of, moderate, own or wait for
+messages.jsonl  every message you wrote, one JSON object per line
+logins.json     your login history: date, IP address, browser and result
+reactions.json  reactions you added, this server does not store reactions
+reports.json    reports you filed, this server does not store reports
+`
+
+// writeArchive writes the zip archive of the data of a user
+func writeArchive(ctx context.Context, repo GdprRepository, userID string, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	if err := writeFile(archive, "README.txt", func(file io.Writer) error {
+		_, err := io.WriteString(file, archiveReadme)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	// profile
+	profile, err := repo.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(archive, "profile.json", profile); err != nil {
+		return err
+	}
+
+	// room memberships
+	rooms, err := repo.GetRooms(ctx, userID)
+	if err != nil {
+		return err
+	}
+	memberships := make([]*membershipEntity, 0, len(rooms))
+	for _, roomModel := range rooms {
+		memberships = append(memberships, &membershipEntity{
+			RoomID:      roomModel.ID.Hex(),
+			Name:        roomModel.Name,
+			Description: roomModel.Description,
+			Roles:       roomRoles(roomModel, userID),
+			CreatedAt:   roomModel.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := writeJSON(archive, "rooms.json", memberships); err != nil {
+		return err
+	}
+
+	// messages, written as they are read
+	if err := writeFile(archive, "messages.jsonl", func(file io.Writer) error {
+		encoder := json.NewEncoder(file)
+		return repo.StreamMessages(ctx, userID, func(message bson.M) error {
+			return encoder.Encode(message)
+		})
+	}); err != nil {
+		return err
+	}
+
+	// login history
+	logins, err := repo.GetLogins(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if logins == nil {
+		logins = []bson.M{}
+	}
+	if err := writeJSON(archive, "logins.json", logins); err != nil {
+		return err
+	}
+
+	// the server keeps no reactions nor reports, the files are there so the archive has every category
+	if err := writeJSON(archive, "reactions.json", []interface{}{}); err != nil {
+		return err
+	}
+	if err := writeJSON(archive, "reports.json", []interface{}{}); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// roomRoles returns the roles of a user in a room
+func roomRoles(roomModel *room.RoomModel, userID string) []string {
+	roles := []string{}
+	if roomModel.Creator == userID {
+		roles = append(roles, "owner")
+	}
+	for _, moderator := range roomModel.Moderators {
+		if moderator == userID {
+			roles = append(roles, "moderator")
+		}
+	}
+	for _, member := range roomModel.Members {
+		if member == userID {
+			roles = append(roles, "member")
+		}
+	}
+	for _, waiting := range roomModel.Waitlist {
+		if waiting == userID {
+			roles = append(roles, "waitlisted")
+		}
+	}
+	return roles
+}
+
+// writeFile adds a file to the archive
+func writeFile(archive *zip.Writer, name string, write func(io.Writer) error) error {
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	return write(file)
+}
+
+// writeJSON adds an indented JSON file to the archive
+func writeJSON(archive *zip.Writer, name string, v interface{}) error {
+	return writeFile(archive, name, func(file io.Writer) error {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	})
+}
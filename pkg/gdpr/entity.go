@@ -0,0 +1,14 @@
+package gdpr
+
+// JobEntity is a personal data export requested by a user
+type JobEntity struct {
+	ID         string `json:"_id"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"createdAt"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+	ExpiresAt  string `json:"expiresAt,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// DownloadURL is only given when the export is requested, it can be used once the export is ready
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
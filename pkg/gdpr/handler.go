@@ -0,0 +1,74 @@
+package gdpr
+
+import (
+	"chat-app/pkg/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"os"
+)
+
+// RequestExportHandler queues an export of the data of the user connected
+func RequestExportHandler(gdprService GdprService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request export"})
+			return
+		}
+		job, err := gdprService.RequestExport(c.Request.Context(), userID)
+		if errors.Is(err, ErrExportInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request export"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"export": job})
+	}
+}
+
+// GetExportsHandler returns the exports of the user connected
+func GetExportsHandler(gdprService GdprService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get exports"})
+			return
+		}
+		jobs, err := gdprService.GetExports(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get exports"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"exports": jobs})
+	}
+}
+
+// DownloadExportHandler sends the archive of an export once, the link is the only credential
+func DownloadExportHandler(gdprService GdprService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path, err := gdprService.ClaimDownload(c.Request.Context(), c.Param("token"))
+		if errors.Is(err, ErrExportNotReady) {
+			c.JSON(http.StatusAccepted, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrLinkInvalid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not download export"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.FileAttachment(path, "personal-data.zip")
+		// the link is used, the archive is not needed anymore
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove the downloaded archive %s: %v", path, err)
+		}
+	}
+}
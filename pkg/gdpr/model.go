@@ -0,0 +1,43 @@
+package gdpr
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// JobModel is a personal data export job, TokenHash is the SHA-256 of its download token
+type JobModel struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	UserID       string             `bson:"userId,omitempty"`
+	Status       string             `bson:"status,omitempty"`
+	TokenHash    string             `bson:"tokenHash,omitempty"`
+	Path         string             `bson:"path,omitempty"`
+	Size         int64              `bson:"size,omitempty"`
+	Error        string             `bson:"error,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt,omitempty"`
+	StartedAt    time.Time          `bson:"startedAt,omitempty"`
+	FinishedAt   time.Time          `bson:"finishedAt,omitempty"`
+	ExpiresAt    time.Time          `bson:"expiresAt,omitempty"`
+	DownloadedAt time.Time          `bson:"downloadedAt,omitempty"`
+}
+
+// ModelToEntity converts a job model to a job entity
+func ModelToEntity(job *JobModel) *JobEntity {
+	return &JobEntity{
+		ID:         job.ID.Hex(),
+		Status:     job.Status,
+		CreatedAt:  job.CreatedAt.String(),
+		FinishedAt: formatOptionalTime(job.FinishedAt),
+		ExpiresAt:  formatOptionalTime(job.ExpiresAt),
+		Size:       job.Size,
+		Error:      job.Error,
+	}
+}
+
+// formatOptionalTime formats a time, a zero time gives an empty string
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.String()
+}
@@ -0,0 +1,260 @@
+package gdpr
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// status of the export jobs
+const (
+	StatusPending    = "pending"
+	StatusRunning    = "running"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+	StatusDownloaded = "downloaded"
+	StatusExpired    = "expired"
+)
+
+// privateFields are the fields of a user never exported, like the password hash
+var privateFields = []string{"password"}
+
+// GdprRepository defines the methods of the export jobs and to read the data of a user
+type GdprRepository interface {
+	CreateJob(ctx context.Context, job *JobModel) error
+	HasActiveJob(ctx context.Context, userID string) (bool, error)
+	GetJobs(ctx context.Context, userID string) ([]*JobModel, error)
+	ClaimPendingJob(ctx context.Context) (*JobModel, error)
+	ResetRunningJobs(ctx context.Context) error
+	FinishJob(ctx context.Context, jobID primitive.ObjectID, path string, size int64, expiresAt time.Time) error
+	FailJob(ctx context.Context, jobID primitive.ObjectID, reason string) error
+	ClaimDownload(ctx context.Context, tokenHash string) (*JobModel, error)
+	GetJobByToken(ctx context.Context, tokenHash string) (*JobModel, error)
+	ExpireJobs(ctx context.Context) ([]*JobModel, error)
+
+	GetProfile(ctx context.Context, userID string) (bson.M, error)
+	GetRooms(ctx context.Context, userID string) ([]*room.RoomModel, error)
+	StreamMessages(ctx context.Context, userID string, fn func(bson.M) error) error
+	GetLogins(ctx context.Context, userID string) ([]bson.M, error)
+}
+
+// gdprRepository is the implementation of the GdprRepository interface
+type gdprRepository struct {
+	collection        *mongo.Collection
+	collectionUser    *mongo.Collection
+	collectionRoom    *mongo.Collection
+	collectionMessage *mongo.Collection
+	collectionLogin   *mongo.Collection
+}
+
+// NewGdprRepository creates a new personal data export repository
+func NewGdprRepository(collection *mongo.Collection, collectionUser *mongo.Collection, collectionRoom *mongo.Collection, collectionMessage *mongo.Collection, collectionLogin *mongo.Collection) GdprRepository {
+	return &gdprRepository{
+		collection:        collection,
+		collectionUser:    collectionUser,
+		collectionRoom:    collectionRoom,
+		collectionMessage: collectionMessage,
+		collectionLogin:   collectionLogin,
+	}
+}
+
+// CreateJob inserts a pending export job
+func (r *gdprRepository) CreateJob(ctx context.Context, job *JobModel) error {
+	job.ID = primitive.NewObjectID()
+	job.Status = StatusPending
+	job.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, job)
+	return err
+}
+
+// HasActiveJob checks if a user has an export pending or running
+func (r *gdprRepository) HasActiveJob(ctx context.Context, userID string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.D{{"userId", userID}, {"status", bson.D{{"$in", bson.A{StatusPending, StatusRunning}}}}})
+	return count > 0, err
+}
+
+// GetJobs returns the last export jobs of a user, most recent first
+func (r *gdprRepository) GetJobs(ctx context.Context, userID string) ([]*JobModel, error) {
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}}).SetLimit(20)
+	cursor, err := r.collection.Find(ctx, bson.D{{"userId", userID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var jobs []*JobModel
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimPendingJob marks the oldest pending job as running and returns it, or nil if there is none
+func (r *gdprRepository) ClaimPendingJob(ctx context.Context) (*JobModel, error) {
+	var job JobModel
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{"createdAt", 1}}).SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.D{{"status", StatusPending}},
+		bson.D{{"$set", bson.D{{"status", StatusRunning}, {"startedAt", time.Now()}}}}, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ResetRunningJobs puts back in the queue the jobs interrupted by a restart
+func (r *gdprRepository) ResetRunningJobs(ctx context.Context) error {
+	_, err := r.collection.UpdateMany(ctx, bson.D{{"status", StatusRunning}}, bson.D{{"$set", bson.D{{"status", StatusPending}}}})
+	return err
+}
+
+// FinishJob marks a job as ready to download until it expires
+func (r *gdprRepository) FinishJob(ctx context.Context, jobID primitive.ObjectID, path string, size int64, expiresAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.D{{"_id", jobID}}, bson.D{{"$set", bson.D{
+		{"status", StatusReady},
+		{"path", path},
+		{"size", size},
+		{"finishedAt", time.Now()},
+		{"expiresAt", expiresAt},
+	}}})
+	return err
+}
+
+// FailJob marks a job as failed
+func (r *gdprRepository) FailJob(ctx context.Context, jobID primitive.ObjectID, reason string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.D{{"_id", jobID}},
+		bson.D{{"$set", bson.D{{"status", StatusFailed}, {"error", reason}, {"finishedAt", time.Now()}}}})
+	return err
+}
+
+// ClaimDownload marks the ready and unexpired job of a token as downloaded and returns it, or nil.
+// The update is atomic so a link can only be used once.
+func (r *gdprRepository) ClaimDownload(ctx context.Context, tokenHash string) (*JobModel, error) {
+	var job JobModel
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.D{{"tokenHash", tokenHash}, {"status", StatusReady}, {"expiresAt", bson.D{{"$gt", time.Now()}}}},
+		bson.D{{"$set", bson.D{{"status", StatusDownloaded}, {"downloadedAt", time.Now()}}}}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJobByToken returns the job of a token
+func (r *gdprRepository) GetJobByToken(ctx context.Context, tokenHash string) (*JobModel, error) {
+	var job JobModel
+	err := r.collection.FindOne(ctx, bson.D{{"tokenHash", tokenHash}}).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ExpireJobs marks the ready jobs past their expiry as expired, and returns them so their archives are removed
+func (r *gdprRepository) ExpireJobs(ctx context.Context) ([]*JobModel, error) {
+	filter := bson.D{{"status", StatusReady}, {"expiresAt", bson.D{{"$lte", time.Now()}}}}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var jobs []*JobModel
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	_, err = r.collection.UpdateMany(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}, {"status", StatusReady}},
+		bson.D{{"$set", bson.D{{"status", StatusExpired}}}})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetProfile returns the user document, without its private fields
+func (r *gdprRepository) GetProfile(ctx context.Context, userID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	projection := bson.D{}
+	for _, field := range privateFields {
+		projection = append(projection, bson.E{Key: field, Value: 0})
+	}
+	var profile bson.M
+	err = r.collectionUser.FindOne(ctx, bson.D{{"_id", userObjectID}}, options.FindOne().SetProjection(projection)).Decode(&profile)
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetRooms returns the rooms the user is a member of, moderates, owns or waits for
+func (r *gdprRepository) GetRooms(ctx context.Context, userID string) ([]*room.RoomModel, error) {
+	filter := bson.D{{"$or", bson.A{
+		bson.D{{"members", userID}},
+		bson.D{{"moderators", userID}},
+		bson.D{{"creator", userID}},
+		bson.D{{"waitlist", userID}},
+	}}}
+	// the message IDs are not needed
+	opts := options.Find().SetProjection(bson.D{{"messages", 0}})
+	cursor, err := r.collectionRoom.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rooms []*room.RoomModel
+	if err = cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// StreamMessages calls fn on every message written by the user, oldest first
+func (r *gdprRepository) StreamMessages(ctx context.Context, userID string, fn func(bson.M) error) error {
+	cursor, err := r.collectionMessage.Find(ctx, bson.D{{"userId", userID}}, options.Find().SetSort(bson.D{{"createdAt", 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var message bson.M
+		if err := cursor.Decode(&message); err != nil {
+			return err
+		}
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetLogins returns the login history of the user, oldest first
+func (r *gdprRepository) GetLogins(ctx context.Context, userID string) ([]bson.M, error) {
+	cursor, err := r.collectionLogin.Find(ctx, bson.D{{"userId", userID}}, options.Find().SetSort(bson.D{{"createdAt", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var logins []bson.M
+	if err = cursor.All(ctx, &logins); err != nil {
+		return nil, err
+	}
+	return logins, nil
+}
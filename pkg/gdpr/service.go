@@ -0,0 +1,229 @@
+package gdpr
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrExportInProgress is returned when a user requests an export while another one is not finished
+	ErrExportInProgress = errors.New("An export is already in progress")
+	// ErrExportNotReady is returned when a link is used before its export is ready
+	ErrExportNotReady = errors.New("The export is not ready yet")
+	// ErrLinkInvalid is returned for a link unknown, expired or already used
+	ErrLinkInvalid = errors.New("The link is invalid, expired or already used")
+)
+
+// Config holds the settings of the personal data exports
+type Config struct {
+	// Dir is the directory of the archives
+	Dir string
+	// LinkTTL is how long an archive can be downloaded once ready
+	LinkTTL time.Duration
+	// Interval is the time between two checks of the pending jobs and expired archives
+	Interval time.Duration
+}
+
+// ConfigFromEnv reads the export settings from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{Dir: filepath.Join("data", "exports"), LinkTTL: 24 * time.Hour, Interval: time.Minute}
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		config.Dir = filepath.Join(dir, "exports")
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("EXPORT_LINK_TTL")); err == nil && ttl > 0 {
+		config.LinkTTL = ttl
+	}
+	return config
+}
+
+// GdprService defines the methods of the personal data exports
+type GdprService interface {
+	RequestExport(ctx context.Context, userID string) (*JobEntity, error)
+	GetExports(ctx context.Context, userID string) ([]*JobEntity, error)
+	ClaimDownload(ctx context.Context, token string) (string, error)
+	Start(ctx context.Context)
+}
+
+// gdprService is the implementation of the GdprService interface
+type gdprService struct {
+	repo   GdprRepository
+	config Config
+	// wake starts the worker without waiting for the next interval
+	wake chan struct{}
+}
+
+// NewGdprService creates a new personal data export service
+func NewGdprService(repo GdprRepository, config Config) GdprService {
+	return &gdprService{repo: repo, config: config, wake: make(chan struct{}, 1)}
+}
+
+// RequestExport queues an export of the data of a user, the download URL is only returned here
+func (s *gdprService) RequestExport(ctx context.Context, userID string) (*JobEntity, error) {
+	active, err := s.repo.HasActiveJob(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		return nil, ErrExportInProgress
+	}
+
+	// only the hash of the token is stored
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	job := &JobModel{UserID: userID, TokenHash: hashToken(token)}
+	if err := s.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	jobEntity := ModelToEntity(job)
+	jobEntity.DownloadURL = "/exports/" + token
+	return jobEntity, nil
+}
+
+// GetExports returns the last exports of a user
+func (s *gdprService) GetExports(ctx context.Context, userID string) ([]*JobEntity, error) {
+	jobs, err := s.repo.GetJobs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	jobEntities := make([]*JobEntity, 0, len(jobs))
+	for _, job := range jobs {
+		jobEntities = append(jobEntities, ModelToEntity(job))
+	}
+	return jobEntities, nil
+}
+
+// ClaimDownload uses the link of an export and returns the path of its archive.
+// The archive can only be downloaded once, the caller removes it after sending it.
+func (s *gdprService) ClaimDownload(ctx context.Context, token string) (string, error) {
+	tokenHash := hashToken(token)
+	job, err := s.repo.ClaimDownload(ctx, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	if job == nil {
+		// tell the user to come back if the export is not finished
+		if pending, err := s.repo.GetJobByToken(ctx, tokenHash); err == nil &&
+			(pending.Status == StatusPending || pending.Status == StatusRunning) {
+			return "", ErrExportNotReady
+		}
+		return "", ErrLinkInvalid
+	}
+	return job.Path, nil
+}
+
+// Start builds the pending archives and removes the expired ones until the context is done
+func (s *gdprService) Start(ctx context.Context) {
+	if err := os.MkdirAll(s.config.Dir, 0700); err != nil {
+		log.Printf("Failed to create the exports directory: %v", err)
+	}
+	// the jobs interrupted by a restart are built again
+	if err := s.repo.ResetRunningJobs(ctx); err != nil {
+		log.Printf("Failed to reset the running exports: %v", err)
+	}
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		s.runPendingJobs(ctx)
+		s.removeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// runPendingJobs builds the archives of the pending jobs one by one
+func (s *gdprService) runPendingJobs(ctx context.Context) {
+	for {
+		job, err := s.repo.ClaimPendingJob(ctx)
+		if err != nil {
+			log.Printf("Failed to get the pending exports: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		path, size, err := s.build(ctx, job)
+		if err != nil {
+			log.Printf("Export %s of user %s failed: %v", job.ID.Hex(), job.UserID, err)
+			if err := s.repo.FailJob(ctx, job.ID, "Could not build the archive"); err != nil {
+				log.Printf("Failed to mark export %s as failed: %v", job.ID.Hex(), err)
+			}
+			continue
+		}
+		if err := s.repo.FinishJob(ctx, job.ID, path, size, time.Now().Add(s.config.LinkTTL)); err != nil {
+			log.Printf("Failed to mark export %s as ready: %v", job.ID.Hex(), err)
+			os.Remove(path)
+		}
+	}
+}
+
+// build writes the archive of a job, to a temporary file renamed once complete
+func (s *gdprService) build(ctx context.Context, job *JobModel) (string, int64, error) {
+	path := filepath.Join(s.config.Dir, job.ID.Hex()+".zip")
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+	err = writeArchive(ctx, s.repo, job.UserID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return "", 0, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+// removeExpired removes the archives not downloaded before their expiry
+func (s *gdprService) removeExpired(ctx context.Context) {
+	jobs, err := s.repo.ExpireJobs(ctx)
+	if err != nil {
+		log.Printf("Failed to expire the exports: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if err := os.Remove(job.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove the archive of export %s: %v", job.ID.Hex(), err)
+		}
+	}
+}
+
+// newToken creates a random download token
+func newToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashToken returns the SHA-256 of a token, as stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunCommand runs the import command line:
+// import (-slack export.zip | -irc channel.log [-channel name] [-date YYYY-MM-DD]) -creator <admin> [-merge] [-apply]
+// The report of a dry run is always printed first, the import is only written with -apply.
+func RunCommand(ctx context.Context, importService ImportService, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	slackFile := flags.String("slack", "", "Slack export zip to import")
+	ircFile := flags.String("irc", "", "IRC log file to import")
+	channel := flags.String("channel", "", "channel of the IRC log, the file name by default")
+	date := flags.String("date", "", "date of an IRC log without dates, YYYY-MM-DD")
+	creator := flags.String("creator", "", "username of the admin creating the rooms")
+	merge := flags.Bool("merge", false, "map the authors to the local users with the same name, instead of placeholders")
+	apply := flags.Bool("apply", false, "write the import, after the dry-run report")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*slackFile == "") == (*ircFile == "") || *creator == "" {
+		flags.Usage()
+		return fmt.Errorf("one of -slack or -irc, and -creator are required")
+	}
+
+	// read the file to import
+	var archive *ArchiveEntity
+	if *slackFile != "" {
+		file, err := os.Open(*slackFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if archive, err = ParseSlack(file, info.Size()); err != nil {
+			return err
+		}
+	} else {
+		var day time.Time
+		if *date != "" {
+			var err error
+			if day, err = time.Parse("2006-01-02", *date); err != nil {
+				return fmt.Errorf("invalid date %q, use YYYY-MM-DD", *date)
+			}
+		}
+		if *channel == "" {
+			*channel = strings.TrimSuffix(filepath.Base(*ircFile), filepath.Ext(*ircFile))
+		}
+		file, err := os.Open(*ircFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if archive, err = ParseIRC(file, *channel, day); err != nil {
+			return err
+		}
+	}
+
+	// dry run first
+	report, err := importService.Import(ctx, archive, *creator, *merge, true)
+	if err != nil {
+		return err
+	}
+	printReport(out, report)
+	if !*apply {
+		fmt.Fprintln(out, "Dry run only, run again with -apply to import")
+		return nil
+	}
+
+	report, err = importService.Import(ctx, archive, *creator, *merge, false)
+	if err != nil {
+		return err
+	}
+	printReport(out, report)
+	return nil
+}
+
+// printReport prints what an import does, or did
+func printReport(out io.Writer, report *ReportEntity) {
+	if report.DryRun {
+		fmt.Fprintf(out, "Dry run of the %s import\n", report.Source)
+	} else {
+		fmt.Fprintf(out, "Import of %s done\n", report.Source)
+	}
+	fmt.Fprintln(out, "Rooms:")
+	for _, room := range report.Rooms {
+		action := "existing"
+		if room.Create {
+			action = "new"
+		}
+		fmt.Fprintf(out, "  %-20s <- %-20s %-8s %d messages, %d new\n", room.Room, room.Channel, action, room.Messages, room.NewMessages)
+	}
+	fmt.Fprintln(out, "Users:")
+	for _, user := range report.Users {
+		action := "imported before"
+		if user.Create {
+			action = "new placeholder"
+		} else if user.Merge {
+			action = "local user"
+		}
+		fmt.Fprintf(out, "  %-10s <- %-20s %s\n", user.Username, user.Author, action)
+	}
+	fmt.Fprintf(out, "Messages: %d, %d new, %d already imported, %d other lines or events skipped\n",
+		report.Messages, report.NewMessages, report.Messages-report.NewMessages, report.Skipped)
+}
@@ -0,0 +1,62 @@
+package importer
+
+import "time"
+
+// ArchiveEntity is the content of an import file
+type ArchiveEntity struct {
+	Source   string
+	Channels []*ChannelEntity
+	// Skipped counts the lines or events that are not messages, like joins and leaves
+	Skipped int
+}
+
+// ChannelEntity is a channel of an import file, imported as a room
+type ChannelEntity struct {
+	ExternalID  string
+	Name        string
+	Description string
+	Topic       string
+	Messages    []*MessageEntity
+}
+
+// MessageEntity is a message of an import file
+type MessageEntity struct {
+	// ExternalID identifies the message in its source, it makes the import idempotent
+	ExternalID string
+	// Author identifies the author in its source, AuthorName is the name to give to a placeholder user
+	Author     string
+	AuthorName string
+	Content    string
+	CreatedAt  time.Time
+	EditedAt   time.Time
+}
+
+// ReportEntity describes what an import does, or did
+type ReportEntity struct {
+	Source      string              `json:"source"`
+	DryRun      bool                `json:"dryRun"`
+	Rooms       []*RoomReportEntity `json:"rooms"`
+	Users       []*UserReportEntity `json:"users"`
+	Messages    int                 `json:"messages"`
+	NewMessages int                 `json:"newMessages"`
+	Skipped     int                 `json:"skipped"`
+}
+
+// RoomReportEntity describes the import of a channel in a room
+type RoomReportEntity struct {
+	Channel     string `json:"channel"`
+	Room        string `json:"room"`
+	RoomID      string `json:"roomId,omitempty"`
+	Create      bool   `json:"create"`
+	Messages    int    `json:"messages"`
+	NewMessages int    `json:"newMessages"`
+}
+
+// UserReportEntity describes the mapping of an author to a user
+type UserReportEntity struct {
+	Author   string `json:"author"`
+	Username string `json:"username"`
+	UserID   string `json:"userId,omitempty"`
+	Create   bool   `json:"create"`
+	Merge    bool   `json:"merge"`
+}
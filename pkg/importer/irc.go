@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ircDated matches a message with a full date: 2024-01-02 12:34:56 <nick> text, brackets and T separator optional
+	ircDated = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2})[T ](\d{2}:\d{2}(?::\d{2})?)(Z|[+-]\d{2}:?\d{2})?\]?\s+(?:<[~&@%+ ]?([^>\s]+)>|\*\s+(\S+))\s?(.*)$`)
+	// ircTimed matches a message with a time only: [12:34] <nick> text
+	ircTimed = regexp.MustCompile(`^\[?(\d{2}:\d{2}(?::\d{2})?)\]?\s+(?:<[~&@%+ ]?([^>\s]+)>|\*\s+(\S+))\s?(.*)$`)
+	// ircDay matches the irssi lines giving the date of the next messages
+	ircDay = regexp.MustCompile(`^--- (?:Log opened|Day changed) (?:\w{3} )?(\w{3} \d{1,2}(?: \d{2}:\d{2}:\d{2})? \d{4})`)
+)
+
+// ParseIRC reads a plain-text IRC log of a channel. Times without a zone are UTC.
+// The logs with a time only on each line need the date from irssi day lines, or the date given.
+func ParseIRC(r io.Reader, channel string, date time.Time) (*ArchiveEntity, error) {
+	channel = strings.TrimLeft(channel, "#&")
+	imported := &ChannelEntity{ExternalID: channel, Name: channel, Description: "Imported from IRC"}
+	result := &ArchiveEntity{Source: "irc", Channels: []*ChannelEntity{imported}}
+
+	// the same line can appear several times, the occurrence keeps the IDs distinct
+	occurrences := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var createdAt time.Time
+		var nick, action, text string
+		if parts := ircDay.FindStringSubmatch(line); parts != nil {
+			day, err := parseIRCDay(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			date = day
+			continue
+		} else if parts := ircDated.FindStringSubmatch(line); parts != nil {
+			value := parts[1] + "T" + parts[2]
+			if len(parts[2]) == 5 {
+				value += ":00"
+			}
+			zone := firstNonEmpty(parts[3], "Z")
+			if len(zone) == 5 {
+				zone = zone[:3] + ":" + zone[3:]
+			}
+			parsed, err := time.Parse(time.RFC3339, value+zone)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			createdAt, nick, action, text = parsed.UTC(), parts[4], parts[5], parts[6]
+		} else if parts := ircTimed.FindStringSubmatch(line); parts != nil {
+			if date.IsZero() {
+				return nil, fmt.Errorf("line %d: the log gives no date, set the date of the log", lineNumber)
+			}
+			value := parts[1]
+			if len(value) == 5 {
+				value += ":00"
+			}
+			clock, err := time.Parse("15:04:05", value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			createdAt = time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+			nick, action, text = parts[2], parts[3], parts[4]
+		} else {
+			// joins, parts, quits, mode changes...
+			result.Skipped++
+			continue
+		}
+
+		// actions, * nick does something, are imported in italic
+		if action != "" {
+			nick, text = action, "_"+strings.TrimSpace(text)+"_"
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || text == "__" {
+			result.Skipped++
+			continue
+		}
+
+		key := createdAt.Format(time.RFC3339) + "\x00" + nick + "\x00" + text
+		occurrences[key]++
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%d", key, occurrences[key])))
+		imported.Messages = append(imported.Messages, &MessageEntity{
+			ExternalID: channel + ":" + hex.EncodeToString(sum[:]),
+			Author:     nick,
+			AuthorName: nick,
+			Content:    text,
+			CreatedAt:  createdAt,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseIRCDay parses the date of an irssi day line, like Jan 02 2024 or Jan 02 00:00:00 2024
+func parseIRCDay(value string) (time.Time, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 4 {
+		fields = []string{fields[0], fields[1], fields[3]}
+	}
+	return time.Parse("Jan 2 2006", strings.Join(fields, " "))
+}
@@ -0,0 +1,31 @@
+package importer
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// MessageModel is an imported message, ImportID is unique to its source message
+type MessageModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	RoomID    string             `bson:"roomId,omitempty"`
+	Username  string             `bson:"username,omitempty"`
+	UserID    string             `bson:"userId,omitempty"`
+	Content   string             `bson:"content,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+	EditedAt  time.Time          `bson:"editedAt,omitempty"`
+	ImportID  string             `bson:"importId,omitempty"`
+}
+
+// PlaceholderUserModel is a user created for an author unknown to the server.
+// It is invalid and has no password, so nobody can log in with it.
+type PlaceholderUserModel struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Username    string             `bson:"username,omitempty"`
+	Role        string             `bson:"role,omitempty"`
+	Validity    string             `bson:"validity,omitempty"`
+	Placeholder bool               `bson:"placeholder,omitempty"`
+	ImportedAs  string             `bson:"importedAs,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt,omitempty"`
+	UpdatedAt   time.Time          `bson:"updatedAt,omitempty"`
+}
@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ImportRepository defines the methods to write the imported rooms, users and messages
+type ImportRepository interface {
+	FindUserID(ctx context.Context, username string) (string, bool, error)
+	FindImportedUser(ctx context.Context, importedAs string) (string, string, bool, error)
+	FindAdminID(ctx context.Context, username string) (string, bool, error)
+	CreatePlaceholderUser(ctx context.Context, username string, author string) (string, error)
+	FindRoomID(ctx context.Context, name string) (string, bool, error)
+	CreateRoom(ctx context.Context, room *room.RoomModel) (string, error)
+	AddMembers(ctx context.Context, roomID string, userIDs []string) error
+	CountImported(ctx context.Context, importIDs []string) (int, error)
+	InsertMessages(ctx context.Context, roomID string, messages []*MessageModel) (int, error)
+}
+
+// importRepository is the implementation of the ImportRepository interface
+type importRepository struct {
+	collectionUser    *mongo.Collection
+	collectionRoom    *mongo.Collection
+	collectionMessage *mongo.Collection
+}
+
+// NewImportRepository creates a new import repository
+func NewImportRepository(collectionUser *mongo.Collection, collectionRoom *mongo.Collection, collectionMessage *mongo.Collection) ImportRepository {
+	return &importRepository{
+		collectionUser:    collectionUser,
+		collectionRoom:    collectionRoom,
+		collectionMessage: collectionMessage,
+	}
+}
+
+// FindUserID returns the ID of the user with a username, and whether it exists
+func (r *importRepository) FindUserID(ctx context.Context, username string) (string, bool, error) {
+	return findID(ctx, r.collectionUser, bson.D{{"username", username}})
+}
+
+// FindImportedUser returns the ID and username of the placeholder user of an imported author, and whether it exists
+func (r *importRepository) FindImportedUser(ctx context.Context, importedAs string) (string, string, bool, error) {
+	var user PlaceholderUserModel
+	err := r.collectionUser.FindOne(ctx, bson.D{{"importedAs", importedAs}},
+		options.FindOne().SetProjection(bson.D{{"_id", 1}, {"username", 1}})).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	return user.ID.Hex(), user.Username, true, nil
+}
+
+// FindAdminID returns the ID of the valid admin with a username, and whether it exists
+func (r *importRepository) FindAdminID(ctx context.Context, username string) (string, bool, error) {
+	return findID(ctx, r.collectionUser, bson.D{{"username", username}, {"role", "admin"}, {"validity", "valid"}})
+}
+
+// CreatePlaceholderUser creates an invalid user for an imported author
+func (r *importRepository) CreatePlaceholderUser(ctx context.Context, username string, author string) (string, error) {
+	user := &PlaceholderUserModel{
+		ID:          primitive.NewObjectID(),
+		Username:    username,
+		Role:        "user",
+		Validity:    "invalid",
+		Placeholder: true,
+		ImportedAs:  author,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	_, err := r.collectionUser.InsertOne(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	return user.ID.Hex(), nil
+}
+
+// FindRoomID returns the ID of the room with a name, and whether it exists
+func (r *importRepository) FindRoomID(ctx context.Context, name string) (string, bool, error) {
+	return findID(ctx, r.collectionRoom, bson.D{{"name", name}})
+}
+
+// CreateRoom inserts an imported room
+func (r *importRepository) CreateRoom(ctx context.Context, room *room.RoomModel) (string, error) {
+	room.ID = primitive.NewObjectID()
+	_, err := r.collectionRoom.InsertOne(ctx, room)
+	if err != nil {
+		return "", err
+	}
+	return room.ID.Hex(), nil
+}
+
+// AddMembers adds users to the members of a room, and the room to the joined rooms of the users
+func (r *importRepository) AddMembers(ctx context.Context, roomID string, userIDs []string) error {
+	roomObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return err
+	}
+	_, err = r.collectionRoom.UpdateOne(ctx, bson.D{{"_id", roomObjectID}},
+		bson.D{{"$addToSet", bson.D{{"members", bson.D{{"$each", userIDs}}}}}})
+	if err != nil {
+		return err
+	}
+	ids := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	_, err = r.collectionUser.UpdateMany(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}},
+		bson.D{{"$addToSet", bson.D{{"joinedRooms", roomID}}}})
+	return err
+}
+
+// CountImported returns how many of the import IDs are already in the messages
+func (r *importRepository) CountImported(ctx context.Context, importIDs []string) (int, error) {
+	if len(importIDs) == 0 {
+		return 0, nil
+	}
+	count, err := r.collectionMessage.CountDocuments(ctx, bson.D{{"importId", bson.D{{"$in", importIDs}}}})
+	return int(count), err
+}
+
+// InsertMessages inserts the messages that are not imported yet, and adds them to the room.
+// It returns the number of messages inserted.
+func (r *importRepository) InsertMessages(ctx context.Context, roomID string, messages []*MessageModel) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	roomObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	// upsert on the import ID, so a message imported again is left as is
+	writes := make([]mongo.WriteModel, 0, len(messages))
+	for _, message := range messages {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"importId", message.ImportID}}).
+			SetUpdate(bson.D{{"$setOnInsert", message}}).
+			SetUpsert(true))
+	}
+	result, err := r.collectionMessage.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	if len(result.UpsertedIDs) == 0 {
+		return 0, nil
+	}
+
+	// the IDs are created from the original times, so sorting them keeps the room messages in order
+	ids := make([]string, 0, len(result.UpsertedIDs))
+	for _, id := range result.UpsertedIDs {
+		if objectID, ok := id.(primitive.ObjectID); ok {
+			ids = append(ids, objectID.Hex())
+		}
+	}
+	_, err = r.collectionRoom.UpdateOne(ctx, bson.D{{"_id", roomObjectID}},
+		bson.D{{"$push", bson.D{{"messages", bson.D{{"$each", ids}, {"$sort", 1}}}}}})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// findID returns the ID of the first document matching a filter, and whether it exists
+func findID(ctx context.Context, collection *mongo.Collection, filter bson.D) (string, bool, error) {
+	var document struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.D{{"_id", 1}})).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return document.ID.Hex(), true, nil
+}
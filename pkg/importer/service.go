@@ -0,0 +1,284 @@
+package importer
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// batchSize is the number of messages written at once
+const batchSize = 500
+
+// placeholderPrefix marks the usernames of the placeholder users, so they cannot pass for local accounts
+const placeholderPrefix = "imp_"
+
+// ErrInvalidCreator is returned when the creator of the imported rooms is not a valid admin
+var ErrInvalidCreator = errors.New("The creator of the rooms must be a valid admin")
+
+// ImportService defines the methods to import the history of other chats
+type ImportService interface {
+	Import(ctx context.Context, archive *ArchiveEntity, creator string, merge bool, dryRun bool) (*ReportEntity, error)
+}
+
+// importService is the implementation of the ImportService interface
+type importService struct {
+	repo ImportRepository
+}
+
+// NewImportService creates a new import service
+func NewImportService(repo ImportRepository) ImportService {
+	return &importService{repo: repo}
+}
+
+// Import maps the channels to rooms and the authors to users, then inserts the messages not imported yet.
+// An author goes to the placeholder user of a previous import of the same source, or to a new placeholder.
+// With merge, an author without placeholder goes to the local user with the same name instead.
+// With dryRun, nothing is written and the report tells what the import would do.
+func (s *importService) Import(ctx context.Context, archive *ArchiveEntity, creator string, merge bool, dryRun bool) (*ReportEntity, error) {
+	report := &ReportEntity{Source: archive.Source, DryRun: dryRun, Skipped: archive.Skipped}
+
+	// the rooms are created by an admin
+	creatorID, ok, err := s.repo.FindAdminID(ctx, creator)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCreator
+	}
+
+	// map the authors to users, in a stable order so an import run again gives the same usernames
+	authors := make(map[string]string)
+	for _, channel := range archive.Channels {
+		for _, message := range channel.Messages {
+			authors[message.Author] = message.AuthorName
+		}
+	}
+	keys := make([]string, 0, len(authors))
+	for author := range authors {
+		keys = append(keys, author)
+	}
+	sort.Strings(keys)
+	userIDs := make(map[string]string, len(authors))
+	usernames := make(map[string]string, len(authors))
+	taken := make(map[string]bool, len(authors))
+	for _, author := range keys {
+		userReport, err := s.mapAuthor(ctx, archive.Source, author, authors[author], merge, dryRun, taken)
+		if err != nil {
+			return nil, err
+		}
+		taken[userReport.Username] = true
+		userIDs[author], usernames[author] = userReport.UserID, userReport.Username
+		report.Users = append(report.Users, userReport)
+	}
+
+	// map the channels to rooms
+	for _, channel := range archive.Channels {
+		roomReport, err := s.importChannel(ctx, archive.Source, channel, creatorID, userIDs, usernames, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %v", channel.Name, err)
+		}
+		report.Rooms = append(report.Rooms, roomReport)
+		report.Messages += roomReport.Messages
+		report.NewMessages += roomReport.NewMessages
+	}
+	return report, nil
+}
+
+// importChannel imports the messages of a channel in its room
+func (s *importService) importChannel(ctx context.Context, source string, channel *ChannelEntity, creatorID string, userIDs, usernames map[string]string, dryRun bool) (*RoomReportEntity, error) {
+	name := normalizeName(channel.Name, 1, 20, "imported")
+	report := &RoomReportEntity{Channel: channel.Name, Room: name, Messages: len(channel.Messages)}
+	roomID, exists, err := s.repo.FindRoomID(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	report.RoomID, report.Create = roomID, !exists
+
+	if dryRun {
+		// count the messages already imported
+		imported := 0
+		for start := 0; start < len(channel.Messages); start += batchSize {
+			ids := make([]string, 0, batchSize)
+			for _, message := range channel.Messages[start:minInt(start+batchSize, len(channel.Messages))] {
+				ids = append(ids, source+":"+message.ExternalID)
+			}
+			count, err := s.repo.CountImported(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			imported += count
+		}
+		report.NewMessages = len(channel.Messages) - imported
+		return report, nil
+	}
+
+	if !exists {
+		roomID, err = s.repo.CreateRoom(ctx, &room.RoomModel{
+			Name:        name,
+			Description: roomDescription(channel.Description, source),
+			Topic:       truncate(channel.Topic, 120),
+			Creator:     creatorID,
+			Members:     []string{creatorID},
+			Messages:    []string{},
+			Hashtags:    []string{"#room"},
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.RoomID = roomID
+	}
+
+	// the authors become members of the room
+	members := make(map[string]bool)
+	for _, message := range channel.Messages {
+		members[userIDs[message.Author]] = true
+	}
+	memberIDs := make([]string, 0, len(members))
+	for memberID := range members {
+		memberIDs = append(memberIDs, memberID)
+	}
+	if len(memberIDs) > 0 {
+		if err := s.repo.AddMembers(ctx, roomID, memberIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	// insert the messages with their original times
+	for start := 0; start < len(channel.Messages); start += batchSize {
+		batch := channel.Messages[start:minInt(start+batchSize, len(channel.Messages))]
+		models := make([]*MessageModel, 0, len(batch))
+		for _, message := range batch {
+			models = append(models, &MessageModel{
+				ID:        primitive.NewObjectIDFromTimestamp(message.CreatedAt),
+				RoomID:    roomID,
+				UserID:    userIDs[message.Author],
+				Username:  usernames[message.Author],
+				Content:   message.Content,
+				CreatedAt: message.CreatedAt,
+				EditedAt:  message.EditedAt,
+				ImportID:  source + ":" + message.ExternalID,
+			})
+		}
+		inserted, err := s.repo.InsertMessages(ctx, roomID, models)
+		if err != nil {
+			return nil, err
+		}
+		report.NewMessages += inserted
+	}
+	return report, nil
+}
+
+// mapAuthor finds or creates the user of an author, the author is identified by its source and its ID there
+func (s *importService) mapAuthor(ctx context.Context, source string, author string, authorName string, merge bool, dryRun bool, taken map[string]bool) (*UserReportEntity, error) {
+	importedAs := source + ":" + author
+	userID, username, exists, err := s.repo.FindImportedUser(ctx, importedAs)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return &UserReportEntity{Author: authorName, Username: username, UserID: userID}, nil
+	}
+
+	if merge {
+		username = normalizeName(authorName, 3, 10, "user")
+		if userID, exists, err = s.repo.FindUserID(ctx, username); err != nil {
+			return nil, err
+		}
+		if exists {
+			return &UserReportEntity{Author: authorName, Username: username, UserID: userID, Merge: true}, nil
+		}
+	}
+
+	// a new placeholder takes a marked name free on the server and in this import
+	name := placeholderPrefix + normalizeName(authorName, 1, 10-len(placeholderPrefix), "user")
+	for {
+		username = uniqueName(name, 10, taken)
+		_, exists, err := s.repo.FindUserID(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			break
+		}
+		taken[username] = true
+	}
+	if !dryRun {
+		if userID, err = s.repo.CreatePlaceholderUser(ctx, username, importedAs); err != nil {
+			return nil, err
+		}
+	}
+	return &UserReportEntity{Author: authorName, Username: username, UserID: userID, Create: true}, nil
+}
+
+// normalizeName keeps the letters, digits and underscores of a name allowed for users and rooms
+func normalizeName(name string, minLength, maxLength int, fallback string) string {
+	var builder strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			builder.WriteRune(r)
+		case r == '-' || r == '.' || r == ' ':
+			builder.WriteRune('_')
+		}
+	}
+	normalized := strings.Trim(builder.String(), "_")
+	if normalized == "" {
+		normalized = fallback
+	}
+	for len(normalized) < minLength {
+		normalized += "_"
+	}
+	return truncate(normalized, maxLength)
+}
+
+// uniqueName adds a number to a name already taken by another author
+func uniqueName(name string, maxLength int, taken map[string]bool) string {
+	candidate := name
+	for i := 1; taken[candidate]; i++ {
+		suffix := fmt.Sprint(i)
+		candidate = truncate(name, maxLength-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+// roomDescription keeps the characters allowed in room descriptions
+func roomDescription(description string, source string) string {
+	var builder strings.Builder
+	for _, r := range description {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ' ' {
+			builder.WriteRune(r)
+		}
+	}
+	cleaned := strings.Join(strings.Fields(builder.String()), " ")
+	if len(cleaned) < 10 {
+		return "Imported from " + source
+	}
+	return truncate(cleaned, 300)
+}
+
+// truncate cuts a string to a length in bytes, without cutting a character
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length]
+}
+
+// minInt returns the smallest of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testRepository keeps the users in memory, the rooms and messages are only counted
+type testRepository struct {
+	ImportRepository
+	users    map[string]string
+	imported map[string]string
+	messages map[string]string
+}
+
+func newTestRepository() *testRepository {
+	return &testRepository{
+		users:    map[string]string{"admin": "id-admin", "bob": "id-bob"},
+		imported: make(map[string]string),
+		messages: make(map[string]string),
+	}
+}
+
+func (r *testRepository) FindUserID(ctx context.Context, username string) (string, bool, error) {
+	id, ok := r.users[username]
+	return id, ok, nil
+}
+
+func (r *testRepository) FindImportedUser(ctx context.Context, importedAs string) (string, string, bool, error) {
+	username, ok := r.imported[importedAs]
+	return r.users[username], username, ok, nil
+}
+
+func (r *testRepository) FindAdminID(ctx context.Context, username string) (string, bool, error) {
+	if username != "admin" {
+		return "", false, nil
+	}
+	return r.users[username], true, nil
+}
+
+func (r *testRepository) CreatePlaceholderUser(ctx context.Context, username string, author string) (string, error) {
+	id := fmt.Sprint("id-", len(r.users))
+	r.users[username], r.imported[author] = id, username
+	return id, nil
+}
+
+func (r *testRepository) FindRoomID(ctx context.Context, name string) (string, bool, error) {
+	return "id-room", true, nil
+}
+
+func (r *testRepository) CreateRoom(ctx context.Context, room *room.RoomModel) (string, error) {
+	return "id-room", nil
+}
+
+func (r *testRepository) AddMembers(ctx context.Context, roomID string, userIDs []string) error {
+	return nil
+}
+
+func (r *testRepository) CountImported(ctx context.Context, importIDs []string) (int, error) {
+	return 0, nil
+}
+
+func (r *testRepository) InsertMessages(ctx context.Context, roomID string, messages []*MessageModel) (int, error) {
+	for _, message := range messages {
+		r.messages[message.ImportID] = message.UserID
+	}
+	return len(messages), nil
+}
+
+// testArchive has a message of bob, who has a local account of the same name, and of alice
+func testArchive() *ArchiveEntity {
+	return &ArchiveEntity{Source: "slack", Channels: []*ChannelEntity{{
+		Name: "general",
+		Messages: []*MessageEntity{
+			{ExternalID: "1", Author: "U1", AuthorName: "bob", Content: "hi", CreatedAt: time.Unix(1700000000, 0)},
+			{ExternalID: "2", Author: "U2", AuthorName: "alice", Content: "hello", CreatedAt: time.Unix(1700000060, 0)},
+		},
+	}}}
+}
+
+func TestImportDoesNotWriteAsLocalUsers(t *testing.T) {
+	repo := newTestRepository()
+	report, err := NewImportService(repo).Import(context.Background(), testArchive(), "admin", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.messages["slack:1"] == "id-bob" {
+		t.Fatal("the message of the imported bob was written as the local bob")
+	}
+	if repo.imported["slack:U1"] != "imp_bob" || repo.imported["slack:U2"] != "imp_alice" {
+		t.Fatalf("got the placeholders %v", repo.imported)
+	}
+	for _, user := range report.Users {
+		if !user.Create || user.Merge {
+			t.Fatalf("got %+v, want a new placeholder", user)
+		}
+	}
+}
+
+func TestImportAgainFindsThePlaceholders(t *testing.T) {
+	repo := newTestRepository()
+	service := NewImportService(repo)
+	if _, err := service.Import(context.Background(), testArchive(), "admin", false, false); err != nil {
+		t.Fatal(err)
+	}
+	users := len(repo.users)
+	report, err := service.Import(context.Background(), testArchive(), "admin", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.users) != users || report.Users[0].Create || report.Users[0].Username != "imp_bob" {
+		t.Fatalf("the import created new users: %+v", report.Users[0])
+	}
+}
+
+func TestImportPlaceholderNameIsUnique(t *testing.T) {
+	repo := newTestRepository()
+	repo.users["imp_bob"] = "id-other"
+	if _, err := NewImportService(repo).Import(context.Background(), testArchive(), "admin", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if repo.imported["slack:U1"] != "imp_bob1" {
+		t.Fatalf("got %q, want imp_bob1", repo.imported["slack:U1"])
+	}
+}
+
+func TestImportMerge(t *testing.T) {
+	repo := newTestRepository()
+	report, err := NewImportService(repo).Import(context.Background(), testArchive(), "admin", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.messages["slack:1"] != "id-bob" || !report.Users[0].Merge {
+		t.Fatalf("bob was not merged: %+v", report.Users[0])
+	}
+	// alice has no local account, she gets a placeholder
+	if repo.imported["slack:U2"] != "imp_alice" {
+		t.Fatalf("got the placeholders %v", repo.imported)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	repo := newTestRepository()
+	report, err := NewImportService(repo).Import(context.Background(), testArchive(), "admin", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.imported) != 0 || len(repo.messages) != 0 {
+		t.Fatal("the dry run wrote the import")
+	}
+	if report.Users[0].Username != "imp_bob" || report.Users[1].Username != "imp_alice" {
+		t.Fatalf("got %+v %+v", report.Users[0], report.Users[1])
+	}
+}
+
+func TestImportInvalidCreator(t *testing.T) {
+	if _, err := NewImportService(newTestRepository()).Import(context.Background(), testArchive(), "bob", false, true); err != ErrInvalidCreator {
+		t.Fatalf("got %v, want ErrInvalidCreator", err)
+	}
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackUser is a user of users.json
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+	} `json:"profile"`
+}
+
+// slackChannel is a channel of channels.json or groups.json
+type slackChannel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Purpose struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+	Topic struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+}
+
+// slackMessage is a message of a channel day file
+type slackMessage struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	User     string `json:"user"`
+	BotID    string `json:"bot_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	Ts       string `json:"ts"`
+	Edited   *struct {
+		Ts string `json:"ts"`
+	} `json:"edited"`
+}
+
+// slackSubtypes are the message subtypes imported, the others are channel events
+var slackSubtypes = map[string]bool{"": true, "bot_message": true, "me_message": true, "thread_broadcast": true, "file_share": true}
+
+// slackMention matches the user mentions, channel mentions and links of a message text
+var slackMention = regexp.MustCompile(`<([@#!]?)([^>|]+)(?:\|([^>]*))?>`)
+
+// ParseSlack reads a Slack export zip
+func ParseSlack(r io.ReaderAt, size int64) (*ArchiveEntity, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[strings.TrimPrefix(file.Name, "./")] = file
+	}
+
+	// read the users and the channels
+	var users []slackUser
+	if err := readZipJSON(files, "users.json", &users); err != nil {
+		return nil, err
+	}
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = firstNonEmpty(user.Profile.DisplayName, user.Name, user.RealName, user.ID)
+	}
+	var channels, groups []slackChannel
+	if err := readZipJSON(files, "channels.json", &channels); err != nil {
+		return nil, err
+	}
+	if _, ok := files["groups.json"]; ok {
+		if err := readZipJSON(files, "groups.json", &groups); err != nil {
+			return nil, err
+		}
+	}
+	channels = append(channels, groups...)
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no channel found in the Slack export")
+	}
+
+	result := &ArchiveEntity{Source: "slack"}
+	for _, channel := range channels {
+		imported := &ChannelEntity{
+			ExternalID:  channel.ID,
+			Name:        channel.Name,
+			Description: channel.Purpose.Value,
+			Topic:       channel.Topic.Value,
+		}
+		// the messages are in a file per day, named YYYY-MM-DD.json
+		var days []string
+		for name := range files {
+			if path.Dir(name) == channel.Name && path.Ext(name) == ".json" {
+				days = append(days, name)
+			}
+		}
+		sort.Strings(days)
+		for _, day := range days {
+			var messages []slackMessage
+			if err := readZipJSON(files, day, &messages); err != nil {
+				return nil, err
+			}
+			for _, message := range messages {
+				if message.Type != "message" || !slackSubtypes[message.Subtype] || message.Ts == "" {
+					result.Skipped++
+					continue
+				}
+				author, authorName := message.User, usernames[message.User]
+				if author == "" {
+					// bot messages have no user
+					author, authorName = "bot:"+message.BotID, firstNonEmpty(message.Username, message.BotID, "bot")
+				}
+				entity := &MessageEntity{
+					ExternalID: channel.ID + ":" + message.Ts,
+					Author:     author,
+					AuthorName: firstNonEmpty(authorName, author),
+					Content:    slackText(message.Text, usernames),
+					CreatedAt:  slackTime(message.Ts),
+				}
+				if message.Subtype == "me_message" {
+					entity.Content = "_" + entity.Content + "_"
+				}
+				if message.Edited != nil {
+					entity.EditedAt = slackTime(message.Edited.Ts)
+				}
+				if entity.Content == "" {
+					result.Skipped++
+					continue
+				}
+				imported.Messages = append(imported.Messages, entity)
+			}
+		}
+		result.Channels = append(result.Channels, imported)
+	}
+	return result, nil
+}
+
+// readZipJSON decodes a JSON file of the export
+func readZipJSON(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s not found in the Slack export", name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := json.NewDecoder(reader).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// slackTime converts a Slack timestamp, seconds.microseconds, to a time
+func slackTime(ts string) time.Time {
+	parts := strings.SplitN(ts, ".", 2)
+	seconds, _ := strconv.ParseInt(parts[0], 10, 64)
+	var micros int64
+	if len(parts) == 2 {
+		micros, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+	return time.Unix(seconds, micros*int64(time.Microsecond)).UTC()
+}
+
+// slackText replaces the mentions and links of a message text by readable text
+func slackText(text string, usernames map[string]string) string {
+	text = slackMention.ReplaceAllStringFunc(text, func(match string) string {
+		parts := slackMention.FindStringSubmatch(match)
+		kind, target, label := parts[1], parts[2], parts[3]
+		switch kind {
+		case "@":
+			return "@" + firstNonEmpty(usernames[target], label, target)
+		case "#":
+			return "#" + firstNonEmpty(label, target)
+		case "!":
+			// special mentions like <!here> or <!channel>
+			return "@" + firstNonEmpty(label, target)
+		}
+		return target
+	})
+	// Slack escapes these characters in the texts
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(strings.TrimSpace(text))
+}
+
+// firstNonEmpty returns the first value that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails of the server
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// MailerFromEnv creates the mailer set by MAIL_DRIVER: smtp, file or log (the default)
+func MailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chat-app@localhost"
+	}
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		config := SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		if config.Host == "" {
+			return nil, errors.New("SMTP_HOST is required by the smtp mail driver")
+		}
+		if config.Port == "" {
+			config.Port = "587"
+		}
+		return NewSMTPMailer(config), nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dataDir := os.Getenv("DATA_DIR")
+			if dataDir == "" {
+				dataDir = "data"
+			}
+			dir = filepath.Join(dataDir, "mail")
+		}
+		return NewFileMailer(dir, from)
+	case "", "log":
+		return NewLogMailer(from), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// fileMailer writes the emails in a directory, one .eml file each, for local development
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a mailer writing the emails in a directory
+func NewFileMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes an email in a new file
+func (m *fileMailer) Send(ctx context.Context, msg *Message) error {
+	file, err := os.CreateTemp(m.dir, time.Now().UTC().Format("20060102T150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(format(m.from, msg))
+	return err
+}
+
+// logMailer writes the emails in the server log, for local development
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer creates a mailer writing the emails in the server log
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+// Send writes an email in the log
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// format builds the content of an email, with its headers
+func format(from string, msg *Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + headerValue(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue removes the line breaks of a header, they would add headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+// SMTPConfig holds the SMTP server of the emails
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// smtpMailer sends the emails through an SMTP server, with STARTTLS when the server offers it
+type smtpMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer sending through an SMTP server
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config}
+}
+
+// Send sends an email, the context is not used by net/smtp
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	address := net.JoinHostPort(m.config.Host, m.config.Port)
+	return smtp.SendMail(address, auth, m.config.From, []string{headerValue(msg.To)}, format(m.config.From, msg))
+}
@@ -0,0 +1,390 @@
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kinds of the nodes of a message
+const (
+	// blocks
+	kindParagraph = iota
+	kindCodeBlock
+	kindQuote
+	kindList
+	kindItem
+	// inlines
+	kindText
+	kindCode
+	kindStrong
+	kindEmphasis
+	kindLink
+)
+
+// maxDepth limits the nesting of quotes and inlines
+const maxDepth = 8
+
+// node is a block or an inline of a message
+type node struct {
+	kind     int
+	text     string
+	url      string
+	ordered  bool
+	start    string
+	children []*node
+}
+
+var (
+	listItemPattern = regexp.MustCompile(`^ {0,3}([-*+]|\d{1,9}[.)])[ \t]+(.*)$`)
+	fencePattern    = regexp.MustCompile("^ {0,3}```")
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,20}$`)
+	autolinkPattern = regexp.MustCompile(`^https?://[^\s<>"` + "`" + `]+`)
+	tagPattern      = regexp.MustCompile(`</?[A-Za-z][^>]*>|<!--.*?-->|<![A-Za-z][^>]*>`)
+)
+
+// Clean normalizes the line breaks of a message and removes its control characters
+func Clean(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ToValidUTF8(source, "")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		// control characters, and the bidirectional overrides that hide the real text
+		if unicode.IsControl(r) || (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069') {
+			return -1
+		}
+		return r
+	}, source)
+}
+
+// parseBlocks splits lines in paragraphs, code blocks, quotes and lists
+func parseBlocks(lines []string, depth int) []*node {
+	var blocks []*node
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fencePattern.MatchString(line):
+			block := &node{kind: kindCodeBlock}
+			if language := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "`")); languagePattern.MatchString(language) {
+				block.start = language
+			}
+			var code []string
+			for i++; i < len(lines) && !fencePattern.MatchString(lines[i]); i++ {
+				code = append(code, lines[i])
+			}
+			// skip the closing fence
+			i++
+			block.text = strings.Join(code, "\n")
+			blocks = append(blocks, block)
+		case isQuote(line) && depth < maxDepth:
+			var quoted []string
+			for ; i < len(lines) && isQuote(lines[i]); i++ {
+				text := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(text, " "))
+			}
+			blocks = append(blocks, &node{kind: kindQuote, children: parseBlocks(quoted, depth+1)})
+		case listItemPattern.MatchString(line):
+			list := &node{kind: kindList, ordered: isOrdered(line)}
+			if list.ordered {
+				list.start = strings.TrimLeft(listItemPattern.FindStringSubmatch(line)[1], " ")
+				list.start = strings.TrimRight(list.start, ".)")
+			}
+			var item []string
+			for ; i < len(lines); i++ {
+				match := listItemPattern.FindStringSubmatch(lines[i])
+				if match != nil && isOrdered(lines[i]) == list.ordered {
+					if item != nil {
+						list.children = append(list.children, &node{kind: kindItem, children: parseInlines(strings.Join(item, "\n"), depth)})
+					}
+					item = []string{match[2]}
+					continue
+				}
+				// an indented line continues the item
+				if match == nil && strings.TrimSpace(lines[i]) != "" && (lines[i][0] == ' ' || lines[i][0] == '\t') {
+					item = append(item, strings.TrimSpace(lines[i]))
+					continue
+				}
+				break
+			}
+			list.children = append(list.children, &node{kind: kindItem, children: parseInlines(strings.Join(item, "\n"), depth)})
+			blocks = append(blocks, list)
+		default:
+			var paragraph []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if len(paragraph) > 0 && startsBlock(lines[i]) {
+					break
+				}
+				paragraph = append(paragraph, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, &node{kind: kindParagraph, children: parseInlines(strings.Join(paragraph, "\n"), depth)})
+		}
+	}
+	return blocks
+}
+
+// isQuote checks if a line is quoted
+func isQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// isOrdered checks if a list item is numbered
+func isOrdered(line string) bool {
+	marker := strings.TrimLeft(line, " ")
+	return marker != "" && marker[0] >= '0' && marker[0] <= '9'
+}
+
+// startsBlock checks if a line ends a paragraph
+func startsBlock(line string) bool {
+	return fencePattern.MatchString(line) || isQuote(line) || listItemPattern.MatchString(line)
+}
+
+// parseInlines splits a text in code spans, bold and italic texts, and links
+func parseInlines(text string, depth int) []*node {
+	var nodes []*node
+	var buf strings.Builder
+	flush := func() {
+		if buf.Len() > 0 {
+			nodes = append(nodes, &node{kind: kindText, text: stripTags(buf.String())})
+			buf.Reset()
+		}
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunct(text[i+1]):
+			buf.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			run := runLength(text, i, '`')
+			delimiter := text[i : i+run]
+			if end := strings.Index(text[i+run:], delimiter); end >= 0 {
+				flush()
+				code := text[i+run : i+run+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				nodes = append(nodes, &node{kind: kindCode, text: code})
+				i += run + end + run
+				continue
+			}
+			buf.WriteString(delimiter)
+			i += run
+			continue
+		case c == '[' && depth < maxDepth:
+			if label, link, n := parseLink(text[i:]); n > 0 {
+				flush()
+				children := unlink(parseInlines(label, depth+1))
+				if safe := safeURL(link); safe != "" {
+					nodes = append(nodes, &node{kind: kindLink, url: safe, children: children})
+				} else {
+					nodes = append(nodes, children...)
+				}
+				i += n
+				continue
+			}
+		case (c == '*' || c == '_') && depth < maxDepth:
+			if n, inner, kind := parseEmphasis(text, i); n > 0 {
+				flush()
+				children := parseInlines(inner, depth+1)
+				if kind == kindStrong+kindEmphasis {
+					children = []*node{{kind: kindEmphasis, children: children}}
+					kind = kindStrong
+				}
+				nodes = append(nodes, &node{kind: kind, children: children})
+				i += n
+				continue
+			}
+			// a run of delimiters that does not open is kept as it is
+			run := runLength(text, i, c)
+			buf.WriteString(text[i : i+run])
+			i += run
+			continue
+		case (c == 'h' || c == 'H') && depth < maxDepth && (i == 0 || !isWordByte(text[i-1])):
+			if match := autolinkPattern.FindString(text[i:]); match != "" {
+				match = TrimLink(match)
+				if safe := safeURL(match); safe != "" {
+					flush()
+					nodes = append(nodes, &node{kind: kindLink, url: safe, children: []*node{{kind: kindText, text: match}}})
+					i += len(match)
+					continue
+				}
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// parseLink reads a [label](url) link, n is its length, 0 if there is none
+func parseLink(text string) (label string, link string, n int) {
+	level := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			level++
+		case ']':
+			level--
+			if level > 0 {
+				continue
+			}
+			if i+1 >= len(text) || text[i+1] != '(' {
+				return "", "", 0
+			}
+			end := closingParen(text[i+2:])
+			if end < 0 {
+				return "", "", 0
+			}
+			link = strings.TrimSpace(text[i+2 : i+2+end])
+			if link == "" || strings.ContainsAny(link, " \t\n") {
+				return "", "", 0
+			}
+			return text[1:i], link, i + 2 + end + 1
+		case '\n':
+			return "", "", 0
+		}
+	}
+	return "", "", 0
+}
+
+// unlink replaces the links of a link label by their text
+func unlink(nodes []*node) []*node {
+	var unlinked []*node
+	for _, n := range nodes {
+		if n.kind == kindLink {
+			unlinked = append(unlinked, unlink(n.children)...)
+			continue
+		}
+		n.children = unlink(n.children)
+		unlinked = append(unlinked, n)
+	}
+	return unlinked
+}
+
+// closingParen returns the index of the parenthesis closing a link, the parentheses of the link are balanced
+func closingParen(text string) int {
+	level := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			level++
+		case ')':
+			if level == 0 {
+				return i
+			}
+			level--
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// parseEmphasis reads a bold or an italic text opened at i, n is its length, 0 if it is not closed.
+// A run of three delimiters is both bold and italic.
+func parseEmphasis(text string, i int) (n int, inner string, kind int) {
+	c := text[i]
+	run := runLength(text, i, c)
+	if run > 3 {
+		return 0, "", 0
+	}
+	open := i + run
+	// the opening delimiter is followed by a text, an underscore in a word is not a delimiter
+	if open >= len(text) || isSpace(text[open]) || (c == '_' && i > 0 && isWordByte(text[i-1])) {
+		return 0, "", 0
+	}
+	delimiter := text[i:open]
+	for from := open; from < len(text); {
+		end := strings.Index(text[from:], delimiter)
+		if end < 0 {
+			return 0, "", 0
+		}
+		end += from
+		after := end + run
+		if end > open && !isSpace(text[end-1]) && (after >= len(text) || text[after] != c) &&
+			(c != '_' || after >= len(text) || !isWordByte(text[after])) {
+			switch run {
+			case 1:
+				kind = kindEmphasis
+			case 2:
+				kind = kindStrong
+			default:
+				kind = kindStrong + kindEmphasis
+			}
+			return after - i, text[open:end], kind
+		}
+		from = end + runLength(text, end, c)
+	}
+	return 0, "", 0
+}
+
+// runLength counts the bytes c from i
+func runLength(text string, i int, c byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// safeURL returns a link if it is http(s) or mailto, an empty string otherwise
+func safeURL(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return ""
+		}
+	case "mailto":
+	default:
+		return ""
+	}
+	return parsed.String()
+}
+
+// TrimLink removes the punctuation ending a sentence after a link found in a text,
+// and a closing parenthesis not opened in it
+func TrimLink(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		if strings.IndexByte(".,;:!?*_~'", last) >= 0 || (last == ')' && strings.Count(link, "(") < strings.Count(link, ")")) {
+			link = link[:len(link)-1]
+			continue
+		}
+		break
+	}
+	return link
+}
+
+// stripTags removes the HTML tags and comments of a text
+func stripTags(text string) string {
+	return tagPattern.ReplaceAllString(text, "")
+}
+
+// isPunct checks if a byte is an ASCII punctuation character, which can be escaped
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("`*_<>[]()#+-.!|~\\", c) >= 0
+}
+
+// isSpace checks if a byte is a space, a tab or a line break
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// isWordByte checks if a byte is part of a word: a letter, a digit, an underscore or a byte of a multibyte character
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
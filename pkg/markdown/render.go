@@ -0,0 +1,150 @@
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// ToHTML renders a message as sanitized HTML: the HTML of the message is removed or escaped,
+// and the links are only http(s) or mailto
+func ToHTML(source string) string {
+	var b strings.Builder
+	writeBlocksHTML(&b, parse(source))
+	return b.String()
+}
+
+// ToText renders a message as plain text, for the notifications and the search
+func ToText(source string) string {
+	var b strings.Builder
+	writeBlocksText(&b, parse(source), "")
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// parse splits a message in blocks
+func parse(source string) []*node {
+	return parseBlocks(strings.Split(Clean(source), "\n"), 0)
+}
+
+// writeBlocksHTML writes the HTML of the blocks of a message
+func writeBlocksHTML(b *strings.Builder, blocks []*node) {
+	for _, block := range blocks {
+		switch block.kind {
+		case kindParagraph:
+			b.WriteString("<p>")
+			writeInlinesHTML(b, block.children)
+			b.WriteString("</p>\n")
+		case kindCodeBlock:
+			b.WriteString("<pre><code")
+			if block.start != "" {
+				b.WriteString(` class="language-` + html.EscapeString(block.start) + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(block.text) + "</code></pre>\n")
+		case kindQuote:
+			b.WriteString("<blockquote>\n")
+			writeBlocksHTML(b, block.children)
+			b.WriteString("</blockquote>\n")
+		case kindList:
+			tag := "ul"
+			if block.ordered {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag)
+			if block.ordered && block.start != "1" {
+				b.WriteString(` start="` + strings.TrimLeft(block.start, "0") + `"`)
+			}
+			b.WriteString(">\n")
+			for _, item := range block.children {
+				b.WriteString("<li>")
+				writeInlinesHTML(b, item.children)
+				b.WriteString("</li>\n")
+			}
+			b.WriteString("</" + tag + ">\n")
+		}
+	}
+}
+
+// writeInlinesHTML writes the HTML of the inline nodes of a block, with the texts escaped
+func writeInlinesHTML(b *strings.Builder, inlines []*node) {
+	for _, inline := range inlines {
+		switch inline.kind {
+		case kindText:
+			b.WriteString(strings.ReplaceAll(html.EscapeString(inline.text), "\n", "<br>\n"))
+		case kindCode:
+			b.WriteString("<code>" + html.EscapeString(inline.text) + "</code>")
+		case kindStrong:
+			b.WriteString("<strong>")
+			writeInlinesHTML(b, inline.children)
+			b.WriteString("</strong>")
+		case kindEmphasis:
+			b.WriteString("<em>")
+			writeInlinesHTML(b, inline.children)
+			b.WriteString("</em>")
+		case kindLink:
+			b.WriteString(`<a href="` + html.EscapeString(inline.url) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+			writeInlinesHTML(b, inline.children)
+			b.WriteString("</a>")
+		}
+	}
+}
+
+// writeBlocksText writes the text of the blocks of a message, each line after a prefix
+func writeBlocksText(b *strings.Builder, blocks []*node, prefix string) {
+	for i, block := range blocks {
+		if i > 0 {
+			b.WriteString(prefix + "\n")
+		}
+		switch block.kind {
+		case kindParagraph:
+			writeLines(b, inlinesText(block.children), prefix)
+		case kindCodeBlock:
+			writeLines(b, block.text, prefix)
+		case kindQuote:
+			writeBlocksText(b, block.children, prefix+"> ")
+		case kindList:
+			for n, item := range block.children {
+				marker := "- "
+				if block.ordered {
+					marker = itemNumber(block.start, n) + ". "
+				}
+				writeLines(b, marker+inlinesText(item.children), prefix)
+			}
+		}
+	}
+}
+
+// inlinesText returns the text of the inline nodes of a block, with the link after its label when they differ
+func inlinesText(inlines []*node) string {
+	var b strings.Builder
+	for _, inline := range inlines {
+		switch inline.kind {
+		case kindText, kindCode:
+			b.WriteString(inline.text)
+		case kindStrong, kindEmphasis:
+			b.WriteString(inlinesText(inline.children))
+		case kindLink:
+			label := inlinesText(inline.children)
+			b.WriteString(label)
+			if label != inline.url && "mailto:"+label != inline.url {
+				b.WriteString(" (" + inline.url + ")")
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeLines writes the lines of a text after a prefix
+func writeLines(b *strings.Builder, text string, prefix string) {
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+}
+
+// itemNumber returns the number of the nth item of a list starting at start
+func itemNumber(start string, n int) string {
+	number := 0
+	for _, c := range start {
+		number = number*10 + int(c-'0')
+	}
+	return strconv.Itoa(number + n)
+}
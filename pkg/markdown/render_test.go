@@ -0,0 +1,93 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct{ source, want string }{
+		{"hello", "<p>hello</p>\n"},
+		{"**bold** *italic* ***both*** `code`", "<p><strong>bold</strong> <em>italic</em> <strong><em>both</em></strong> <code>code</code></p>\n"},
+		// like CommonMark, only the asterisks emphasize in a word
+		{"snake_case_name and 2*3*4", "<p>snake_case_name and 2<em>3</em>4</p>\n"},
+		{`\*not italic\*`, "<p>*not italic*</p>\n"},
+		{"line one\nline two", "<p>line one<br>\nline two</p>\n"},
+		{"- one\n- two\n  more", "<ul>\n<li>one</li>\n<li>two<br>\nmore</li>\n</ul>\n"},
+		{"3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"> quoted\n>> nested", "<blockquote>\n<p>quoted</p>\n<blockquote>\n<p>nested</p>\n</blockquote>\n</blockquote>\n"},
+		{"```go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}</code></pre>\n"},
+		{"[the site](https://example.com/a?b=1&c=2)",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer" target="_blank">the site</a></p>` + "\n"},
+		{"see https://example.com/page.",
+			`<p>see <a href="https://example.com/page" rel="nofollow noopener noreferrer" target="_blank">https://example.com/page</a>.</p>` + "\n"},
+		{"(https://en.wikipedia.org/wiki/Go_(language))",
+			`<p>(<a href="https://en.wikipedia.org/wiki/Go_(language)" rel="nofollow noopener noreferrer" target="_blank">https://en.wikipedia.org/wiki/Go_(language)</a>)</p>` + "\n"},
+		{"[mail](mailto:alice@example.com)",
+			`<p><a href="mailto:alice@example.com" rel="nofollow noopener noreferrer" target="_blank">mail</a></p>` + "\n"},
+	}
+	for _, test := range tests {
+		if got := ToHTML(test.source); got != test.want {
+			t.Errorf("ToHTML(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestToHTMLSanitizes(t *testing.T) {
+	tests := []struct{ source, want string }{
+		{"<script>alert(1)</script>", "<p>alert(1)</p>\n"},
+		{`<img src=x onerror="alert(1)">hi`, "<p>hi</p>\n"},
+		{"<!-- hidden -->shown", "<p>shown</p>\n"},
+		{"a < b && c > d", "<p>a &lt; b &amp;&amp; c &gt; d</p>\n"},
+		{`"quotes" 'too'`, "<p>&#34;quotes&#34; &#39;too&#39;</p>\n"},
+		{"[click](javascript:alert(1))", "<p>click</p>\n"},
+		{"[click](JavaScript:alert(1))", "<p>click</p>\n"},
+		{"[click](data:text/html,<script>alert(1)</script>)", "<p>click</p>\n"},
+		{"[click](vbscript:msgbox)", "<p>click</p>\n"},
+		{"[click](//evil.example.com)", "<p>click</p>\n"},
+		{"[click](http:alert)", "<p>click</p>\n"},
+		{`[x](https://example.com/"onmouseover="alert(1))`,
+			`<p><a href="https://example.com/%22onmouseover=%22alert%281%29" rel="nofollow noopener noreferrer" target="_blank">x</a></p>` + "\n"},
+		{"`<b>code</b>`", "<p><code>&lt;b&gt;code&lt;/b&gt;</code></p>\n"},
+		{"```\"><script>\n<script>alert(1)</script>\n```", "<pre><code>&lt;script&gt;alert(1)&lt;/script&gt;</code></pre>\n"},
+		// a link in the label of a link is only its text
+		{"[[inner](https://a.example.com)](https://b.example.com)",
+			`<p><a href="https://b.example.com" rel="nofollow noopener noreferrer" target="_blank">inner</a></p>` + "\n"},
+	}
+	for _, test := range tests {
+		if got := ToHTML(test.source); got != test.want {
+			t.Errorf("ToHTML(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestToHTMLLimitsTheNesting(t *testing.T) {
+	quotes := strings.Repeat(">", 100) + " deep"
+	if got := strings.Count(ToHTML(quotes), "<blockquote>"); got != maxDepth {
+		t.Fatalf("got %d quotes, want %d", got, maxDepth)
+	}
+	// the input of a message is bounded, the parsing must stay fast and return
+	ToHTML(strings.Repeat("[", 5000) + strings.Repeat("*a", 5000) + strings.Repeat("`", 5000))
+}
+
+func TestToText(t *testing.T) {
+	tests := []struct{ source, want string }{
+		{"**bold** and `code`", "bold and code"},
+		{"[the site](https://example.com)", "the site (https://example.com)"},
+		{"https://example.com", "https://example.com"},
+		{"[alice@example.com](mailto:alice@example.com)", "alice@example.com"},
+		{"<b>tags</b> removed", "tags removed"},
+		{"> quoted\n\n2. two\n3. three", "> quoted\n\n2. two\n3. three"},
+	}
+	for _, test := range tests {
+		if got := ToText(test.source); got != test.want {
+			t.Errorf("ToText(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	if got := Clean("a\r\nb\x00c\x1b[31md‮evil⁦e\tf\xff"); got != "a\nbc[31mdevile\tf" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,25 @@
+package message
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrCommandNotAllowed is returned when a user runs a command it does not have the permission of
+var ErrCommandNotAllowed = errors.New("You are not allowed to run this command")
+
+// CommandResult is the outcome of a slash command: a response shown to its sender only, or a message sent in its place
+type CommandResult struct {
+	Command  string `json:"command"`
+	Response string `json:"response,omitempty"`
+	// Message is sent to the room instead of the command, like the action of /me
+	Message *MessageEntity `json:"-"`
+}
+
+// Commands runs the slash commands typed as messages, they are never sent as they are
+type Commands interface {
+	// IsCommand tells if the content of a message is a command
+	IsCommand(content string) bool
+	// Run runs the command of a message, for the sender of the message with its role
+	Run(ctx context.Context, message *MessageEntity, role string) (*CommandResult, error)
+}
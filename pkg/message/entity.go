@@ -8,4 +8,45 @@ type MessageEntity struct {
 	UserID    string `json:"userId,omitempty"`
 	Content   string `json:"content,omitempty"`
 	CreatedAt string `json:"createdAt,omitempty"`
+	// HTML and Text are the renderings of the Markdown of the content, they are never stored
+	HTML string `json:"html,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Attachments are the uploaded files of the message, only their IDs are needed to send it
+	Attachments []AttachmentEntity `json:"attachments,omitempty"`
+	// Previews are the cards of the links of the message, added after it is sent
+	Previews []PreviewEntity `json:"previews,omitempty"`
+	// Bot marks the messages sent by a bot, with an API key
+	Bot bool `json:"bot,omitempty"`
+	// Action marks the messages of /me, the content is what the sender does
+	Action bool `json:"action,omitempty"`
+}
+
+// AttachmentEntity is a file attached to a message
+type AttachmentEntity struct {
+	ID          string `json:"_id"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	// Status tells if the thumbnails of an image are ready, Width and Height are the dimensions of an image
+	Status     string            `json:"status,omitempty"`
+	Width      int               `json:"width,omitempty"`
+	Height     int               `json:"height,omitempty"`
+	Thumbnails []ThumbnailEntity `json:"thumbnails,omitempty"`
+}
+
+// ThumbnailEntity is a smaller version of an image attachment, downloaded by its name
+type ThumbnailEntity struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// PreviewEntity is the card of a link found in a message
+type PreviewEntity struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
 }
@@ -2,13 +2,15 @@ package message
 
 import (
 	"chat-app/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"strconv"
 )
 
-// CreateMessageHandler creates a new message.
-func CreateMessageHandler(messageService MessageService) gin.HandlerFunc {
+// CreateMessageHandler creates a new message, or runs the slash command typed in it.
+func CreateMessageHandler(messageService MessageService, commands Commands) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		var message MessageEntity
@@ -17,22 +19,31 @@ func CreateMessageHandler(messageService MessageService) gin.HandlerFunc {
 			return
 		}
 
-		// check if username and content are empty
-		if message.RoomID == "" || message.Username == "" || message.Content == "" {
+		// check if username and content are empty, a message with attachments can have no content
+		if message.RoomID == "" || message.Username == "" || (message.Content == "" && len(message.Attachments) == 0) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Message error"})
 			return
 		}
 
 		// check if userConnected is the one who sends a creation message request
-		_, usernameConnected, errConnection := utils.GetUserIDAndUsernameFromContext(c)
+		claims, errConnection := utils.GetClaimsFromContext(c)
 		if errConnection != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not send a message"})
 			return
 		}
-		if message.Username != usernameConnected {
+		if message.Username != claims.Username {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not send a message"})
 			return
 		}
+		// an API key must be allowed to write in the room
+		if !claims.Allows(utils.ScopeMessagesWrite, message.RoomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The API key does not have the " + utils.ScopeMessagesWrite + " scope for this room"})
+			return
+		}
+		// the sender is always the user connected, a bot is marked as such
+		message.UserID = claims.UserID
+		message.Bot = claims.Bot
+		message.Action = false
 
 		// check if roomID is a valid objectID, and convert it to an objectID
 		_, err := primitive.ObjectIDFromHex(message.RoomID)
@@ -52,13 +63,37 @@ func CreateMessageHandler(messageService MessageService) gin.HandlerFunc {
 			return
 		}
 		// check if content is not too short
-		if len(message.Content) < 1 {
+		if len(message.Content) < 1 && len(message.Attachments) == 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Message is too short"})
 			return
 		}
+		// a slash command is run instead of being sent, its response is only for the sender
+		if commands != nil && commands.IsCommand(message.Content) {
+			result, err := commands.Run(c.Request.Context(), &message, claims.Role)
+			if errors.Is(err, ErrCommandNotAllowed) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if result.Message == nil {
+				c.JSON(http.StatusOK, gin.H{"ephemeral": true, "command": result.Command, "response": result.Response})
+				return
+			}
+			message = *result.Message
+		}
 		// create message
 		messageCreated, err := messageService.CreateMessage(c.Request.Context(), &message)
 		if err != nil {
+			// report the remaining cooldown of the slow mode or mute
+			var retryableErr RetryableError
+			if errors.As(err, &retryableErr) {
+				c.Header("Retry-After", strconv.Itoa(retryableErr.RetryAfter()))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retryAfter": retryableErr.RetryAfter()})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -71,6 +106,12 @@ func GetMessagesHandler(messageService MessageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomIDString := c.Param("id")
 
+		// an API key must be allowed to read the room
+		if claims, err := utils.GetClaimsFromContext(c); err == nil && !claims.Allows(utils.ScopeMessagesRead, roomIDString) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The API key does not have the " + utils.ScopeMessagesRead + " scope for this room"})
+			return
+		}
+
 		// get messages
 		messages, err := messageService.GetMessages(c.Request.Context(), roomIDString)
 		if err != nil {
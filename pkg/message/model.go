@@ -1,6 +1,7 @@
 package message
 
 import (
+	"chat-app/pkg/markdown"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
@@ -13,30 +14,157 @@ type MessageModel struct {
 	UserID    string             `bson:"userId,omitempty"`
 	Content   string             `bson:"content,omitempty"`
 	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+	// Attachments keeps a copy of the metadata of the files, so the messages are read without the attachments
+	Attachments []AttachmentModel `bson:"attachments,omitempty"`
+	// Previews are set once the links of the message are fetched
+	Previews []PreviewModel `bson:"previews,omitempty"`
+	// Bot marks the messages sent by a bot
+	Bot bool `bson:"bot,omitempty"`
+	// Action marks the messages of /me
+	Action bool `bson:"action,omitempty"`
+}
+
+// SlowModeModel is the time of the last message of a user in a slow mode room, its ID is "<roomId>:<userId>"
+type SlowModeModel struct {
+	ID            string    `bson:"_id"`
+	LastMessageAt time.Time `bson:"lastMessageAt"`
+}
+
+// AttachmentModel is the metadata of a file attached to a message
+type AttachmentModel struct {
+	ID          string           `bson:"_id"`
+	Name        string           `bson:"name,omitempty"`
+	ContentType string           `bson:"contentType,omitempty"`
+	Size        int64            `bson:"size,omitempty"`
+	Checksum    string           `bson:"checksum,omitempty"`
+	Status      string           `bson:"status,omitempty"`
+	Width       int              `bson:"width,omitempty"`
+	Height      int              `bson:"height,omitempty"`
+	Thumbnails  []ThumbnailModel `bson:"thumbnails,omitempty"`
+}
+
+// ThumbnailModel is a smaller version of an image attachment
+type ThumbnailModel struct {
+	Name   string `bson:"name"`
+	Width  int    `bson:"width"`
+	Height int    `bson:"height"`
+}
+
+// PreviewModel is the card of a link found in a message
+type PreviewModel struct {
+	URL         string `bson:"url"`
+	Title       string `bson:"title,omitempty"`
+	Description string `bson:"description,omitempty"`
+	Image       string `bson:"image,omitempty"`
+	SiteName    string `bson:"siteName,omitempty"`
 }
 
 // ModelToEntity function
 func ModelToEntity(message *MessageModel) *MessageEntity {
 	return &MessageEntity{
-		ID:        message.ID.Hex(),
-		RoomID:    message.RoomID,
-		Username:  message.Username,
-		UserID:    message.UserID,
-		Content:   message.Content,
-		CreatedAt: message.CreatedAt.String(),
+		ID:          message.ID.Hex(),
+		RoomID:      message.RoomID,
+		Username:    message.Username,
+		UserID:      message.UserID,
+		Content:     message.Content,
+		CreatedAt:   message.CreatedAt.String(),
+		HTML:        markdown.ToHTML(message.Content),
+		Text:        markdown.ToText(message.Content),
+		Attachments: attachmentModelsToEntities(message.Attachments),
+		Previews:    PreviewModelsToEntities(message.Previews),
+		Bot:         message.Bot,
+		Action:      message.Action,
 	}
 }
 
 // EntityToModel function
 func EntityToModel(message *MessageEntity) *MessageModel {
 	return &MessageModel{
-		ID:        stringToObjectID(message.ID),
-		RoomID:    message.RoomID,
-		Username:  message.Username,
-		UserID:    message.UserID,
-		Content:   message.Content,
-		CreatedAt: parseTime(message.CreatedAt),
+		ID:          stringToObjectID(message.ID),
+		RoomID:      message.RoomID,
+		Username:    message.Username,
+		UserID:      message.UserID,
+		Content:     message.Content,
+		CreatedAt:   parseTime(message.CreatedAt),
+		Attachments: attachmentEntitiesToModels(message.Attachments),
+		Previews:    PreviewEntitiesToModels(message.Previews),
+		Bot:         message.Bot,
+		Action:      message.Action,
+	}
+}
+
+// attachmentModelsToEntities converts the attachments of a message model
+func attachmentModelsToEntities(attachments []AttachmentModel) []AttachmentEntity {
+	if len(attachments) == 0 {
+		return nil
+	}
+	entities := make([]AttachmentEntity, 0, len(attachments))
+	for _, attachment := range attachments {
+		entity := AttachmentEntity{
+			ID:          attachment.ID,
+			Name:        attachment.Name,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			Checksum:    attachment.Checksum,
+			Status:      attachment.Status,
+			Width:       attachment.Width,
+			Height:      attachment.Height,
+		}
+		for _, thumbnail := range attachment.Thumbnails {
+			entity.Thumbnails = append(entity.Thumbnails, ThumbnailEntity(thumbnail))
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// attachmentEntitiesToModels converts the attachments of a message entity
+func attachmentEntitiesToModels(attachments []AttachmentEntity) []AttachmentModel {
+	if len(attachments) == 0 {
+		return nil
+	}
+	models := make([]AttachmentModel, 0, len(attachments))
+	for _, attachment := range attachments {
+		model := AttachmentModel{
+			ID:          attachment.ID,
+			Name:        attachment.Name,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			Checksum:    attachment.Checksum,
+			Status:      attachment.Status,
+			Width:       attachment.Width,
+			Height:      attachment.Height,
+		}
+		for _, thumbnail := range attachment.Thumbnails {
+			model.Thumbnails = append(model.Thumbnails, ThumbnailModel(thumbnail))
+		}
+		models = append(models, model)
+	}
+	return models
+}
+
+// PreviewModelsToEntities converts the link previews of a message model
+func PreviewModelsToEntities(previews []PreviewModel) []PreviewEntity {
+	if len(previews) == 0 {
+		return nil
+	}
+	entities := make([]PreviewEntity, 0, len(previews))
+	for _, preview := range previews {
+		entities = append(entities, PreviewEntity(preview))
+	}
+	return entities
+}
+
+// PreviewEntitiesToModels converts the link previews of a message entity
+func PreviewEntitiesToModels(previews []PreviewEntity) []PreviewModel {
+	if len(previews) == 0 {
+		return nil
+	}
+	models := make([]PreviewModel, 0, len(previews))
+	for _, preview := range previews {
+		models = append(models, PreviewModel(preview))
 	}
+	return models
 }
 
 // parseTime parses a time string and returns a time.Time object
@@ -3,9 +3,11 @@ package message
 import (
 	"chat-app/pkg/room"
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
@@ -15,17 +17,20 @@ type MessageRepository interface {
 	GetMessages(ctx context.Context, roomID string) ([]*MessageEntity, error)
 	GetMessage(ctx context.Context, messageID string) (*MessageEntity, error)
 	DeleteMessage(ctx context.Context, messageID string) error
+	ClaimSlowMode(ctx context.Context, roomID string, userID string, now time.Time, cooldown time.Duration) (time.Time, bool, error)
+	ReleaseSlowMode(ctx context.Context, roomID string, userID string, claimedAt time.Time, previous time.Time) error
 }
 
 // messageRepository is a struct that embeds the collection of messages and rooms
 type messageRepository struct {
-	collectionMessage *mongo.Collection
-	collectionRoom    *mongo.Collection
+	collectionMessage  *mongo.Collection
+	collectionRoom     *mongo.Collection
+	collectionSlowMode *mongo.Collection
 }
 
 // NewMessageRepository creates a new instance of MessageRepository
-func NewMessageRepository(collectionMessage *mongo.Collection, collectionRoom *mongo.Collection) MessageRepository {
-	return &messageRepository{collectionMessage: collectionMessage, collectionRoom: collectionRoom}
+func NewMessageRepository(collectionMessage *mongo.Collection, collectionRoom *mongo.Collection, collectionSlowMode *mongo.Collection) MessageRepository {
+	return &messageRepository{collectionMessage: collectionMessage, collectionRoom: collectionRoom, collectionSlowMode: collectionSlowMode}
 }
 
 // CreateMessage creates a new message in the database
@@ -38,6 +43,10 @@ func (r *messageRepository) CreateMessage(ctx context.Context, message *MessageE
 		UserID:    message.UserID,
 		Content:   message.Content,
 		CreatedAt: time.Now(),
+		// the attachments are checked by the attachment service
+		Attachments: attachmentEntitiesToModels(message.Attachments),
+		Bot:         message.Bot,
+		Action:      message.Action,
 	}
 	// insert message into the message collection
 	_, err := r.collectionMessage.InsertOne(ctx, messageModel)
@@ -51,15 +60,18 @@ func (r *messageRepository) CreateMessage(ctx context.Context, message *MessageE
 	if err != nil {
 		return nil, err
 	}
-	_, err = r.collectionRoom.UpdateOne(ctx, bson.D{{"_id", roomPrimitiveID}}, bson.D{{"$push", bson.D{{"messages", messageModel.ID.Hex()}}}})
+	// an archived room takes no message, even when it was archived after the check of the service
+	result, err := r.collectionRoom.UpdateOne(ctx, bson.D{{"_id", roomPrimitiveID}, {"archived", bson.D{{"$ne", true}}}},
+		bson.D{{"$push", bson.D{{"messages", messageModel.ID.Hex()}}}})
+	if err == nil && result.MatchedCount == 0 {
+		err = room.ErrRoomArchived
+	}
 	if err != nil {
 		// delete the message if the update fails
-		_, err = r.collectionMessage.DeleteOne(ctx, bson.D{{"_id", messageModel.ID}})
-		if err != nil {
-			return nil, err
+		if _, errDelete := r.collectionMessage.DeleteOne(ctx, bson.D{{"_id", messageModel.ID}}); errDelete != nil {
+			return nil, errDelete
 		}
 		return nil, err
-
 	}
 	return ModelToEntity(messageModel), nil
 }
@@ -152,3 +164,39 @@ func (r *messageRepository) DeleteMessage(ctx context.Context, messageID string)
 
 	return nil
 }
+
+// ClaimSlowMode sets the time of the last message of a user in a room to now, only if it is older than the cooldown.
+// It returns the previous time, and false with it when the cooldown is not over.
+// The filter and the write are one operation, so of concurrent messages only one claims the cooldown.
+func (r *messageRepository) ClaimSlowMode(ctx context.Context, roomID string, userID string, now time.Time, cooldown time.Duration) (time.Time, bool, error) {
+	id := roomID + ":" + userID
+	filter := bson.D{{"_id", id}, {"lastMessageAt", bson.D{{"$lte", now.Add(-cooldown)}}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	var previous SlowModeModel
+	err := r.collectionSlowMode.FindOneAndUpdate(ctx, filter, bson.D{{"$set", bson.D{{"lastMessageAt", now}}}}, opts).Decode(&previous)
+	switch {
+	case err == nil:
+		return previous.LastMessageAt, true, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// first message of the user in the room
+		return time.Time{}, true, nil
+	case mongo.IsDuplicateKeyError(err):
+		// the document exists but the filter did not match it, the upsert tried to insert it again
+		if err := r.collectionSlowMode.FindOne(ctx, bson.D{{"_id", id}}).Decode(&previous); err != nil {
+			return now, false, nil
+		}
+		return previous.LastMessageAt, false, nil
+	}
+	return time.Time{}, false, err
+}
+
+// ReleaseSlowMode gives back the cooldown claimed for a message that was not created, unless another message claimed it since
+func (r *messageRepository) ReleaseSlowMode(ctx context.Context, roomID string, userID string, claimedAt time.Time, previous time.Time) error {
+	filter := bson.D{{"_id", roomID + ":" + userID}, {"lastMessageAt", claimedAt}}
+	if previous.IsZero() {
+		_, err := r.collectionSlowMode.DeleteOne(ctx, filter)
+		return err
+	}
+	_, err := r.collectionSlowMode.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"lastMessageAt", previous}}}})
+	return err
+}
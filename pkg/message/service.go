@@ -1,7 +1,15 @@
 package message
 
 import (
+	"chat-app/pkg/markdown"
+	"chat-app/pkg/room"
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
 )
 
 // MessageService defines the methods that a message service should implement
@@ -12,18 +20,82 @@ type MessageService interface {
 	DeleteMessage(ctx context.Context, messageID string) error
 }
 
+// RetryableError is implemented by the errors of messages that can be sent again after a delay
+type RetryableError interface {
+	error
+	RetryAfter() int
+}
+
+// SlowModeError is returned when a user sends messages faster than the slow mode of the room allows
+type SlowModeError struct {
+	Remaining time.Duration
+}
+
+// RetryAfter returns the remaining cooldown rounded up to whole seconds
+func (e *SlowModeError) RetryAfter() int {
+	return int(math.Ceil(e.Remaining.Seconds()))
+}
+
+// Error implements the error interface
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("Slow mode is enabled, please wait %d seconds", e.RetryAfter())
+}
+
 // messageService is a struct that embeds the message repository
 type messageService struct {
-	repo MessageRepository
+	repo        MessageRepository
+	roomService room.RoomService
 }
 
 // NewMessageService creates a new instance of MessageService
-func NewMessageService(repo MessageRepository) MessageService {
-	return &messageService{repo: repo}
+func NewMessageService(repo MessageRepository, roomService room.RoomService) MessageService {
+	return &messageService{repo: repo, roomService: roomService}
 }
 
 // CreateMessage creates a new message
 func (m *messageService) CreateMessage(ctx context.Context, message *MessageEntity) (*MessageEntity, error) {
+	// the Markdown source is stored, without the characters that could hide or break its rendering
+	message.Content = markdown.Clean(message.Content)
+	if strings.TrimSpace(message.Content) == "" && len(message.Attachments) == 0 {
+		return nil, errors.New("Message is too short")
+	}
+
+	// get the room of the message
+	roomRetrieved, err := m.roomService.GetRoom(ctx, message.RoomID)
+	if err != nil {
+		return nil, errors.New("The room does not exist")
+	}
+	// an archived room is read-only
+	if roomRetrieved.Archived {
+		return nil, room.ErrRoomArchived
+	}
+
+	// claim the slow mode cooldown of the room, moderators and owner are exempt
+	if roomRetrieved.SlowMode > 0 && !roomRetrieved.IsModerator(message.UserID) {
+		cooldown := time.Duration(roomRetrieved.SlowMode) * time.Second
+		now := time.Now()
+		previous, claimed, err := m.repo.ClaimSlowMode(ctx, message.RoomID, message.UserID, now, cooldown)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			remaining := cooldown - now.Sub(previous)
+			if remaining <= 0 {
+				remaining = time.Second
+			}
+			return nil, &SlowModeError{Remaining: remaining}
+		}
+		created, err := m.repo.CreateMessage(ctx, message)
+		if err != nil {
+			// the message was not sent, it does not start a cooldown
+			if err := m.repo.ReleaseSlowMode(ctx, message.RoomID, message.UserID, now, previous); err != nil {
+				log.Printf("Failed to release the slow mode of user %s in room %s: %v", message.UserID, message.RoomID, err)
+			}
+			return nil, err
+		}
+		return created, nil
+	}
+
 	return m.repo.CreateMessage(ctx, message)
 }
 
@@ -0,0 +1,140 @@
+package message
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRooms serves one room
+type testRooms struct {
+	room.RoomService
+	room *room.RoomEntity
+}
+
+func (r *testRooms) GetRoom(ctx context.Context, roomID string) (*room.RoomEntity, error) {
+	return r.room, nil
+}
+
+// testRepository keeps the slow mode times like the conditional update of the repository
+type testRepository struct {
+	MessageRepository
+	mu        sync.Mutex
+	last      map[string]time.Time
+	created   int
+	createErr error
+	claimErr  error
+	released  int
+}
+
+func (r *testRepository) CreateMessage(ctx context.Context, message *MessageEntity) (*MessageEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return nil, r.createErr
+	}
+	r.created++
+	return message, nil
+}
+
+func (r *testRepository) ClaimSlowMode(ctx context.Context, roomID string, userID string, now time.Time, cooldown time.Duration) (time.Time, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.claimErr != nil {
+		return time.Time{}, false, r.claimErr
+	}
+	previous, ok := r.last[roomID+":"+userID]
+	if ok && previous.After(now.Add(-cooldown)) {
+		return previous, false, nil
+	}
+	r.last[roomID+":"+userID] = now
+	return previous, true, nil
+}
+
+func (r *testRepository) ReleaseSlowMode(ctx context.Context, roomID string, userID string, claimedAt time.Time, previous time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.released++
+	if r.last[roomID+":"+userID].Equal(claimedAt) {
+		if previous.IsZero() {
+			delete(r.last, roomID+":"+userID)
+		} else {
+			r.last[roomID+":"+userID] = previous
+		}
+	}
+	return nil
+}
+
+func newSlowModeService(repo *testRepository) MessageService {
+	rooms := &testRooms{room: &room.RoomEntity{ID: "room1", Creator: "owner", SlowMode: 30}}
+	return NewMessageService(repo, rooms)
+}
+
+func TestSlowModeRejectsConcurrentMessages(t *testing.T) {
+	repo := &testRepository{last: make(map[string]time.Time)}
+	service := newSlowModeService(repo)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rejected := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "bob", Content: "hi"})
+			var slowMode *SlowModeError
+			if errors.As(err, &slowMode) {
+				mu.Lock()
+				rejected++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if repo.created != 1 || rejected != 9 {
+		t.Fatalf("got %d messages created and %d rejected, want 1 and 9", repo.created, rejected)
+	}
+}
+
+func TestSlowModeRetryAfter(t *testing.T) {
+	repo := &testRepository{last: map[string]time.Time{"room1:bob": time.Now().Add(-10 * time.Second)}}
+	_, err := newSlowModeService(repo).CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "bob", Content: "hi"})
+	var slowMode *SlowModeError
+	if !errors.As(err, &slowMode) || slowMode.RetryAfter() != 20 {
+		t.Fatalf("got %v, want to wait 20 seconds", err)
+	}
+}
+
+func TestSlowModeFailsClosed(t *testing.T) {
+	repo := &testRepository{last: make(map[string]time.Time), claimErr: errors.New("connection lost")}
+	if _, err := newSlowModeService(repo).CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "bob", Content: "hi"}); err == nil || repo.created != 0 {
+		t.Fatal("the message was sent without the slow mode check")
+	}
+}
+
+func TestSlowModeIsReleasedWhenTheMessageFails(t *testing.T) {
+	repo := &testRepository{last: make(map[string]time.Time), createErr: errors.New("insert failed")}
+	service := newSlowModeService(repo)
+	if _, err := service.CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "bob", Content: "hi"}); err == nil {
+		t.Fatal("the error of the message was lost")
+	}
+	repo.createErr = nil
+	if _, err := service.CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "bob", Content: "hi"}); err != nil {
+		t.Fatalf("the failed message started a cooldown: %v", err)
+	}
+}
+
+func TestSlowModeExemptsModerators(t *testing.T) {
+	repo := &testRepository{last: make(map[string]time.Time)}
+	service := newSlowModeService(repo)
+	for i := 0; i < 3; i++ {
+		if _, err := service.CreateMessage(context.Background(), &MessageEntity{RoomID: "room1", UserID: "owner", Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(repo.last) != 0 {
+		t.Fatal("the owner claimed a cooldown")
+	}
+}
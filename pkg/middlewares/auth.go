@@ -2,30 +2,63 @@ package middlewares
 
 import (
 	"chat-app/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
 
-// AuthMiddleware function to validate the token and authorize the user.
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get token from cookie
-		var token string
-		token, err := c.Cookie("token")
-		if err != nil {
-			token = c.GetHeader("Authorization")
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "1 - Unauthorized"})
+// authenticate verifies the access token or the API key of the request, the request is aborted if it is missing or invalid.
+// An expired token is reported as such, so the client knows to use its refresh token.
+// An API key is only accepted by the routes with scopes, when it has all of them.
+func authenticate(c *gin.Context, scopes []string) (*utils.Claims, bool) {
+	// Get token from cookie/headers
+	token, err := utils.GetTokenFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "1 - Unauthorized"})
+		c.Abort()
+		return nil, false
+	}
+
+	// Verify and decode token
+	claims, err := utils.VerifyToken(&token)
+	if errors.Is(err, utils.ErrTokenExpired) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "expired": true})
+		c.Abort()
+		return nil, false
+	}
+	if errors.Is(err, utils.ErrTokenRevoked) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "2 - Unauthorized"})
+		c.Abort()
+		return nil, false
+	}
+	if claims.IsAPIKey() {
+		if len(scopes) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used on this route"})
+			c.Abort()
+			return nil, false
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The API key does not have the " + scope + " scope"})
 				c.Abort()
-				return
+				return nil, false
 			}
 		}
+	}
+	return claims, true
+}
 
-		// Verify and decode token
-		claims, err := utils.VerifyToken(&token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "2 - Unauthorized"})
-			c.Abort()
+// AuthMiddleware function to validate the token and authorize the user.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, nil)
+		if !ok {
 			return
 		}
 
@@ -51,23 +84,8 @@ func AuthMiddleware() gin.HandlerFunc {
 // IsAdminMiddleware Check If User Is Logged In and If Is Admin
 func IsAdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from cookie
-		var token string
-		token, err := c.Cookie("token")
-		if err != nil {
-			token = c.GetHeader("Authorization")
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "1 - Unauthorized"})
-				c.Abort()
-				return
-			}
-		}
-
-		// Verify and decode token
-		claims, err := utils.VerifyToken(&token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "2 - Unauthorized"})
-			c.Abort()
+		claims, ok := authenticate(c, nil)
+		if !ok {
 			return
 		}
 
@@ -87,26 +105,11 @@ func IsAdminMiddleware() gin.HandlerFunc {
 	}
 }
 
-// IsLoggedInMiddleware check If User Is Logged In
-func IsLoggedInMiddleware() gin.HandlerFunc {
+// IsLoggedInMiddleware check If User Is Logged In, or if the API key of a bot has the scopes of the route
+func IsLoggedInMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from cookie
-		var token string
-		token, err := c.Cookie("token")
-		if err != nil {
-			token = c.GetHeader("Authorization")
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "1 - Unauthorized"})
-				c.Abort()
-				return
-			}
-		}
-
-		// Verify and decode token
-		claims, err := utils.VerifyToken(&token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "2 - Unauthorized"})
-			c.Abort()
+		claims, ok := authenticate(c, scopes)
+		if !ok {
 			return
 		}
 
@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"chat-app/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// RateLimitMiddleware rejects requests exceeding the limiter with a 429 response.
+// Requests are keyed by the user ID set by the auth middlewares, or by client IP.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, wait := limiter.Allow(RateLimitKey(c))
+		if !allowed {
+			retryAfter := ratelimit.RetryAfterSeconds(wait)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests", "retryAfter": retryAfter})
+			c.Abort()
+			return
+		}
+
+		// Continue with the request
+		c.Next()
+	}
+}
+
+// RateLimitKey returns the key used to limit the request: the logged in user or the client IP
+func RateLimitKey(c *gin.Context) string {
+	if userID, ok := c.Get("userID"); ok {
+		if id, ok := userID.(string); ok && id != "" {
+			return "user:" + id
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
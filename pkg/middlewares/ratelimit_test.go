@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"chat-app/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// login sends a request from the remote address with a forwarded IP
+func login(r *gin.Engine, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func newTestRouter(t *testing.T, proxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.Per(2, time.Minute))
+	r.POST("auth/login", RateLimitMiddleware(limiter), func(c *gin.Context) {
+		c.String(http.StatusOK, RateLimitKey(c))
+	})
+	return r
+}
+
+func TestForwardedForIsIgnoredWithoutTrustedProxies(t *testing.T) {
+	r := newTestRouter(t, nil)
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		if w := login(r, "203.0.113.7:4000", ip); w.Code != http.StatusOK || w.Body.String() != "ip:203.0.113.7" {
+			t.Fatalf("got %d %q", w.Code, w.Body.String())
+		}
+	}
+	w := login(r, "203.0.113.7:4000", "3.3.3.3")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("a new forwarded IP got around the limit: %d", w.Code)
+	}
+}
+
+func TestForwardedForOfATrustedProxy(t *testing.T) {
+	r := newTestRouter(t, []string{"10.0.0.0/8"})
+	if w := login(r, "10.0.0.1:4000", "198.51.100.1"); w.Body.String() != "ip:198.51.100.1" {
+		t.Fatalf("got %q, want the forwarded IP", w.Body.String())
+	}
+	if w := login(r, "203.0.113.7:4000", "198.51.100.1"); w.Body.String() != "ip:203.0.113.7" {
+		t.Fatalf("got %q, want the remote address", w.Body.String())
+	}
+}
+
+func TestRateLimitKeyOfAUser(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("userID", "64b7f0c2a1b2c3d4e5f60001")
+	if key := RateLimitKey(c); key != "user:64b7f0c2a1b2c3d4e5f60001" {
+		t.Fatalf("got %q", key)
+	}
+}
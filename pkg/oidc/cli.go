@@ -0,0 +1,28 @@
+package oidc
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// RunMockCommand runs a mock OpenID Connect provider for development:
+// oidc-mock [-addr :9000] [-issuer http://localhost:9000] [-client-id chat-app] [-client-secret secret]
+// The server is configured for it with OIDC_PROVIDERS=mock and OIDC_MOCK_ISSUER, OIDC_MOCK_CLIENT_ID, OIDC_MOCK_CLIENT_SECRET.
+func RunMockCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("oidc-mock", flag.ContinueOnError)
+	addr := flags.String("addr", ":9000", "address to listen on")
+	issuer := flags.String("issuer", "http://localhost:9000", "issuer URL of the provider, as the server reaches it")
+	clientID := flags.String("client-id", "chat-app", "client ID of the server")
+	clientSecret := flags.String("client-secret", "secret", "client secret of the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	provider, err := NewMockProvider(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Mock OpenID Connect provider %s listening on %s\n", *issuer, *addr)
+	return http.ListenAndServe(*addr, provider)
+}
@@ -0,0 +1,28 @@
+package oidc
+
+import "chat-app/pkg/auth"
+
+// ProviderEntity is a provider users can log in with
+type ProviderEntity struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	// LoginURL starts the login, the browser is redirected to the provider
+	LoginURL string `json:"loginUrl"`
+}
+
+// IdentityEntity is the account of a user at a provider, linked to its account
+type IdentityEntity struct {
+	ID          string `json:"_id"`
+	Provider    string `json:"provider"`
+	Email       string `json:"email,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	LastLoginAt string `json:"lastLoginAt,omitempty"`
+}
+
+// LoginResultEntity is the end of a login at a provider: the tokens, or the challenge of two-factor authentication.
+// Linked is set when a user connected linked a new identity instead.
+type LoginResultEntity struct {
+	Tokens    *auth.TokenEntity
+	Challenge *auth.TwoFactorChallengeEntity
+	Linked    bool
+}
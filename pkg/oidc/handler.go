@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"chat-app/pkg/auth"
+	"chat-app/pkg/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// stateCookie binds a login at a provider to the browser that started it
+const stateCookie = "oidc_state"
+
+// GetProvidersHandler lists the providers users can log in with.
+func GetProvidersHandler(oidcService OidcService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, oidcService.Providers())
+	}
+}
+
+// LoginHandler starts a login at a provider, the browser is redirected to it.
+func LoginHandler(oidcService OidcService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		begin(c, oidcService, "")
+	}
+}
+
+// LinkHandler starts the link of an identity of a provider to the user connected, the browser is redirected to it.
+func LinkHandler(oidcService OidcService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		begin(c, oidcService, claims.UserID)
+	}
+}
+
+// begin starts a login or a link at a provider and redirects the browser to it.
+func begin(c *gin.Context, oidcService OidcService, userID string) {
+	authURL, state, err := oidcService.Begin(c.Request.Context(), c.Param("provider"), userID)
+	if errors.Is(err, ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": ErrProviderUnavailable.Error()})
+		return
+	}
+	c.SetCookie(stateCookie, state, int(stateTTL.Seconds()), "/auth/oidc", "localhost", false, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// CallbackHandler ends a login at a provider, where the provider redirects the browser.
+// The browser goes on to the page of the client when there is one, with the tokens in cookies, else the response is JSON.
+func CallbackHandler(oidcService OidcService, authService auth.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if providerError := c.Query("error"); providerError != "" {
+			finish(c, oidcService, http.StatusBadRequest, gin.H{"error": "The identity provider refused the login: " + providerError})
+			return
+		}
+		// the login must come back to the browser that started it
+		state := c.Query("state")
+		if cookie, err := c.Cookie(stateCookie); err != nil || cookie != state {
+			finish(c, oidcService, http.StatusBadRequest, gin.H{"error": ErrInvalidState.Error()})
+			return
+		}
+		c.SetCookie(stateCookie, "", -1, "/auth/oidc", "localhost", false, true)
+
+		result, err := oidcService.Callback(c.Request.Context(), c.Param("provider"), state, c.Query("code"), c.ClientIP(), c.Request.UserAgent())
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			finish(c, oidcService, http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotAllowed), errors.Is(err, ErrLinkRequired), errors.Is(err, ErrIdentityLinked),
+			errors.Is(err, auth.ErrEmailNotVerified):
+			finish(c, oidcService, http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInvalidState), errors.Is(err, ErrInvalidIDToken):
+			finish(c, oidcService, http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrProviderUnavailable):
+			finish(c, oidcService, http.StatusBadGateway, gin.H{"error": err.Error()})
+		case err != nil:
+			finish(c, oidcService, http.StatusBadRequest, gin.H{"error": "Could not log in"})
+		case result.Linked:
+			finish(c, oidcService, http.StatusOK, gin.H{"status": true, "linked": true, "message": "The identity has been linked to your account"})
+		case result.Challenge != nil:
+			finish(c, oidcService, http.StatusOK, gin.H{"status": true, "twoFactorRequired": true, "step": result.Challenge.Step,
+				"challengeToken": result.Challenge.ChallengeToken, "expiresIn": result.Challenge.ExpiresIn})
+		default:
+			auth.SetTokens(c, authService, result.Tokens)
+			finish(c, oidcService, http.StatusOK, gin.H{"status": true, "token": result.Tokens.Token, "refreshToken": result.Tokens.RefreshToken,
+				"expiresIn": result.Tokens.ExpiresIn, "message": "You're logged in!"})
+		}
+	}
+}
+
+// finish writes the response of a callback, or redirects the browser to the page of the client with the response in the query.
+// The tokens are never put in the query, they are in the cookies.
+func finish(c *gin.Context, oidcService OidcService, status int, response gin.H) {
+	page := oidcService.Config().LoginRedirectURL
+	if page == "" {
+		c.JSON(status, response)
+		return
+	}
+	redirect, err := url.Parse(page)
+	if err != nil {
+		c.JSON(status, response)
+		return
+	}
+	query := redirect.Query()
+	for key, value := range response {
+		switch key {
+		case "token", "refreshToken", "expiresIn", "message":
+			continue
+		case "status", "linked", "twoFactorRequired":
+			query.Set(key, strconv.FormatBool(value.(bool)))
+		default:
+			query.Set(key, value.(string))
+		}
+	}
+	redirect.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, redirect.String())
+}
+
+// GetIdentitiesHandler lists the identities linked to the user connected.
+func GetIdentitiesHandler(oidcService OidcService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		identities, err := oidcService.GetIdentities(c.Request.Context(), claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get identities"})
+			return
+		}
+		c.JSON(http.StatusOK, identities)
+	}
+}
+
+// UnlinkIdentityHandler unlinks an identity of the user connected.
+func UnlinkIdentityHandler(oidcService OidcService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err := oidcService.Unlink(c.Request.Context(), claims.UserID, c.Param("id")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "The identity has been unlinked"})
+	}
+}
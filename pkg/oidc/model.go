@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// IdentityModel links the account of a user at a provider, its subject, to a user
+type IdentityModel struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      string             `bson:"userId"`
+	Provider    string             `bson:"provider"`
+	Subject     string             `bson:"subject"`
+	Email       string             `bson:"email,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+	LastLoginAt time.Time          `bson:"lastLoginAt,omitempty"`
+}
+
+// ModelToEntity converts an identity model to an identity entity
+func ModelToEntity(identity *IdentityModel) *IdentityEntity {
+	entity := &IdentityEntity{
+		ID:        identity.ID.Hex(),
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt.String(),
+	}
+	if !identity.LastLoginAt.IsZero() {
+		entity.LastLoginAt = identity.LastLoginAt.String()
+	}
+	return entity
+}
+
+// StateModel is a login started at a provider, until the provider redirects the user back.
+// Only the hash of its state is stored, the PKCE verifier and the nonce never leave the server.
+// UserID is set when a user connected links a new identity.
+type StateModel struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Hash         string             `bson:"hash"`
+	Provider     string             `bson:"provider"`
+	CodeVerifier string             `bson:"codeVerifier"`
+	Nonce        string             `bson:"nonce"`
+	UserID       string             `bson:"userId,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt"`
+	ExpiresAt    time.Time          `bson:"expiresAt"`
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"chat-app/pkg/user"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// OidcRepository defines the storage of the identities and of the logins in progress
+type OidcRepository interface {
+	CreateState(ctx context.Context, state *StateModel) error
+	UseState(ctx context.Context, hash string) (*StateModel, error)
+	DeleteExpiredStates(ctx context.Context, before time.Time) (int64, error)
+	GetIdentity(ctx context.Context, provider string, subject string) (*IdentityModel, error)
+	GetIdentities(ctx context.Context, userID string) ([]*IdentityModel, error)
+	CreateIdentity(ctx context.Context, identity *IdentityModel) error
+	SeeIdentity(ctx context.Context, identityID primitive.ObjectID, email string) error
+	DeleteIdentity(ctx context.Context, userID string, identityID string) error
+	FindUserByEmail(ctx context.Context, email string) (*user.UserEntity, error)
+	GetUser(ctx context.Context, userID string) (*user.UserEntity, error)
+}
+
+// oidcRepository stores the identities and the logins in progress in MongoDB
+type oidcRepository struct {
+	collection      *mongo.Collection
+	collectionState *mongo.Collection
+	collectionUsers *mongo.Collection
+}
+
+// NewOidcRepository creates a new OIDC repository
+func NewOidcRepository(collection *mongo.Collection, collectionState *mongo.Collection, collectionUsers *mongo.Collection) OidcRepository {
+	return &oidcRepository{collection: collection, collectionState: collectionState, collectionUsers: collectionUsers}
+}
+
+// CreateState inserts a login in progress
+func (r *oidcRepository) CreateState(ctx context.Context, state *StateModel) error {
+	state.ID = primitive.NewObjectID()
+	_, err := r.collectionState.InsertOne(ctx, state)
+	return err
+}
+
+// UseState removes a login in progress and returns it, once, before it expires
+func (r *oidcRepository) UseState(ctx context.Context, hash string) (*StateModel, error) {
+	var state StateModel
+	filter := bson.D{{"hash", hash}, {"expiresAt", bson.D{{"$gt", time.Now()}}}}
+	if err := r.collectionState.FindOneAndDelete(ctx, filter).Decode(&state); err != nil {
+		return nil, errors.New(" login state not found")
+	}
+	return &state, nil
+}
+
+// DeleteExpiredStates removes the logins in progress expired before a date
+func (r *oidcRepository) DeleteExpiredStates(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionState.DeleteMany(ctx, bson.D{{"expiresAt", bson.D{{"$lt", before}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// GetIdentity retrieves the identity of a subject at a provider, nil if it is not linked
+func (r *oidcRepository) GetIdentity(ctx context.Context, provider string, subject string) (*IdentityModel, error) {
+	var identity IdentityModel
+	err := r.collection.FindOne(ctx, bson.D{{"provider", provider}, {"subject", subject}}).Decode(&identity)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetIdentities retrieves the identities linked to a user
+func (r *oidcRepository) GetIdentities(ctx context.Context, userID string) ([]*IdentityModel, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{{"userId", userID}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var identities []*IdentityModel
+	if err := cursor.All(ctx, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// CreateIdentity links an identity to a user
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *IdentityModel) error {
+	identity.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, identity)
+	return err
+}
+
+// SeeIdentity records a login with an identity, and the email the provider gave
+func (r *oidcRepository) SeeIdentity(ctx context.Context, identityID primitive.ObjectID, email string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.D{{"_id", identityID}},
+		bson.D{{"$set", bson.D{{"lastLoginAt", time.Now()}, {"email", email}}}})
+	return err
+}
+
+// DeleteIdentity unlinks an identity of a user
+func (r *oidcRepository) DeleteIdentity(ctx context.Context, userID string, identityID string) error {
+	objectID, err := primitive.ObjectIDFromHex(identityID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.DeleteOne(ctx, bson.D{{"_id", objectID}, {"userId", userID}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New(" identity not found")
+	}
+	return nil
+}
+
+// FindUserByEmail retrieves the user of an email, nil if there is none
+func (r *oidcRepository) FindUserByEmail(ctx context.Context, email string) (*user.UserEntity, error) {
+	var foundUser user.UserModel
+	err := r.collectionUsers.FindOne(ctx, bson.D{{"email", email}}).Decode(&foundUser)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.ModelToEntity(&foundUser), nil
+}
+
+// GetUser retrieves a user by ID
+func (r *oidcRepository) GetUser(ctx context.Context, userID string) (*user.UserEntity, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	var foundUser user.UserModel
+	if err := r.collectionUsers.FindOne(ctx, bson.D{{"_id", objectID}}).Decode(&foundUser); err != nil {
+		return nil, errors.New("user not found")
+	}
+	return user.ModelToEntity(&foundUser), nil
+}
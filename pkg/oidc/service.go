@@ -0,0 +1,434 @@
+package oidc
+
+import (
+	"chat-app/pkg/auth"
+	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider not configured
+	ErrUnknownProvider = errors.New("Unknown identity provider")
+	// ErrInvalidState is returned for a login not started by the server, already ended or expired
+	ErrInvalidState = errors.New("Invalid or expired login, please try again")
+	// ErrNotAllowed is returned for an identity the policy of the provider does not let in
+	ErrNotAllowed = errors.New("Your account is not allowed to log in with this provider")
+	// ErrIdentityLinked is returned to link an identity already linked to another user
+	ErrIdentityLinked = errors.New("This identity is already linked to another account")
+	// ErrLinkRequired is returned for a new identity of the email of a user, who has to log in and link it
+	ErrLinkRequired = errors.New("An account already uses this email, log in to it and link this identity from its settings")
+	// ErrIdentityNotFound is returned to unlink an identity that is not one of the user
+	ErrIdentityNotFound = errors.New("Identity not found")
+)
+
+// stateTTL is how long a user has to log in at the provider
+const stateTTL = 10 * time.Minute
+
+// ProviderConfig holds the client of the server at a provider, and who can log in with it
+type ProviderConfig struct {
+	// Name is the name of the provider in the routes
+	Name        string
+	DisplayName string
+	// Issuer is the URL of the provider, its configuration is read from Issuer/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the server registered at the provider
+	RedirectURL string
+	Scopes      []string
+	// AllowedDomains are the only email domains that can create an account or be linked by email, any domain when empty
+	AllowedDomains []string
+	// Provision creates an account for a new user of the provider
+	Provision bool
+	// LinkByEmail links a new identity to the user of its email, when the provider and the user both verified it
+	LinkByEmail bool
+}
+
+// Config holds the providers and the page of the client the browser goes back to
+type Config struct {
+	Providers []ProviderConfig
+	// LoginRedirectURL is the page the browser is sent to after a login at a provider, the responses are JSON when empty
+	LoginRedirectURL string
+}
+
+// namePattern is the form of the names of the providers
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ConfigFromEnv reads the providers from the environment, OIDC_PROVIDERS is the comma separated list of their names
+// and OIDC_<NAME>_* their settings
+func ConfigFromEnv() Config {
+	config := Config{LoginRedirectURL: os.Getenv("OIDC_LOGIN_REDIRECT_URL")}
+	baseURL := strings.TrimSuffix(os.Getenv("OIDC_REDIRECT_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !namePattern.MatchString(name) {
+			log.Printf("Ignoring the identity provider %q, its name must be lowercase letters, digits, - or _", name)
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := ProviderConfig{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("Ignoring the identity provider %q, %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+			continue
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = name
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = baseURL + "/auth/oidc/" + name + "/callback"
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		for _, domain := range strings.Split(os.Getenv(prefix+"ALLOWED_DOMAINS"), ",") {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				provider.AllowedDomains = append(provider.AllowedDomains, strings.TrimPrefix(domain, "@"))
+			}
+		}
+		provider.Provision, _ = strconv.ParseBool(os.Getenv(prefix + "PROVISION"))
+		provider.LinkByEmail, _ = strconv.ParseBool(os.Getenv(prefix + "LINK_BY_EMAIL"))
+		config.Providers = append(config.Providers, provider)
+	}
+	return config
+}
+
+// OidcService defines the logins with OpenID Connect providers
+type OidcService interface {
+	Providers() []ProviderEntity
+	Begin(ctx context.Context, providerName string, userID string) (string, string, error)
+	Callback(ctx context.Context, providerName string, state string, code string, ip string, userAgent string) (*LoginResultEntity, error)
+	GetIdentities(ctx context.Context, userID string) ([]*IdentityEntity, error)
+	Unlink(ctx context.Context, userID string, identityID string) error
+	Config() Config
+	Start(ctx context.Context)
+}
+
+// oidcService logs the users in with the providers, and links their identities
+type oidcService struct {
+	repo        OidcRepository
+	userService user.UserService
+	authService auth.AuthService
+	config      Config
+	providers   map[string]*Provider
+}
+
+// NewOidcService creates a new OIDC service with the providers of the configuration
+func NewOidcService(repo OidcRepository, userService user.UserService, authService auth.AuthService, config Config) OidcService {
+	providers := map[string]*Provider{}
+	for _, providerConfig := range config.Providers {
+		providers[providerConfig.Name] = NewProvider(providerConfig)
+	}
+	return &oidcService{repo: repo, userService: userService, authService: authService, config: config, providers: providers}
+}
+
+// Providers lists the providers users can log in with
+func (s *oidcService) Providers() []ProviderEntity {
+	providers := make([]ProviderEntity, 0, len(s.config.Providers))
+	for _, provider := range s.config.Providers {
+		providers = append(providers, ProviderEntity{
+			Name:        provider.Name,
+			DisplayName: provider.DisplayName,
+			LoginURL:    "/auth/oidc/" + provider.Name + "/login",
+		})
+	}
+	return providers
+}
+
+// Begin starts a login at a provider, or the link of an identity when the user is set.
+// It returns the page of the provider and the state of the login, with a new PKCE verifier and nonce.
+func (s *oidcService) Begin(ctx context.Context, providerName string, userID string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	state, err := utils.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := utils.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	err = s.repo.CreateState(ctx, &StateModel{
+		Hash:         utils.HashToken(state),
+		Provider:     providerName,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		UserID:       userID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(stateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authURL, err := provider.AuthURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// Callback ends a login at a provider with the code it gave: the identity is linked to a user, or logs it in.
+// A new identity logs in the user of its email, or a new user, only when the policy of the provider allows it.
+func (s *oidcService) Callback(ctx context.Context, providerName string, state string, code string, ip string, userAgent string) (*LoginResultEntity, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidState
+	}
+	stored, err := s.repo.UseState(ctx, utils.HashToken(state))
+	if err != nil || stored.Provider != providerName {
+		return nil, ErrInvalidState
+	}
+	token, err := provider.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		log.Printf("Failed to log in with the identity provider %s: %v", providerName, err)
+		if errors.Is(err, ErrInvalidIDToken) {
+			return nil, err
+		}
+		return nil, ErrProviderUnavailable
+	}
+	email, _ := user.NormalizeEmail(token.Email)
+	identity, err := s.repo.GetIdentity(ctx, providerName, token.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// a user connected links the identity to its account
+	if stored.UserID != "" {
+		if identity != nil {
+			if identity.UserID != stored.UserID {
+				return nil, ErrIdentityLinked
+			}
+			return &LoginResultEntity{Linked: true}, nil
+		}
+		err := s.repo.CreateIdentity(ctx, &IdentityModel{UserID: stored.UserID, Provider: providerName, Subject: token.Subject,
+			Email: email, CreatedAt: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResultEntity{Linked: true}, nil
+	}
+
+	var authenticatedUser *user.UserEntity
+	if identity != nil {
+		authenticatedUser, err = s.repo.GetUser(ctx, identity.UserID)
+		if err != nil {
+			return nil, ErrNotAllowed
+		}
+		if err := s.repo.SeeIdentity(ctx, identity.ID, email); err != nil {
+			log.Printf("Failed to update the identity %s: %v", identity.ID.Hex(), err)
+		}
+	} else {
+		authenticatedUser, err = s.newIdentity(ctx, provider.config, token, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the same checks as a login with a password
+	if authenticatedUser.Validity != "valid" {
+		s.authService.RecordLogin(ctx, authenticatedUser.ID, ip, userAgent, false)
+		return nil, ErrNotAllowed
+	}
+	if s.authService.Config().EmailVerification == auth.VerificationLogin && !authenticatedUser.EmailVerified && authenticatedUser.Role != "admin" {
+		return nil, auth.ErrEmailNotVerified
+	}
+	challenge, err := s.authService.LoginChallenge(ctx, authenticatedUser, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResultEntity{Challenge: challenge}, nil
+	}
+	tokens, err := s.authService.IssueTokens(ctx, authenticatedUser, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	s.authService.RecordLogin(ctx, authenticatedUser.ID, ip, userAgent, true)
+	return &LoginResultEntity{Tokens: tokens}, nil
+}
+
+// newIdentity links a new identity to the user of its email, or to a new user, as the policy of the provider allows
+func (s *oidcService) newIdentity(ctx context.Context, provider ProviderConfig, token *IDToken, email string) (*user.UserEntity, error) {
+	// only an email verified by the provider, of an allowed domain, identifies a user
+	if email == "" || !token.EmailVerified || !allowedDomain(provider.AllowedDomains, email) {
+		return nil, ErrNotAllowed
+	}
+	foundUser, err := s.repo.FindUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	// an email the user did not verify may be someone else's, who would share the account
+	if foundUser != nil && (!provider.LinkByEmail || !foundUser.EmailVerified) {
+		return nil, ErrLinkRequired
+	}
+	if foundUser == nil {
+		if !provider.Provision {
+			return nil, ErrNotAllowed
+		}
+		foundUser, err = s.provision(ctx, token, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	err = s.repo.CreateIdentity(ctx, &IdentityModel{UserID: foundUser.ID, Provider: provider.Name, Subject: token.Subject,
+		Email: email, CreatedAt: now, LastLoginAt: now})
+	if err != nil {
+		return nil, err
+	}
+	return foundUser, nil
+}
+
+// provision creates the account of a new user of a provider, without password, with the email the provider verified
+func (s *oidcService) provision(ctx context.Context, token *IDToken, email string) (*user.UserEntity, error) {
+	username, err := s.username(ctx, token, email)
+	if err != nil {
+		return nil, err
+	}
+	newUser := &user.UserEntity{
+		Username:      username,
+		Email:         email,
+		EmailVerified: true,
+		Role:          "user",
+		Validity:      "valid",
+	}
+	if err := s.userService.CreateUser(ctx, newUser); err != nil {
+		// a user signed up with the email since it was looked up
+		if errors.Is(err, user.ErrEmailExists) {
+			return nil, ErrLinkRequired
+		}
+		return nil, err
+	}
+	return newUser, nil
+}
+
+// usernameChars are the characters of the usernames
+var usernameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// username finds a free username for a new user, from its username at the provider or its email
+func (s *oidcService) username(ctx context.Context, token *IDToken, email string) (string, error) {
+	base := token.PreferredUsername
+	if at := strings.Index(base, "@"); at >= 0 {
+		base = base[:at]
+	}
+	base = usernameChars.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = usernameChars.ReplaceAllString(email[:strings.Index(email, "@")], "")
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 10 {
+		base = base[:10]
+	}
+	candidate := base
+	for i := 0; i < 10; i++ {
+		if err := s.userService.CheckUsername(ctx, candidate); err == nil {
+			return candidate, nil
+		}
+		// the username is taken, a few digits are added
+		prefix := base
+		if len(prefix) > 6 {
+			prefix = prefix[:6]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", prefix, n)
+	}
+	return "", errors.New("no free username")
+}
+
+// allowedDomain checks if the domain of an email is one of the domains, any domain when there are none
+func allowedDomain(domains []string, email string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIdentities lists the identities linked to a user
+func (s *oidcService) GetIdentities(ctx context.Context, userID string) ([]*IdentityEntity, error) {
+	identities, err := s.repo.GetIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*IdentityEntity, 0, len(identities))
+	for _, identity := range identities {
+		entities = append(entities, ModelToEntity(identity))
+	}
+	return entities, nil
+}
+
+// Unlink removes an identity of a user, it can no longer log in with it
+func (s *oidcService) Unlink(ctx context.Context, userID string, identityID string) error {
+	if err := s.repo.DeleteIdentity(ctx, userID, identityID); err != nil {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// Config returns the providers and the page of the client after a login
+func (s *oidcService) Config() Config {
+	return s.config
+}
+
+// Start removes the expired logins in progress every hour until the context is done
+func (s *oidcService) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if _, err := s.repo.DeleteExpiredStates(ctx, time.Now()); err != nil {
+			log.Printf("Failed to remove the expired OIDC logins: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
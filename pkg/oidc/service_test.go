@@ -0,0 +1,431 @@
+package oidc
+
+import (
+	"chat-app/pkg/auth"
+	"chat-app/pkg/user"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "chat-app"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:8080/auth/oidc/mock/callback"
+)
+
+// testRepository keeps the logins in progress, the identities and the users in memory
+type testRepository struct {
+	states     map[string]*StateModel
+	identities []*IdentityModel
+	users      []*user.UserEntity
+}
+
+func newTestRepository() *testRepository {
+	return &testRepository{states: map[string]*StateModel{}}
+}
+
+func (r *testRepository) CreateState(ctx context.Context, state *StateModel) error {
+	r.states[state.Hash] = state
+	return nil
+}
+
+func (r *testRepository) UseState(ctx context.Context, hash string) (*StateModel, error) {
+	state, ok := r.states[hash]
+	if !ok || state.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New(" login state not found")
+	}
+	delete(r.states, hash)
+	return state, nil
+}
+
+func (r *testRepository) DeleteExpiredStates(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *testRepository) GetIdentity(ctx context.Context, provider string, subject string) (*IdentityModel, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *testRepository) GetIdentities(ctx context.Context, userID string) ([]*IdentityModel, error) {
+	var identities []*IdentityModel
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *testRepository) CreateIdentity(ctx context.Context, identity *IdentityModel) error {
+	identity.ID = primitive.NewObjectID()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *testRepository) SeeIdentity(ctx context.Context, identityID primitive.ObjectID, email string) error {
+	return nil
+}
+
+func (r *testRepository) DeleteIdentity(ctx context.Context, userID string, identityID string) error {
+	return nil
+}
+
+func (r *testRepository) FindUserByEmail(ctx context.Context, email string) (*user.UserEntity, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *testRepository) GetUser(ctx context.Context, userID string) (*user.UserEntity, error) {
+	for _, u := range r.users {
+		if u.ID == userID {
+			return u, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+// testUsers creates the users in the repository
+type testUsers struct {
+	user.UserService
+	repo *testRepository
+}
+
+func (u *testUsers) CreateUser(ctx context.Context, newUser *user.UserEntity) error {
+	newUser.ID = primitive.NewObjectID().Hex()
+	u.repo.users = append(u.repo.users, newUser)
+	return nil
+}
+
+func (u *testUsers) CheckUsername(ctx context.Context, username string) error {
+	for _, existing := range u.repo.users {
+		if existing.Username == username {
+			return errors.New("username already exists")
+		}
+	}
+	return nil
+}
+
+// testAuth issues the tokens of the user who logged in as its username
+type testAuth struct {
+	auth.AuthService
+}
+
+func (a *testAuth) Config() auth.Config {
+	return auth.Config{EmailVerification: auth.VerificationLogin}
+}
+
+func (a *testAuth) LoginChallenge(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*auth.TwoFactorChallengeEntity, error) {
+	return nil, nil
+}
+
+func (a *testAuth) IssueTokens(ctx context.Context, authenticatedUser *user.UserEntity, ip string, userAgent string) (*auth.TokenEntity, error) {
+	return &auth.TokenEntity{Token: authenticatedUser.Username}, nil
+}
+
+func (a *testAuth) RecordLogin(ctx context.Context, userID string, ip string, userAgent string, success bool) {
+}
+
+// testProvider serves a mock provider on a local server
+func testProvider(t *testing.T) (*MockProvider, ProviderConfig) {
+	t.Helper()
+	var mock *MockProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	mock, err := NewMockProvider(server.URL, testClientID, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, ProviderConfig{Name: "mock", Issuer: server.URL, ClientID: testClientID, ClientSecret: testClientSecret,
+		RedirectURL: testRedirectURL, Scopes: []string{"openid", "email"}}
+}
+
+func newTestService(provider ProviderConfig, repo *testRepository) OidcService {
+	return NewOidcService(repo, &testUsers{repo: repo}, &testAuth{}, Config{Providers: []ProviderConfig{provider}})
+}
+
+// login logs in at the mock provider with an email, and returns the code and the state it sends back
+func login(t *testing.T, authURL string, email string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(authURL, url.Values{"email": {email}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound || !strings.HasPrefix(callback.String(), testRedirectURL) {
+		t.Fatalf("got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+// logIn goes through a whole login with an email
+func logIn(t *testing.T, s OidcService, userID string, email string) (*LoginResultEntity, error) {
+	t.Helper()
+	authURL, state, err := s.Begin(context.Background(), "mock", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, returnedState := login(t, authURL, email)
+	if returnedState != state {
+		t.Fatalf("got the state %q, want %q", returnedState, state)
+	}
+	return s.Callback(context.Background(), "mock", state, code, "127.0.0.1", "test")
+}
+
+func TestLoginWithPKCE(t *testing.T) {
+	_, provider := testProvider(t)
+	provider.Provision = true
+	repo := newTestRepository()
+	s := newTestService(provider, repo)
+
+	authURL, state, err := s.Begin(context.Background(), "mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ := url.Parse(authURL)
+	var stored *StateModel
+	for _, s := range repo.states {
+		stored = s
+	}
+	// the challenge of the provider is the hash of the verifier kept on the server
+	challenge := sha256.Sum256([]byte(stored.CodeVerifier))
+	if query.Query().Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) ||
+		query.Query().Get("code_challenge_method") != "S256" || query.Query().Get("nonce") != stored.Nonce ||
+		strings.Contains(authURL, stored.CodeVerifier) {
+		t.Fatalf("got %s", authURL)
+	}
+
+	code, _ := login(t, authURL, "alice@example.com")
+	result, err := s.Callback(context.Background(), "mock", state, code, "127.0.0.1", "test")
+	if err != nil || result.Tokens == nil || result.Tokens.Token != "alice" {
+		t.Fatalf("got %+v %v", result, err)
+	}
+	// the state is used once
+	if _, err := s.Callback(context.Background(), "mock", state, code, "127.0.0.1", "test"); err != ErrInvalidState {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestCodeNeedsTheVerifier(t *testing.T) {
+	_, provider := testProvider(t)
+	provider.Provision = true
+	repo := newTestRepository()
+	s := newTestService(provider, repo)
+
+	authURL, state, err := s.Begin(context.Background(), "mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := login(t, authURL, "alice@example.com")
+	// a code stolen on its way back is exchanged without the verifier of the login
+	for _, stored := range repo.states {
+		stored.CodeVerifier = "another verifier"
+	}
+	if _, err := s.Callback(context.Background(), "mock", state, code, "127.0.0.1", "test"); err != ErrProviderUnavailable {
+		t.Fatalf("got %v, want ErrProviderUnavailable", err)
+	}
+	if len(repo.users) != 0 {
+		t.Fatal("a user was created")
+	}
+}
+
+func TestNonceMismatch(t *testing.T) {
+	_, provider := testProvider(t)
+	provider.Provision = true
+	repo := newTestRepository()
+	s := newTestService(provider, repo)
+
+	authURL, state, err := s.Begin(context.Background(), "mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := login(t, authURL, "alice@example.com")
+	for _, stored := range repo.states {
+		stored.Nonce = "another nonce"
+	}
+	if _, err := s.Callback(context.Background(), "mock", state, code, "127.0.0.1", "test"); err != ErrInvalidIDToken {
+		t.Fatalf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := testProvider(t)
+	p := NewProvider(provider)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key *rsa.PrivateKey, change func(jwt.MapClaims)) string {
+		claims := jwt.MapClaims{
+			"iss":   mock.issuer,
+			"sub":   "subject",
+			"aud":   testClientID,
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+		change(claims)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "mock"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		key    *rsa.PrivateKey
+		change func(jwt.MapClaims)
+		valid  bool
+	}{
+		{"valid", mock.key, func(c jwt.MapClaims) {}, true},
+		{"audience list with azp", mock.key, func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other"}
+			c["azp"] = testClientID
+		}, true},
+		{"expired within the clock skew", mock.key, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }, true},
+		{"expired", mock.key, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * clockSkew).Unix() }, false},
+		{"no expiry", mock.key, func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"other audience", mock.key, func(c jwt.MapClaims) { c["aud"] = "other" }, false},
+		{"audience list without azp", mock.key, func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"} }, false},
+		{"other azp", mock.key, func(c jwt.MapClaims) { c["azp"] = "other" }, false},
+		{"other issuer", mock.key, func(c jwt.MapClaims) { c["iss"] = "http://evil.example.com" }, false},
+		{"no subject", mock.key, func(c jwt.MapClaims) { delete(c, "sub") }, false},
+		{"other nonce", mock.key, func(c jwt.MapClaims) { c["nonce"] = "other" }, false},
+		{"other key", otherKey, func(c jwt.MapClaims) {}, false},
+	}
+	for _, test := range tests {
+		_, err := p.verify(context.Background(), sign(test.key, test.change), "nonce")
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+
+	// a token signed with the secret of the client, not a key of the provider
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": mock.issuer, "sub": "subject", "aud": testClientID,
+		"exp": time.Now().Add(time.Minute).Unix(), "nonce": "nonce"})
+	signed, _ := token.SignedString([]byte(testClientSecret))
+	if _, err := p.verify(context.Background(), signed, "nonce"); err != ErrInvalidIDToken {
+		t.Fatalf("got %v for HS256, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestLinkByEmail(t *testing.T) {
+	_, provider := testProvider(t)
+	repo := newTestRepository()
+	repo.users = []*user.UserEntity{{ID: primitive.NewObjectID().Hex(), Username: "alice", Email: "alice@example.com",
+		EmailVerified: true, Role: "user", Validity: "valid"}}
+
+	// without the policy, the email of a user does not log in as this user
+	if _, err := logIn(t, newTestService(provider, repo), "", "Alice@Example.com"); err != ErrLinkRequired {
+		t.Fatalf("got %v, want ErrLinkRequired", err)
+	}
+	provider.LinkByEmail = true
+	// an email the user did not verify may have been registered by someone else
+	repo.users[0].EmailVerified = false
+	if _, err := logIn(t, newTestService(provider, repo), "", "alice@example.com"); err != ErrLinkRequired {
+		t.Fatalf("got %v for an unverified email, want ErrLinkRequired", err)
+	}
+	if len(repo.identities) != 0 {
+		t.Fatal("the identity was linked to an unverified email")
+	}
+	repo.users[0].EmailVerified = true
+	provider.AllowedDomains = []string{"example.org"}
+	if _, err := logIn(t, newTestService(provider, repo), "", "alice@example.com"); err != ErrNotAllowed {
+		t.Fatalf("got %v for another domain, want ErrNotAllowed", err)
+	}
+
+	provider.AllowedDomains = []string{"example.com"}
+	s := newTestService(provider, repo)
+	result, err := logIn(t, s, "", "Alice@Example.com")
+	if err != nil || result.Tokens.Token != "alice" {
+		t.Fatalf("got %+v %v", result, err)
+	}
+	if len(repo.identities) != 1 || repo.identities[0].UserID != repo.users[0].ID || len(repo.users) != 1 {
+		t.Fatalf("got the identities %+v", repo.identities)
+	}
+	// the identity logs in the next times
+	if result, err := logIn(t, s, "", "alice@example.com"); err != nil || result.Tokens.Token != "alice" || len(repo.identities) != 1 {
+		t.Fatalf("got %+v %v", result, err)
+	}
+}
+
+func TestProvisioningPolicy(t *testing.T) {
+	_, provider := testProvider(t)
+	repo := newTestRepository()
+
+	if _, err := logIn(t, newTestService(provider, repo), "", "bob@example.com"); err != ErrNotAllowed {
+		t.Fatalf("got %v, want ErrNotAllowed", err)
+	}
+	if len(repo.users) != 0 || len(repo.identities) != 0 {
+		t.Fatal("a user was created without the policy")
+	}
+
+	provider.Provision = true
+	provider.AllowedDomains = []string{"example.com"}
+	s := newTestService(provider, repo)
+	if _, err := logIn(t, s, "", "bob@example.org"); err != ErrNotAllowed {
+		t.Fatalf("got %v for another domain, want ErrNotAllowed", err)
+	}
+	repo.users = append(repo.users, &user.UserEntity{ID: primitive.NewObjectID().Hex(), Username: "bob", Email: "other@example.com"})
+	result, err := logIn(t, s, "", "bob@example.com")
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("got %+v %v", result, err)
+	}
+	created := repo.users[1]
+	// the username is free, and the email was verified by the provider
+	if created.Username == "bob" || !strings.HasPrefix(created.Username, "bob") || created.Email != "bob@example.com" ||
+		!created.EmailVerified || created.Role != "user" {
+		t.Fatalf("got %+v", created)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	_, provider := testProvider(t)
+	repo := newTestRepository()
+	aliceID, bobID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+	repo.users = []*user.UserEntity{
+		{ID: aliceID, Username: "alice", Email: "alice@example.com", EmailVerified: true, Validity: "valid"},
+		{ID: bobID, Username: "bob", Email: "bob@example.com", EmailVerified: true, Validity: "valid"},
+	}
+	s := newTestService(provider, repo)
+
+	// a user connected links any identity, without the policy
+	result, err := logIn(t, s, aliceID, "work@example.net")
+	if err != nil || !result.Linked || result.Tokens != nil {
+		t.Fatalf("got %+v %v", result, err)
+	}
+	if _, err := logIn(t, s, bobID, "work@example.net"); err != ErrIdentityLinked {
+		t.Fatalf("got %v, want ErrIdentityLinked", err)
+	}
+	if result, err := logIn(t, s, "", "work@example.net"); err != nil || result.Tokens.Token != "alice" {
+		t.Fatalf("got %+v %v", result, err)
+	}
+}
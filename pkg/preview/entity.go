@@ -0,0 +1,9 @@
+package preview
+
+import "chat-app/pkg/message"
+
+// EventEntity is the data of the WebSocket event sent when the links of a message are fetched
+type EventEntity struct {
+	MessageID string                  `json:"messageId"`
+	Previews  []message.PreviewEntity `json:"previews"`
+}
@@ -0,0 +1,209 @@
+package preview
+
+import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrBlockedURL is returned for a link that is not http(s), or whose domain is not allowed
+	ErrBlockedURL = errors.New("The link is not allowed")
+	// ErrBlockedAddress is returned when a link resolves to a private address
+	ErrBlockedAddress = errors.New("The address of the link is not allowed")
+	// ErrNotHTML is returned for a link to something else than a page
+	ErrNotHTML = errors.New("The link is not a page")
+)
+
+// maxRedirects is the number of redirects followed for a link
+const maxRedirects = 3
+
+// limits of the texts of a preview, in runes
+const (
+	maxTitle       = 200
+	maxDescription = 500
+)
+
+// Fetcher reads the metadata of the pages
+type Fetcher struct {
+	config Config
+	client *http.Client
+}
+
+// NewFetcher creates a fetcher with the limits of the configuration
+func NewFetcher(config Config) *Fetcher {
+	f := &Fetcher{config: config}
+	f.client = &http.Client{
+		Transport: utils.NewPublicTransport(config.Timeout, config.AllowPrivate, ErrBlockedAddress),
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// via holds the first request too
+			if len(via) > maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// Fetch reads the title, description, image and site name of a page
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*message.PreviewEntity, error) {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrBlockedURL
+	}
+	if err := f.checkURL(link); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "chat-app link preview")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	preview := parsePage(io.LimitReader(resp.Body, f.config.MaxSize))
+	preview.URL = rawURL
+	// the image is relative to the page the redirects ended on
+	if preview.Image != "" {
+		preview.Image = resolveImage(resp.Request.URL, preview.Image)
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errors.New("no metadata")
+	}
+	return preview, nil
+}
+
+// checkURL rejects the links that are not http(s) and the domains not allowed
+func (f *Fetcher) checkURL(link *url.URL) error {
+	if link.Scheme != "http" && link.Scheme != "https" || link.Hostname() == "" || link.User != nil {
+		return ErrBlockedURL
+	}
+	host := strings.ToLower(strings.TrimSuffix(link.Hostname(), "."))
+	if matchDomain(f.config.Deny, host) {
+		return ErrBlockedURL
+	}
+	if len(f.config.Allow) > 0 && !matchDomain(f.config.Allow, host) {
+		return ErrBlockedURL
+	}
+	return nil
+}
+
+// matchDomain checks if a host is one of the domains, or one of their subdomains
+func matchDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePage reads the metadata of the head of a page, OpenGraph first then the title and the description
+func parsePage(r io.Reader) *message.PreviewEntity {
+	preview := &message.PreviewEntity{}
+	var title, description string
+	tokenizer := html.NewTokenizer(r)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return finishPreview(preview, title, description)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				return finishPreview(preview, title, description)
+			case "title":
+				if title == "" && tokenizer.Next() == html.TextToken {
+					title = string(tokenizer.Text())
+				}
+			case "meta":
+				var key, content string
+				for _, attr := range token.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(attr.Val)
+						}
+					case "content":
+						content = attr.Val
+					}
+				}
+				switch key {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image", "og:image:url":
+					if preview.Image == "" {
+						preview.Image = content
+					}
+				case "og:site_name":
+					preview.SiteName = content
+				case "description":
+					description = content
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "head" {
+				return finishPreview(preview, title, description)
+			}
+		}
+	}
+}
+
+// finishPreview falls back on the title and the description of the page, and cleans the texts
+func finishPreview(preview *message.PreviewEntity, title string, description string) *message.PreviewEntity {
+	if preview.Title == "" {
+		preview.Title = title
+	}
+	if preview.Description == "" {
+		preview.Description = description
+	}
+	preview.Title = cleanText(preview.Title, maxTitle)
+	preview.Description = cleanText(preview.Description, maxDescription)
+	preview.SiteName = cleanText(preview.SiteName, maxTitle)
+	return preview
+}
+
+// cleanText collapses the spaces of a text and cuts it to a number of runes
+func cleanText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// resolveImage makes the image of a page absolute, it is dropped if it is not http(s)
+func resolveImage(page *url.URL, image string) string {
+	imageURL, err := page.Parse(strings.TrimSpace(image))
+	if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+		return ""
+	}
+	return imageURL.String()
+}
@@ -0,0 +1,27 @@
+package preview
+
+import (
+	"chat-app/pkg/message"
+	"context"
+)
+
+// previewedMessageService previews the links of every new message after it is sent
+type previewedMessageService struct {
+	message.MessageService
+	previewService PreviewService
+}
+
+// NewPreviewedMessageService adds the link previews behind a message service
+func NewPreviewedMessageService(messageService message.MessageService, previewService PreviewService) message.MessageService {
+	return &previewedMessageService{MessageService: messageService, previewService: previewService}
+}
+
+// CreateMessage creates the message, its links are fetched in background and sent as a follow-up event
+func (p *previewedMessageService) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	created, err := p.MessageService.CreateMessage(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	p.previewService.Enqueue(created)
+	return created, nil
+}
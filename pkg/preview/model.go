@@ -0,0 +1,29 @@
+package preview
+
+import (
+	"chat-app/pkg/message"
+	"time"
+)
+
+// PreviewModel is a fetched link kept in the cache, the links that could not be fetched are kept too
+type PreviewModel struct {
+	URL         string    `bson:"_id"`
+	Title       string    `bson:"title,omitempty"`
+	Description string    `bson:"description,omitempty"`
+	Image       string    `bson:"image,omitempty"`
+	SiteName    string    `bson:"siteName,omitempty"`
+	Failed      bool      `bson:"failed,omitempty"`
+	FetchedAt   time.Time `bson:"fetchedAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// ModelToEntity converts a cached link to the preview of a message
+func ModelToEntity(preview *PreviewModel) message.PreviewEntity {
+	return message.PreviewEntity{
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		Image:       preview.Image,
+		SiteName:    preview.SiteName,
+	}
+}
@@ -0,0 +1,65 @@
+package preview
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// PreviewRepository defines the methods of the cache of the links and of the previews of the messages
+type PreviewRepository interface {
+	GetCached(ctx context.Context, url string) (*PreviewModel, error)
+	SaveCached(ctx context.Context, preview *PreviewModel) error
+	SetPreviews(ctx context.Context, messageID string, previews []message.PreviewModel) error
+}
+
+// previewRepository is the implementation of the PreviewRepository interface
+type previewRepository struct {
+	collection        *mongo.Collection
+	collectionMessage *mongo.Collection
+}
+
+// NewPreviewRepository creates a new preview repository
+func NewPreviewRepository(collection *mongo.Collection, collectionMessage *mongo.Collection) PreviewRepository {
+	return &previewRepository{collection: collection, collectionMessage: collectionMessage}
+}
+
+// GetCached retrieves a link of the cache, nil if it is not cached or expired
+func (r *previewRepository) GetCached(ctx context.Context, url string) (*PreviewModel, error) {
+	var preview PreviewModel
+	err := r.collection.FindOne(ctx, bson.D{{"_id", url}, {"expiresAt", bson.D{{"$gt", time.Now()}}}}).Decode(&preview)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// SaveCached inserts or replaces a link of the cache
+func (r *previewRepository) SaveCached(ctx context.Context, preview *PreviewModel) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.D{{"_id", preview.URL}}, preview, options.Replace().SetUpsert(true))
+	return err
+}
+
+// SetPreviews sets the previews of a message
+func (r *previewRepository) SetPreviews(ctx context.Context, messageID string, previews []message.PreviewModel) error {
+	messageObjectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collectionMessage.UpdateOne(ctx, bson.D{{"_id", messageObjectID}}, bson.D{{"$set", bson.D{{"previews", previews}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(" message not found")
+	}
+	return nil
+}
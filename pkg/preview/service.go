@@ -0,0 +1,228 @@
+package preview
+
+import (
+	"chat-app/pkg/markdown"
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the limits of the link previews
+type Config struct {
+	// Enabled turns the link previews on
+	Enabled bool
+	// Timeout is the time limit to fetch a page
+	Timeout time.Duration
+	// MaxSize is the number of bytes of a page read, in bytes
+	MaxSize int64
+	// MaxLinks is the number of links of a message previewed
+	MaxLinks int
+	// CacheTTL is how long a fetched link is kept
+	CacheTTL time.Duration
+	// Allow are the only domains fetched when set, Deny the domains never fetched, with their subdomains
+	Allow []string
+	Deny  []string
+	// AllowPrivate lets the links reach private addresses, to test with a local server only
+	AllowPrivate bool
+	// Workers is the number of messages processed at the same time
+	Workers int
+}
+
+// ConfigFromEnv reads the link preview limits from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{
+		Enabled:  true,
+		Timeout:  5 * time.Second,
+		MaxSize:  512 << 10,
+		MaxLinks: 3,
+		CacheTTL: 24 * time.Hour,
+		Workers:  4,
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("LINK_PREVIEW_ENABLED")); err == nil {
+		config.Enabled = enabled
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("LINK_PREVIEW_TIMEOUT")); err == nil && timeout > 0 {
+		config.Timeout = timeout
+	}
+	if size, err := strconv.ParseInt(os.Getenv("LINK_PREVIEW_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		config.MaxSize = size
+	}
+	if links, err := strconv.Atoi(os.Getenv("LINK_PREVIEW_MAX_LINKS")); err == nil && links > 0 {
+		config.MaxLinks = links
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("LINK_PREVIEW_CACHE_TTL")); err == nil && ttl > 0 {
+		config.CacheTTL = ttl
+	}
+	config.Allow = splitDomains(os.Getenv("LINK_PREVIEW_ALLOW"))
+	config.Deny = splitDomains(os.Getenv("LINK_PREVIEW_DENY"))
+	if allowPrivate, err := strconv.ParseBool(os.Getenv("LINK_PREVIEW_ALLOW_PRIVATE")); err == nil {
+		config.AllowPrivate = allowPrivate
+	}
+	return config
+}
+
+// splitDomains parses a comma separated list of domains
+func splitDomains(value string) []string {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// EventPreviews is the WebSocket event sent when the links of a message are fetched
+const EventPreviews = "message.previews"
+
+// failedTTL is how long a link that could not be fetched is not fetched again
+const failedTTL = 10 * time.Minute
+
+// PreviewService defines the methods of the link previews
+type PreviewService interface {
+	Enqueue(msg *message.MessageEntity)
+	Previews(ctx context.Context, content string) []message.PreviewEntity
+	Start(ctx context.Context)
+}
+
+// previewService fetches the links of the messages in background
+type previewService struct {
+	repo      PreviewRepository
+	fetcher   *Fetcher
+	broadcast room.Broadcaster
+	config    Config
+	queue     chan *message.MessageEntity
+}
+
+// NewPreviewService creates a new preview service
+func NewPreviewService(repo PreviewRepository, broadcast room.Broadcaster, config Config) PreviewService {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return &previewService{
+		repo:      repo,
+		fetcher:   NewFetcher(config),
+		broadcast: broadcast,
+		config:    config,
+		queue:     make(chan *message.MessageEntity, 100),
+	}
+}
+
+// Enqueue adds a message to the messages to preview, it is dropped when the queue is full
+func (s *previewService) Enqueue(msg *message.MessageEntity) {
+	if !s.config.Enabled || len(findLinks(msg.Content, 1)) == 0 {
+		return
+	}
+	select {
+	case s.queue <- msg:
+	default:
+		log.Printf("Link preview queue full, message %s not previewed", msg.ID)
+	}
+}
+
+// Start runs the workers of the queue until the context is done
+func (s *previewService) Start(ctx context.Context) {
+	for i := 0; i < s.config.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-s.queue:
+					s.process(ctx, msg)
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+}
+
+// process fetches the links of a message, saves them in it, and sends them to its room
+func (s *previewService) process(ctx context.Context, msg *message.MessageEntity) {
+	previews := s.Previews(ctx, msg.Content)
+	if len(previews) == 0 {
+		return
+	}
+	if err := s.repo.SetPreviews(ctx, msg.ID, message.PreviewEntitiesToModels(previews)); err != nil {
+		log.Printf("Failed to save the link previews of message %s: %v", msg.ID, err)
+		return
+	}
+	if s.broadcast != nil {
+		s.broadcast(msg.RoomID, EventPreviews, EventEntity{MessageID: msg.ID, Previews: previews})
+	}
+}
+
+// Previews returns the previews of the links of a text, from the cache or fetched
+func (s *previewService) Previews(ctx context.Context, content string) []message.PreviewEntity {
+	var previews []message.PreviewEntity
+	for _, link := range findLinks(content, s.config.MaxLinks) {
+		cached, err := s.repo.GetCached(ctx, link)
+		if err != nil {
+			log.Printf("Failed to read the link preview cache: %v", err)
+		}
+		if cached == nil {
+			cached = s.fetch(ctx, link)
+		}
+		if !cached.Failed {
+			previews = append(previews, ModelToEntity(cached))
+		}
+	}
+	return previews
+}
+
+// fetch fetches a link and keeps it in the cache, with a shorter expiry when it failed
+func (s *previewService) fetch(ctx context.Context, link string) *PreviewModel {
+	fetchCtx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	now := time.Now()
+	cached := &PreviewModel{URL: link, FetchedAt: now, ExpiresAt: now.Add(s.config.CacheTTL)}
+	preview, err := s.fetcher.Fetch(fetchCtx, link)
+	if err != nil {
+		cached.Failed = true
+		if failedTTL < s.config.CacheTTL {
+			cached.ExpiresAt = now.Add(failedTTL)
+		}
+	} else {
+		cached.Title, cached.Description, cached.Image, cached.SiteName = preview.Title, preview.Description, preview.Image, preview.SiteName
+	}
+	if err := s.repo.SaveCached(ctx, cached); err != nil {
+		log.Printf("Failed to save the link preview cache: %v", err)
+	}
+	return cached
+}
+
+// linkPattern matches the http(s) links of a text
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// findLinks returns the distinct links of a text, at most limit links
+func findLinks(content string, limit int) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, match := range linkPattern.FindAllString(content, -1) {
+		match = markdown.TrimLink(match)
+		link, err := url.Parse(match)
+		if err != nil || link.Host == "" {
+			continue
+		}
+		// the fragment is not sent to the server, the same page is cached once
+		link.Fragment = ""
+		normalized := link.String()
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		links = append(links, normalized)
+		if len(links) >= limit {
+			break
+		}
+	}
+	return links
+}
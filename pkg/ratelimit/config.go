@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuleFromEnv reads a rule from an environment variable formatted as "<count>/<interval>",
+// for example "5/1m" or "20/10s". "off" disables the limit.
+// The fallback rule is returned when the variable is empty or invalid.
+func RuleFromEnv(name string, fallback Rule) Rule {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	if value == "off" {
+		return Rule{}
+	}
+	rule, err := ParseRule(value)
+	if err != nil {
+		log.Printf("Invalid rate limit %s=%q, using default: %v", name, value, err)
+		return fallback
+	}
+	return rule
+}
+
+// ParseRule parses a rule formatted as "<count>/<interval>".
+func ParseRule(value string) (Rule, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Rule{}, strconv.ErrSyntax
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count <= 0 {
+		return Rule{}, strconv.ErrSyntax
+	}
+	interval, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || interval <= 0 {
+		return Rule{}, strconv.ErrSyntax
+	}
+	return Per(count, interval), nil
+}
+
+// TrustedProxiesFromEnv reads the comma-separated IPs or CIDRs of the reverse proxies allowed to set
+// X-Forwarded-For from TRUSTED_PROXIES. None are trusted when it is empty, the client IP is then the remote address.
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
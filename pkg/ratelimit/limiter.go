@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rule describes a token bucket: up to Burst tokens, refilled at Rate tokens per second.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+// Per returns a rule allowing n events per interval, with a burst of n.
+func Per(n int, interval time.Duration) Rule {
+	return Rule{Rate: float64(n) / interval.Seconds(), Burst: n}
+}
+
+// bucket holds the state of a single key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket rate limiter keyed by an arbitrary string (user ID, client IP...).
+type Limiter struct {
+	rule      Rule
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a new limiter applying the given rule to every key.
+func NewLimiter(rule Rule) *Limiter {
+	return &Limiter{rule: rule, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Allow consumes a token for the key.
+// It returns false and the time to wait before the next token when the bucket is empty.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	// a rule without rate or burst does not limit anything
+	if l == nil || l.rule.Rate <= 0 || l.rule.Burst <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	// refill the bucket with the tokens earned since the last call
+	b.tokens = math.Min(float64(l.rule.Burst), b.tokens+now.Sub(b.last).Seconds()*l.rule.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rule.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes the buckets that are full again, at most once per minute
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(float64(l.rule.Burst) / l.rule.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limits groups limiters by name, such as a route group or a WebSocket message type.
+type Limits map[string]*Limiter
+
+// Allow checks the key against the limiter registered under name.
+// Names without a limiter are rejected, so a new name cannot skip the limits.
+func (l Limits) Allow(name string, key string) (bool, time.Duration) {
+	limiter, ok := l[name]
+	if !ok {
+		return false, 0
+	}
+	return limiter.Allow(key)
+}
+
+// RetryAfterSeconds rounds a wait duration up to whole seconds, as expected by the Retry-After header.
+func RetryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
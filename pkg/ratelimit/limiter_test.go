@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowConsumesTheBurst(t *testing.T) {
+	limiter := NewLimiter(Per(3, time.Minute))
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("alice"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+	ok, wait := limiter.Allow("alice")
+	if ok {
+		t.Fatal("the fourth request was allowed")
+	}
+	// one token comes back every 20 seconds
+	if wait <= 0 || wait > 20*time.Second {
+		t.Fatalf("got a wait of %v, want up to 20s", wait)
+	}
+	if ok, _ := limiter.Allow("bob"); !ok {
+		t.Fatal("the keys share their bucket")
+	}
+}
+
+func TestAllowRefills(t *testing.T) {
+	limiter := NewLimiter(Per(2, 100*time.Millisecond))
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	if ok, _ := limiter.Allow("alice"); ok {
+		t.Fatal("the empty bucket allowed a request")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := limiter.Allow("alice"); !ok {
+		t.Fatal("the bucket was not refilled")
+	}
+}
+
+func TestAllowWithoutRule(t *testing.T) {
+	var nilLimiter *Limiter
+	for _, limiter := range []*Limiter{NewLimiter(Rule{}), nilLimiter} {
+		for i := 0; i < 100; i++ {
+			if ok, _ := limiter.Allow("alice"); !ok {
+				t.Fatal("a limiter without rule limited a request")
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{"message": NewLimiter(Per(1, time.Minute))}
+	limits.Allow("message", "alice")
+	if ok, _ := limits.Allow("message", "alice"); ok {
+		t.Fatal("the message limit was not applied")
+	}
+	if ok, _ := limits.Allow("typing", "alice"); ok {
+		t.Fatal("a name without limiter was allowed")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("20/10s")
+	if err != nil || rule.Burst != 20 || rule.Rate != 2 {
+		t.Fatalf("got %+v %v", rule, err)
+	}
+	for _, value := range []string{"20", "0/1m", "-1/1m", "5/0s", "five/1m", "5/minute"} {
+		if _, err := ParseRule(value); err == nil {
+			t.Errorf("ParseRule(%q) did not fail", value)
+		}
+	}
+}
+
+func TestRuleFromEnv(t *testing.T) {
+	fallback := Per(5, time.Minute)
+	t.Setenv("RATE_LIMIT_TEST", "off")
+	if rule := RuleFromEnv("RATE_LIMIT_TEST", fallback); rule != (Rule{}) {
+		t.Fatalf("got %+v, want no limit", rule)
+	}
+	t.Setenv("RATE_LIMIT_TEST", "bad")
+	if rule := RuleFromEnv("RATE_LIMIT_TEST", fallback); rule != fallback {
+		t.Fatalf("got %+v, want the fallback", rule)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	if seconds := RetryAfterSeconds(1500 * time.Millisecond); seconds != 2 {
+		t.Fatalf("got %d, want 2", seconds)
+	}
+	if seconds := RetryAfterSeconds(0); seconds != 1 {
+		t.Fatalf("got %d, want 1", seconds)
+	}
+}
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	if proxies := TrustedProxiesFromEnv(); proxies != nil {
+		t.Fatalf("got %v, want nil", proxies)
+	}
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1, ,172.16.0.0/12")
+	if proxies := TrustedProxiesFromEnv(); len(proxies) != 2 || proxies[0] != "10.0.0.1" || proxies[1] != "172.16.0.0/12" {
+		t.Fatalf("got %v", proxies)
+	}
+}
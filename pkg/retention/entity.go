@@ -0,0 +1,27 @@
+package retention
+
+// RunEntity represents the result of a purge of the expired messages
+type RunEntity struct {
+	ID         string          `json:"_id,omitempty"`
+	Mode       string          `json:"mode,omitempty"`
+	StartedAt  string          `json:"startedAt,omitempty"`
+	FinishedAt string          `json:"finishedAt,omitempty"`
+	Rooms      []RoomRunEntity `json:"rooms,omitempty"`
+	Purged     int             `json:"purged"`
+	Errors     []string        `json:"errors,omitempty"`
+}
+
+// RoomRunEntity represents the result of a purge for a room
+type RoomRunEntity struct {
+	RoomID string `json:"roomId,omitempty"`
+	Cutoff string `json:"cutoff,omitempty"`
+	Purged int    `json:"purged"`
+}
+
+// PolicyEntity represents the server retention policy
+type PolicyEntity struct {
+	DefaultDays int    `json:"defaultDays"`
+	Mode        string `json:"mode"`
+	Interval    string `json:"interval"`
+	BatchSize   int    `json:"batchSize"`
+}
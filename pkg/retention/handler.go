@@ -0,0 +1,35 @@
+package retention
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetRunsHandler returns the retention policy and the results of the last purges
+func GetRunsHandler(retentionService RetentionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runs, err := retentionService.GetRuns(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get purges"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"policy": retentionService.Policy(), "runs": runs})
+	}
+}
+
+// RunPurgeHandler purges the expired messages now
+func RunPurgeHandler(retentionService RetentionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := retentionService.Run(c.Request.Context())
+		if errors.Is(err, ErrPurgeRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not purge messages"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"run": run})
+	}
+}
@@ -0,0 +1,41 @@
+package retention
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RunModel represents the result of a purge, stored for the admins
+type RunModel struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Mode       string             `bson:"mode,omitempty"`
+	StartedAt  time.Time          `bson:"startedAt,omitempty"`
+	FinishedAt time.Time          `bson:"finishedAt,omitempty"`
+	Rooms      []RoomRunModel     `bson:"rooms,omitempty"`
+	Purged     int                `bson:"purged"`
+	Errors     []string           `bson:"errors,omitempty"`
+}
+
+// RoomRunModel represents the result of a purge for a room
+type RoomRunModel struct {
+	RoomID string    `bson:"roomId,omitempty"`
+	Cutoff time.Time `bson:"cutoff,omitempty"`
+	Purged int       `bson:"purged"`
+}
+
+// ModelToEntity converts a run model to a run entity
+func ModelToEntity(run *RunModel) *RunEntity {
+	rooms := make([]RoomRunEntity, 0)
+	for _, room := range run.Rooms {
+		rooms = append(rooms, RoomRunEntity{RoomID: room.RoomID, Cutoff: room.Cutoff.String(), Purged: room.Purged})
+	}
+	return &RunEntity{
+		ID:         run.ID.Hex(),
+		Mode:       run.Mode,
+		StartedAt:  run.StartedAt.String(),
+		FinishedAt: run.FinishedAt.String(),
+		Rooms:      rooms,
+		Purged:     run.Purged,
+		Errors:     run.Errors,
+	}
+}
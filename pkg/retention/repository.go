@@ -0,0 +1,121 @@
+package retention
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// RetentionRepository defines the methods to purge the expired messages
+type RetentionRepository interface {
+	PurgeBatch(ctx context.Context, roomID string, cutoff time.Time, archive bool, batchSize int) (int, error)
+	SaveRun(ctx context.Context, run *RunModel) error
+	GetRuns(ctx context.Context, limit int64) ([]*RunEntity, error)
+}
+
+// retentionRepository is the implementation of the RetentionRepository interface
+type retentionRepository struct {
+	collectionMessage *mongo.Collection
+	collectionRoom    *mongo.Collection
+	collectionArchive *mongo.Collection
+	collectionRun     *mongo.Collection
+}
+
+// NewRetentionRepository creates a new retention repository
+func NewRetentionRepository(collectionMessage *mongo.Collection, collectionRoom *mongo.Collection, collectionArchive *mongo.Collection, collectionRun *mongo.Collection) RetentionRepository {
+	return &retentionRepository{
+		collectionMessage: collectionMessage,
+		collectionRoom:    collectionRoom,
+		collectionArchive: collectionArchive,
+		collectionRun:     collectionRun,
+	}
+}
+
+// PurgeBatch deletes, or moves to the archive, up to batchSize messages of a room created before the cutoff.
+// It returns the number of messages purged.
+func (r *retentionRepository) PurgeBatch(ctx context.Context, roomID string, cutoff time.Time, archive bool, batchSize int) (int, error) {
+	// find the oldest expired messages of the room
+	opts := options.Find().SetSort(bson.D{{"createdAt", 1}}).SetLimit(int64(batchSize))
+	cursor, err := r.collectionMessage.Find(ctx, bson.D{{"roomId", roomID}, {"createdAt", bson.D{{"$lt", cutoff}}}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	var messages []bson.M
+	if err = cursor.All(ctx, &messages); err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	idsHex := make([]string, 0, len(messages))
+	documents := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		id, ok := message["_id"].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		ids = append(ids, id)
+		idsHex = append(idsHex, id.Hex())
+		message["archivedAt"] = time.Now()
+		documents = append(documents, message)
+	}
+
+	// copy the messages to the archive, a message already archived by a previous run is skipped
+	if archive {
+		_, err = r.collectionArchive.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+	}
+
+	// remove the references of the room first, so that it never points to a deleted message
+	_, err = r.collectionRoom.UpdateOne(ctx, bson.M{"_id": stringToObjectID(roomID)},
+		bson.M{"$pull": bson.M{"messages": bson.M{"$in": idsHex}}})
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.collectionMessage.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+// SaveRun stores the result of a purge
+func (r *retentionRepository) SaveRun(ctx context.Context, run *RunModel) error {
+	run.ID = primitive.NewObjectID()
+	_, err := r.collectionRun.InsertOne(ctx, run)
+	return err
+}
+
+// GetRuns returns the last results of the purges, most recent first
+func (r *retentionRepository) GetRuns(ctx context.Context, limit int64) ([]*RunEntity, error) {
+	opts := options.Find().SetSort(bson.D{{"startedAt", -1}}).SetLimit(limit)
+	cursor, err := r.collectionRun.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var runs []RunModel
+	if err = cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	// convert list of runs to list of run entities
+	runsEntities := make([]*RunEntity, 0)
+	for i := range runs {
+		runsEntities = append(runsEntities, ModelToEntity(&runs[i]))
+	}
+	return runsEntities, nil
+}
+
+// convert string to Object id
+func stringToObjectID(id string) primitive.ObjectID {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	return objectID
+}
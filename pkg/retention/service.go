@@ -0,0 +1,172 @@
+package retention
+
+import (
+	"chat-app/pkg/room"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// purge modes of the expired messages
+const (
+	ModeDelete  = "delete"
+	ModeArchive = "archive"
+)
+
+// ErrPurgeRunning is returned when a purge is requested while another one is running
+var ErrPurgeRunning = errors.New("A purge is already running")
+
+// Config holds the server retention policy
+type Config struct {
+	// DefaultDays is the retention of the rooms without their own setting, 0 keeps messages forever
+	DefaultDays int
+	// Mode is delete or archive
+	Mode string
+	// Interval is the time between two purges
+	Interval time.Duration
+	// BatchSize is the number of messages purged at once
+	BatchSize int
+}
+
+// ConfigFromEnv reads the retention policy from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{DefaultDays: 0, Mode: ModeDelete, Interval: time.Hour, BatchSize: 500}
+	if days, err := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS")); err == nil && days >= 0 {
+		config.DefaultDays = days
+	}
+	if mode := os.Getenv("RETENTION_MODE"); mode == ModeArchive {
+		config.Mode = ModeArchive
+	}
+	if interval, err := time.ParseDuration(os.Getenv("RETENTION_INTERVAL")); err == nil && interval > 0 {
+		config.Interval = interval
+	}
+	if batchSize, err := strconv.Atoi(os.Getenv("RETENTION_BATCH_SIZE")); err == nil && batchSize > 0 {
+		config.BatchSize = batchSize
+	}
+	return config
+}
+
+// RetentionService defines the methods of the background purger
+type RetentionService interface {
+	Start(ctx context.Context)
+	Run(ctx context.Context) (*RunEntity, error)
+	GetRuns(ctx context.Context) ([]*RunEntity, error)
+	Policy() PolicyEntity
+}
+
+// retentionService is the implementation of the RetentionService interface
+type retentionService struct {
+	repo        RetentionRepository
+	roomService room.RoomService
+	config      Config
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(repo RetentionRepository, roomService room.RoomService, config Config) RetentionService {
+	return &retentionService{repo: repo, roomService: roomService, config: config}
+}
+
+// Start purges the expired messages at every interval until the context is done
+func (s *retentionService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Run(ctx); err != nil && !errors.Is(err, ErrPurgeRunning) {
+				log.Printf("Retention purge failed: %v", err)
+			}
+		}
+	}
+}
+
+// Run purges the expired messages of every room and records the result
+func (s *retentionService) Run(ctx context.Context) (*RunEntity, error) {
+	// only one purge at a time
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, ErrPurgeRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	run := &RunModel{Mode: s.config.Mode, StartedAt: time.Now()}
+	rooms, err := s.roomService.GetAllRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, roomToPurge := range rooms {
+		days := s.retentionDays(&roomToPurge)
+		if days <= 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+		purged, err := s.purgeRoom(ctx, roomToPurge.ID, cutoff)
+		if err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("room %s: %v", roomToPurge.ID, err))
+		}
+		if purged > 0 {
+			run.Rooms = append(run.Rooms, RoomRunModel{RoomID: roomToPurge.ID, Cutoff: cutoff, Purged: purged})
+			run.Purged += purged
+		}
+	}
+	run.FinishedAt = time.Now()
+
+	log.Printf("Retention purge (%s): %d messages in %d rooms, %d errors, %s",
+		run.Mode, run.Purged, len(run.Rooms), len(run.Errors), run.FinishedAt.Sub(run.StartedAt))
+	if err := s.repo.SaveRun(ctx, run); err != nil {
+		log.Printf("Failed to save the retention purge result: %v", err)
+	}
+	return ModelToEntity(run), nil
+}
+
+// GetRuns returns the results of the last purges
+func (s *retentionService) GetRuns(ctx context.Context) ([]*RunEntity, error) {
+	return s.repo.GetRuns(ctx, 50)
+}
+
+// Policy returns the server retention policy
+func (s *retentionService) Policy() PolicyEntity {
+	return PolicyEntity{
+		DefaultDays: s.config.DefaultDays,
+		Mode:        s.config.Mode,
+		Interval:    s.config.Interval.String(),
+		BatchSize:   s.config.BatchSize,
+	}
+}
+
+// retentionDays returns the retention of a room in days, 0 or less to keep messages forever
+func (s *retentionService) retentionDays(roomToPurge *room.RoomEntity) int {
+	if roomToPurge.Retention != 0 {
+		return roomToPurge.Retention
+	}
+	return s.config.DefaultDays
+}
+
+// purgeRoom purges the messages of a room in batches
+func (s *retentionService) purgeRoom(ctx context.Context, roomID string, cutoff time.Time) (int, error) {
+	total := 0
+	for {
+		purged, err := s.repo.PurgeBatch(ctx, roomID, cutoff, s.config.Mode == ModeArchive, s.config.BatchSize)
+		total += purged
+		if err != nil || purged < s.config.BatchSize {
+			return total, err
+		}
+	}
+}
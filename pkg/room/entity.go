@@ -2,23 +2,107 @@ package room
 
 // RoomEntity represents the structure of a room entity.
 type RoomEntity struct {
-	ID          string   `json:"_id,omitempty"`
-	Name        string   `json:"name,omitempty"`
-	Description string   `json:"description,omitempty"`
-	Creator     string   `json:"creator,omitempty"`
-	CreatedAt   string   `json:"createdAt,omitempty"`
-	UpdatedAt   string   `json:"updatedAt,omitempty"`
-	Members     []string `json:"members,omitempty"`
-	Hashtags    []string `json:"hashtags,omitempty"`
-	Messages    []string `json:"messages,omitempty"`
-}
-
-// Member of a room
+	ID           string              `json:"_id,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Description  string              `json:"description,omitempty"`
+	Creator      string              `json:"creator,omitempty"`
+	CreatedAt    string              `json:"createdAt,omitempty"`
+	UpdatedAt    string              `json:"updatedAt,omitempty"`
+	Members      []string            `json:"members,omitempty"`
+	Moderators   []string            `json:"moderators,omitempty"`
+	Hashtags     []string            `json:"hashtags,omitempty"`
+	Messages     []string            `json:"messages,omitempty"`
+	SlowMode     int                 `json:"slowMode,omitempty"`
+	Archived     bool                `json:"archived"`
+	ArchivedAt   string              `json:"archivedAt,omitempty"`
+	Topic        string              `json:"topic,omitempty"`
+	Announcement *AnnouncementEntity `json:"announcement,omitempty"`
+	MaxMembers   int                 `json:"maxMembers,omitempty"`
+	Waitlist     []string            `json:"waitlist,omitempty"`
+	Retention    int                 `json:"retentionDays,omitempty"`
+}
+
+// IsModerator checks if the user is the owner or a moderator of the room
+func (r *RoomEntity) IsModerator(userID string) bool {
+	if userID == r.Creator {
+		return true
+	}
+	for _, moderator := range r.Moderators {
+		if moderator == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Member of a room, Waitlist asks to wait for a place when the room is full
 type MemberEntity struct {
-	ID string `json:"ID,omitempty" `
+	ID       string `json:"ID,omitempty" `
+	Waitlist bool   `json:"waitlist,omitempty"`
+}
+
+// Retention of the messages of a room in days : 0 for the server default, -1 to keep them forever
+type RetentionEntity struct {
+	Retention int `json:"retentionDays"`
+}
+
+// Capacity of a room : maximum number of members, 0 for no limit
+type CapacityEntity struct {
+	MaxMembers int `json:"maxMembers"`
 }
 
 // Hashtag of a room
 type HashtagEntity struct {
 	Hashtag string `json:"hashtag,omitempty" `
 }
+
+// Slow mode of a room : minimum interval in seconds between two messages of a user
+type SlowModeEntity struct {
+	SlowMode int `json:"slowMode"`
+}
+
+// Update of the name and description of a room
+type RoomUpdateEntity struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// HistoryEntity represents an entry of the history of a room
+type HistoryEntity struct {
+	ID        string            `json:"_id,omitempty"`
+	RoomID    string            `json:"roomId,omitempty"`
+	Action    string            `json:"action,omitempty"`
+	ActorID   string            `json:"actorId,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt string            `json:"createdAt,omitempty"`
+}
+
+// Topic of a room
+type TopicEntity struct {
+	Topic string `json:"topic"`
+}
+
+// AnnouncementEntity represents the announcement banner of a room
+type AnnouncementEntity struct {
+	Text      string `json:"text,omitempty"`
+	SetBy     string `json:"setBy,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// Announcement banner to set on a room, expiring after ExpiresIn seconds if not 0
+type AnnouncementUpdateEntity struct {
+	Text      string `json:"text,omitempty"`
+	ExpiresIn int    `json:"expiresIn,omitempty"`
+}
+
+// TopicEventEntity represents the topic and the announcement banner sent to the clients of a room
+type TopicEventEntity struct {
+	Topic        string              `json:"topic"`
+	Announcement *AnnouncementEntity `json:"announcement"`
+}
+
+// TopicEvent returns the topic and the announcement banner of the room
+func (r *RoomEntity) TopicEvent() TopicEventEntity {
+	return TopicEventEntity{Topic: r.Topic, Announcement: r.Announcement}
+}
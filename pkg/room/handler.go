@@ -3,11 +3,55 @@ package room
 import (
 	"chat-app/pkg/user"
 	"chat-app/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 )
 
+// Broadcaster sends an event to the clients connected to a room
+type Broadcaster func(roomID string, eventType string, data interface{})
+
+// events broadcast to the clients connected to a room
+const (
+	EventRoomUpdated = "room.updated"
+	EventRoomTopic   = "room.topic"
+)
+
+// validateRoomName returns the error message of an invalid room name, or an empty string
+func validateRoomName(name string) string {
+	// check if name is not too long
+	if len(name) > 20 {
+		return "Name is too long"
+	}
+	// check if name respects convention with a regex check
+	nameConvention := "^[a-zA-Z0-9_]*$"
+	if re, _ := regexp.Compile(nameConvention); !re.Match([]byte(name)) {
+		return "Invalid name"
+	}
+	return ""
+}
+
+// validateRoomDescription returns the error message of an invalid room description, or an empty string
+func validateRoomDescription(description string) string {
+	// check if description is not too long
+	if len(description) > 300 {
+		return "Description is too long"
+	}
+	// check if description is not too short
+	if len(description) < 10 {
+		return "Description is too short"
+	}
+	// check if description respects convention with a regex check
+	descriptionConvention := "^[a-zA-Z0-9_ ]*$"
+	if re, _ := regexp.Compile(descriptionConvention); !re.Match([]byte(description)) {
+		return "Invalid description"
+	}
+	return ""
+}
+
 // CreateRoomHandler create a room
 func CreateRoomHandler(roomService RoomService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -22,31 +66,13 @@ func CreateRoomHandler(roomService RoomService) gin.HandlerFunc {
 			return
 		}
 
-		// check if name is not too long
-		if len(newRoom.Name) > 20 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Name is too long"})
-			return
-		}
-		// check if description is not too long
-		if len(newRoom.Description) > 300 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Description is too long"})
+		// check if name and description respect the conventions
+		if errMessage := validateRoomName(newRoom.Name); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
 			return
 		}
-		// check if description is not too short
-		if len(newRoom.Description) < 10 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Description is too short"})
-			return
-		}
-		// check if name respects convention with a regex check
-		nameConvention := "^[a-zA-Z0-9_]*$"
-		if re, _ := regexp.Compile(nameConvention); !re.Match([]byte(newRoom.Name)) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid name"})
-			return
-		}
-		// check if description respects convention with a regex check
-		descriptionConvention := "^[a-zA-Z0-9_ ]*$"
-		if re, _ := regexp.Compile(descriptionConvention); !re.Match([]byte(newRoom.Description)) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid description"})
+		if errMessage := validateRoomDescription(newRoom.Description); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
 			return
 		}
 		// check if name is unique
@@ -150,6 +176,24 @@ func AddMemberToRoom(roomService RoomService) gin.HandlerFunc {
 			return
 		}
 		room, err := roomService.AddMember(c.Request.Context(), roomID, member.ID)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
+		// a full room can put the member on its waitlist
+		if errors.Is(err, ErrRoomFull) {
+			if !member.Waitlist {
+				c.JSON(http.StatusConflict, gin.H{"error": "Room is full"})
+				return
+			}
+			room, err = roomService.JoinWaitlist(c.Request.Context(), roomID, member.ID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Could not join waitlist"})
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{"room": room, "waitlisted": true})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not add member"})
 			return
@@ -171,6 +215,10 @@ func RemoveMemberFromRoom(roomService RoomService) gin.HandlerFunc {
 		}
 
 		room, err := roomService.RemoveMember(c.Request.Context(), roomID, member.ID)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not remove member"})
 			return
@@ -203,7 +251,10 @@ func AddHashtagToRoomHandler(roomService RoomService) gin.HandlerFunc {
 			return
 		}
 		room, err := roomService.AddHashtag(c.Request.Context(), roomID, hashtagToAdd.Hashtag)
-
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Error adding hashtag " + hashtagToAdd.Hashtag})
 			return
@@ -238,6 +289,10 @@ func RemoveHashtagFromRoomHandler(roomService RoomService) gin.HandlerFunc {
 		}
 		// remove hashtag from room
 		room, err := roomService.RemoveHashtag(c.Request.Context(), roomID, hashtagToRemove.Hashtag)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Error removing hashtag " + hashtagToRemove.Hashtag})
 			return
@@ -299,3 +354,554 @@ func DeleteRoomHandler(roomService RoomService) gin.HandlerFunc {
 
 	}
 }
+
+// AddModeratorToRoomHandler give the moderator role to a member of a room
+func AddModeratorToRoomHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var moderator MemberEntity
+		if err := c.ShouldBindJSON(&moderator); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		// only the room creator can choose moderators
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not add moderator"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.AddModerator(c.Request.Context(), roomID, moderator.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not add moderator"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// RemoveModeratorFromRoomHandler remove the moderator role from a member of a room
+func RemoveModeratorFromRoomHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var moderator MemberEntity
+		if err := c.ShouldBindJSON(&moderator); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		// only the room creator can choose moderators
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not remove moderator"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.RemoveModerator(c.Request.Context(), roomID, moderator.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not remove moderator"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// SetSlowModeHandler set the minimum interval between two messages of a user in a room
+func SetSlowModeHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var slowMode SlowModeEntity
+		if err := c.ShouldBindJSON(&slowMode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		// check if interval is between 0 (disabled) and 6 hours
+		if slowMode.SlowMode < 0 || slowMode.SlowMode > 6*3600 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slow mode must be between 0 and 21600 seconds"})
+			return
+		}
+
+		// only the room moderators can change the slow mode
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set slow mode"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if !room.IsModerator(userConnectedId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.SetSlowMode(c.Request.Context(), roomID, slowMode.SlowMode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set slow mode"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// ArchiveRoomHandler freeze a room : it stays readable but rejects new messages, members and hashtags
+func ArchiveRoomHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		// only the room creator can archive the room
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not archive room"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.ArchiveRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not archive room"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// UnarchiveRoomHandler reopen an archived room
+func UnarchiveRoomHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		// only the room creator can unarchive the room
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not unarchive room"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.UnarchiveRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not unarchive room"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// UpdateRoomHandler change the name and the description of a room
+func UpdateRoomHandler(roomService RoomService, broadcast Broadcaster) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var update RoomUpdateEntity
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		// only the room creator can update the room
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not update room"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		// keep the current values of the fields not provided
+		if update.Name == "" {
+			update.Name = room.Name
+		}
+		if update.Description == "" {
+			update.Description = room.Description
+		}
+		// check if name and description respect the conventions
+		if errMessage := validateRoomName(update.Name); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+			return
+		}
+		if errMessage := validateRoomDescription(update.Description); errMessage != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+			return
+		}
+		// check if the new name is unique
+		if update.Name != room.Name {
+			if err := roomService.CheckName(c.Request.Context(), update.Name); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Name already exists"})
+				return
+			}
+		}
+
+		room, err = roomService.UpdateRoom(c.Request.Context(), roomID, userConnectedId, &update)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not update room"})
+			return
+		}
+		broadcast(roomID, EventRoomUpdated, room)
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// TransferOwnershipHandler make a member of the room its new creator
+func TransferOwnershipHandler(roomService RoomService, broadcast Broadcaster) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var newOwner MemberEntity
+		if err := c.ShouldBindJSON(&newOwner); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		// only the room creator or an admin can transfer the room
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not transfer room"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if claims.UserID != room.Creator && claims.Role != "admin" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.TransferOwnership(c.Request.Context(), roomID, claims.UserID, newOwner.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not transfer room"})
+			return
+		}
+		broadcast(roomID, EventRoomUpdated, room)
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// GetRoomHistoryHandler get the history of a room
+func GetRoomHistoryHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		history, err := roomService.GetHistory(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"history": history})
+	}
+}
+
+// SetTopicHandler set the topic of a room, an empty topic removes it
+func SetTopicHandler(roomService RoomService, broadcast Broadcaster) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var topic TopicEntity
+		if err := c.ShouldBindJSON(&topic); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		topic.Topic = strings.TrimSpace(topic.Topic)
+		// check if topic is not too long
+		if len(topic.Topic) > 120 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Topic is too long"})
+			return
+		}
+
+		// only the room moderators can change the topic
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set topic"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if !room.IsModerator(userConnectedId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.SetTopic(c.Request.Context(), roomID, userConnectedId, topic.Topic)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set topic"})
+			return
+		}
+		broadcast(roomID, EventRoomTopic, room.TopicEvent())
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// SetAnnouncementHandler set the announcement banner of a room
+func SetAnnouncementHandler(roomService RoomService, broadcast Broadcaster) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var announcement AnnouncementUpdateEntity
+		if err := c.ShouldBindJSON(&announcement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		announcement.Text = strings.TrimSpace(announcement.Text)
+		// check if text is not empty nor too long
+		if announcement.Text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Announcement is empty"})
+			return
+		}
+		if len(announcement.Text) > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Announcement is too long"})
+			return
+		}
+		// check if expiry is between 0 (no expiry) and 30 days
+		if announcement.ExpiresIn < 0 || announcement.ExpiresIn > 30*24*3600 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry"})
+			return
+		}
+
+		// only the room moderators can change the announcement
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set announcement"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if !room.IsModerator(userConnectedId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		var expiresAt time.Time
+		if announcement.ExpiresIn > 0 {
+			expiresAt = time.Now().Add(time.Duration(announcement.ExpiresIn) * time.Second)
+		}
+		room, err = roomService.SetAnnouncement(c.Request.Context(), roomID, userConnectedId, announcement.Text, expiresAt)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set announcement"})
+			return
+		}
+		broadcast(roomID, EventRoomTopic, room.TopicEvent())
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// ClearAnnouncementHandler remove the announcement banner of a room
+func ClearAnnouncementHandler(roomService RoomService, broadcast Broadcaster) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		// only the room moderators can change the announcement
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not remove announcement"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if !room.IsModerator(userConnectedId) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.ClearAnnouncement(c.Request.Context(), roomID, userConnectedId)
+		if errors.Is(err, ErrRoomArchived) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Room is archived"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not remove announcement"})
+			return
+		}
+		broadcast(roomID, EventRoomTopic, room.TopicEvent())
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// LeaveWaitlistHandler remove a user from the waitlist of a room
+func LeaveWaitlistHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var member MemberEntity
+		if err := c.ShouldBindJSON(&member); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		// the users can leave a waitlist, only the room moderators can remove someone else
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not leave waitlist"})
+			return
+		}
+		if member.ID != userConnectedId {
+			room, err := roomService.GetRoom(c.Request.Context(), roomID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+				return
+			}
+			if !room.IsModerator(userConnectedId) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+				return
+			}
+		}
+
+		room, err := roomService.LeaveWaitlist(c.Request.Context(), roomID, member.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not leave waitlist"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// SetCapacityHandler set the maximum number of members of a room
+func SetCapacityHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var capacity CapacityEntity
+		if err := c.ShouldBindJSON(&capacity); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		// check if capacity is between 0 (no limit) and 10000
+		if capacity.MaxMembers < 0 || capacity.MaxMembers > 10000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum members must be between 0 and 10000"})
+			return
+		}
+
+		// only the room creator can change the capacity
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set capacity"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.SetMaxMembers(c.Request.Context(), roomID, capacity.MaxMembers)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set capacity"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// SetRetentionHandler set how long the messages of a room are kept
+func SetRetentionHandler(roomService RoomService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("id")
+
+		var retention RetentionEntity
+		if err := c.ShouldBindJSON(&retention); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		// check if retention is -1 (forever), 0 (server default) or a number of days up to 10 years
+		if retention.Retention < -1 || retention.Retention > 3650 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Retention must be -1, 0 or a number of days up to 3650"})
+			return
+		}
+
+		// only the room creator can change the retention
+		userConnectedId, _, err := utils.GetUserIDAndUsernameFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set retention"})
+			return
+		}
+		room, err := roomService.GetRoom(c.Request.Context(), roomID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get room"})
+			return
+		}
+		if userConnectedId != room.Creator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not allowed to do this action"})
+			return
+		}
+
+		room, err = roomService.SetRetention(c.Request.Context(), roomID, retention.Retention)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not set retention"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
@@ -6,28 +6,46 @@ import (
 )
 
 type RoomModel struct {
-	ID          primitive.ObjectID ` bson:"_id,omitempty"`
-	Name        string             ` bson:"name,omitempty"`
-	Description string             ` bson:"description,omitempty"`
-	Creator     string             ` bson:"creator,omitempty"`
-	Members     []string           ` bson:"members,omitempty"`
-	Hashtags    []string           ` bson:"hashtags,omitempty"`
-	Messages    []string           ` bson:"messages,omitempty"`
-	CreatedAt   time.Time          ` bson:"createdAt,omitempty"`
-	UpdatedAt   time.Time          ` bson:"updatedAt,omitempty"`
+	ID           primitive.ObjectID ` bson:"_id,omitempty"`
+	Name         string             ` bson:"name,omitempty"`
+	Description  string             ` bson:"description,omitempty"`
+	Creator      string             ` bson:"creator,omitempty"`
+	Members      []string           ` bson:"members,omitempty"`
+	Moderators   []string           ` bson:"moderators,omitempty"`
+	Hashtags     []string           ` bson:"hashtags,omitempty"`
+	Messages     []string           ` bson:"messages,omitempty"`
+	SlowMode     int                ` bson:"slowMode,omitempty"`
+	Archived     bool               ` bson:"archived,omitempty"`
+	ArchivedAt   time.Time          ` bson:"archivedAt,omitempty"`
+	Topic        string             ` bson:"topic,omitempty"`
+	Announcement *AnnouncementModel ` bson:"announcement,omitempty"`
+	MaxMembers   int                ` bson:"maxMembers,omitempty"`
+	Waitlist     []string           ` bson:"waitlist,omitempty"`
+	Retention    int                ` bson:"retentionDays,omitempty"`
+	CreatedAt    time.Time          ` bson:"createdAt,omitempty"`
+	UpdatedAt    time.Time          ` bson:"updatedAt,omitempty"`
 }
 
 func ModelToEntity(room *RoomModel) *RoomEntity {
 	return &RoomEntity{
-		ID:          room.ID.Hex(),
-		Name:        room.Name,
-		Description: room.Description,
-		Creator:     room.Creator,
-		Members:     room.Members,
-		Hashtags:    room.Hashtags,
-		Messages:    room.Messages,
-		CreatedAt:   room.CreatedAt.String(),
-		UpdatedAt:   room.UpdatedAt.String(),
+		ID:           room.ID.Hex(),
+		Name:         room.Name,
+		Description:  room.Description,
+		Creator:      room.Creator,
+		Members:      room.Members,
+		Moderators:   room.Moderators,
+		Hashtags:     room.Hashtags,
+		Messages:     room.Messages,
+		SlowMode:     room.SlowMode,
+		Archived:     room.Archived,
+		ArchivedAt:   formatOptionalTime(room.ArchivedAt),
+		Topic:        room.Topic,
+		Announcement: announcementModelToEntity(room.Announcement),
+		MaxMembers:   room.MaxMembers,
+		Waitlist:     room.Waitlist,
+		Retention:    room.Retention,
+		CreatedAt:    room.CreatedAt.String(),
+		UpdatedAt:    room.UpdatedAt.String(),
 	}
 }
 
@@ -38,19 +56,83 @@ func EntityToModel(room *RoomEntity) *RoomModel {
 		Description: room.Description,
 		Creator:     room.Creator,
 		Members:     room.Members,
+		Moderators:  room.Moderators,
 		Hashtags:    room.Hashtags,
 		Messages:    room.Messages,
+		SlowMode:    room.SlowMode,
+		Archived:    room.Archived,
+		ArchivedAt:  parseTime(room.ArchivedAt),
+		Topic:       room.Topic,
+		MaxMembers:  room.MaxMembers,
+		Waitlist:    room.Waitlist,
+		Retention:   room.Retention,
 		CreatedAt:   parseTime(room.CreatedAt),
 		UpdatedAt:   parseTime(room.UpdatedAt),
 	}
 }
 
+// AnnouncementModel represents the announcement banner of a room
+type AnnouncementModel struct {
+	Text      string    `bson:"text,omitempty"`
+	SetBy     string    `bson:"setBy,omitempty"`
+	CreatedAt time.Time `bson:"createdAt,omitempty"`
+	ExpiresAt time.Time `bson:"expiresAt,omitempty"`
+}
+
+// Expired checks if the announcement has an expiry in the past
+func (a *AnnouncementModel) Expired() bool {
+	return !a.ExpiresAt.IsZero() && time.Now().After(a.ExpiresAt)
+}
+
+// announcementModelToEntity converts an announcement, expired announcements are not returned
+func announcementModelToEntity(announcement *AnnouncementModel) *AnnouncementEntity {
+	if announcement == nil || announcement.Expired() {
+		return nil
+	}
+	return &AnnouncementEntity{
+		Text:      announcement.Text,
+		SetBy:     announcement.SetBy,
+		CreatedAt: announcement.CreatedAt.String(),
+		ExpiresAt: formatOptionalTime(announcement.ExpiresAt),
+	}
+}
+
+// HistoryModel represents an entry of the history of a room
+type HistoryModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	RoomID    string             `bson:"roomId,omitempty"`
+	Action    string             `bson:"action,omitempty"`
+	ActorID   string             `bson:"actorId,omitempty"`
+	Details   map[string]string  `bson:"details,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+}
+
+// HistoryModelToEntity converts a history model to a history entity
+func HistoryModelToEntity(history *HistoryModel) *HistoryEntity {
+	return &HistoryEntity{
+		ID:        history.ID.Hex(),
+		RoomID:    history.RoomID,
+		Action:    history.Action,
+		ActorID:   history.ActorID,
+		Details:   history.Details,
+		CreatedAt: history.CreatedAt.String(),
+	}
+}
+
 // parseTime parses a time string and returns a time.Time object
 func parseTime(timeStr string) time.Time {
 	parsedTime, _ := time.Parse(time.RFC3339, timeStr)
 	return parsedTime
 }
 
+// formatOptionalTime formats a time, or returns an empty string if the time is not set
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.String()
+}
+
 // convert string to Object id
 func stringToObjectID(id string) primitive.ObjectID {
 	objectID, _ := primitive.ObjectIDFromHex(id)
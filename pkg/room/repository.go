@@ -7,6 +7,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
@@ -20,20 +21,36 @@ type RoomRepository interface {
 	GetRoomsCreatedByAdmin(ctx context.Context, adminID string) ([]RoomEntity, error)
 	AddMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
 	RemoveMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	JoinWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	LeaveWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	SetMaxMembers(ctx context.Context, roomID string, maxMembers int) (*RoomEntity, error)
+	SetRetention(ctx context.Context, roomID string, days int) (*RoomEntity, error)
 	AddHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error)
 	RemoveHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error)
+	AddModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error)
+	RemoveModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error)
+	SetSlowMode(ctx context.Context, roomID string, seconds int) (*RoomEntity, error)
+	SetArchived(ctx context.Context, roomID string, archived bool) (*RoomEntity, error)
+	Update(ctx context.Context, roomID string, name string, description string) (*RoomEntity, error)
+	TransferOwnership(ctx context.Context, roomID string, newOwnerID string) (*RoomEntity, error)
+	SetTopic(ctx context.Context, roomID string, topic string) (*RoomEntity, error)
+	SetAnnouncement(ctx context.Context, roomID string, announcement *AnnouncementModel) (*RoomEntity, error)
+	ClearExpiredAnnouncements(ctx context.Context, before time.Time) ([]string, error)
+	AddHistory(ctx context.Context, history *HistoryModel) error
+	GetHistory(ctx context.Context, roomID string) ([]HistoryEntity, error)
 	Delete(ctx context.Context, roomID string) error
 }
 
 // roomRepository is the implementation of the RoomRepository interface.
 type roomRepository struct {
-	collection      *mongo.Collection
-	collectionUsers *mongo.Collection
+	collection        *mongo.Collection
+	collectionUsers   *mongo.Collection
+	collectionHistory *mongo.Collection
 }
 
 // NewRoomRepository creates a new room repository.
-func NewRoomRepository(collection *mongo.Collection, collectionUsers *mongo.Collection) RoomRepository {
-	return &roomRepository{collection: collection, collectionUsers: collectionUsers}
+func NewRoomRepository(collection *mongo.Collection, collectionUsers *mongo.Collection, collectionHistory *mongo.Collection) RoomRepository {
+	return &roomRepository{collection: collection, collectionUsers: collectionUsers, collectionHistory: collectionHistory}
 }
 
 // CreateRoom creates a new room in the database.
@@ -217,27 +234,149 @@ func (r *roomRepository) AddMember(ctx context.Context, roomID string, memberID
 	if errCheckUser != nil {
 		return nil, errors.New(" Member does not exist")
 	}
-	var room RoomModel
-	// check if member exists in room
-	errCheck := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"members", memberID}}).Decode(&room)
-	if errCheck == nil {
-		return nil, errors.New(" Member already added to room")
+	// add member to room in a single update, only if not already a member, if the room is not full and not archived
+	filter := bson.M{
+		"_id":      roomIDObjectID,
+		"members":  bson.M{"$ne": memberID},
+		"archived": bson.M{"$ne": true},
+		"$or": bson.A{
+			bson.M{"maxMembers": bson.M{"$exists": false}},
+			bson.M{"maxMembers": bson.M{"$lte": 0}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$members", bson.A{}}}}, "$maxMembers"}}},
+		},
+	}
+	update := bson.M{
+		"$push": bson.M{"members": memberID},
+		"$pull": bson.M{"waitlist": memberID},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		// find out why the member was not added
+		var room RoomModel
+		errCheck := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}}).Decode(&room)
+		if errCheck != nil {
+			return nil, errors.New(" Room does not exist")
+		}
+		if room.Archived {
+			return nil, ErrRoomArchived
+		}
+		for _, existingMember := range room.Members {
+			if existingMember == memberID {
+				return nil, errors.New(" Member already added to room")
+			}
+		}
+		return nil, ErrRoomFull
+	}
+
 	// add room to rooms fields of user
 	_, err = r.collectionUsers.UpdateOne(ctx,
 		bson.D{{"_id", memberIDObjectID}},
 		bson.D{{"$push", bson.D{{"joinedRooms", roomID}}}})
+	if err != nil {
+		// remove the member from the room
+		r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$pull", bson.D{{"members", memberID}}}})
+		return nil, err
+	}
+	return r.GetRoom(ctx, roomID)
+}
+
+// JoinWaitlist adds a user to the waitlist of a room
+func (r *roomRepository) JoinWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	// check IDs by converting them to objectIDs
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+	memberIDObjectID, err := primitive.ObjectIDFromHex(memberID)
+	if err != nil {
+		return nil, errors.New(" Invalid member ID")
+	}
+
+	// check if member exists in users
+	var member user.UserModel
+	errCheckUser := r.collectionUsers.FindOne(ctx, bson.D{{"_id", memberIDObjectID}}).Decode(&member)
+	if errCheckUser != nil {
+		return nil, errors.New(" Member does not exist")
+	}
+
+	// a member of the room can not wait for it, the waitlist keeps the order of arrival
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": roomIDObjectID, "members": bson.M{"$ne": memberID}, "waitlist": bson.M{"$ne": memberID}, "archived": bson.M{"$ne": true}},
+		bson.M{"$push": bson.M{"waitlist": memberID}})
 	if err != nil {
 		return nil, err
 	}
-	_, err = r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$push", bson.D{{"members", memberID}}}})
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Member already in the room or in its waitlist"))
+	}
+	return r.GetRoom(ctx, roomID)
+}
+
+// LeaveWaitlist removes a user from the waitlist of a room
+func (r *roomRepository) LeaveWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": roomIDObjectID, "waitlist": memberID},
+		bson.M{"$pull": bson.M{"waitlist": memberID}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(" Member is not in the waitlist")
+	}
+	return r.GetRoom(ctx, roomID)
+}
+
+// SetMaxMembers sets the maximum number of members of a room, 0 removes the limit
+func (r *roomRepository) SetMaxMembers(ctx context.Context, roomID string, maxMembers int) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	update := bson.M{"$set": bson.M{"maxMembers": maxMembers, "updatedAt": time.Now()}}
+	if maxMembers == 0 {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"maxMembers": ""}}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(" Room does not exist")
+	}
+	return r.GetRoom(ctx, roomID)
+}
+
+// SetRetention sets the retention of the messages of a room in days, 0 for the server default
+func (r *roomRepository) SetRetention(ctx context.Context, roomID string, days int) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	update := bson.M{"$set": bson.M{"retentionDays": days, "updatedAt": time.Now()}}
+	if days == 0 {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"retentionDays": ""}}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID}, update)
 	if err != nil {
-		// delete last room from rooms fields of user
-		_, err = r.collectionUsers.UpdateOne(ctx,
-			bson.D{{"_id", memberIDObjectID}},
-			bson.D{{"$pull", bson.D{{"joinedRooms", roomID}}}})
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(" Room does not exist")
+	}
 	return r.GetRoom(ctx, roomID)
 }
 
@@ -264,31 +403,59 @@ func (r *roomRepository) RemoveMember(ctx context.Context, roomID string, member
 	if errCheck == nil {
 		return nil, errors.New(" Member is the creator of the room")
 	}
+	// remove member from room, only if a member and if the room is not archived
+	result, err := r.collection.UpdateOne(ctx,
+		bson.D{{"_id", roomIDObjectID}, {"members", memberID}, {"archived", bson.D{{"$ne", true}}}},
+		bson.D{{"$pull", bson.D{{"members", memberID}}}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Member already removed from room"))
+	}
+
 	// remove room from rooms fields of user
 	_, err = r.collectionUsers.UpdateOne(ctx,
 		bson.D{{"_id", memberIDObjectID}},
 		bson.D{{"$pull", bson.D{{"joinedRooms", roomID}}}})
 	if err != nil {
+		// add member back to room
+		r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$push", bson.D{{"members", memberID}}}})
 		return nil, err
 	}
+	return r.GetRoom(ctx, roomID)
+}
+
+func (r *roomRepository) AddHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
+
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
 
-	// check if member exists in room
-	errCheck = r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"members", memberID}}).Decode(&room)
+	//check if room exists
+	var room RoomModel
+	errCheck := r.collection.FindOne(ctx, bson.M{"_id": roomIDObjectID}).Decode(&room)
 	if errCheck != nil {
-		return nil, errors.New(" Member already removed from room")
+		return nil, errors.New(" Room does not exist")
 	}
-	_, err = r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$pull", bson.D{{"members", memberID}}}})
+
+	// add hashtag to room and update last update field, only if the room is not archived
+	result, err := r.collection.UpdateOne(ctx,
+		bson.D{{"_id", roomIDObjectID}, {"hashtags", bson.D{{"$ne", hashtag}}}, {"archived", bson.D{{"$ne", true}}}},
+		bson.D{{"$push", bson.D{{"hashtags", hashtag}}}, {"$set", bson.D{{"updatedAt", time.Now()}}}})
 	if err != nil {
-		// add room to rooms fields of user
-		_, err = r.collectionUsers.UpdateOne(ctx,
-			bson.D{{"_id", memberIDObjectID}},
-			bson.D{{"$push", bson.D{{"joinedRooms", roomID}}}})
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Hashtag already added to room"))
+	}
+
 	return r.GetRoom(ctx, roomID)
 }
 
-func (r *roomRepository) AddHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
+func (r *roomRepository) RemoveHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
 
 	// convert roomID to objectID
 	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
@@ -302,69 +469,284 @@ func (r *roomRepository) AddHashtag(ctx context.Context, roomID string, hashtag
 	if errCheck != nil {
 		return nil, errors.New(" Room does not exist")
 	}
-
-	//check if hashtag already exists in hashtag array
-	errHashtag := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"hashtags", hashtag}})
-	if errHashtag == nil {
-		return nil, errors.New(" Hashtag already added to room")
+	// check if hashtag array is not empty or there is at least two hashtags
+	if len(room.Hashtags) < 2 {
+		return nil, errors.New(" Hashtag array is empty or there is only one hashtag")
 	}
 
-	// add hashtag to room
-	_, err = r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$push", bson.D{{"hashtags", hashtag}}}})
+	// remove hashtag from room and update last update field, only if the room is not archived
+	result, err := r.collection.UpdateOne(ctx,
+		bson.D{{"_id", roomIDObjectID}, {"hashtags", hashtag}, {"hashtags.1", bson.D{{"$exists", true}}}, {"archived", bson.D{{"$ne", true}}}},
+		bson.D{{"$pull", bson.D{{"hashtags", hashtag}}}, {"$set", bson.D{{"updatedAt", time.Now()}}}})
 	if err != nil {
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Hashtag already removed from room"))
+	}
+
+	return r.GetRoom(ctx, roomID)
+}
 
-	// update last update field
-	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID}, bson.M{"$set": bson.M{"updatedAt": time.Now()}})
+// AddModerator gives a member of the room the moderator role
+func (r *roomRepository) AddModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
 	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	// check if the moderator is a member of the room
+	var room RoomModel
+	errCheck := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"members", moderatorID}}).Decode(&room)
+	if errCheck != nil {
+		return nil, errors.New(" Moderator is not a member of the room")
+	}
 
+	// add moderator to room, only once
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID},
+		bson.M{"$addToSet": bson.M{"moderators": moderatorID}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
 		return nil, err
 	}
 
 	return r.GetRoom(ctx, roomID)
 }
 
-func (r *roomRepository) RemoveHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
-
+// RemoveModerator removes the moderator role from a member of the room
+func (r *roomRepository) RemoveModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error) {
 	// convert roomID to objectID
 	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
 	if err != nil {
 		return nil, errors.New(" Invalid room ID")
 	}
 
-	//check if room exists
+	// check if the member is a moderator of the room
 	var room RoomModel
-	errCheck := r.collection.FindOne(ctx, bson.M{"_id": roomIDObjectID}).Decode(&room)
+	errCheck := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"moderators", moderatorID}}).Decode(&room)
 	if errCheck != nil {
+		return nil, errors.New(" Member is not a moderator of the room")
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID},
+		bson.M{"$pull": bson.M{"moderators": moderatorID}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetRoom(ctx, roomID)
+}
+
+// SetSlowMode sets the minimum interval in seconds between two messages of a user, 0 disables it
+func (r *roomRepository) SetSlowMode(ctx context.Context, roomID string, seconds int) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID},
+		bson.M{"$set": bson.M{"slowMode": seconds, "updatedAt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
 		return nil, errors.New(" Room does not exist")
 	}
-	// check if hashtag doesn't exist in hashtag array
-	errHashtag := r.collection.FindOne(ctx, bson.D{{"_id", roomIDObjectID}, {"hashtags", hashtag}})
-	if errHashtag == nil {
-		return nil, errors.New(" Hashtag already removed from room")
+
+	return r.GetRoom(ctx, roomID)
+}
+
+// SetArchived archives or unarchives a room
+func (r *roomRepository) SetArchived(ctx context.Context, roomID string, archived bool) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
 	}
 
-	// check if hashtag array is not empty or there is at least two hashtags
-	if len(room.Hashtags) < 2 {
-		return nil, errors.New(" Hashtag array is empty or there is only one hashtag")
+	// only a room in the opposite state can be changed
+	filter := bson.M{"_id": roomIDObjectID, "archived": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"archived": true, "archivedAt": time.Now(), "updatedAt": time.Now()}}
+	if !archived {
+		filter = bson.M{"_id": roomIDObjectID, "archived": true}
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"archived": "", "archivedAt": ""}}
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		if archived {
+			return nil, errors.New(" Room does not exist or is already archived")
+		}
+		return nil, errors.New(" Room does not exist or is not archived")
+	}
+
+	return r.GetRoom(ctx, roomID)
+}
 
-	_, err = r.collection.UpdateOne(ctx, bson.D{{"_id", roomIDObjectID}}, bson.D{{"$pull", bson.D{{"hashtags", hashtag}}}})
+// Update changes the name and the description of a room
+func (r *roomRepository) Update(ctx context.Context, roomID string, name string, description string) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID, "archived": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"name": name, "description": description, "updatedAt": time.Now()}})
 	if err != nil {
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Room does not exist"))
+	}
 
-	// update last update field
-	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID}, bson.M{"$set": bson.M{"updatedAt": time.Now()}})
+	return r.GetRoom(ctx, roomID)
+}
+
+// TransferOwnership makes a member of the room its new creator
+func (r *roomRepository) TransferOwnership(ctx context.Context, roomID string, newOwnerID string) (*RoomEntity, error) {
+	// check IDs by converting them to objectIDs
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
 	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+	newOwnerObjectID, err := primitive.ObjectIDFromHex(newOwnerID)
+	if err != nil {
+		return nil, errors.New(" Invalid member ID")
+	}
 
+	// check if the new owner exists and is valid
+	var newOwner user.UserModel
+	errCheckUser := r.collectionUsers.FindOne(ctx, bson.D{{"_id", newOwnerObjectID}}).Decode(&newOwner)
+	if errCheckUser != nil {
+		return nil, errors.New(" Member does not exist")
+	}
+	if newOwner.Validity != "valid" {
+		return nil, errors.New(" Member is not a valid user")
+	}
+
+	// the new owner must be a member of the room, the owner does not need the moderator role
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": roomIDObjectID, "members": newOwnerID, "creator": bson.M{"$ne": newOwnerID}},
+		bson.M{"$set": bson.M{"creator": newOwnerID, "updatedAt": time.Now()}, "$pull": bson.M{"moderators": newOwnerID}})
+	if err != nil {
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(" Member is not a member of the room or already its creator")
+	}
 
 	return r.GetRoom(ctx, roomID)
 }
 
+// SetTopic sets the topic of a room, an empty topic removes it
+func (r *roomRepository) SetTopic(ctx context.Context, roomID string, topic string) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	update := bson.M{"$set": bson.M{"topic": topic, "updatedAt": time.Now()}}
+	if topic == "" {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"topic": ""}}
+	}
+	// an archived room keeps its topic and announcement
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID, "archived": bson.M{"$ne": true}}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Room does not exist"))
+	}
+
+	return r.GetRoom(ctx, roomID)
+}
+
+// SetAnnouncement sets the announcement banner of a room, a nil announcement removes it
+func (r *roomRepository) SetAnnouncement(ctx context.Context, roomID string, announcement *AnnouncementModel) (*RoomEntity, error) {
+	// convert roomID to objectID
+	roomIDObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return nil, errors.New(" Invalid room ID")
+	}
+
+	update := bson.M{"$set": bson.M{"announcement": announcement, "updatedAt": time.Now()}}
+	if announcement == nil {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"announcement": ""}}
+	}
+	// an archived room keeps its topic and announcement
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": roomIDObjectID, "archived": bson.M{"$ne": true}}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, r.archivedOr(ctx, roomIDObjectID, errors.New(" Room does not exist"))
+	}
+
+	return r.GetRoom(ctx, roomID)
+}
+
+// ClearExpiredAnnouncements removes the announcements expired before a time, and returns the IDs of their rooms
+func (r *roomRepository) ClearExpiredAnnouncements(ctx context.Context, before time.Time) ([]string, error) {
+	// an archived room keeps its topic and announcement
+	filter := bson.M{"announcement.expiresAt": bson.M{"$lt": before}, "archived": bson.M{"$ne": true}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var rooms []RoomModel
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+
+	var roomIDs []string
+	for _, room := range rooms {
+		// the announcement may have been replaced since it was found
+		filter["_id"] = room.ID
+		update := bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"announcement": ""}}
+		result, err := r.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return roomIDs, err
+		}
+		if result.ModifiedCount > 0 {
+			roomIDs = append(roomIDs, room.ID.Hex())
+		}
+	}
+	return roomIDs, nil
+}
+
+// AddHistory records an entry in the history of a room
+func (r *roomRepository) AddHistory(ctx context.Context, history *HistoryModel) error {
+	history.ID = primitive.NewObjectID()
+	history.CreatedAt = time.Now()
+	_, err := r.collectionHistory.InsertOne(ctx, history)
+	return err
+}
+
+// GetHistory returns the history of a room, most recent first
+func (r *roomRepository) GetHistory(ctx context.Context, roomID string) ([]HistoryEntity, error) {
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}})
+	cursor, err := r.collectionHistory.Find(ctx, bson.D{{"roomId", roomID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var history []HistoryModel
+	if err = cursor.All(ctx, &history); err != nil {
+		return nil, err
+	}
+	// convert list of history models to list of history entities
+	historyEntities := make([]HistoryEntity, 0)
+	for i := range history {
+		historyEntities = append(historyEntities, *HistoryModelToEntity(&history[i]))
+	}
+	return historyEntities, nil
+}
+
 func (r *roomRepository) Delete(ctx context.Context, roomID string) error {
 	// remove room from all users
 	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": roomID})
@@ -373,3 +755,16 @@ func (r *roomRepository) Delete(ctx context.Context, roomID string) error {
 	}
 	return nil
 }
+
+// archivedOr returns ErrRoomArchived when a conditional update did not match the room because it is archived,
+// or the error of the other condition
+func (r *roomRepository) archivedOr(ctx context.Context, roomIDObjectID primitive.ObjectID, err error) error {
+	var room RoomModel
+	if errCheck := r.collection.FindOne(ctx, bson.M{"_id": roomIDObjectID}).Decode(&room); errCheck != nil {
+		return errors.New(" Room does not exist")
+	}
+	if room.Archived {
+		return ErrRoomArchived
+	}
+	return err
+}
@@ -2,8 +2,26 @@ package room
 
 import (
 	"context"
+	"errors"
+	"log"
+	"time"
 )
 
+// actions recorded in the history of a room
+const (
+	HistoryRoomUpdated       = "room.updated"
+	HistoryOwnershipTransfer = "room.ownership_transferred"
+	HistoryTopicChanged      = "room.topic_changed"
+	HistoryAnnouncementSet   = "room.announcement_set"
+	HistoryAnnouncementClear = "room.announcement_cleared"
+)
+
+// ErrRoomArchived is returned when a change is requested on an archived room
+var ErrRoomArchived = errors.New("Room is archived")
+
+// ErrRoomFull is returned when a member is added to a room that reached its maximum number of members
+var ErrRoomFull = errors.New("Room is full")
+
 type RoomService interface {
 	CreateRoom(ctx context.Context, room *RoomEntity) (*RoomEntity, error)
 	CheckName(ctx context.Context, name string) error
@@ -13,17 +31,34 @@ type RoomService interface {
 	GetRoomsCreatedByAdmin(ctx context.Context, adminID string) ([]RoomEntity, error)
 	AddMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
 	RemoveMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	JoinWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	LeaveWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error)
+	SetMaxMembers(ctx context.Context, roomID string, maxMembers int) (*RoomEntity, error)
+	SetRetention(ctx context.Context, roomID string, days int) (*RoomEntity, error)
 	AddHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error)
 	RemoveHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error)
+	AddModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error)
+	RemoveModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error)
+	SetSlowMode(ctx context.Context, roomID string, seconds int) (*RoomEntity, error)
+	ArchiveRoom(ctx context.Context, roomID string) (*RoomEntity, error)
+	UnarchiveRoom(ctx context.Context, roomID string) (*RoomEntity, error)
+	UpdateRoom(ctx context.Context, roomID string, actorID string, update *RoomUpdateEntity) (*RoomEntity, error)
+	TransferOwnership(ctx context.Context, roomID string, actorID string, newOwnerID string) (*RoomEntity, error)
+	SetTopic(ctx context.Context, roomID string, actorID string, topic string) (*RoomEntity, error)
+	SetAnnouncement(ctx context.Context, roomID string, actorID string, text string, expiresAt time.Time) (*RoomEntity, error)
+	ClearAnnouncement(ctx context.Context, roomID string, actorID string) (*RoomEntity, error)
+	GetHistory(ctx context.Context, roomID string) ([]HistoryEntity, error)
 	DeleteRoom(ctx context.Context, roomID string) error
+	Start(ctx context.Context)
 }
 
 type roomService struct {
-	repo RoomRepository
+	repo      RoomRepository
+	broadcast Broadcaster
 }
 
-func NewRoomService(repo RoomRepository) RoomService {
-	return &roomService{repo: repo}
+func NewRoomService(repo RoomRepository, broadcast Broadcaster) RoomService {
+	return &roomService{repo: repo, broadcast: broadcast}
 
 }
 
@@ -49,19 +84,193 @@ func (r *roomService) CheckName(ctx context.Context, name string) error {
 }
 
 func (r *roomService) RemoveMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
-	return r.repo.RemoveMember(ctx, roomID, memberID)
+	room, err := r.repo.RemoveMember(ctx, roomID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	// a place is free for the waitlist
+	return r.promoteWaitlist(ctx, room), nil
 }
 
 func (r *roomService) AddMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
 	return r.repo.AddMember(ctx, roomID, memberID)
 }
 
+func (r *roomService) JoinWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	return r.repo.JoinWaitlist(ctx, roomID, memberID)
+}
+
+func (r *roomService) LeaveWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	return r.repo.LeaveWaitlist(ctx, roomID, memberID)
+}
+
+func (r *roomService) SetMaxMembers(ctx context.Context, roomID string, maxMembers int) (*RoomEntity, error) {
+	room, err := r.repo.SetMaxMembers(ctx, roomID, maxMembers)
+	if err != nil {
+		return nil, err
+	}
+	// a higher capacity may free places for the waitlist
+	return r.promoteWaitlist(ctx, room), nil
+}
+
+func (r *roomService) SetRetention(ctx context.Context, roomID string, days int) (*RoomEntity, error) {
+	return r.repo.SetRetention(ctx, roomID, days)
+}
+
 func (r *roomService) AddHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
 	return r.repo.AddHashtag(ctx, roomID, hashtag)
 }
 func (r *roomService) RemoveHashtag(ctx context.Context, roomID string, hashtag string) (*RoomEntity, error) {
 	return r.repo.RemoveHashtag(ctx, roomID, hashtag)
 }
+func (r *roomService) AddModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error) {
+	return r.repo.AddModerator(ctx, roomID, moderatorID)
+}
+func (r *roomService) RemoveModerator(ctx context.Context, roomID string, moderatorID string) (*RoomEntity, error) {
+	return r.repo.RemoveModerator(ctx, roomID, moderatorID)
+}
+func (r *roomService) SetSlowMode(ctx context.Context, roomID string, seconds int) (*RoomEntity, error) {
+	return r.repo.SetSlowMode(ctx, roomID, seconds)
+}
+func (r *roomService) ArchiveRoom(ctx context.Context, roomID string) (*RoomEntity, error) {
+	return r.repo.SetArchived(ctx, roomID, true)
+}
+func (r *roomService) UnarchiveRoom(ctx context.Context, roomID string) (*RoomEntity, error) {
+	return r.repo.SetArchived(ctx, roomID, false)
+}
+func (r *roomService) UpdateRoom(ctx context.Context, roomID string, actorID string, update *RoomUpdateEntity) (*RoomEntity, error) {
+	before, err := r.repo.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if before.Archived {
+		return nil, ErrRoomArchived
+	}
+	room, err := r.repo.Update(ctx, roomID, update.Name, update.Description)
+	if err != nil {
+		return nil, err
+	}
+	r.addHistory(ctx, roomID, HistoryRoomUpdated, actorID, map[string]string{
+		"oldName":        before.Name,
+		"name":           room.Name,
+		"oldDescription": before.Description,
+		"description":    room.Description,
+	})
+	return room, nil
+}
+func (r *roomService) TransferOwnership(ctx context.Context, roomID string, actorID string, newOwnerID string) (*RoomEntity, error) {
+	before, err := r.repo.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	room, err := r.repo.TransferOwnership(ctx, roomID, newOwnerID)
+	if err != nil {
+		return nil, err
+	}
+	r.addHistory(ctx, roomID, HistoryOwnershipTransfer, actorID, map[string]string{
+		"oldCreator": before.Creator,
+		"creator":    room.Creator,
+	})
+	return room, nil
+}
+func (r *roomService) SetTopic(ctx context.Context, roomID string, actorID string, topic string) (*RoomEntity, error) {
+	room, err := r.repo.SetTopic(ctx, roomID, topic)
+	if err != nil {
+		return nil, err
+	}
+	r.addHistory(ctx, roomID, HistoryTopicChanged, actorID, map[string]string{"topic": topic})
+	return room, nil
+}
+func (r *roomService) SetAnnouncement(ctx context.Context, roomID string, actorID string, text string, expiresAt time.Time) (*RoomEntity, error) {
+	announcement := &AnnouncementModel{Text: text, SetBy: actorID, CreatedAt: time.Now(), ExpiresAt: expiresAt}
+	room, err := r.repo.SetAnnouncement(ctx, roomID, announcement)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]string{"text": text}
+	if !expiresAt.IsZero() {
+		details["expiresAt"] = expiresAt.String()
+	}
+	r.addHistory(ctx, roomID, HistoryAnnouncementSet, actorID, details)
+	return room, nil
+}
+func (r *roomService) ClearAnnouncement(ctx context.Context, roomID string, actorID string) (*RoomEntity, error) {
+	room, err := r.repo.SetAnnouncement(ctx, roomID, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.addHistory(ctx, roomID, HistoryAnnouncementClear, actorID, nil)
+	return room, nil
+}
+func (r *roomService) GetHistory(ctx context.Context, roomID string) ([]HistoryEntity, error) {
+	return r.repo.GetHistory(ctx, roomID)
+}
 func (r *roomService) DeleteRoom(ctx context.Context, roomID string) error {
 	return r.repo.Delete(ctx, roomID)
 }
+
+// addHistory records an action in the history of a room, a failure does not cancel the action
+func (r *roomService) addHistory(ctx context.Context, roomID string, action string, actorID string, details map[string]string) {
+	err := r.repo.AddHistory(ctx, &HistoryModel{RoomID: roomID, Action: action, ActorID: actorID, Details: details})
+	if err != nil {
+		log.Printf("Failed to record %s in the history of room %s: %v", action, roomID, err)
+	}
+}
+
+// promoteWaitlist adds the first users of the waitlist to the room while there are free places
+func (r *roomService) promoteWaitlist(ctx context.Context, room *RoomEntity) *RoomEntity {
+	if room.Archived {
+		return room
+	}
+	for len(room.Waitlist) > 0 && (room.MaxMembers <= 0 || len(room.Members) < room.MaxMembers) {
+		candidate := room.Waitlist[0]
+		promoted, err := r.repo.AddMember(ctx, room.ID, candidate)
+		if errors.Is(err, ErrRoomFull) || errors.Is(err, ErrRoomArchived) {
+			break
+		}
+		if err != nil {
+			// the candidate can not join anymore, forget it
+			log.Printf("Failed to promote %s from the waitlist of room %s: %v", candidate, room.ID, err)
+			promoted, err = r.repo.LeaveWaitlist(ctx, room.ID, candidate)
+			if err != nil {
+				break
+			}
+		}
+		room = promoted
+	}
+	return room
+}
+
+// Start removes the expired announcements every minute until the context is done,
+// and sends the cleared announcement to the clients of their rooms
+func (r *roomService) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		r.clearExpiredAnnouncements(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// clearExpiredAnnouncements removes the expired announcements and sends the new topic event of their rooms
+func (r *roomService) clearExpiredAnnouncements(ctx context.Context) {
+	roomIDs, err := r.repo.ClearExpiredAnnouncements(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to remove the expired announcements: %v", err)
+	}
+	if r.broadcast == nil {
+		return
+	}
+	for _, roomID := range roomIDs {
+		room, err := r.repo.GetRoom(ctx, roomID)
+		if err != nil {
+			log.Printf("Failed to get room %s after its announcement expired: %v", roomID, err)
+			continue
+		}
+		r.broadcast(roomID, EventRoomTopic, room.TopicEvent())
+	}
+}
@@ -0,0 +1,85 @@
+package room
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testRepository fails like the conditional updates of the repository once the room is archived
+type testRepository struct {
+	RoomRepository
+	room *RoomEntity
+	left []string
+}
+
+func (r *testRepository) RemoveMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	members := []string{}
+	for _, member := range r.room.Members {
+		if member != memberID {
+			members = append(members, member)
+		}
+	}
+	r.room.Members = members
+	// the room is archived by someone else right after the member left
+	r.room.Archived = true
+	return &RoomEntity{ID: r.room.ID, Members: members, Waitlist: r.room.Waitlist, MaxMembers: r.room.MaxMembers}, nil
+}
+
+func (r *testRepository) AddMember(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	if r.room.Archived {
+		return nil, ErrRoomArchived
+	}
+	r.room.Members = append(r.room.Members, memberID)
+	return r.room, nil
+}
+
+func (r *testRepository) LeaveWaitlist(ctx context.Context, roomID string, memberID string) (*RoomEntity, error) {
+	r.left = append(r.left, memberID)
+	return r.room, nil
+}
+
+func TestWaitlistIsKeptWhenTheRoomIsArchived(t *testing.T) {
+	repo := &testRepository{room: &RoomEntity{ID: "room1", Members: []string{"a", "b"}, Waitlist: []string{"c"}, MaxMembers: 2}}
+	room, err := NewRoomService(repo, nil).RemoveMember(context.Background(), "room1", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.left) != 0 || len(room.Waitlist) != 1 {
+		t.Fatalf("the waitlist was emptied: %v left it", repo.left)
+	}
+}
+
+// announcementRepository has an announcement expired in room1
+type announcementRepository struct {
+	RoomRepository
+	cleared bool
+}
+
+func (r *announcementRepository) ClearExpiredAnnouncements(ctx context.Context, before time.Time) ([]string, error) {
+	if r.cleared {
+		return nil, nil
+	}
+	r.cleared = true
+	return []string{"room1"}, nil
+}
+
+func (r *announcementRepository) GetRoom(ctx context.Context, roomID string) (*RoomEntity, error) {
+	return &RoomEntity{ID: roomID, Topic: "news"}, nil
+}
+
+func TestExpiredAnnouncementIsSent(t *testing.T) {
+	var events []TopicEventEntity
+	broadcast := func(roomID string, eventType string, data interface{}) {
+		if roomID != "room1" || eventType != EventRoomTopic {
+			t.Fatalf("got %s for %s, want %s for room1", eventType, roomID, EventRoomTopic)
+		}
+		events = append(events, data.(TopicEventEntity))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	NewRoomService(&announcementRepository{}, broadcast).Start(ctx)
+	if len(events) != 1 || events[0].Announcement != nil || events[0].Topic != "news" {
+		t.Fatalf("got %+v, want one event without the announcement", events)
+	}
+}
@@ -1,90 +1,265 @@
 package router
 
 import (
+	"chat-app/pkg/attachment"
 	"chat-app/pkg/auth"
+	"chat-app/pkg/bot"
 	"chat-app/pkg/code"
+	"chat-app/pkg/export"
+	"chat-app/pkg/gdpr"
 	"chat-app/pkg/message"
 	"chat-app/pkg/middlewares"
+	"chat-app/pkg/oidc"
+	"chat-app/pkg/ratelimit"
+	"chat-app/pkg/retention"
 	"chat-app/pkg/room"
+	"chat-app/pkg/spam"
 	"chat-app/pkg/user"
+	"chat-app/pkg/utils"
+	"chat-app/pkg/webhook"
 	"chat-app/pkg/websocket"
 	"github.com/gin-gonic/gin"
+	"log"
+	"time"
 )
 
-func NewRouter(userService user.UserService, codeService code.CodeService, authService auth.AuthService, roomService room.RoomService, messageService message.MessageService) *gin.Engine {
+func NewRouter(userService user.UserService, codeService code.CodeService, authService auth.AuthService, roomService room.RoomService, messageService message.MessageService, spamService spam.SpamService, retentionService retention.RetentionService, exportService export.ExportService, gdprService gdpr.GdprService, attachmentService attachment.AttachmentService, oidcService oidc.OidcService, botService bot.BotService, commands message.Commands, webhookService webhook.WebhookService) *gin.Engine {
 
 	// Set Gin to default(debug) mode
 	r := gin.Default()
 
+	// The client IP, used by the rate limits, the sessions and the login history, is taken from
+	// X-Forwarded-For only when the request comes from a trusted proxy
+	if err := r.SetTrustedProxies(ratelimit.TrustedProxiesFromEnv()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Rate limiters per route group, configurable with "<count>/<interval>" env variables
+	authLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_AUTH", ratelimit.Per(5, time.Minute)))
+	loginLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_LOGIN", ratelimit.Per(5, time.Minute)))
+	refreshLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_REFRESH", ratelimit.Per(30, time.Minute)))
+	oidcLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_OIDC", ratelimit.Per(20, time.Minute)))
+	downloadLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_EXPORT_DOWNLOAD", ratelimit.Per(10, time.Minute)))
+	userLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_USERS", ratelimit.Per(60, time.Minute)))
+	roomLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_ROOMS", ratelimit.Per(120, time.Minute)))
+	messageLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_MESSAGES", ratelimit.Per(20, 10*time.Second)))
+	wsConnectLimiter := ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_WS_CONNECT", ratelimit.Per(10, time.Minute)))
+	// Rate limiters per WebSocket message type
+	wsLimits := ratelimit.Limits{
+		websocket.MessageTypeChat: ratelimit.NewLimiter(ratelimit.RuleFromEnv("RATE_LIMIT_WS_MESSAGE", ratelimit.Per(10, 10*time.Second))),
+	}
+
 	// User routes
-	r.GET("users", middlewares.IsAdminMiddleware(),
+	r.GET("users", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.GetUsersHandler(userService))
-	r.GET("users/:id", middlewares.AuthMiddleware(),
+	r.GET("users/:id", middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.GetUserHandler(userService))
-	r.POST("users",
-		user.CreateUserHandler(userService, codeService))
+	r.POST("users", middlewares.RateLimitMiddleware(authLimiter),
+		user.CreateUserHandler(userService, codeService, authService))
 	r.PUT("users/:id",
-		middlewares.AuthMiddleware(),
+		middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.UpdateUserHandler(userService))
 	r.PUT("users/:id/password",
-		middlewares.AuthMiddleware(),
+		middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(authLimiter),
 		user.UpdatePasswordHandler(userService))
 	r.GET("users/ban/:id/:idBanned",
-		middlewares.AuthMiddleware(),
+		middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.BanUserHandler(userService))
 	r.GET("users/unban/:id/:idBanned",
-		middlewares.AuthMiddleware(),
+		middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.UnBanUserHandler(userService))
 	r.DELETE("users/:id",
-		middlewares.AuthMiddleware(),
+		middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		user.DeleteUserHandler(userService))
 
 	//code route
-	r.POST("codes", middlewares.IsAdminMiddleware(),
+	r.POST("codes", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
 		code.CreateCodeHandler(codeService))
 
 	// Room routes
-	r.GET("rooms", middlewares.IsLoggedInMiddleware(),
+	r.GET("rooms", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.GetRoomsHandler(roomService))
-	r.GET("rooms/:id", middlewares.IsLoggedInMiddleware(),
+	r.GET("rooms/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.GetRoomHandler(roomService))
-	r.GET("rooms/created/:id", middlewares.IsAdminMiddleware(),
+	r.GET("rooms/created/:id", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.GetRoomsCreatedByAdminHandler(roomService))
-	r.GET("rooms/user/:id", middlewares.IsLoggedInMiddleware(),
+	r.GET("rooms/user/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.GetUserRoomsHandler(roomService))
-	r.POST("rooms", middlewares.IsAdminMiddleware(),
+	r.POST("rooms", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.CreateRoomHandler(roomService))
-	r.PUT("rooms/add/:id", middlewares.IsLoggedInMiddleware(),
+	r.PUT("rooms/add/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.AddMemberToRoom(roomService))
-	r.PUT("rooms/remove/:id", middlewares.IsLoggedInMiddleware(),
+	r.PUT("rooms/remove/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.RemoveMemberFromRoom(roomService))
-	r.PATCH("rooms/add/hashtag/:id", middlewares.IsAdminMiddleware(),
+	r.PUT("rooms/waitlist/remove/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.LeaveWaitlistHandler(roomService))
+	r.PATCH("rooms/capacity/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.SetCapacityHandler(roomService))
+	r.GET("rooms/export/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		export.ExportRoomHandler(exportService))
+	r.PATCH("rooms/retention/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.SetRetentionHandler(roomService))
+	r.PATCH("rooms/add/hashtag/:id", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.AddHashtagToRoomHandler(roomService))
-	r.PATCH("rooms/remove/hashtag/:id", middlewares.IsAdminMiddleware(),
+	r.PATCH("rooms/remove/hashtag/:id", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.RemoveHashtagFromRoomHandler(roomService))
+	r.PATCH("rooms/add/moderator/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.AddModeratorToRoomHandler(roomService))
+	r.PATCH("rooms/remove/moderator/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.RemoveModeratorFromRoomHandler(roomService))
+	r.PATCH("rooms/slowmode/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.SetSlowModeHandler(roomService))
+	r.PATCH("rooms/archive/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.ArchiveRoomHandler(roomService))
+	r.PATCH("rooms/unarchive/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.UnarchiveRoomHandler(roomService))
+	r.PUT("rooms/update/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.UpdateRoomHandler(roomService, websocket.BroadcastEvent))
+	r.PUT("rooms/transfer/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.TransferOwnershipHandler(roomService, websocket.BroadcastEvent))
+	r.PATCH("rooms/topic/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.SetTopicHandler(roomService, websocket.BroadcastEvent))
+	r.PATCH("rooms/announcement/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.SetAnnouncementHandler(roomService, websocket.BroadcastEvent))
+	r.DELETE("rooms/announcement/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.ClearAnnouncementHandler(roomService, websocket.BroadcastEvent))
+	r.GET("rooms/history/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		room.GetRoomHistoryHandler(roomService))
 	// get all members of a room
-	r.GET("rooms/members/:id", middlewares.IsLoggedInMiddleware(),
+	r.GET("rooms/members/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.GetRoomMembersHandler(roomService, userService))
-	r.DELETE("rooms/delete/:id", middlewares.IsAdminMiddleware(),
+	r.DELETE("rooms/delete/:id", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
 		room.DeleteRoomHandler(roomService))
 
 	// Message routes
-	r.POST("messages", middlewares.IsLoggedInMiddleware(),
-		message.CreateMessageHandler(messageService))
-	r.GET("messages/:id", middlewares.IsLoggedInMiddleware(),
+	r.POST("messages", middlewares.IsLoggedInMiddleware(utils.ScopeMessagesWrite), middlewares.RateLimitMiddleware(messageLimiter),
+		message.CreateMessageHandler(messageService, commands))
+	r.GET("messages/:id", middlewares.IsLoggedInMiddleware(utils.ScopeMessagesRead), middlewares.RateLimitMiddleware(roomLimiter),
 		message.GetMessagesHandler(messageService))
-	r.DELETE("messages/:id", middlewares.IsLoggedInMiddleware(),
+	r.DELETE("messages/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(messageLimiter),
 		message.DeleteMessageHandler(messageService))
 
+	// Spam routes
+	r.GET("spam/stats", middlewares.IsAdminMiddleware(),
+		spam.GetSpamStatsHandler(spamService))
+	r.GET("spam/flags", middlewares.IsAdminMiddleware(),
+		spam.GetSpamFlagsHandler(spamService))
+	r.PATCH("spam/flags/:id", middlewares.IsAdminMiddleware(),
+		spam.ReviewSpamFlagHandler(spamService))
+	r.DELETE("spam/mutes/:id", middlewares.IsAdminMiddleware(),
+		spam.UnmuteUserHandler(spamService))
+
+	// Retention routes
+	r.GET("retention/runs", middlewares.IsAdminMiddleware(),
+		retention.GetRunsHandler(retentionService))
+	r.POST("retention/run", middlewares.IsAdminMiddleware(),
+		retention.RunPurgeHandler(retentionService))
+
+	// Attachment routes
+	r.POST("attachments/upload/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(messageLimiter),
+		attachment.UploadAttachmentHandler(attachmentService))
+	r.GET("attachments/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		attachment.DownloadAttachmentHandler(attachmentService))
+	r.GET("attachments/:id/thumbnails/:size", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(roomLimiter),
+		attachment.DownloadThumbnailHandler(attachmentService))
+
+	// Personal data export routes
+	r.POST("exports", middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		gdpr.RequestExportHandler(gdprService))
+	r.GET("exports", middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		gdpr.GetExportsHandler(gdprService))
+	r.GET("exports/:token", middlewares.RateLimitMiddleware(downloadLimiter),
+		gdpr.DownloadExportHandler(gdprService))
+
 	// auth routes
-	r.POST("auth/login",
+	r.POST("auth/login", middlewares.RateLimitMiddleware(loginLimiter),
 		auth.LoginUserHandler(authService))
+	r.POST("auth/login/2fa", middlewares.RateLimitMiddleware(loginLimiter),
+		auth.LoginTwoFactorHandler(authService))
+	r.POST("auth/refresh", middlewares.RateLimitMiddleware(refreshLimiter),
+		auth.RefreshTokenHandler(authService))
 	r.GET("auth/logout",
 		auth.LogoutUserHandler(authService))
+	r.POST("auth/logout/all", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(refreshLimiter),
+		auth.LogoutEverywhereHandler(authService))
+	r.POST("auth/password/forgot", middlewares.RateLimitMiddleware(authLimiter),
+		auth.RequestPasswordResetHandler(authService))
+	r.POST("auth/password/reset", middlewares.RateLimitMiddleware(authLimiter),
+		auth.ResetPasswordHandler(authService))
+	r.POST("auth/email/resend", middlewares.RateLimitMiddleware(authLimiter),
+		auth.ResendEmailVerificationHandler(authService))
+	r.POST("auth/email/verify", middlewares.RateLimitMiddleware(authLimiter),
+		auth.VerifyEmailHandler(authService))
+
+	// two-factor authentication routes, enroll and confirm also take the challenge token of a login
+	r.GET("auth/2fa", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		auth.GetTwoFactorHandler(authService))
+	r.POST("auth/2fa/enroll", middlewares.RateLimitMiddleware(authLimiter),
+		auth.EnrollTwoFactorHandler(authService))
+	r.POST("auth/2fa/confirm", middlewares.RateLimitMiddleware(authLimiter),
+		auth.ConfirmTwoFactorHandler(authService))
+	r.POST("auth/2fa/disable", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(authLimiter),
+		auth.DisableTwoFactorHandler(authService))
+	r.POST("auth/2fa/recovery-codes", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(authLimiter),
+		auth.RegenerateRecoveryCodesHandler(authService))
+
+	// single sign-on routes, login and link redirect the browser to the provider, which redirects it to the callback
+	r.GET("auth/oidc", middlewares.RateLimitMiddleware(userLimiter),
+		oidc.GetProvidersHandler(oidcService))
+	r.GET("auth/oidc/:provider/login", middlewares.RateLimitMiddleware(oidcLimiter),
+		oidc.LoginHandler(oidcService))
+	r.GET("auth/oidc/:provider/link", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(oidcLimiter),
+		oidc.LinkHandler(oidcService))
+	r.GET("auth/oidc/:provider/callback", middlewares.RateLimitMiddleware(oidcLimiter),
+		oidc.CallbackHandler(oidcService, authService))
+	r.GET("identities", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		oidc.GetIdentitiesHandler(oidcService))
+	r.DELETE("identities/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		oidc.UnlinkIdentityHandler(oidcService))
+
+	// bot routes, the API keys are shown once and then listed by their prefix
+	r.POST("bots", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.CreateBotHandler(botService, userService))
+	r.GET("bots", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.GetBotsHandler(botService))
+	r.DELETE("bots/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.DeleteBotHandler(botService))
+	r.POST("bots/:id/keys", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.CreateAPIKeyHandler(botService))
+	r.GET("bots/:id/keys", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.GetAPIKeysHandler(botService))
+	r.DELETE("bots/:id/keys/:keyId", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		bot.RevokeAPIKeyHandler(botService))
+
+	// webhook routes, of a room for its moderators or of all the rooms for the admins
+	r.POST("webhooks", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.CreateWebhookHandler(webhookService))
+	r.GET("webhooks", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.GetWebhooksHandler(webhookService))
+	r.GET("webhooks/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.GetWebhookHandler(webhookService))
+	r.PATCH("webhooks/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.UpdateWebhookHandler(webhookService))
+	r.DELETE("webhooks/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.DeleteWebhookHandler(webhookService))
+	r.GET("webhooks/:id/deliveries", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.GetDeliveriesHandler(webhookService))
+	r.POST("webhooks/:id/deliveries/:deliveryId/redeliver", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		webhook.RedeliverHandler(webhookService))
+
+	// session routes
+	r.GET("sessions", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		auth.GetSessionsHandler(authService))
+	r.DELETE("sessions/:id", middlewares.IsLoggedInMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		auth.RevokeSessionHandler(authService))
+	r.GET("sessions/user/:id", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		auth.GetUserSessionsHandler(authService))
+	r.DELETE("sessions/user/:id/:sessionId", middlewares.IsAdminMiddleware(), middlewares.RateLimitMiddleware(userLimiter),
+		auth.RevokeUserSessionHandler(authService))
 
 	// websocket routes
-	r.GET("/ws", func(c *gin.Context) {
-		websocket.WebSocketHandler(c, messageService, roomService)
+	r.GET("/ws", middlewares.RateLimitMiddleware(wsConnectLimiter), func(c *gin.Context) {
+		websocket.WebSocketHandler(c, messageService, roomService, commands, wsLimits)
 	})
 	// starting handling rooms
 	c := gin.Context{}
@@ -0,0 +1,252 @@
+package spam
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// actions taken when a message is detected as spam
+const (
+	ActionReject = "reject"
+	ActionMute   = "mute"
+	ActionFlag   = "flag"
+)
+
+// Config holds the settings of the spam detector
+type Config struct {
+	// Window is the period during which messages of a user are compared
+	Window time.Duration
+	// MaxRepeats is the number of identical or near-identical messages allowed in the window
+	MaxRepeats int
+	// MaxMessages is the number of messages allowed in the window, whatever their content
+	MaxMessages int
+	// Similarity is the minimum similarity, between 0 and 1, for two messages to be near-identical
+	Similarity float64
+	// MinLength is the minimum normalized length for a message to be compared
+	MinLength int
+	// Actions are the actions taken on spam : reject, mute and/or flag
+	Actions []string
+	// MuteDuration is the duration of an automatic mute
+	MuteDuration time.Duration
+}
+
+// ConfigFromEnv reads the spam detector settings from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{
+		Window:       envDuration("SPAM_WINDOW", 2*time.Minute),
+		MaxRepeats:   envInt("SPAM_MAX_REPEATS", 3),
+		MaxMessages:  envInt("SPAM_MAX_MESSAGES", 30),
+		Similarity:   envFloat("SPAM_SIMILARITY", 0.8),
+		MinLength:    envInt("SPAM_MIN_LENGTH", 8),
+		Actions:      []string{ActionReject, ActionFlag},
+		MuteDuration: envDuration("SPAM_MUTE_DURATION", 10*time.Minute),
+	}
+	if actions := os.Getenv("SPAM_ACTIONS"); actions != "" {
+		config.Actions = nil
+		for _, action := range strings.Split(actions, ",") {
+			config.Actions = append(config.Actions, strings.TrimSpace(action))
+		}
+	}
+	return config
+}
+
+// hasAction checks if the action is configured
+func (c Config) hasAction(action string) bool {
+	for _, a := range c.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// entry is a message recently sent by a user
+type entry struct {
+	roomID     string
+	normalized string
+	shingles   map[string]bool
+	at         time.Time
+}
+
+// detection is the result of the analysis of a message
+type detection struct {
+	reason string
+	rooms  []string
+}
+
+// detector keeps the recent messages of each user in memory
+type detector struct {
+	config    Config
+	mu        sync.Mutex
+	history   map[string][]entry
+	lastSweep time.Time
+}
+
+// newDetector creates a new detector
+func newDetector(config Config) *detector {
+	return &detector{config: config, history: make(map[string][]entry), lastSweep: time.Now()}
+}
+
+// analyze compares a message with the recent messages of the user and records it.
+// It returns nil when the message is not spam. The message is recorded at once, so that concurrent messages
+// count it, and forget takes it back when it is not created.
+func (d *detector) analyze(userID string, roomID string, content string, now time.Time) *detection {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+
+	// keep only the messages of the window
+	recent := d.history[userID][:0]
+	for _, e := range d.history[userID] {
+		if now.Sub(e.at) <= d.config.Window {
+			recent = append(recent, e)
+		}
+	}
+
+	current := entry{roomID: roomID, normalized: normalize(content), at: now}
+	current.shingles = shingles(current.normalized)
+
+	// count the identical or near-identical messages, in any room
+	var result *detection
+	if len(current.normalized) >= d.config.MinLength {
+		repeats := 1
+		rooms := map[string]bool{roomID: true}
+		for _, e := range recent {
+			if e.normalized == current.normalized || similarity(e.shingles, current.shingles) >= d.config.Similarity {
+				repeats++
+				rooms[e.roomID] = true
+			}
+		}
+		if repeats > d.config.MaxRepeats {
+			result = &detection{reason: "duplicate", rooms: keys(rooms)}
+		}
+	}
+	// count all the messages of the window
+	if result == nil && d.config.MaxMessages > 0 && len(recent)+1 > d.config.MaxMessages {
+		result = &detection{reason: "flood", rooms: []string{roomID}}
+	}
+
+	// spam is not recorded, so that it does not extend the window
+	if result == nil {
+		recent = append(recent, current)
+	}
+	if len(recent) == 0 {
+		delete(d.history, userID)
+	} else {
+		d.history[userID] = recent
+	}
+	return result
+}
+
+// forget removes the last record of a message of the user, for a message that was not created in the end
+func (d *detector) forget(userID string, roomID string, content string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	normalized := normalize(content)
+	entries := d.history[userID]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].roomID == roomID && entries[i].normalized == normalized {
+			d.history[userID] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(d.history[userID]) == 0 {
+		delete(d.history, userID)
+	}
+}
+
+// sweep forgets the users without messages in the window, at most once per window
+func (d *detector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.config.Window {
+		return
+	}
+	d.lastSweep = now
+	for userID, entries := range d.history {
+		if len(entries) == 0 || now.Sub(entries[len(entries)-1].at) > d.config.Window {
+			delete(d.history, userID)
+		}
+	}
+}
+
+// normalize lowers the content and keeps only letters and digits separated by single spaces
+func normalize(content string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range strings.ToLower(content) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && builder.Len() > 0 {
+				builder.WriteByte(' ')
+			}
+			builder.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return builder.String()
+}
+
+// shingles returns the set of 3-characters sequences of a normalized content
+func shingles(normalized string) map[string]bool {
+	set := make(map[string]bool)
+	runes := []rune(normalized)
+	if len(runes) < 3 {
+		set[normalized] = true
+		return set
+	}
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
+
+// similarity returns the Jaccard index of two sets of shingles
+func similarity(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for s := range a {
+		if b[s] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// keys returns the keys of a set
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+	return list
+}
+
+// envDuration reads a duration from the environment
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// envInt reads an integer from the environment
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+// envFloat reads a float from the environment
+func envFloat(name string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && value > 0 && value <= 1 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,33 @@
+package spam
+
+// StatsEntity represents the counters of the spam detector
+type StatsEntity struct {
+	Checked    int64 `json:"checked"`
+	Duplicates int64 `json:"duplicates"`
+	Floods     int64 `json:"floods"`
+	Rejected   int64 `json:"rejected"`
+	Muted      int64 `json:"muted"`
+	Flagged    int64 `json:"flagged"`
+	MutedNow   int   `json:"mutedNow"`
+}
+
+// FlagEntity represents a message flagged as spam for review
+type FlagEntity struct {
+	ID        string   `json:"_id,omitempty"`
+	UserID    string   `json:"userId,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	RoomID    string   `json:"roomId,omitempty"`
+	Rooms     []string `json:"rooms,omitempty"`
+	Content   string   `json:"content,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	Actions   []string `json:"actions,omitempty"`
+	Reviewed  bool     `json:"reviewed"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+}
+
+// MuteEntity represents a user muted by the spam detector, or by a moderator in a room
+type MuteEntity struct {
+	UserID string `json:"userId,omitempty"`
+	RoomID string `json:"roomId,omitempty"`
+	Until  string `json:"until,omitempty"`
+}
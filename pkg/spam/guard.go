@@ -0,0 +1,33 @@
+package spam
+
+import (
+	"chat-app/pkg/message"
+	"context"
+)
+
+// guardedMessageService checks every new message with the spam detector before creating it
+type guardedMessageService struct {
+	message.MessageService
+	spamService SpamService
+}
+
+// NewGuardedMessageService puts the spam detector in front of a message service
+func NewGuardedMessageService(messageService message.MessageService, spamService SpamService) message.MessageService {
+	return &guardedMessageService{MessageService: messageService, spamService: spamService}
+}
+
+// CreateMessage rejects spam, then creates the message.
+// A message rejected by the message service, for the slow mode or an archived room, is not counted as sent.
+func (g *guardedMessageService) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	if err := g.spamService.Check(ctx, msg); err != nil {
+		return nil, err
+	}
+	// the message service may clean the content, the copy is the message as checked
+	checked := *msg
+	created, err := g.MessageService.CreateMessage(ctx, msg)
+	if err != nil {
+		g.spamService.Forget(&checked)
+		return nil, err
+	}
+	return created, nil
+}
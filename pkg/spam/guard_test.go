@@ -0,0 +1,182 @@
+package spam
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testFlags keeps the flags and the mutes in memory
+type testFlags struct {
+	SpamRepository
+	flags []*FlagModel
+	mutes map[string]*MuteModel
+}
+
+func (r *testFlags) CreateFlag(ctx context.Context, flag *FlagModel) error {
+	r.flags = append(r.flags, flag)
+	return nil
+}
+
+func (r *testFlags) SaveMute(ctx context.Context, mute *MuteModel) error {
+	if r.mutes == nil {
+		r.mutes = map[string]*MuteModel{}
+	}
+	mute.ID = mute.UserID + ":" + mute.RoomID
+	r.mutes[mute.ID] = mute
+	return nil
+}
+
+func (r *testFlags) GetMutes(ctx context.Context, now time.Time) ([]*MuteModel, error) {
+	var mutes []*MuteModel
+	for _, mute := range r.mutes {
+		if mute.Until.After(now) {
+			mutes = append(mutes, mute)
+		}
+	}
+	return mutes, nil
+}
+
+func (r *testFlags) DeleteMute(ctx context.Context, userID string, roomID string) error {
+	delete(r.mutes, userID+":"+roomID)
+	return nil
+}
+
+func (r *testFlags) DeleteUserMutes(ctx context.Context, userID string) error {
+	for id, mute := range r.mutes {
+		if mute.UserID == userID {
+			delete(r.mutes, id)
+		}
+	}
+	return nil
+}
+
+// testMessages rejects the messages while fail is set, like the slow mode of a room
+type testMessages struct {
+	message.MessageService
+	fail    bool
+	created int
+}
+
+func (m *testMessages) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	if m.fail {
+		return nil, errors.New("Slow mode is enabled")
+	}
+	m.created++
+	return msg, nil
+}
+
+func testConfig() Config {
+	return Config{Window: time.Minute, MaxRepeats: 2, MaxMessages: 5, Similarity: 0.8, MinLength: 8,
+		Actions: []string{ActionMute, ActionFlag}, MuteDuration: time.Minute}
+}
+
+func send(service message.MessageService, content string) error {
+	_, err := service.CreateMessage(context.Background(), &message.MessageEntity{UserID: "bob", RoomID: "room1", Content: content})
+	return err
+}
+
+func TestRejectedMessagesAreNotCounted(t *testing.T) {
+	messages := &testMessages{fail: true}
+	spamService := NewSpamService(&testFlags{}, testConfig())
+	guarded := NewGuardedMessageService(messages, spamService)
+	for i := 0; i < 10; i++ {
+		if err := send(guarded, "hello everybody"); err == nil {
+			t.Fatal("the message service error was lost")
+		}
+	}
+	messages.fail = false
+	if err := send(guarded, "hello everybody"); err != nil {
+		t.Fatalf("the user was muted for messages that were never posted: %v", err)
+	}
+	if len(spamService.GetMutes()) != 0 {
+		t.Fatal("the user was muted")
+	}
+}
+
+func TestDuplicatesMuteTheUser(t *testing.T) {
+	flags := &testFlags{}
+	messages := &testMessages{}
+	guarded := NewGuardedMessageService(messages, NewSpamService(flags, testConfig()))
+	send(guarded, "buy cheap watches now")
+	send(guarded, "Buy cheap watches NOW!")
+	var muted *MutedError
+	if err := send(guarded, "buy cheap watches now"); !errors.As(err, &muted) {
+		t.Fatalf("got %v, want the user muted", err)
+	}
+	if messages.created != 2 || len(flags.flags) != 1 || flags.flags[0].Reason != "duplicate" {
+		t.Fatalf("got %d messages created and the flags %+v", messages.created, flags.flags)
+	}
+	// the mute applies to the next messages too
+	if err := send(guarded, "something else entirely"); !errors.As(err, &muted) {
+		t.Fatalf("got %v, want the user still muted", err)
+	}
+}
+
+func TestMutesAreKeptOnRestart(t *testing.T) {
+	flags := &testFlags{}
+	spamService := NewSpamService(flags, testConfig())
+	spamService.MuteInRoom("room1", "bob", time.Hour)
+	spamService.MuteInRoom("room2", "bob", -time.Second)
+	spamService.Mute("alice", time.Hour)
+
+	// a new service, as after a restart, loads the mutes not over
+	restarted := NewSpamService(flags, testConfig())
+	if mutes := restarted.GetMutes(); len(mutes) != 2 {
+		t.Fatalf("got the mutes %+v, want the mutes of bob in room1 and of alice", mutes)
+	}
+	var muted *MutedError
+	if err := restarted.Check(context.Background(), &message.MessageEntity{UserID: "bob", RoomID: "room1", Content: "hello there"}); !errors.As(err, &muted) {
+		t.Fatalf("got %v, want bob muted in room1", err)
+	}
+
+	restarted.UnmuteInRoom("room1", "bob")
+	restarted.Unmute("alice")
+	if mutes := NewSpamService(flags, testConfig()).GetMutes(); len(mutes) != 0 {
+		t.Fatalf("got the mutes %+v after unmuting", mutes)
+	}
+}
+
+func TestFlood(t *testing.T) {
+	d := newDetector(testConfig())
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if result := d.analyze("bob", "room1", string(rune('a'+i)), now); result != nil {
+			t.Fatalf("message %d detected as %s", i+1, result.reason)
+		}
+	}
+	if result := d.analyze("bob", "room1", "f", now); result == nil || result.reason != "flood" {
+		t.Fatalf("got %+v, want a flood", result)
+	}
+	// the window is over
+	if result := d.analyze("bob", "room1", "g", now.Add(2*time.Minute)); result != nil {
+		t.Fatalf("got %+v after the window", result)
+	}
+}
+
+func TestForget(t *testing.T) {
+	d := newDetector(testConfig())
+	now := time.Now()
+	d.analyze("bob", "room1", "first message", now)
+	d.analyze("bob", "room1", "second message", now)
+	d.forget("bob", "room1", "first message")
+	if len(d.history["bob"]) != 1 || d.history["bob"][0].normalized != "second message" {
+		t.Fatalf("got %+v", d.history["bob"])
+	}
+	d.forget("bob", "room1", "second message")
+	if _, ok := d.history["bob"]; ok {
+		t.Fatal("the user without messages was kept")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a, b := shingles(normalize("Hello, World!!")), shingles(normalize("hello world"))
+	if similarity(a, b) != 1 {
+		t.Fatalf("got %v for the same words", similarity(a, b))
+	}
+	if similarity(a, shingles(normalize("something else"))) >= 0.8 {
+		t.Fatal("different messages are near-identical")
+	}
+}
@@ -0,0 +1,45 @@
+package spam
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetSpamStatsHandler returns the counters of the spam detector and the muted users
+func GetSpamStatsHandler(spamService SpamService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"stats": spamService.Stats(), "mutes": spamService.GetMutes()})
+	}
+}
+
+// GetSpamFlagsHandler returns the messages flagged as spam, ?reviewed=true for the reviewed ones
+func GetSpamFlagsHandler(spamService SpamService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewed := c.Query("reviewed") == "true"
+		flags, err := spamService.GetFlags(c.Request.Context(), reviewed)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not get flags"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"flags": flags})
+	}
+}
+
+// ReviewSpamFlagHandler marks a flagged message as reviewed
+func ReviewSpamFlagHandler(spamService SpamService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := spamService.ReviewFlag(c.Request.Context(), c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not review flag"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Flag reviewed"})
+	}
+}
+
+// UnmuteUserHandler lifts the mute of a user
+func UnmuteUserHandler(spamService SpamService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spamService.Unmute(c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "User unmuted"})
+	}
+}
@@ -0,0 +1,45 @@
+package spam
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// FlagModel represents a message flagged as spam, stored for review
+type FlagModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"userId,omitempty"`
+	Username  string             `bson:"username,omitempty"`
+	RoomID    string             `bson:"roomId,omitempty"`
+	Rooms     []string           `bson:"rooms,omitempty"`
+	Content   string             `bson:"content,omitempty"`
+	Reason    string             `bson:"reason,omitempty"`
+	Actions   []string           `bson:"actions,omitempty"`
+	Reviewed  bool               `bson:"reviewed"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty"`
+}
+
+// ModelToEntity converts a flag model to a flag entity
+func ModelToEntity(flag *FlagModel) *FlagEntity {
+	return &FlagEntity{
+		ID:        flag.ID.Hex(),
+		UserID:    flag.UserID,
+		Username:  flag.Username,
+		RoomID:    flag.RoomID,
+		Rooms:     flag.Rooms,
+		Content:   flag.Content,
+		Reason:    flag.Reason,
+		Actions:   flag.Actions,
+		Reviewed:  flag.Reviewed,
+		CreatedAt: flag.CreatedAt.String(),
+	}
+}
+
+// MuteModel is a muted user, in a room or everywhere, kept until the end of the mute.
+// Its ID is the user and the room, so a new mute replaces the previous one.
+type MuteModel struct {
+	ID     string    `bson:"_id"`
+	UserID string    `bson:"userId"`
+	RoomID string    `bson:"roomId,omitempty"`
+	Until  time.Time `bson:"until"`
+}
@@ -0,0 +1,112 @@
+package spam
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// SpamRepository defines the methods to store the messages flagged as spam
+type SpamRepository interface {
+	CreateFlag(ctx context.Context, flag *FlagModel) error
+	GetFlags(ctx context.Context, reviewed bool) ([]*FlagEntity, error)
+	ReviewFlag(ctx context.Context, flagID string) error
+	SaveMute(ctx context.Context, mute *MuteModel) error
+	GetMutes(ctx context.Context, now time.Time) ([]*MuteModel, error)
+	DeleteMute(ctx context.Context, userID string, roomID string) error
+	DeleteUserMutes(ctx context.Context, userID string) error
+}
+
+// spamRepository is the implementation of the SpamRepository interface
+type spamRepository struct {
+	collection      *mongo.Collection
+	collectionMutes *mongo.Collection
+}
+
+// NewSpamRepository creates a new spam repository
+func NewSpamRepository(collection *mongo.Collection, collectionMutes *mongo.Collection) SpamRepository {
+	return &spamRepository{collection: collection, collectionMutes: collectionMutes}
+}
+
+// CreateFlag stores a flagged message
+func (r *spamRepository) CreateFlag(ctx context.Context, flag *FlagModel) error {
+	flag.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, flag)
+	return err
+}
+
+// GetFlags returns the flagged messages, most recent first
+func (r *spamRepository) GetFlags(ctx context.Context, reviewed bool) ([]*FlagEntity, error) {
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}})
+	cursor, err := r.collection.Find(ctx, bson.D{{"reviewed", reviewed}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var flags []FlagModel
+	if err = cursor.All(ctx, &flags); err != nil {
+		return nil, err
+	}
+	// convert list of flags to list of flag entities
+	flagsEntities := make([]*FlagEntity, 0)
+	for i := range flags {
+		flagsEntities = append(flagsEntities, ModelToEntity(&flags[i]))
+	}
+	return flagsEntities, nil
+}
+
+// ReviewFlag marks a flagged message as reviewed
+func (r *spamRepository) ReviewFlag(ctx context.Context, flagID string) error {
+	flagObjectID, err := primitive.ObjectIDFromHex(flagID)
+	if err != nil {
+		return errors.New(" Invalid flag ID")
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": flagObjectID}, bson.M{"$set": bson.M{"reviewed": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(" Flag does not exist")
+	}
+	return nil
+}
+
+// SaveMute stores a mute, in place of the previous mute of the user in the room
+func (r *spamRepository) SaveMute(ctx context.Context, mute *MuteModel) error {
+	mute.ID = mute.UserID + ":" + mute.RoomID
+	_, err := r.collectionMutes.ReplaceOne(ctx, bson.D{{"_id", mute.ID}}, mute, options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetMutes returns the mutes not over, the mutes over are removed
+func (r *spamRepository) GetMutes(ctx context.Context, now time.Time) ([]*MuteModel, error) {
+	if _, err := r.collectionMutes.DeleteMany(ctx, bson.D{{"until", bson.D{{"$lte", now}}}}); err != nil {
+		return nil, err
+	}
+	cursor, err := r.collectionMutes.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var mutes []*MuteModel
+	if err := cursor.All(ctx, &mutes); err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// DeleteMute removes the mute of a user in a room, or everywhere when the room is empty
+func (r *spamRepository) DeleteMute(ctx context.Context, userID string, roomID string) error {
+	_, err := r.collectionMutes.DeleteOne(ctx, bson.D{{"_id", userID + ":" + roomID}})
+	return err
+}
+
+// DeleteUserMutes removes all the mutes of a user
+func (r *spamRepository) DeleteUserMutes(ctx context.Context, userID string) error {
+	_, err := r.collectionMutes.DeleteMany(ctx, bson.D{{"userId", userID}})
+	return err
+}
@@ -0,0 +1,248 @@
+package spam
+
+import (
+	"chat-app/pkg/message"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSpam is returned when a message is rejected as spam
+var ErrSpam = errors.New("Message rejected as spam")
+
+// MutedError is returned when a muted user sends a message
+type MutedError struct {
+	Remaining time.Duration
+}
+
+// RetryAfter returns the remaining mute rounded up to whole seconds
+func (e *MutedError) RetryAfter() int {
+	return int(math.Ceil(e.Remaining.Seconds()))
+}
+
+// Error implements the error interface
+func (e *MutedError) Error() string {
+	return fmt.Sprintf("You are muted for %d seconds", e.RetryAfter())
+}
+
+// SpamService defines the methods of the spam detector
+type SpamService interface {
+	Check(ctx context.Context, message *message.MessageEntity) error
+	Forget(message *message.MessageEntity)
+	Stats() StatsEntity
+	GetFlags(ctx context.Context, reviewed bool) ([]*FlagEntity, error)
+	ReviewFlag(ctx context.Context, flagID string) error
+	Mute(userID string, duration time.Duration)
+	MuteInRoom(roomID string, userID string, duration time.Duration)
+	Unmute(userID string)
+	UnmuteInRoom(roomID string, userID string)
+	GetMutes() []MuteEntity
+}
+
+// spamService is the implementation of the SpamService interface
+type spamService struct {
+	repo     SpamRepository
+	config   Config
+	detector *detector
+
+	mutesMu sync.Mutex
+	mutes   map[muteKey]time.Time
+
+	checked    int64
+	duplicates int64
+	floods     int64
+	rejected   int64
+	muted      int64
+	flagged    int64
+}
+
+// muteKey is a muted user, in a room, or everywhere when the room is empty
+type muteKey struct {
+	userID string
+	roomID string
+}
+
+// NewSpamService creates a new spam service, with the mutes not over
+func NewSpamService(repo SpamRepository, config Config) SpamService {
+	s := &spamService{
+		repo:     repo,
+		config:   config,
+		detector: newDetector(config),
+		mutes:    make(map[muteKey]time.Time),
+	}
+	mutes, err := repo.GetMutes(context.Background(), time.Now())
+	if err != nil {
+		log.Printf("Failed to load the mutes: %v", err)
+	}
+	for _, mute := range mutes {
+		s.mutes[muteKey{userID: mute.UserID, roomID: mute.RoomID}] = mute.Until
+	}
+	return s
+}
+
+// Check analyzes a message before its creation and applies the configured actions.
+// It returns an error when the message must be rejected.
+func (s *spamService) Check(ctx context.Context, message *message.MessageEntity) error {
+	atomic.AddInt64(&s.checked, 1)
+
+	// a muted user can not send messages, everywhere or in the room of its mute
+	if remaining := s.mutedFor(message.UserID, message.RoomID); remaining > 0 {
+		atomic.AddInt64(&s.rejected, 1)
+		return &MutedError{Remaining: remaining}
+	}
+
+	result := s.detector.analyze(message.UserID, message.RoomID, message.Content, time.Now())
+	if result == nil {
+		return nil
+	}
+	if result.reason == "flood" {
+		atomic.AddInt64(&s.floods, 1)
+	} else {
+		atomic.AddInt64(&s.duplicates, 1)
+	}
+
+	// flag the message for review
+	if s.config.hasAction(ActionFlag) {
+		flag := &FlagModel{
+			UserID:    message.UserID,
+			Username:  message.Username,
+			RoomID:    message.RoomID,
+			Rooms:     result.rooms,
+			Content:   message.Content,
+			Reason:    result.reason,
+			Actions:   s.config.Actions,
+			CreatedAt: time.Now(),
+		}
+		if err := s.repo.CreateFlag(ctx, flag); err != nil {
+			log.Printf("Failed to flag spam of user %s: %v", message.UserID, err)
+		} else {
+			atomic.AddInt64(&s.flagged, 1)
+		}
+	}
+	// mute the user, the message is rejected as well
+	if s.config.hasAction(ActionMute) {
+		s.Mute(message.UserID, s.config.MuteDuration)
+		atomic.AddInt64(&s.muted, 1)
+		atomic.AddInt64(&s.rejected, 1)
+		return &MutedError{Remaining: s.config.MuteDuration}
+	}
+	if s.config.hasAction(ActionReject) {
+		atomic.AddInt64(&s.rejected, 1)
+		return ErrSpam
+	}
+	return nil
+}
+
+// Forget takes back a checked message that was not created, so it does not count toward the detection
+func (s *spamService) Forget(message *message.MessageEntity) {
+	s.detector.forget(message.UserID, message.RoomID, message.Content)
+}
+
+// Stats returns the counters of the spam detector
+func (s *spamService) Stats() StatsEntity {
+	return StatsEntity{
+		Checked:    atomic.LoadInt64(&s.checked),
+		Duplicates: atomic.LoadInt64(&s.duplicates),
+		Floods:     atomic.LoadInt64(&s.floods),
+		Rejected:   atomic.LoadInt64(&s.rejected),
+		Muted:      atomic.LoadInt64(&s.muted),
+		Flagged:    atomic.LoadInt64(&s.flagged),
+		MutedNow:   len(s.GetMutes()),
+	}
+}
+
+// GetFlags returns the messages flagged for review
+func (s *spamService) GetFlags(ctx context.Context, reviewed bool) ([]*FlagEntity, error) {
+	return s.repo.GetFlags(ctx, reviewed)
+}
+
+// ReviewFlag marks a flagged message as reviewed
+func (s *spamService) ReviewFlag(ctx context.Context, flagID string) error {
+	return s.repo.ReviewFlag(ctx, flagID)
+}
+
+// Mute prevents a user from sending messages for a duration
+func (s *spamService) Mute(userID string, duration time.Duration) {
+	s.mute(muteKey{userID: userID}, time.Now().Add(duration))
+}
+
+// MuteInRoom prevents a user from sending messages in a room for a duration
+func (s *spamService) MuteInRoom(roomID string, userID string, duration time.Duration) {
+	s.mute(muteKey{userID: userID, roomID: roomID}, time.Now().Add(duration))
+}
+
+// mute sets the end of a mute, and stores it so it is kept on a restart
+func (s *spamService) mute(key muteKey, until time.Time) {
+	s.mutesMu.Lock()
+	s.mutes[key] = until
+	s.mutesMu.Unlock()
+	if err := s.repo.SaveMute(context.Background(), &MuteModel{UserID: key.userID, RoomID: key.roomID, Until: until}); err != nil {
+		log.Printf("Failed to save the mute of user %s: %v", key.userID, err)
+	}
+}
+
+// Unmute lifts all the mutes of a user, everywhere and in the rooms
+func (s *spamService) Unmute(userID string) {
+	s.mutesMu.Lock()
+	for key := range s.mutes {
+		if key.userID == userID {
+			delete(s.mutes, key)
+		}
+	}
+	s.mutesMu.Unlock()
+	if err := s.repo.DeleteUserMutes(context.Background(), userID); err != nil {
+		log.Printf("Failed to remove the mutes of user %s: %v", userID, err)
+	}
+}
+
+// UnmuteInRoom lifts the mute of a user in a room
+func (s *spamService) UnmuteInRoom(roomID string, userID string) {
+	s.mutesMu.Lock()
+	delete(s.mutes, muteKey{userID: userID, roomID: roomID})
+	s.mutesMu.Unlock()
+	if err := s.repo.DeleteMute(context.Background(), userID, roomID); err != nil {
+		log.Printf("Failed to remove the mute of user %s: %v", userID, err)
+	}
+}
+
+// GetMutes returns the users currently muted
+func (s *spamService) GetMutes() []MuteEntity {
+	s.mutesMu.Lock()
+	defer s.mutesMu.Unlock()
+	mutes := make([]MuteEntity, 0)
+	for key, until := range s.mutes {
+		if time.Now().After(until) {
+			delete(s.mutes, key)
+			continue
+		}
+		mutes = append(mutes, MuteEntity{UserID: key.userID, RoomID: key.roomID, Until: until.String()})
+	}
+	return mutes
+}
+
+// mutedFor returns the longest remaining mute of a user in a room, 0 if the user is not muted
+func (s *spamService) mutedFor(userID string, roomID string) time.Duration {
+	s.mutesMu.Lock()
+	defer s.mutesMu.Unlock()
+	var longest time.Duration
+	for _, key := range []muteKey{{userID: userID}, {userID: userID, roomID: roomID}} {
+		until, ok := s.mutes[key]
+		if !ok {
+			continue
+		}
+		remaining := time.Until(until)
+		if remaining <= 0 {
+			delete(s.mutes, key)
+			continue
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest
+}
@@ -14,6 +14,9 @@ type UserEntity struct {
 	Validity     string    `json:"validity,omitempty"`
 	Code         string    `json:"code,omitempty"`
 	JoinedSalons []string  `json:"joinedSalons"`
+	TokenVersion int       `json:"-"`
+	// EmailVerified is set once the user opened the verification link sent to its email
+	EmailVerified bool `json:"emailVerified"`
 }
 
 // UserValidationEntity  represents the login credentials provided by the user.
@@ -3,14 +3,26 @@ package user
 import (
 	"chat-app/pkg/code"
 	"chat-app/pkg/utils"
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
 	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreateUserHandler creates a new user.
-func CreateUserHandler(userService UserService, codeService code.CodeService) gin.HandlerFunc {
+// EmailVerifier sends the verification link of the email of a new user
+type EmailVerifier interface {
+	SendEmailVerification(ctx context.Context, user *UserEntity) error
+	// EmailRequired tells if the users need an email, when it has to be verified
+	EmailRequired() bool
+}
+
+// CreateUserHandler creates a new user, a verification link is sent to its email.
+func CreateUserHandler(userService UserService, codeService code.CodeService, emailVerifier EmailVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var newUser UserEntity
 		if err := c.ShouldBindJSON(&newUser); err != nil {
@@ -65,6 +77,21 @@ func CreateUserHandler(userService UserService, codeService code.CodeService) gi
 			return
 		}
 
+		// Check if email is valid, it is required when it has to be verified
+		if newUser.Email != "" {
+			email, ok := NormalizeEmail(newUser.Email)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+				return
+			}
+			newUser.Email = email
+		} else if emailVerifier != nil && emailVerifier.EmailRequired() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+			return
+		}
+		// the email is verified by its link only
+		newUser.EmailVerified = false
+
 		// Hash the password
 		hashedPassword, err := utils.HashPassword(newUser.Password)
 		if err != nil {
@@ -78,6 +105,13 @@ func CreateUserHandler(userService UserService, codeService code.CodeService) gi
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
 			return
 		}
+		// Check if email is unique
+		if newUser.Email != "" {
+			if err := userService.CheckEmail(c.Request.Context(), newUser.Email); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
+				return
+			}
+		}
 		// Check if the provided code is valid
 		if newUser.Code != "" {
 			isValid, err := codeService.CheckCode(c.Request.Context(), &newUser.Code)
@@ -101,9 +135,20 @@ func CreateUserHandler(userService UserService, codeService code.CodeService) gi
 
 		// Create user
 		if err := userService.CreateUser(c.Request.Context(), &newUser); err != nil {
+			// the email was taken since the check
+			if errors.Is(err, ErrEmailExists) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create user"})
 			return
 		}
+		// Send the verification link, the user can ask for a new one if it fails
+		if newUser.Email != "" && emailVerifier != nil {
+			if err := emailVerifier.SendEmailVerification(c.Request.Context(), &newUser); err != nil {
+				log.Printf("Failed to send the verification email of user %s: %v", newUser.Username, err)
+			}
+		}
 		// Remove password from the response
 		newUser.Password = ""
 		c.JSON(http.StatusOK, newUser)
@@ -291,3 +336,19 @@ func DeleteUserHandler(userService UserService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 	}
 }
+
+// emailPattern is the form of the emails accepted, a local part, @ and a domain with a dot
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+
+// NormalizeEmail checks that an email is a plain address, without a name, and lowercases it
+func NormalizeEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 254 || !emailPattern.MatchString(email) {
+		return "", false
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", false
+	}
+	return email, true
+}
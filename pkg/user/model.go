@@ -13,34 +13,42 @@ type UserModel struct {
 	Role         string    `bson:"role,omitempty"`
 	Validity     string    `bson:"validity,omitempty"`
 	JoinedSalons []string  `bson:"joinedRooms,omitempty"`
+	// TokenVersion is increased to log the user out everywhere, the tokens of an older version are rejected
+	TokenVersion int `bson:"tokenVersion,omitempty"`
+	// EmailVerified is set by the verification link of the email, a new email is not verified
+	EmailVerified bool `bson:"emailVerified,omitempty"`
 }
 
 // ModelToEntity converts a user model to a user entity.
 func ModelToEntity(model *UserModel) *UserEntity {
 	return &UserEntity{
-		ID:           model.ID,
-		Username:     model.Username,
-		Email:        model.Email,
-		Password:     model.Password,
-		CreatedAt:    model.CreatedAt,
-		UpdatedAt:    model.UpdatedAt,
-		Role:         model.Role,
-		Validity:     model.Validity,
-		JoinedSalons: model.JoinedSalons,
+		ID:            model.ID,
+		Username:      model.Username,
+		Email:         model.Email,
+		Password:      model.Password,
+		CreatedAt:     model.CreatedAt,
+		UpdatedAt:     model.UpdatedAt,
+		Role:          model.Role,
+		Validity:      model.Validity,
+		JoinedSalons:  model.JoinedSalons,
+		TokenVersion:  model.TokenVersion,
+		EmailVerified: model.EmailVerified,
 	}
 }
 
 // EntityToModel converts a user entity to a user model.
 func EntityToModel(entity *UserEntity) *UserModel {
 	return &UserModel{
-		ID:           entity.ID,
-		Username:     entity.Username,
-		Email:        entity.Email,
-		Password:     entity.Password,
-		CreatedAt:    entity.CreatedAt,
-		UpdatedAt:    entity.UpdatedAt,
-		Role:         entity.Role,
-		Validity:     entity.Validity,
-		JoinedSalons: entity.JoinedSalons,
+		ID:            entity.ID,
+		Username:      entity.Username,
+		Email:         entity.Email,
+		Password:      entity.Password,
+		CreatedAt:     entity.CreatedAt,
+		UpdatedAt:     entity.UpdatedAt,
+		Role:          entity.Role,
+		Validity:      entity.Validity,
+		JoinedSalons:  entity.JoinedSalons,
+		TokenVersion:  entity.TokenVersion,
+		EmailVerified: entity.EmailVerified,
 	}
 }
@@ -6,13 +6,18 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
+// ErrEmailExists is returned to create a user with the email of another user
+var ErrEmailExists = errors.New("Email already exists")
+
 // UserRepository is the interface that wraps the basic CRUD operations for the user entity.
 type UserRepository interface {
 	Create(ctx context.Context, user *UserEntity) error
 	Read(ctx context.Context, id string) (*UserEntity, error)
+	ReadByUsername(ctx context.Context, username string) (*UserEntity, error)
 	ReadUsers(ctx context.Context) ([]UserEntity, error)
 	CheckEmail(ctx context.Context, email string) error
 	CheckUsername(ctx context.Context, username string) error
@@ -21,6 +26,7 @@ type UserRepository interface {
 	BanUser(ctx context.Context, idBanner string, idBanned string) error
 	UnBanUser(ctx context.Context, idBanner string, idBanned string) error
 	Delete(ctx context.Context, id string) error
+	CreateIndexes(ctx context.Context) error
 }
 
 // userRepository represents the repository for the user entity.
@@ -34,10 +40,31 @@ func NewUserRepository(collection *mongo.Collection, collectionMessage *mongo.Co
 	return &userRepository{collection: collection, collectionMessage: collectionMessage}
 }
 
-// Create creates a new user in the database.
+// Create creates a new user in the database, and sets its ID.
 func (r *userRepository) Create(ctx context.Context, user *UserEntity) error {
 	model := EntityToModel(user)
-	_, err := r.collection.InsertOne(ctx, model)
+	result, err := r.collection.InsertOne(ctx, model)
+	// the email is the only unique field besides the ID
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailExists
+	}
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		user.ID = id.Hex()
+	}
+	return nil
+}
+
+// CreateIndexes makes the emails unique, the check before the insert does not stop two users created at the same time.
+// The users without an email are not indexed.
+func (r *userRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"email", 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.D{{"email", bson.D{{"$type", "string"}}}}),
+	})
 	return err
 }
 
@@ -56,6 +83,16 @@ func (r *userRepository) Read(ctx context.Context, id string) (*UserEntity, erro
 	return ModelToEntity(&model), nil
 }
 
+// ReadByUsername returns the user with the provided username.
+func (r *userRepository) ReadByUsername(ctx context.Context, username string) (*UserEntity, error) {
+	var model UserModel
+	err := r.collection.FindOne(ctx, bson.D{{"username", username}}).Decode(&model)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return ModelToEntity(&model), nil
+}
+
 // CheckUsername checks if the username already exists in the database.
 func (r *userRepository) CheckUsername(ctx context.Context, username string) error {
 	var user UserModel
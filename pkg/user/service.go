@@ -11,6 +11,7 @@ type UserService interface {
 	CheckEmail(ctx context.Context, email string) error
 	CheckUsername(ctx context.Context, username string) error
 	GetUser(ctx context.Context, id string) (*UserEntity, error)
+	GetUserByUsername(ctx context.Context, username string) (*UserEntity, error)
 	GetAllUsers(ctx context.Context) ([]UserEntity, error)
 	UpdateUser(ctx context.Context, id string, username string) error
 	UpdatePassword(ctx context.Context, id string, newPassword string) error
@@ -51,6 +52,11 @@ func (s *userService) GetUser(ctx context.Context, id string) (*UserEntity, erro
 	return s.repo.Read(ctx, id)
 }
 
+// GetUserByUsername retrieves a user by username.
+func (s *userService) GetUserByUsername(ctx context.Context, username string) (*UserEntity, error) {
+	return s.repo.ReadByUsername(ctx, username)
+}
+
 // GetAllUsers retrieves all users.
 func (s *userService) GetAllUsers(ctx context.Context) ([]UserEntity, error) {
 	return s.repo.ReadUsers(ctx)
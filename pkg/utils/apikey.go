@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, to tell them from the access tokens
+const APIKeyPrefix = "cak_"
+
+// scopes of the API keys, a scope is given for all the rooms, or for one room as "<scope>:<room ID>"
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+// Scopes are the scopes an API key can be given
+var Scopes = []string{ScopeMessagesRead, ScopeMessagesWrite}
+
+// ErrInvalidAPIKey is returned for an API key unknown, revoked or expired
+var ErrInvalidAPIKey = errors.New("Invalid API key")
+
+// APIKeyStore gives the claims of an API key, of the bot it belongs to
+type APIKeyStore interface {
+	VerifyAPIKey(ctx context.Context, key string) (*Claims, error)
+}
+
+// apiKeyStore is checked by VerifyToken for the API keys, once set at startup
+var apiKeyStore APIKeyStore
+
+// SetAPIKeyStore sets the store of the API keys accepted in place of the access tokens
+func SetAPIKeyStore(store APIKeyStore) {
+	apiKeyStore = store
+}
+
+// IsAPIKey tells if a token is an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// verifyAPIKey returns the claims of an API key, the key is rejected when there is no store or it cannot be read
+func verifyAPIKey(key string) (*Claims, error) {
+	if apiKeyStore == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return apiKeyStore.VerifyAPIKey(ctx, key)
+}
+
+// IsAPIKey tells if the claims are the ones of an API key
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+// HasScope tells if the claims allow a scope, in at least one room. An access token allows every scope.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsAPIKey() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope || strings.HasPrefix(s, scope+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows tells if the claims allow a scope in a room. An access token allows every scope.
+func (c *Claims) Allows(scope string, roomID string) bool {
+	if !c.IsAPIKey() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope || s == scope+":"+roomID {
+			return true
+		}
+	}
+	return false
+}
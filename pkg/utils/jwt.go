@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,24 +17,74 @@ type Claims struct {
 	UserID   string
 	Username string
 	Role     string
+	// Version is the token version of the user when the token was issued
+	Version int
+	// SessionID is the session of the login that issued the token
+	SessionID string
+	// APIKeyID, Scopes and Bot are set for an API key, they are never in a JWT
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
+	Bot      bool     `json:"-"`
+	// the ID of the token (jti) is in the standard claims
 	jwt.StandardClaims
 }
 
-// GenerateToken generates a new JWT token based on the provided username and user ID.
+// RevocationStore tells if an access token was revoked by a logout, or with its session
+type RevocationStore interface {
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// revocationStore is checked by VerifyToken, once set at startup
+var revocationStore RevocationStore
+
+// SetRevocationStore sets the store of the revoked tokens checked on every token verification
+func SetRevocationStore(store RevocationStore) {
+	revocationStore = store
+}
+
+// tokenSubject is the subject of the access tokens
+const tokenSubject = "authentication"
+
+var (
+	// ErrTokenExpired is returned for an access token past its expiry, a new one is given by the refresh token
+	ErrTokenExpired = errors.New("Token expired")
+	// ErrTokenRevoked is returned for an access token of a session logged out
+	ErrTokenRevoked = errors.New("Token revoked")
+)
+
+// AccessTokenTTL returns how long an access token is valid, 15 minutes by default
+func AccessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+// GenerateToken generates a new short-lived JWT access token based on the provided username and user ID.
 // It returns the signed token string or an error if the token generation fails.
-func GenerateToken(username *string, userID *string, role *string) (string, error) {
+func GenerateToken(username *string, userID *string, role *string, version int, sessionID string) (string, error) {
 
 	// Retrieve the JWT secret key from environment variables.
 	signingKey := []byte(os.Getenv("JWT_SECRET"))
 
+	// Each token has its own ID, to revoke it alone.
+	tokenID, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+
 	// Define the token claims.
 	claims := Claims{
-		UserID:   *userID,
-		Username: *username,
-		Role:     *role,
+		UserID:    *userID,
+		Username:  *username,
+		Role:      *role,
+		Version:   version,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 30).Unix(), // Token expires in 24 hours
-			Subject:   "authentication",
+			Id:        tokenID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL()).Unix(),
+			Subject:   tokenSubject,
 		},
 	}
 
@@ -50,41 +104,94 @@ func GenerateToken(username *string, userID *string, role *string) (string, erro
 // It returns the claims if the token is valid or an error otherwise.
 func VerifyToken(tokenString *string) (*Claims, error) {
 
+	// API keys are not JWTs, they are checked by their store
+	if IsAPIKey(*tokenString) {
+		return verifyAPIKey(*tokenString)
+	}
+
 	// Retrieve the JWT secret key from environment variables.
 	signingKey := []byte(os.Getenv("JWT_SECRET"))
 
-	// Parse and verify the token.
+	// Parse and verify the token, only with the signing method of the server.
 	token, err := jwt.ParseWithClaims(*tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
 		return signingKey, nil
 	})
 
 	// Check for errors during token parsing or verification.
 	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, ErrTokenExpired
+		}
 		return nil, err
 	}
 
 	// Extract the claims from the token.
 	claims, ok := token.Claims.(*Claims)
-	if !ok {
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	// the tokens without expiry, or issued for another use, are not access tokens
+	if claims.ExpiresAt == 0 || claims.Subject != tokenSubject || claims.Id == "" {
+		return nil, errors.New("invalid token")
+	}
+	if err := checkRevocation(claims); err != nil {
 		return nil, err
 	}
 
 	return claims, nil
 }
 
-// GetUserIDAndUsernameFromContext get Id and Username of user from token cookie/headers
-func GetUserIDAndUsernameFromContext(c *gin.Context) (string, string, error) {
-	// Get token from cookie/headers
-	token, err := c.Cookie("token")
+// checkRevocation rejects a token revoked by a logout, with its session, or older than the last logout everywhere of its user.
+// The token is rejected when the store cannot be read.
+func checkRevocation(claims *Claims) error {
+	if revocationStore == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	revoked, err := revocationStore.IsRevoked(ctx, claims)
 	if err != nil {
-		token := c.GetHeader("Authorization")
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// GetTokenFromContext get the access token from cookie/headers, with or without the Bearer prefix
+func GetTokenFromContext(c *gin.Context) (string, error) {
+	token, err := c.Cookie("token")
+	if err != nil || token == "" {
+		token = strings.TrimSpace(c.GetHeader("Authorization"))
+		if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+			token = strings.TrimSpace(token[len("bearer "):])
+		}
 		if token == "" {
-			return "", "", err
+			return "", errors.New("no token")
 		}
+	}
+	return token, nil
+}
 
+// GetClaimsFromContext get the claims of the token from cookie/headers
+func GetClaimsFromContext(c *gin.Context) (*Claims, error) {
+	// Get token from cookie/headers
+	token, err := GetTokenFromContext(c)
+	if err != nil {
+		return nil, err
 	}
 	// Verify token
-	claims, err := VerifyToken(&token)
+	return VerifyToken(&token)
+}
+
+// GetUserIDAndUsernameFromContext get Id and Username of user from token cookie/headers
+func GetUserIDAndUsernameFromContext(c *gin.Context) (string, string, error) {
+	claims, err := GetClaimsFromContext(c)
 	if err != nil {
 		return "", "", err
 	}
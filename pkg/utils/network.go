@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// blockedNetworks are the networks not covered by the methods of net.IP
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"2001:db8::/32",
+)
+
+// IsPrivate checks if an address is not on the public internet
+func IsPrivate(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPublicTransport creates an HTTP transport that only connects to public addresses, for the requests to the URLs
+// of the users. A connection to a private address fails with the blocked error, unless allowPrivate is set.
+// The address is checked once the name is resolved, so a name that resolves to a private address is rejected too.
+func NewPublicTransport(timeout time.Duration, allowPrivate bool, blocked error) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout, Control: func(network string, address string, _ syscall.RawConn) error {
+		if allowPrivate {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || IsPrivate(ip) {
+			return blocked
+		}
+		return nil
+	}}
+	return &http.Transport{
+		// a proxy would connect to the addresses in place of the dialer
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// parseNetworks parses a list of CIDR networks
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
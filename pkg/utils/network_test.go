@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivate(t *testing.T) {
+	private := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "100.64.0.1",
+		"198.18.0.1", "224.0.0.1", "255.255.255.255",
+		"::1", "::", "fc00::1", "fe80::1", "ff02::1", "2001:db8::1",
+		// IPv4-mapped IPv6
+		"::ffff:127.0.0.1", "::ffff:10.0.0.1", "::ffff:169.254.169.254",
+		// NAT64
+		"64:ff9b::7f00:1", "64:ff9b::a00:1", "64:ff9b:1::a00:1",
+	}
+	for _, address := range private {
+		if !IsPrivate(net.ParseIP(address)) {
+			t.Errorf("%s is not private", address)
+		}
+	}
+	for _, address := range []string{"93.184.216.34", "8.8.8.8", "::ffff:8.8.8.8", "2606:4700:4700::1111"} {
+		if IsPrivate(net.ParseIP(address)) {
+			t.Errorf("%s is private", address)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package webhook
+
+// WebhookEntity is a subscription of a URL to the events of a room, or of all the rooms when roomId is empty
+type WebhookEntity struct {
+	ID          string   `json:"_id"`
+	RoomID      string   `json:"roomId,omitempty"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Active      bool     `json:"active"`
+	CreatedBy   string   `json:"createdBy"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+// CreateWebhookRequest creates a webhook of a room, or of all the rooms without roomId
+type CreateWebhookRequest struct {
+	RoomID      string   `json:"roomId,omitempty"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	Events      []string `json:"events,omitempty"`
+}
+
+// UpdateWebhookRequest changes the fields set of a webhook
+type UpdateWebhookRequest struct {
+	URL         *string   `json:"url,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Events      *[]string `json:"events,omitempty"`
+	Active      *bool     `json:"active,omitempty"`
+}
+
+// DeliveryEntity is an event sent to a webhook, with its attempts
+type DeliveryEntity struct {
+	ID            string          `json:"_id"`
+	WebhookID     string          `json:"webhookId"`
+	RoomID        string          `json:"roomId,omitempty"`
+	Event         string          `json:"event"`
+	EventID       string          `json:"eventId"`
+	Payload       string          `json:"payload"`
+	Status        string          `json:"status"`
+	NextAttemptAt string          `json:"nextAttemptAt,omitempty"`
+	Attempts      []AttemptEntity `json:"attempts"`
+	RedeliveryOf  string          `json:"redeliveryOf,omitempty"`
+	CreatedAt     string          `json:"createdAt"`
+}
+
+// AttemptEntity is a request of a delivery, with the response of the webhook
+type AttemptEntity struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Response   string `json:"response,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Duration   int64  `json:"durationMs"`
+}
+
+// EventEntity is the body of a delivery, the same for all the webhooks of an event
+type EventEntity struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	RoomID    string      `json:"roomId,omitempty"`
+	CreatedAt string      `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// MemberEventEntity is the data of the member.joined and member.left events
+type MemberEventEntity struct {
+	RoomID string `json:"roomId"`
+	UserID string `json:"userId"`
+}
+
+// BanEventEntity is the data of the user.banned and user.unbanned events, ActorID is the admin who did it
+type BanEventEntity struct {
+	UserID  string `json:"userId"`
+	ActorID string `json:"actorId"`
+}
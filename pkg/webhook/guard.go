@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/room"
+	"chat-app/pkg/user"
+	"context"
+)
+
+// notifiedMessageService sends the messages created and deleted to the webhooks
+type notifiedMessageService struct {
+	message.MessageService
+	webhookService WebhookService
+}
+
+// NewNotifiedMessageService adds the webhook events behind a message service
+func NewNotifiedMessageService(messageService message.MessageService, webhookService WebhookService) message.MessageService {
+	return &notifiedMessageService{MessageService: messageService, webhookService: webhookService}
+}
+
+// CreateMessage creates the message, then sends it to the webhooks
+func (n *notifiedMessageService) CreateMessage(ctx context.Context, msg *message.MessageEntity) (*message.MessageEntity, error) {
+	created, err := n.MessageService.CreateMessage(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	n.webhookService.Dispatch(EventMessageCreated, created.RoomID, created)
+	return created, nil
+}
+
+// DeleteMessage deletes the message, then sends it to the webhooks
+func (n *notifiedMessageService) DeleteMessage(ctx context.Context, messageID string) error {
+	deleted, err := n.MessageService.GetMessage(ctx, messageID)
+	if err != nil {
+		return n.MessageService.DeleteMessage(ctx, messageID)
+	}
+	if err := n.MessageService.DeleteMessage(ctx, messageID); err != nil {
+		return err
+	}
+	n.webhookService.Dispatch(EventMessageDeleted, deleted.RoomID, deleted)
+	return nil
+}
+
+// notifiedRoomService sends the rooms created and deleted, and the members joining and leaving, to the webhooks
+type notifiedRoomService struct {
+	room.RoomService
+	webhookService WebhookService
+}
+
+// NewNotifiedRoomService adds the webhook events behind a room service
+func NewNotifiedRoomService(roomService room.RoomService, webhookService WebhookService) room.RoomService {
+	return &notifiedRoomService{RoomService: roomService, webhookService: webhookService}
+}
+
+// CreateRoom creates the room, then sends it to the webhooks
+func (n *notifiedRoomService) CreateRoom(ctx context.Context, roomEntity *room.RoomEntity) (*room.RoomEntity, error) {
+	created, err := n.RoomService.CreateRoom(ctx, roomEntity)
+	if err != nil {
+		return nil, err
+	}
+	n.webhookService.Dispatch(EventRoomCreated, created.ID, created)
+	return created, nil
+}
+
+// AddMember adds the member, then sends it to the webhooks
+func (n *notifiedRoomService) AddMember(ctx context.Context, roomID string, memberID string) (*room.RoomEntity, error) {
+	return n.changeMembers(ctx, roomID, func() (*room.RoomEntity, error) {
+		return n.RoomService.AddMember(ctx, roomID, memberID)
+	})
+}
+
+// RemoveMember removes the member, then sends it and the members taken from the waitlist to the webhooks
+func (n *notifiedRoomService) RemoveMember(ctx context.Context, roomID string, memberID string) (*room.RoomEntity, error) {
+	return n.changeMembers(ctx, roomID, func() (*room.RoomEntity, error) {
+		return n.RoomService.RemoveMember(ctx, roomID, memberID)
+	})
+}
+
+// SetMaxMembers changes the capacity, then sends the members taken from the waitlist to the webhooks
+func (n *notifiedRoomService) SetMaxMembers(ctx context.Context, roomID string, maxMembers int) (*room.RoomEntity, error) {
+	return n.changeMembers(ctx, roomID, func() (*room.RoomEntity, error) {
+		return n.RoomService.SetMaxMembers(ctx, roomID, maxMembers)
+	})
+}
+
+// DeleteRoom deletes the room, then sends it to the webhooks
+func (n *notifiedRoomService) DeleteRoom(ctx context.Context, roomID string) error {
+	deleted, err := n.RoomService.GetRoom(ctx, roomID)
+	if err != nil {
+		return n.RoomService.DeleteRoom(ctx, roomID)
+	}
+	if err := n.RoomService.DeleteRoom(ctx, roomID); err != nil {
+		return err
+	}
+	n.webhookService.Dispatch(EventRoomDeleted, roomID, deleted)
+	return nil
+}
+
+// changeMembers runs a change of a room and sends the members who joined and left with it to the webhooks
+func (n *notifiedRoomService) changeMembers(ctx context.Context, roomID string, change func() (*room.RoomEntity, error)) (*room.RoomEntity, error) {
+	var before []string
+	if previous, err := n.RoomService.GetRoom(ctx, roomID); err == nil {
+		before = previous.Members
+	}
+	updated, err := change()
+	if err != nil {
+		return nil, err
+	}
+	for _, memberID := range updated.Members {
+		if !contains(before, memberID) {
+			n.webhookService.Dispatch(EventMemberJoined, roomID, MemberEventEntity{RoomID: roomID, UserID: memberID})
+		}
+	}
+	for _, memberID := range before {
+		if !contains(updated.Members, memberID) {
+			n.webhookService.Dispatch(EventMemberLeft, roomID, MemberEventEntity{RoomID: roomID, UserID: memberID})
+		}
+	}
+	return updated, nil
+}
+
+// notifiedUserService sends the users banned and unbanned to the webhooks
+type notifiedUserService struct {
+	user.UserService
+	webhookService WebhookService
+}
+
+// NewNotifiedUserService adds the webhook events behind a user service
+func NewNotifiedUserService(userService user.UserService, webhookService WebhookService) user.UserService {
+	return &notifiedUserService{UserService: userService, webhookService: webhookService}
+}
+
+// BanUser bans the user, then sends it to the webhooks
+func (n *notifiedUserService) BanUser(ctx context.Context, idBanner string, idBanned string) error {
+	if err := n.UserService.BanUser(ctx, idBanner, idBanned); err != nil {
+		return err
+	}
+	n.webhookService.Dispatch(EventUserBanned, "", BanEventEntity{UserID: idBanned, ActorID: idBanner})
+	return nil
+}
+
+// UnBanUser unbans the user, then sends it to the webhooks
+func (n *notifiedUserService) UnBanUser(ctx context.Context, idBanner string, idBanned string) error {
+	if err := n.UserService.UnBanUser(ctx, idBanner, idBanned); err != nil {
+		return err
+	}
+	n.webhookService.Dispatch(EventUserUnbanned, "", BanEventEntity{UserID: idBanned, ActorID: idBanner})
+	return nil
+}
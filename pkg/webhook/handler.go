@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"chat-app/pkg/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// CreateWebhookHandler creates a webhook of a room for its moderators, or of all the rooms for an admin.
+func CreateWebhookHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		var request CreateWebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if len(request.URL) > 2000 || len(request.Description) > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "URL or description is too long"})
+			return
+		}
+		secret, webhook, err := webhookService.CreateWebhook(c.Request.Context(), claims.UserID, claims.Role, &request)
+		if err != nil {
+			webhookError(c, err, "Could not create the webhook")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhook": webhook, "secret": secret, "message": "Copy the secret now, it will not be shown again"})
+	}
+}
+
+// GetWebhooksHandler lists the webhooks of the room in ?roomId=, or all the webhooks for an admin.
+func GetWebhooksHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		webhooks, err := webhookService.GetWebhooks(c.Request.Context(), claims.UserID, claims.Role, c.Query("roomId"))
+		if err != nil {
+			webhookError(c, err, "Could not get the webhooks")
+			return
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// GetWebhookHandler returns a webhook.
+func GetWebhookHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		webhook, err := webhookService.GetWebhook(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"))
+		if err != nil {
+			webhookError(c, err, "Could not get the webhook")
+			return
+		}
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// UpdateWebhookHandler changes the URL, description, events or state of a webhook.
+func UpdateWebhookHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		var request UpdateWebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if (request.URL != nil && len(*request.URL) > 2000) || (request.Description != nil && len(*request.Description) > 200) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "URL or description is too long"})
+			return
+		}
+		webhook, err := webhookService.UpdateWebhook(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"), &request)
+		if err != nil {
+			webhookError(c, err, "Could not update the webhook")
+			return
+		}
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// DeleteWebhookHandler deletes a webhook and its delivery log.
+func DeleteWebhookHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if err := webhookService.DeleteWebhook(c.Request.Context(), claims.UserID, claims.Role, c.Param("id")); err != nil {
+			webhookError(c, err, "Could not delete the webhook")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": true, "message": "The webhook has been deleted"})
+	}
+}
+
+// GetDeliveriesHandler lists the last deliveries of a webhook, of the status in ?status= when it is set.
+func GetDeliveriesHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		status := c.Query("status")
+		if status != "" && status != StatusPending && status != StatusSending && status != StatusSucceeded && status != StatusFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		deliveries, err := webhookService.GetDeliveries(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"), status)
+		if err != nil {
+			webhookError(c, err, "Could not get the deliveries")
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverHandler sends a delivery of a webhook again.
+func RedeliverHandler(webhookService WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		delivery, err := webhookService.Redeliver(c.Request.Context(), claims.UserID, claims.Role, c.Param("id"), c.Param("deliveryId"))
+		if err != nil {
+			webhookError(c, err, "Could not send the delivery again")
+			return
+		}
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// webhookError writes the response of a webhook or delivery error.
+func webhookError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotAllowed), errors.Is(err, ErrTooManyWebhooks):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrInvalidEvent), errors.Is(err, ErrWebhookDisabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusSending   = "sending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// WebhookModel is a subscription of a URL to the events of a room, or of all the rooms
+type WebhookModel struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// RoomID is empty for a webhook of all the rooms, created by an admin
+	RoomID      string `bson:"roomId"`
+	URL         string `bson:"url"`
+	Description string `bson:"description,omitempty"`
+	// Secret signs the payloads, it is only shown when the webhook is created
+	Secret string `bson:"secret"`
+	// Events are the events sent, all the events of the scope of the webhook when empty
+	Events    []string  `bson:"events,omitempty"`
+	Active    bool      `bson:"active"`
+	CreatedBy string    `bson:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// DeliveryModel is an event sent to a webhook, with its attempts
+type DeliveryModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	WebhookID primitive.ObjectID `bson:"webhookId"`
+	RoomID    string             `bson:"roomId,omitempty"`
+	Event     string             `bson:"event"`
+	// EventID is the same for all the webhooks of an event, and for its redeliveries
+	EventID string `bson:"eventId"`
+	Payload string `bson:"payload"`
+	Status  string `bson:"status"`
+	// NextAttemptAt is when a pending delivery is sent
+	NextAttemptAt time.Time      `bson:"nextAttemptAt"`
+	Attempts      []AttemptModel `bson:"attempts,omitempty"`
+	// RedeliveryOf is the ID of the delivery sent again by hand
+	RedeliveryOf string    `bson:"redeliveryOf,omitempty"`
+	CreatedAt    time.Time `bson:"createdAt"`
+}
+
+// AttemptModel is a request of a delivery, with the response of the webhook
+type AttemptModel struct {
+	At         time.Time `bson:"at"`
+	StatusCode int       `bson:"statusCode,omitempty"`
+	// Response is the start of the body of the response
+	Response string `bson:"response,omitempty"`
+	Error    string `bson:"error,omitempty"`
+	Duration int64  `bson:"durationMs"`
+}
+
+// ModelToEntity converts a webhook model to a webhook entity, without its secret
+func ModelToEntity(webhook *WebhookModel) *WebhookEntity {
+	return &WebhookEntity{
+		ID:          webhook.ID.Hex(),
+		RoomID:      webhook.RoomID,
+		URL:         webhook.URL,
+		Description: webhook.Description,
+		Events:      webhook.Events,
+		Active:      webhook.Active,
+		CreatedBy:   webhook.CreatedBy,
+		CreatedAt:   webhook.CreatedAt.String(),
+		UpdatedAt:   webhook.UpdatedAt.String(),
+	}
+}
+
+// DeliveryModelToEntity converts a delivery model to a delivery entity
+func DeliveryModelToEntity(delivery *DeliveryModel) *DeliveryEntity {
+	entity := &DeliveryEntity{
+		ID:           delivery.ID.Hex(),
+		WebhookID:    delivery.WebhookID.Hex(),
+		RoomID:       delivery.RoomID,
+		Event:        delivery.Event,
+		EventID:      delivery.EventID,
+		Payload:      delivery.Payload,
+		Status:       delivery.Status,
+		Attempts:     make([]AttemptEntity, 0, len(delivery.Attempts)),
+		RedeliveryOf: delivery.RedeliveryOf,
+		CreatedAt:    delivery.CreatedAt.String(),
+	}
+	if delivery.Status == StatusPending {
+		entity.NextAttemptAt = delivery.NextAttemptAt.String()
+	}
+	for _, attempt := range delivery.Attempts {
+		entity.Attempts = append(entity.Attempts, AttemptEntity{
+			At:         attempt.At.String(),
+			StatusCode: attempt.StatusCode,
+			Response:   attempt.Response,
+			Error:      attempt.Error,
+			Duration:   attempt.Duration,
+		})
+	}
+	return entity
+}
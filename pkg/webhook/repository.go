@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// WebhookRepository defines the storage of the webhooks and of their deliveries
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *WebhookModel) error
+	GetWebhook(ctx context.Context, webhookID string) (*WebhookModel, error)
+	GetWebhooks(ctx context.Context, roomID string) ([]*WebhookModel, error)
+	GetSubscribers(ctx context.Context, roomID string) ([]*WebhookModel, error)
+	UpdateWebhook(ctx context.Context, webhook *WebhookModel) error
+	DeleteWebhook(ctx context.Context, webhookID primitive.ObjectID) error
+	DisableRoomWebhooks(ctx context.Context, roomID string) error
+	CreateDeliveries(ctx context.Context, deliveries []*DeliveryModel) error
+	GetDelivery(ctx context.Context, webhookID primitive.ObjectID, deliveryID string) (*DeliveryModel, error)
+	GetDeliveries(ctx context.Context, webhookID primitive.ObjectID, status string, limit int64) ([]*DeliveryModel, error)
+	ClaimDelivery(ctx context.Context) (*DeliveryModel, error)
+	ResetSendingDeliveries(ctx context.Context) error
+	FinishAttempt(ctx context.Context, deliveryID primitive.ObjectID, status string, nextAttemptAt time.Time, attempt *AttemptModel) error
+	DeleteDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// webhookRepository stores the webhooks and their deliveries in MongoDB
+type webhookRepository struct {
+	collection         *mongo.Collection
+	collectionDelivery *mongo.Collection
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(collection *mongo.Collection, collectionDelivery *mongo.Collection) WebhookRepository {
+	return &webhookRepository{collection: collection, collectionDelivery: collectionDelivery}
+}
+
+// CreateWebhook inserts a webhook, and sets its ID
+func (r *webhookRepository) CreateWebhook(ctx context.Context, webhook *WebhookModel) error {
+	webhook.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, webhook)
+	return err
+}
+
+// GetWebhook retrieves a webhook by ID
+func (r *webhookRepository) GetWebhook(ctx context.Context, webhookID string) (*WebhookModel, error) {
+	objectID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	var webhook WebhookModel
+	if err := r.collection.FindOne(ctx, bson.D{{"_id", objectID}}).Decode(&webhook); err != nil {
+		return nil, errors.New(" webhook not found")
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks retrieves the webhooks of a room, or all the webhooks when the room is empty
+func (r *webhookRepository) GetWebhooks(ctx context.Context, roomID string) ([]*WebhookModel, error) {
+	filter := bson.D{}
+	if roomID != "" {
+		filter = bson.D{{"roomId", roomID}}
+	}
+	return r.findWebhooks(ctx, filter)
+}
+
+// GetSubscribers retrieves the active webhooks of a room and the active webhooks of all the rooms
+func (r *webhookRepository) GetSubscribers(ctx context.Context, roomID string) ([]*WebhookModel, error) {
+	return r.findWebhooks(ctx, bson.D{{"active", true}, {"roomId", bson.D{{"$in", bson.A{"", roomID}}}}})
+}
+
+// findWebhooks retrieves the webhooks of a filter, the oldest first
+func (r *webhookRepository) findWebhooks(ctx context.Context, filter bson.D) ([]*WebhookModel, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{"createdAt", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var webhooks []*WebhookModel
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook saves the URL, description, events and state of a webhook
+func (r *webhookRepository) UpdateWebhook(ctx context.Context, webhook *WebhookModel) error {
+	_, err := r.collection.UpdateOne(ctx, bson.D{{"_id", webhook.ID}}, bson.D{{"$set", bson.D{
+		{"url", webhook.URL},
+		{"description", webhook.Description},
+		{"events", webhook.Events},
+		{"active", webhook.Active},
+		{"updatedAt", webhook.UpdatedAt},
+	}}})
+	return err
+}
+
+// DeleteWebhook removes a webhook and its deliveries
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, webhookID primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.D{{"_id", webhookID}}); err != nil {
+		return err
+	}
+	_, err := r.collectionDelivery.DeleteMany(ctx, bson.D{{"webhookId", webhookID}})
+	return err
+}
+
+// DisableRoomWebhooks stops the webhooks of a room
+func (r *webhookRepository) DisableRoomWebhooks(ctx context.Context, roomID string) error {
+	_, err := r.collection.UpdateMany(ctx, bson.D{{"roomId", roomID}, {"active", true}},
+		bson.D{{"$set", bson.D{{"active", false}, {"updatedAt", time.Now()}}}})
+	return err
+}
+
+// CreateDeliveries inserts deliveries, and sets their IDs
+func (r *webhookRepository) CreateDeliveries(ctx context.Context, deliveries []*DeliveryModel) error {
+	documents := make([]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		delivery.ID = primitive.NewObjectID()
+		documents = append(documents, delivery)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	_, err := r.collectionDelivery.InsertMany(ctx, documents)
+	return err
+}
+
+// GetDelivery retrieves a delivery of a webhook
+func (r *webhookRepository) GetDelivery(ctx context.Context, webhookID primitive.ObjectID, deliveryID string) (*DeliveryModel, error) {
+	objectID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	var delivery DeliveryModel
+	if err := r.collectionDelivery.FindOne(ctx, bson.D{{"_id", objectID}, {"webhookId", webhookID}}).Decode(&delivery); err != nil {
+		return nil, errors.New(" delivery not found")
+	}
+	return &delivery, nil
+}
+
+// GetDeliveries retrieves the last deliveries of a webhook, of a status when it is set
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID primitive.ObjectID, status string, limit int64) ([]*DeliveryModel, error) {
+	filter := bson.D{{"webhookId", webhookID}}
+	if status != "" {
+		filter = append(filter, bson.E{"status", status})
+	}
+	cursor, err := r.collectionDelivery.Find(ctx, filter, options.Find().SetSort(bson.D{{"createdAt", -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var deliveries []*DeliveryModel
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDelivery takes the pending delivery due first, nil when none is due
+func (r *webhookRepository) ClaimDelivery(ctx context.Context) (*DeliveryModel, error) {
+	var delivery DeliveryModel
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{"nextAttemptAt", 1}}).SetReturnDocument(options.After)
+	err := r.collectionDelivery.FindOneAndUpdate(ctx,
+		bson.D{{"status", StatusPending}, {"nextAttemptAt", bson.D{{"$lte", time.Now()}}}},
+		bson.D{{"$set", bson.D{{"status", StatusSending}}}}, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ResetSendingDeliveries puts back in the queue the deliveries interrupted by a restart
+func (r *webhookRepository) ResetSendingDeliveries(ctx context.Context) error {
+	_, err := r.collectionDelivery.UpdateMany(ctx, bson.D{{"status", StatusSending}}, bson.D{{"$set", bson.D{{"status", StatusPending}}}})
+	return err
+}
+
+// FinishAttempt records an attempt of a delivery, with the status and the next attempt that follow it
+func (r *webhookRepository) FinishAttempt(ctx context.Context, deliveryID primitive.ObjectID, status string, nextAttemptAt time.Time, attempt *AttemptModel) error {
+	_, err := r.collectionDelivery.UpdateOne(ctx, bson.D{{"_id", deliveryID}}, bson.D{
+		{"$set", bson.D{{"status", status}, {"nextAttemptAt", nextAttemptAt}}},
+		{"$push", bson.D{{"attempts", attempt}}},
+	})
+	return err
+}
+
+// DeleteDeliveries removes the deliveries created before a date, that are not waiting to be sent
+func (r *webhookRepository) DeleteDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collectionDelivery.DeleteMany(ctx, bson.D{
+		{"createdAt", bson.D{{"$lt", before}}},
+		{"status", bson.D{{"$in", bson.A{StatusSucceeded, StatusFailed}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"bytes"
+	"chat-app/pkg/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// headers of a delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxResponse is the number of bytes of a response kept in the delivery log
+const maxResponse = 1024
+
+var (
+	// ErrInvalidURL is returned for a URL that is not http(s), or with credentials
+	ErrInvalidURL = errors.New("The URL must be an http or https URL, without credentials")
+	// ErrBlockedAddress is returned when the URL of a webhook resolves to a private address
+	ErrBlockedAddress = errors.New("The address of the webhook is not allowed")
+)
+
+// Sign returns the signature of a payload, sent as "sha256=<signature>": the hex HMAC-SHA256 of "<timestamp>.<body>"
+// with the secret of the webhook
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkURL validates the URL of a webhook
+func checkURL(rawURL string) error {
+	link, err := url.Parse(rawURL)
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Hostname() == "" || link.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// sender posts the deliveries to the webhooks
+type sender struct {
+	config Config
+	client *http.Client
+}
+
+// newSender creates a sender with the timeout of the configuration, it does not follow redirects
+func newSender(config Config) *sender {
+	s := &sender{config: config}
+	s.client = &http.Client{
+		Transport: utils.NewPublicTransport(config.Timeout, config.AllowPrivate, ErrBlockedAddress),
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// send posts a delivery to a webhook and returns the attempt, it succeeded with a 2xx response
+func (s *sender) send(ctx context.Context, webhook *WebhookModel, delivery *DeliveryModel) (*AttemptModel, bool) {
+	start := time.Now()
+	attempt := &AttemptModel{At: start}
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = ErrInvalidURL.Error()
+		return attempt, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chat-app-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	attempt.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			attempt.Error = ErrBlockedAddress.Error()
+		} else {
+			attempt.Error = err.Error()
+		}
+		return attempt, false
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = strings.ToValidUTF8(string(response), string(utf8.RuneError))
+	return attempt, resp.StatusCode >= 200 && resp.StatusCode < 300
+}
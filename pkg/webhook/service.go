@@ -0,0 +1,587 @@
+package webhook
+
+import (
+	"chat-app/pkg/room"
+	"chat-app/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// events sent to the webhooks, there is no message.edited because the messages cannot be edited yet
+const (
+	EventMessageCreated = "message.created"
+	EventMessageDeleted = "message.deleted"
+	EventMemberJoined   = "member.joined"
+	EventMemberLeft     = "member.left"
+	EventRoomCreated    = "room.created"
+	EventRoomDeleted    = "room.deleted"
+	EventUserBanned     = "user.banned"
+	EventUserUnbanned   = "user.unbanned"
+)
+
+// Events are all the events, a webhook of all the rooms can subscribe to them
+var Events = []string{
+	EventMessageCreated,
+	EventMessageDeleted,
+	EventMemberJoined,
+	EventMemberLeft,
+	EventRoomCreated,
+	EventRoomDeleted,
+	EventUserBanned,
+	EventUserUnbanned,
+}
+
+// RoomEvents are the events of a room, a webhook of a room can subscribe to them
+var RoomEvents = []string{
+	EventMessageCreated,
+	EventMessageDeleted,
+	EventMemberJoined,
+	EventMemberLeft,
+	EventRoomDeleted,
+}
+
+const (
+	// maxWebhooks is the number of webhooks of a room
+	maxWebhooks = 10
+	// maxDeliveries is the number of deliveries listed
+	maxDeliveries = 100
+	// pollInterval is how often the workers look for the deliveries due
+	pollInterval = 5 * time.Second
+)
+
+var (
+	// ErrWebhookNotFound is returned for a webhook that does not exist, or that the user cannot manage
+	ErrWebhookNotFound = errors.New("Webhook not found")
+	// ErrDeliveryNotFound is returned for a delivery that does not exist
+	ErrDeliveryNotFound = errors.New("Delivery not found")
+	// ErrNotAllowed is returned when the user does not moderate the room of a webhook, only admins manage the webhooks
+	// of all the rooms
+	ErrNotAllowed = errors.New("Only the moderators of a room manage its webhooks, and the admins the webhooks of all the rooms")
+	// ErrInvalidEvent is returned for an unknown event, or an event that is not of a room for a webhook of a room
+	ErrInvalidEvent = errors.New("Invalid event")
+	// ErrTooManyWebhooks is returned when a room already has the most webhooks allowed
+	ErrTooManyWebhooks = errors.New("This room cannot have more webhooks")
+	// ErrWebhookDisabled is returned when a delivery of a disabled webhook is sent again
+	ErrWebhookDisabled = errors.New("The webhook is disabled")
+)
+
+// Config holds the delivery settings of the webhooks
+type Config struct {
+	// Timeout is the time limit of a request to a webhook
+	Timeout time.Duration
+	// MaxAttempts is the number of requests of a delivery before it fails
+	MaxAttempts int
+	// RetryBase is the wait after the first failed attempt, doubled after each attempt up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// LogTTL is how long the deliveries are kept
+	LogTTL time.Duration
+	// AllowPrivate lets the webhooks reach private addresses, for services on the same network
+	AllowPrivate bool
+	// Workers is the number of deliveries sent at the same time
+	Workers int
+}
+
+// ConfigFromEnv reads the webhook settings from the environment, with defaults
+func ConfigFromEnv() Config {
+	config := Config{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 8,
+		RetryBase:   30 * time.Second,
+		RetryMax:    time.Hour,
+		LogTTL:      7 * 24 * time.Hour,
+		Workers:     4,
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && timeout > 0 {
+		config.Timeout = timeout
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		config.MaxAttempts = attempts
+	}
+	if base, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_BASE")); err == nil && base > 0 {
+		config.RetryBase = base
+	}
+	if retryMax, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_MAX")); err == nil && retryMax > 0 {
+		config.RetryMax = retryMax
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("WEBHOOK_LOG_TTL")); err == nil && ttl > 0 {
+		config.LogTTL = ttl
+	}
+	if allowPrivate, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE")); err == nil {
+		config.AllowPrivate = allowPrivate
+	}
+	if workers, err := strconv.Atoi(os.Getenv("WEBHOOK_WORKERS")); err == nil && workers > 0 {
+		config.Workers = workers
+	}
+	return config
+}
+
+// WebhookService defines the webhooks, and sends the events to them
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, userID string, role string, request *CreateWebhookRequest) (string, *WebhookEntity, error)
+	GetWebhooks(ctx context.Context, userID string, role string, roomID string) ([]*WebhookEntity, error)
+	GetWebhook(ctx context.Context, userID string, role string, webhookID string) (*WebhookEntity, error)
+	UpdateWebhook(ctx context.Context, userID string, role string, webhookID string, request *UpdateWebhookRequest) (*WebhookEntity, error)
+	DeleteWebhook(ctx context.Context, userID string, role string, webhookID string) error
+	GetDeliveries(ctx context.Context, userID string, role string, webhookID string, status string) ([]*DeliveryEntity, error)
+	Redeliver(ctx context.Context, userID string, role string, webhookID string, deliveryID string) (*DeliveryEntity, error)
+	Dispatch(event string, roomID string, data interface{})
+	Start(ctx context.Context)
+}
+
+// dispatched is an event waiting for its deliveries to be created
+type dispatched struct {
+	event   string
+	roomID  string
+	id      string
+	payload string
+}
+
+// webhookService manages the webhooks and delivers their events in background
+type webhookService struct {
+	repo        WebhookRepository
+	roomService room.RoomService
+	sender      *sender
+	config      Config
+	events      chan *dispatched
+	// wake starts the workers without waiting for the next interval
+	wake chan struct{}
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(repo WebhookRepository, roomService room.RoomService, config Config) WebhookService {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &webhookService{
+		repo:        repo,
+		roomService: roomService,
+		sender:      newSender(config),
+		config:      config,
+		events:      make(chan *dispatched, 1000),
+		wake:        make(chan struct{}, config.Workers),
+	}
+}
+
+// CreateWebhook creates a webhook and returns its secret, it is never shown again
+func (s *webhookService) CreateWebhook(ctx context.Context, userID string, role string, request *CreateWebhookRequest) (string, *WebhookEntity, error) {
+	request.RoomID = strings.TrimSpace(request.RoomID)
+	if err := s.checkManager(ctx, userID, role, request.RoomID); err != nil {
+		return "", nil, err
+	}
+	url := strings.TrimSpace(request.URL)
+	if err := checkURL(url); err != nil {
+		return "", nil, err
+	}
+	events, err := checkEvents(request.RoomID, request.Events)
+	if err != nil {
+		return "", nil, err
+	}
+	if request.RoomID != "" {
+		webhooks, err := s.repo.GetWebhooks(ctx, request.RoomID)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(webhooks) >= maxWebhooks {
+			return "", nil, ErrTooManyWebhooks
+		}
+	}
+	secret, err := utils.NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	webhook := &WebhookModel{
+		RoomID:      request.RoomID,
+		URL:         url,
+		Description: strings.TrimSpace(request.Description),
+		Secret:      secret,
+		Events:      events,
+		Active:      true,
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		return "", nil, err
+	}
+	return secret, ModelToEntity(webhook), nil
+}
+
+// GetWebhooks lists the webhooks of a room, or all the webhooks for an admin without room
+func (s *webhookService) GetWebhooks(ctx context.Context, userID string, role string, roomID string) ([]*WebhookEntity, error) {
+	if err := s.checkManager(ctx, userID, role, roomID); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.repo.GetWebhooks(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*WebhookEntity, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		entities = append(entities, ModelToEntity(webhook))
+	}
+	return entities, nil
+}
+
+// GetWebhook returns a webhook the user manages
+func (s *webhookService) GetWebhook(ctx context.Context, userID string, role string, webhookID string) (*WebhookEntity, error) {
+	webhook, err := s.getWebhook(ctx, userID, role, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	return ModelToEntity(webhook), nil
+}
+
+// UpdateWebhook changes the URL, description, events or state of a webhook
+func (s *webhookService) UpdateWebhook(ctx context.Context, userID string, role string, webhookID string, request *UpdateWebhookRequest) (*WebhookEntity, error) {
+	webhook, err := s.getWebhook(ctx, userID, role, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if request.URL != nil {
+		url := strings.TrimSpace(*request.URL)
+		if err := checkURL(url); err != nil {
+			return nil, err
+		}
+		webhook.URL = url
+	}
+	if request.Description != nil {
+		webhook.Description = strings.TrimSpace(*request.Description)
+	}
+	if request.Events != nil {
+		events, err := checkEvents(webhook.RoomID, *request.Events)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = events
+	}
+	if request.Active != nil {
+		webhook.Active = *request.Active
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := s.repo.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return ModelToEntity(webhook), nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *webhookService) DeleteWebhook(ctx context.Context, userID string, role string, webhookID string) error {
+	webhook, err := s.getWebhook(ctx, userID, role, webhookID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(ctx, webhook.ID)
+}
+
+// GetDeliveries lists the last deliveries of a webhook, of a status when it is set
+func (s *webhookService) GetDeliveries(ctx context.Context, userID string, role string, webhookID string, status string) ([]*DeliveryEntity, error) {
+	webhook, err := s.getWebhook(ctx, userID, role, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.GetDeliveries(ctx, webhook.ID, status, maxDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]*DeliveryEntity, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		entities = append(entities, DeliveryModelToEntity(delivery))
+	}
+	return entities, nil
+}
+
+// Redeliver sends a delivery again, as a new delivery with the same payload
+func (s *webhookService) Redeliver(ctx context.Context, userID string, role string, webhookID string, deliveryID string) (*DeliveryEntity, error) {
+	webhook, err := s.getWebhook(ctx, userID, role, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if !webhook.Active {
+		return nil, ErrWebhookDisabled
+	}
+	original, err := s.repo.GetDelivery(ctx, webhook.ID, deliveryID)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	now := time.Now()
+	delivery := &DeliveryModel{
+		WebhookID:     webhook.ID,
+		RoomID:        original.RoomID,
+		Event:         original.Event,
+		EventID:       original.EventID,
+		Payload:       original.Payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  original.ID.Hex(),
+		CreatedAt:     now,
+	}
+	if err := s.repo.CreateDeliveries(ctx, []*DeliveryModel{delivery}); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return DeliveryModelToEntity(delivery), nil
+}
+
+// Dispatch queues an event for the webhooks of its room and of all the rooms, roomID is empty for an event without room.
+// The event is dropped when the queue is full.
+func (s *webhookService) Dispatch(event string, roomID string, data interface{}) {
+	id := primitive.NewObjectID().Hex()
+	payload, err := json.Marshal(EventEntity{ID: id, Event: event, RoomID: roomID, CreatedAt: time.Now().UTC().Format(time.RFC3339), Data: data})
+	if err != nil {
+		log.Printf("Failed to encode the %s webhook event: %v", event, err)
+		return
+	}
+	select {
+	case s.events <- &dispatched{event: event, roomID: roomID, id: id, payload: string(payload)}:
+	default:
+		log.Printf("Webhook event queue full, %s event %s not delivered", event, id)
+	}
+}
+
+// Start creates the deliveries of the events, runs the workers sending them, and removes the old deliveries
+// every hour, until the context is done
+func (s *webhookService) Start(ctx context.Context) {
+	// the deliveries interrupted by a restart are sent again
+	if err := s.repo.ResetSendingDeliveries(ctx); err != nil {
+		log.Printf("Failed to reset the webhook deliveries: %v", err)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-s.events:
+				s.createDeliveries(ctx, event)
+			}
+		}
+	}()
+	for i := 0; i < s.config.Workers; i++ {
+		go s.runWorker(ctx)
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		s.removeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// createDeliveries creates a delivery of an event for each webhook subscribed to it
+func (s *webhookService) createDeliveries(ctx context.Context, event *dispatched) {
+	webhooks, err := s.repo.GetSubscribers(ctx, event.roomID)
+	if err != nil {
+		log.Printf("Failed to get the webhooks of %s event %s: %v", event.event, event.id, err)
+		return
+	}
+	now := time.Now()
+	var deliveries []*DeliveryModel
+	for _, webhook := range webhooks {
+		if !subscribed(webhook, event.event) {
+			continue
+		}
+		deliveries = append(deliveries, &DeliveryModel{
+			WebhookID:     webhook.ID,
+			RoomID:        event.roomID,
+			Event:         event.event,
+			EventID:       event.id,
+			Payload:       event.payload,
+			Status:        StatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if err := s.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		log.Printf("Failed to create the deliveries of %s event %s: %v", event.event, event.id, err)
+		return
+	}
+	// the webhooks of a deleted room have nothing more to send
+	if event.event == EventRoomDeleted && event.roomID != "" {
+		if err := s.repo.DisableRoomWebhooks(ctx, event.roomID); err != nil {
+			log.Printf("Failed to disable the webhooks of room %s: %v", event.roomID, err)
+		}
+	}
+	if len(deliveries) > 0 {
+		s.notify()
+	}
+}
+
+// runWorker sends the deliveries due, then waits for new ones
+func (s *webhookService) runWorker(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		s.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// deliverDue sends the deliveries due one by one, a failed delivery is retried later with an exponential backoff
+func (s *webhookService) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivery, err := s.repo.ClaimDelivery(ctx)
+		if err != nil {
+			log.Printf("Failed to get the webhook deliveries due: %v", err)
+			return
+		}
+		if delivery == nil {
+			return
+		}
+		s.deliver(ctx, delivery)
+	}
+}
+
+// deliver sends a delivery to its webhook, and records the attempt
+func (s *webhookService) deliver(ctx context.Context, delivery *DeliveryModel) {
+	var attempt *AttemptModel
+	ok := false
+	webhook, err := s.repo.GetWebhook(ctx, delivery.WebhookID.Hex())
+	switch {
+	case err != nil:
+		attempt = &AttemptModel{At: time.Now(), Error: ErrWebhookNotFound.Error()}
+	case !webhook.Active:
+		attempt = &AttemptModel{At: time.Now(), Error: ErrWebhookDisabled.Error()}
+	default:
+		attempt, ok = s.sender.send(ctx, webhook, delivery)
+	}
+
+	status, next := StatusSucceeded, time.Time{}
+	attempts := len(delivery.Attempts) + 1
+	if !ok {
+		status = StatusFailed
+		// a delivery of a removed or disabled webhook is not retried
+		if err == nil && webhook.Active && attempts < s.config.MaxAttempts {
+			status, next = StatusPending, time.Now().Add(s.backoff(attempts))
+		}
+	}
+	if err := s.repo.FinishAttempt(ctx, delivery.ID, status, next, attempt); err != nil {
+		log.Printf("Failed to record the attempt of webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// backoff returns the wait before the next attempt of a delivery, doubled after each attempt
+func (s *webhookService) backoff(attempts int) time.Duration {
+	wait := s.config.RetryBase
+	for i := 1; i < attempts && wait < s.config.RetryMax; i++ {
+		wait *= 2
+	}
+	if wait > s.config.RetryMax {
+		wait = s.config.RetryMax
+	}
+	return wait
+}
+
+// removeExpired removes the deliveries older than the log TTL
+func (s *webhookService) removeExpired(ctx context.Context) {
+	removed, err := s.repo.DeleteDeliveries(ctx, time.Now().Add(-s.config.LogTTL))
+	if err != nil {
+		log.Printf("Failed to remove the old webhook deliveries: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Removed %d old webhook deliveries", removed)
+	}
+}
+
+// notify wakes a worker, unless they are all awake already
+func (s *webhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// checkManager tells if a user manages the webhooks of a room: its moderators and the admins, only the admins
+// manage the webhooks of all the rooms
+func (s *webhookService) checkManager(ctx context.Context, userID string, role string, roomID string) error {
+	if role == "admin" {
+		if roomID == "" {
+			return nil
+		}
+		if _, err := s.roomService.GetRoom(ctx, roomID); err != nil {
+			return ErrNotAllowed
+		}
+		return nil
+	}
+	if roomID == "" {
+		return ErrNotAllowed
+	}
+	roomRetrieved, err := s.roomService.GetRoom(ctx, roomID)
+	if err != nil || !roomRetrieved.IsModerator(userID) {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+// getWebhook returns a webhook the user manages
+func (s *webhookService) getWebhook(ctx context.Context, userID string, role string, webhookID string) (*WebhookModel, error) {
+	webhook, err := s.repo.GetWebhook(ctx, webhookID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	if role != "admin" && (webhook.RoomID == "" || s.checkManager(ctx, userID, role, webhook.RoomID) != nil) {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// checkEvents validates the events of a webhook, the events of a room only for a webhook of a room.
+// It returns them without duplicates, no events subscribes to all of them.
+func checkEvents(roomID string, events []string) ([]string, error) {
+	allowed := Events
+	if roomID != "" {
+		allowed = RoomEvents
+	}
+	checked := make([]string, 0, len(events))
+	seen := map[string]bool{}
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if seen[event] {
+			continue
+		}
+		seen[event] = true
+		if !contains(allowed, event) {
+			return nil, ErrInvalidEvent
+		}
+		checked = append(checked, event)
+	}
+	return checked, nil
+}
+
+// subscribed tells if a webhook receives an event
+func subscribed(webhook *WebhookModel, event string) bool {
+	if webhook.RoomID != "" && !contains(RoomEvents, event) {
+		return false
+	}
+	return len(webhook.Events) == 0 || contains(webhook.Events, event)
+}
+
+// contains tells if a list has a value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -2,14 +2,18 @@ package websocket
 
 import (
 	"chat-app/pkg/message"
-	"chat-app/pkg/room"
+	"chat-app/pkg/ratelimit"
+	roomPkg "chat-app/pkg/room"
 	"chat-app/pkg/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // WebSocketHandler handles WebSocket connections for a specific room
-func WebSocketHandler(c *gin.Context, messageService message.MessageService, roomService room.RoomService) {
+func WebSocketHandler(c *gin.Context, messageService message.MessageService, roomService roomPkg.RoomService, commands message.Commands, limits ratelimit.Limits) {
 	roomID := c.Query("id")
 	// update the room from the database
 	UpdateRoomsFromDatabase(c, roomService)
@@ -24,15 +28,38 @@ func WebSocketHandler(c *gin.Context, messageService message.MessageService, roo
 	}
 	roomsMu.Unlock()
 
+	// an API key must be allowed to read the room
+	claims, err := utils.GetClaimsFromContext(c)
+	if err == nil && !claims.Allows(utils.ScopeMessagesRead, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The API key does not have the " + utils.ScopeMessagesRead + " scope for this room"})
+		return
+	}
+
 	// upgrade the HTTP connection to a WebSocket connection
 	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 			return
 	}
 	defer ws.Close()
+	// the connection is closed when its login session is revoked
+	if claims != nil {
+		setSession(ws, claims.SessionID)
+	}
+	defer func() {
+		roomsMu.Lock()
+		delete(sessions, ws)
+		roomsMu.Unlock()
+	}()
 
 	// add the WebSocket connection to the room
+	roomsMu.Lock()
 	room.Members[ws] = true
+	roomsMu.Unlock()
+
+	// send the topic and the announcement banner of the room to the new client
+	if roomDB, err := roomService.GetRoom(c.Request.Context(), roomID); err == nil {
+		sendFrame(ws, EventSocket{Type: roomPkg.EventRoomTopic, RoomID: roomID, Data: roomDB.TopicEvent()})
+	}
 
 	// read messages from the WebSocket connection
 	for {
@@ -51,31 +78,87 @@ func WebSocketHandler(c *gin.Context, messageService message.MessageService, roo
 			roomsMu.Unlock()
 			return
 		}
-		if msg.Token != "" {
-			_, err := utils.VerifyToken(&msg.Token)
-			if err != nil {
-				roomsMu.Lock()
-				roomsMu.Unlock()
-				return
-			}
+		claims, err := utils.VerifyToken(&msg.Token)
+		// an expired token is reported, the client sends the message again with a refreshed token
+		if errors.Is(err, utils.ErrTokenExpired) {
+			sendError(ws, err.Error(), 0)
+			continue
+		}
+		if err != nil {
+			roomsMu.Lock()
+			roomsMu.Unlock()
+			return
 		}
+
+		setSession(ws, claims.SessionID)
+
+		// an API key must be allowed to write in the room
+		if !claims.Allows(utils.ScopeMessagesWrite, roomID) {
+			sendError(ws, "The API key does not have the "+utils.ScopeMessagesWrite+" scope for this room", 0)
+			continue
+		}
+
+		// clients only send chat messages, the other types are the events of the server
+		if msg.Type != "" && msg.Type != MessageTypeChat {
+			sendError(ws, "Unknown message type", 0)
+			continue
+		}
+		msg.Type = MessageTypeChat
+		// check the rate limit of the message type for the user
+		if allowed, wait := limits.Allow(msg.Type, "user:"+claims.UserID); !allowed {
+			sendError(ws, "Too many messages", wait)
+			continue
+		}
+
+		// the sender is always the owner of the token
+		msg.UserID = claims.UserID
+		msg.Username = claims.Username
+		msg.Bot = claims.Bot
+
 		// save the message to the database
 		messageDB := message.MessageEntity{
-			RoomID:   roomID,
-			UserID:   msg.UserID,
-			Username: msg.Username,
-			Content:  msg.Message,
+			RoomID:      roomID,
+			UserID:      msg.UserID,
+			Username:    msg.Username,
+			Content:     msg.Message,
+			Attachments: msg.Attachments,
+			Bot:         msg.Bot,
+		}
+		// a slash command is run instead of being sent, its response is only for the sender
+		if commands != nil && commands.IsCommand(messageDB.Content) {
+			result, err := commands.Run(c.Request.Context(), &messageDB, claims.Role)
+			if err != nil {
+				sendError(ws, err.Error(), 0)
+				continue
+			}
+			if result.Message == nil {
+				sendFrame(ws, EventSocket{Type: EventCommandResponse, RoomID: roomID, Data: result})
+				continue
+			}
+			messageDB = *result.Message
 		}
-		// create the message
-		_, err = messageService.CreateMessage(c.Request.Context(), &messageDB)
+		// create the message, a rejected message is reported to its sender only
+		created, err := messageService.CreateMessage(c.Request.Context(), &messageDB)
 		if err != nil {
-			roomsMu.Lock()
-			delete(room.Members, ws)
-			roomsMu.Unlock()
-			break
+			var retryableErr message.RetryableError
+			if errors.As(err, &retryableErr) {
+				sendError(ws, retryableErr.Error(), time.Duration(retryableErr.RetryAfter())*time.Second)
+				continue
+			}
+			sendError(ws, strings.TrimSpace(err.Error()), 0)
+			continue
 		}
 
-		// broadcast the message to all members in the room
+		// broadcast the message to all members in the room, without the token of its sender
+		msg.Token = ""
+		msg.RoomID = roomID
+		msg.CreatedAt = time.Now()
+		msg.ID = created.ID
+		msg.Message = created.Content
+		msg.HTML = created.HTML
+		msg.Text = created.Text
+		msg.Attachments = created.Attachments
+		msg.Action = created.Action
 		room.broadcast <- msg
 	}
 }
@@ -1,6 +1,8 @@
 package websocket
 
 import (
+	"chat-app/pkg/message"
+	"chat-app/pkg/ratelimit"
 	"chat-app/pkg/room"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -13,19 +15,52 @@ import (
 type RoomSocket struct {
 	ID        string
 	Members   map[*websocket.Conn]bool
-	broadcast chan MessageSocket
+	broadcast chan interface{}
 }
 
 // MessageSocket struct from the websocket package
 type MessageSocket struct {
+	ID        string    `json:"_id,omitempty"`
+	Type      string    `json:"type,omitempty"`
 	RoomID    string    `json:"roomId,omitempty"`
 	Username  string    `json:"username,omitempty"`
 	UserID    string    `json:"userId,omitempty"`
 	Message   string    `json:"message,omitempty"`
 	CreatedAt time.Time `json:"createdAt,omitempty"`
 	Token     string    `json:"token,omitempty"`
+	// HTML and Text are the renderings of the Markdown of the message, set by the server
+	HTML string `json:"html,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Attachments are sent with their IDs only, and broadcast with their metadata
+	Attachments []message.AttachmentEntity `json:"attachments,omitempty"`
+	// Bot marks the messages of a bot, set by the server
+	Bot bool `json:"bot,omitempty"`
+	// Action marks the actions sent with /me, set by the server
+	Action bool `json:"action,omitempty"`
 }
 
+// ErrorSocket is the frame sent to a single client when one of its messages is rejected
+type ErrorSocket struct {
+	Type       string `json:"type"`
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+}
+
+// EventSocket is a frame sent by the server to all the clients of a room
+type EventSocket struct {
+	Type   string      `json:"type"`
+	RoomID string      `json:"roomId,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// message types received from the clients
+const (
+	MessageTypeChat = "message"
+)
+
+// EventCommandResponse is the frame of the response of a slash command, sent to its sender only
+const EventCommandResponse = "command.response"
+
 // upgrader variable from the websocket package
 var (
 	upgrader = websocket.Upgrader{
@@ -38,8 +73,13 @@ var (
 
 	rooms   = make(map[string]*RoomSocket)
 	roomsMu sync.Mutex
+	// sessions are the login sessions of the connections, from their last token, guarded by roomsMu
+	sessions = make(map[*websocket.Conn]string)
 )
 
+// CloseCodeSessionRevoked is the close code of the connections of a revoked session
+const CloseCodeSessionRevoked = 4001
+
 // GetRoomsFromDatabase retrieves rooms from the database
 func GetRoomsFromDatabase(c *gin.Context, roomService room.RoomService) []*RoomSocket {
 	// Get all rooms from the database
@@ -55,7 +95,7 @@ func GetRoomsFromDatabase(c *gin.Context, roomService room.RoomService) []*RoomS
 		rooms = append(rooms, &RoomSocket{
 			ID:        r.ID,
 			Members:   make(map[*websocket.Conn]bool),
-			broadcast: make(chan MessageSocket),
+			broadcast: make(chan interface{}),
 		})
 	}
 	// Return the slice of rooms
@@ -81,7 +121,7 @@ func UpdateRoomsFromDatabase(c *gin.Context, roomService room.RoomService) {
 			rooms[roomID] = &RoomSocket{
 				ID:        roomID,
 				Members:   make(map[*websocket.Conn]bool),
-				broadcast: make(chan MessageSocket),
+				broadcast: make(chan interface{}),
 			}
 			// Start broadcasting messages to all members in the room
 			go handleRoomBroadcast(rooms[roomID])
@@ -135,31 +175,67 @@ func HandleRooms(c *gin.Context, roomService room.RoomService) {
 		roomSocket := &RoomSocket{
 			ID:        roomDB.ID,
 			Members:   make(map[*websocket.Conn]bool),
-			broadcast: make(chan MessageSocket),
+			broadcast: make(chan interface{}),
 		}
 		// Start broadcasting messages to all members in the room
 		roomsMu.Lock()
 		rooms[roomSocket.ID] = roomSocket
 		roomsMu.Unlock()
 		// Start broadcasting messages to all members in the room
-		go func(r *RoomSocket) {
-			for {
-				// Get the message from the broadcast channel
-				msg := <-r.broadcast
-
-				// Broadcast the message to all members in the room
-				for client := range r.Members {
-					err := client.WriteJSON(msg)
-					if err != nil {
-						// Close the client connection
-						client.Close()
-						roomsMu.Lock()
-						// Delete the client from the room
-						delete(r.Members, client)
-						roomsMu.Unlock()
-					}
-				}
-			}
-		}(roomSocket)
+		go handleRoomBroadcast(roomSocket)
+	}
+}
+
+// sendFrame writes a frame to a single client, waiting for any broadcast in progress
+func sendFrame(ws *websocket.Conn, frame interface{}) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	ws.WriteJSON(frame)
+}
+
+// sendError writes an error frame to a single client
+func sendError(ws *websocket.Conn, errorMessage string, retryAfter time.Duration) {
+	frame := ErrorSocket{Type: "error", Error: errorMessage}
+	if retryAfter > 0 {
+		frame.RetryAfter = ratelimit.RetryAfterSeconds(retryAfter)
+	}
+	sendFrame(ws, frame)
+}
+
+// BroadcastEvent sends an event to all the clients connected to a room
+func BroadcastEvent(roomID string, eventType string, data interface{}) {
+	roomsMu.Lock()
+	room, ok := rooms[roomID]
+	roomsMu.Unlock()
+	// nobody is connected to a room that is not loaded yet
+	if !ok {
+		return
+	}
+	room.broadcast <- EventSocket{Type: eventType, RoomID: roomID, Data: data}
+}
+
+// setSession records the login session of a connection
+func setSession(ws *websocket.Conn, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	roomsMu.Lock()
+	sessions[ws] = sessionID
+	roomsMu.Unlock()
+}
+
+// CloseSession closes the connections of a login session, when it is revoked
+func CloseSession(sessionID string) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	for ws, id := range sessions {
+		if id != sessionID {
+			continue
+		}
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseCodeSessionRevoked, "Session revoked"),
+			time.Now().Add(time.Second))
+		// the read loop of the connection ends and removes it from its room
+		ws.Close()
+		delete(sessions, ws)
 	}
 }